@@ -23,6 +23,7 @@ import (
 
 	"github.com/omec-project/amf/logger"
 	"github.com/omec-project/amf/producer"
+	"github.com/omec-project/amf/util"
 	"github.com/omec-project/http_wrapper"
 	"github.com/omec-project/openapi"
 	"github.com/omec-project/openapi/models"
@@ -30,7 +31,7 @@ import (
 
 // CreateUEContext - Namf_Communication CreateUEContext service Operation
 func HTTPCreateUEContext(c *gin.Context) {
-	var createUeContextRequest models.CreateUeContextRequest
+	var createUeContextRequest producer.CreateUeContextRequest
 	createUeContextRequest.JsonData = new(models.UeContextCreateData)
 
 	requestBody, err := c.GetRawData()
@@ -52,7 +53,9 @@ func HTTPCreateUEContext(c *gin.Context) {
 	case "application/json":
 		err = openapi.Deserialize(createUeContextRequest.JsonData, requestBody, contentType)
 	case "multipart/related":
-		err = openapi.Deserialize(&createUeContextRequest, requestBody, contentType)
+		// the NGAP IEs are the binary parts referenced by their Content-ID
+		createUeContextRequest.NgapParts, err = util.MultipartRelatedDeserialize(requestBody, contentType,
+			createUeContextRequest.JsonData)
 	default:
 		err = fmt.Errorf("Wrong content type")
 	}
@@ -74,7 +77,9 @@ func HTTPCreateUEContext(c *gin.Context) {
 	rsp := producer.HandleCreateUEContextRequest(req)
 
 	if rsp.Status == http.StatusCreated {
-		responseBody, contentType, err := openapi.MultipartSerialize(rsp.Body)
+		createUeContextResponse := rsp.Body.(*producer.CreateUeContextResponse)
+		responseBody, contentType, err := util.MultipartRelatedSerialize(createUeContextResponse.JsonData,
+			createUeContextResponse.NgapParts)
 		if err != nil {
 			logger.CommLog.Errorln(err)
 			problemDetails := models.ProblemDetails{
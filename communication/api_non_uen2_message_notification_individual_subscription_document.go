@@ -20,10 +20,29 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/producer"
+	"github.com/omec-project/http_wrapper"
+	"github.com/omec-project/openapi"
+	"github.com/omec-project/openapi/models"
 )
 
 // NonUeN2InfoUnSubscribe - Namf_Communication Non UE N2 Info UnSubscribe service Operation
 func HTTPNonUeN2InfoUnSubscribe(c *gin.Context) {
-	logger.CommLog.Warnf("Handle Non Ue N2 Info UnSubscribe is not implemented.")
-	c.JSON(http.StatusOK, gin.H{})
+	req := http_wrapper.NewRequest(c.Request, nil)
+	req.Params["n2NotifySubscriptionId"] = c.Params.ByName("n2NotifySubscriptionId")
+
+	rsp := producer.HandleNonUeN2InfoUnSubscribe(req)
+
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.CommLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
 }
@@ -15,15 +15,128 @@
 package communication
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/producer"
+	"github.com/omec-project/http_wrapper"
+	"github.com/omec-project/openapi"
+	"github.com/omec-project/openapi/models"
 )
 
 // NonUeN2MessageTransfer - Namf_Communication Non UE N2 Message Transfer service Operation
 func HTTPNonUeN2MessageTransfer(c *gin.Context) {
-	logger.CommLog.Warnf("Handle Non Ue N2 Message Transfer is not implemented.")
-	c.JSON(http.StatusOK, gin.H{})
+	var transferRequest producer.NonUeN2MessageTransferRequest
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.CommLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err == nil {
+		switch mediaType {
+		case "application/json":
+			err = fmt.Errorf("N2 Information is Empty in NonUeN2MessageTransfer")
+		case "multipart/related":
+			err = deserializeNonUeN2MessageTransfer(&transferRequest, requestBody, params["boundary"])
+		default:
+			err = fmt.Errorf("Wrong content type")
+		}
+	}
+
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.CommLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, transferRequest)
+	rsp := producer.HandleNonUeN2MessageTransfer(req)
+
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.CommLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
+
+// deserializeNonUeN2MessageTransfer reads the JSON part and the NGAP part of the multipart body,
+// the NGAP part is identified by the Content-ID referenced in the N2 information container
+func deserializeNonUeN2MessageTransfer(transferRequest *producer.NonUeN2MessageTransferRequest,
+	body []byte, boundary string) error {
+	binaryParts := make(map[string][]byte)
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "application/json":
+			transferRequest.JsonData = new(models.N2InformationTransferReqData)
+			if err := json.Unmarshal(content, transferRequest.JsonData); err != nil {
+				return err
+			}
+		case "application/vnd.3gpp.ngap":
+			contentId := strings.Trim(part.Header.Get("Content-Id"), "<>")
+			binaryParts[contentId] = content
+		}
+	}
+	if transferRequest.JsonData == nil || transferRequest.JsonData.N2Information == nil {
+		return fmt.Errorf("N2 Information is Empty in NonUeN2MessageTransfer")
+	}
+
+	var n2InfoContent *models.N2InfoContent
+	n2Info := transferRequest.JsonData.N2Information
+	switch {
+	case n2Info.NrppaInfo != nil:
+		n2InfoContent = n2Info.NrppaInfo.NrppaPdu
+	case n2Info.PwsInfo != nil:
+		n2InfoContent = n2Info.PwsInfo.PwsContainer
+	case n2Info.RanInfo != nil:
+		n2InfoContent = n2Info.RanInfo.N2InfoContent
+	}
+	if n2InfoContent == nil || n2InfoContent.NgapData == nil {
+		return fmt.Errorf("N2 Information Content is Empty in NonUeN2MessageTransfer")
+	}
+	transferRequest.BinaryDataN2Information = binaryParts[n2InfoContent.NgapData.ContentId]
+	return nil
 }
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package communication
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+
+	"github.com/omec-project/amf/producer"
+	"github.com/omec-project/openapi/models"
+)
+
+func TestDeserializeNonUeN2MessageTransfer(t *testing.T) {
+	jsonData, err := json.Marshal(models.N2InformationTransferReqData{
+		N2Information: &models.N2InfoContainer{
+			N2InformationClass: models.N2InformationClass_PWS,
+			PwsInfo: &models.PwsInformation{
+				MessageIdentifier: 4352,
+				SerialNumber:      1,
+				PwsContainer: &models.N2InfoContent{
+					NgapData: &models.RefToBinaryData{ContentId: "pws"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ngapData := []byte{0x00, 0x33, 0x00, 0x04}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	parts := []struct {
+		header  textproto.MIMEHeader
+		content []byte
+	}{
+		{textproto.MIMEHeader{"Content-Type": {"application/json"}}, jsonData},
+		// a binary part which is not referenced by the N2 information container
+		{textproto.MIMEHeader{"Content-Type": {"application/vnd.3gpp.ngap"}, "Content-Id": {"<other>"}}, []byte{0xff}},
+		{textproto.MIMEHeader{"Content-Type": {"application/vnd.3gpp.ngap"}, "Content-Id": {"<pws>"}}, ngapData},
+	}
+	for _, p := range parts {
+		partWriter, err := writer.CreatePart(p.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := partWriter.Write(p.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var transferRequest producer.NonUeN2MessageTransferRequest
+	if err := deserializeNonUeN2MessageTransfer(&transferRequest, body.Bytes(), writer.Boundary()); err != nil {
+		t.Fatalf("Failed to deserialize: %v", err)
+	}
+	if transferRequest.JsonData == nil || transferRequest.JsonData.N2Information.PwsInfo.MessageIdentifier != 4352 {
+		t.Errorf("Unexpected JSON data: %+v", transferRequest.JsonData)
+	}
+	if !bytes.Equal(transferRequest.BinaryDataN2Information, ngapData) {
+		t.Errorf("N2 Information, want: %x, got: %x", ngapData, transferRequest.BinaryDataN2Information)
+	}
+}
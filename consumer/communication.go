@@ -8,12 +8,18 @@ package consumer
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"time"
 
 	amf_context "github.com/omec-project/amf/context"
 	"github.com/omec-project/amf/logger"
-	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/amf/util"
+	"github.com/omec-project/nas/security"
 	"github.com/omec-project/openapi"
 	"github.com/omec-project/openapi/Namf_Communication"
 	"github.com/omec-project/openapi/models"
@@ -101,9 +107,76 @@ func BuildUeContextModel(ue *amf_context.AmfUe) (ueContext models.UeContext) {
 	if ue.TraceData != nil {
 		ueContext.TraceData = ue.TraceData
 	}
+
+	if ue.SecurityContextAvailable {
+		ngKsi := ue.NgKsi
+		ueContext.SeafData = &models.SeafData{
+			NgKsi: &ngKsi,
+			KeyAmf: &models.KeyAmf{
+				KeyType: models.KeyAmfType_KAMF,
+				KeyVal:  ue.Kamf,
+			},
+			Nh:  hex.EncodeToString(ue.NH),
+			Ncc: int32(ue.NCC),
+		}
+		ueContext.MmContextList = append(ueContext.MmContextList, buildMmContext(ue, models.AccessType__3_GPP_ACCESS))
+	}
+
+	ue.SmContextList.Range(func(key, value interface{}) bool {
+		smContext := value.(*amf_context.SmContext)
+		snssai := smContext.Snssai()
+		ueContext.SessionContextList = append(ueContext.SessionContextList, models.PduSessionContext{
+			PduSessionId: smContext.PduSessionID(),
+			SmContextRef: smContext.SmContextUri(),
+			SNssai:       &snssai,
+			Dnn:          smContext.Dnn(),
+			AccessType:   smContext.AccessType(),
+			HsmfId:       smContext.HSmfID(),
+			VsmfId:       smContext.VSmfID(),
+			NsInstance:   smContext.NsInstance(),
+		})
+		return true
+	})
 	return ueContext
 }
 
+// TS 29.518 6.1.6.2.6
+func buildMmContext(ue *amf_context.AmfUe, anType models.AccessType) (mmContext models.MmContext) {
+	mmContext.AccessType = anType
+	mmContext.NasSecurityMode = &models.NasSecurityMode{}
+	switch ue.IntegrityAlg {
+	case security.AlgIntegrity128NIA0:
+		mmContext.NasSecurityMode.IntegrityAlgorithm = models.IntegrityAlgorithm_NIA0
+	case security.AlgIntegrity128NIA1:
+		mmContext.NasSecurityMode.IntegrityAlgorithm = models.IntegrityAlgorithm_NIA1
+	case security.AlgIntegrity128NIA2:
+		mmContext.NasSecurityMode.IntegrityAlgorithm = models.IntegrityAlgorithm_NIA2
+	case security.AlgIntegrity128NIA3:
+		mmContext.NasSecurityMode.IntegrityAlgorithm = models.IntegrityAlgorithm_NIA3
+	}
+	switch ue.CipheringAlg {
+	case security.AlgCiphering128NEA0:
+		mmContext.NasSecurityMode.CipheringAlgorithm = models.CipheringAlgorithm_NEA0
+	case security.AlgCiphering128NEA1:
+		mmContext.NasSecurityMode.CipheringAlgorithm = models.CipheringAlgorithm_NEA1
+	case security.AlgCiphering128NEA2:
+		mmContext.NasSecurityMode.CipheringAlgorithm = models.CipheringAlgorithm_NEA2
+	case security.AlgCiphering128NEA3:
+		mmContext.NasSecurityMode.CipheringAlgorithm = models.CipheringAlgorithm_NEA3
+	}
+	mmContext.NasDownlinkCount = int32(ue.DLCount.Get())
+	mmContext.NasUplinkCount = int32(ue.ULCount.Get())
+	if ue.UESecurityCapability.Buffer != nil {
+		mmContext.UeSecurityCapability = base64.StdEncoding.EncodeToString(ue.UESecurityCapability.Buffer)
+	}
+	for _, allowedSnssai := range ue.AllowedNssai[anType] {
+		if allowedSnssai.AllowedSnssai != nil {
+			mmContext.AllowedNssai = append(mmContext.AllowedNssai, *allowedSnssai.AllowedSnssai)
+		}
+	}
+	return mmContext
+}
+
 func buildAmPolicyReqTriggers(triggers []models.RequestTrigger) (amPolicyReqTriggers []models.AmPolicyReqTrigger) {
 	for _, trigger := range triggers {
 		switch trigger {
@@ -120,31 +193,59 @@ func buildAmPolicyReqTriggers(triggers []models.RequestTrigger) (amPolicyReqTrig
 	return
 }
 
-func CreateUEContextRequest(ue *amf_context.AmfUe, ueContextCreateData models.UeContextCreateData) (
-	ueContextCreatedData *models.UeContextCreatedData, problemDetails *models.ProblemDetails, err error) {
-	configuration := Namf_Communication.NewConfiguration()
-	configuration.SetBasePath(ue.TargetAmfUri)
-	client := Namf_Communication.NewAPIClient(configuration)
+// TS 29.518 5.2.2.2.3, ueContextCreateError is returned if the handover preparation failed in the target AMF.
+// The NGAP IEs are sent and received as the binary parts of the multipart/related bodies, keyed by Content-ID
+func CreateUEContextRequest(ue *amf_context.AmfUe, ueContextCreateData models.UeContextCreateData,
+	ngapParts map[string][]byte) (ueContextCreatedData *models.UeContextCreatedData, createdNgapParts map[string][]byte,
+	ueContextCreateError *models.UeContextCreateError, problemDetails *models.ProblemDetails, err error) {
+	body, contentType, err := util.MultipartRelatedSerialize(ueContextCreateData, ngapParts)
+	if err != nil {
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
 	defer cancel()
 
-	req := models.CreateUeContextRequest{
-		JsonData: &ueContextCreateData,
+	uri := fmt.Sprintf("%s/namf-comm/v1/ue-contexts/%s", ue.TargetAmfUri, ue.Supi)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uri, bytes.NewReader(body))
+	if err != nil {
+		return
 	}
-	res, httpResp, localErr := client.IndividualUeContextDocumentApi.CreateUEContext(ctx, ue.Guti, req)
-	if localErr == nil {
-		ueContextCreatedData = res.JsonData
-		logger.ConsumerLog.Debugf("UeContextCreatedData: %+v", *ueContextCreatedData)
-	} else if httpResp != nil {
-		if httpResp.Status != localErr.Error() {
-			err = localErr
+	req.Header.Set("Content-Type", contentType)
+	client := &http.Client{Timeout: 30 * time.Second}
+	httpResp, localErr := client.Do(req)
+	if localErr != nil {
+		err = openapi.ReportError("%s: server no response", ue.TargetAmfUri)
+		return
+	}
+	defer httpResp.Body.Close()
+	rspBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return
+	}
+
+	switch httpResp.StatusCode {
+	case http.StatusCreated:
+		createdData := new(models.UeContextCreatedData)
+		createdNgapParts, err = util.MultipartRelatedDeserialize(rspBody, httpResp.Header.Get("Content-Type"),
+			createdData)
+		if err == nil {
+			ueContextCreatedData = createdData
+			logger.ConsumerLog.Debugf("UeContextCreatedData: %+v", *ueContextCreatedData)
+		}
+	case http.StatusForbidden:
+		// the target AMF answers a failed handover preparation with an UeContextCreateError
+		createError := new(models.UeContextCreateError)
+		if err = json.Unmarshal(rspBody, createError); err == nil && createError.Error != nil {
+			ueContextCreateError = createError
 			return
 		}
-		problem := localErr.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
-		problemDetails = &problem
-	} else {
-		err = openapi.ReportError("%s: server no response", ue.TargetAmfUri)
+		fallthrough
+	default:
+		problemDetails = new(models.ProblemDetails)
+		if err = json.Unmarshal(rspBody, problemDetails); err != nil {
+			problemDetails = nil
+		}
 	}
 	return
 }
@@ -165,7 +266,7 @@ func ReleaseUEContextRequest(ue *amf_context.AmfUe, ngapCause models.NgApCause)
 	ueContextRelease := models.UeContextRelease{
 		NgapCause: &ngapCause,
 	}
-	if ue.RegistrationType5GS == nasMessage.RegistrationType5GSEmergencyRegistration && ue.UnauthenticatedSupi {
+	if ue.EmergencyRegistered && ue.UnauthenticatedSupi {
 		ueContextRelease.Supi = ue.Supi
 		ueContextRelease.UnauthenticatedSupi = true
 	}
@@ -190,9 +291,10 @@ func ReleaseUEContextRequest(ue *amf_context.AmfUe, ngapCause models.NgApCause)
 	return problemDetails, err
 }
 
+// TS 29.518 5.2.2.2.1, the UE radio capability is returned in the binary part of ueContextTransferRsp
 func UEContextTransferRequest(
 	ue *amf_context.AmfUe, accessType models.AccessType, transferReason models.TransferReason) (
-	ueContextTransferRspData *models.UeContextTransferRspData, problemDetails *models.ProblemDetails, err error) {
+	ueContextTransferRsp *models.UeContextTransferResponse, problemDetails *models.ProblemDetails, err error) {
 	configuration := Namf_Communication.NewConfiguration()
 	configuration.SetBasePath(ue.TargetAmfUri)
 	client := Namf_Communication.NewAPIClient(configuration)
@@ -206,15 +308,20 @@ func UEContextTransferRequest(
 		JsonData: &ueContextTransferReqData,
 	}
 	if transferReason == models.TransferReason_INIT_REG || transferReason == models.TransferReason_MOBI_REG {
-		var buf bytes.Buffer
-		ue.RegistrationRequest.EncodeRegistrationRequest(&buf)
 		ueContextTransferReqData.RegRequest = &models.N1MessageContainer{
 			N1MessageClass: models.N1MessageClass__5_GMM,
 			N1MessageContent: &models.RefToBinaryData{
 				ContentId: "n1Msg",
 			},
 		}
-		req.BinaryDataN1Message = buf.Bytes()
+		// the old AMF verifies the integrity of the complete Registration Request as sent by the UE
+		if ue.RegistrationRequestPdu != nil {
+			req.BinaryDataN1Message = ue.RegistrationRequestPdu
+		} else {
+			var buf bytes.Buffer
+			ue.RegistrationRequest.EncodeRegistrationRequest(&buf)
+			req.BinaryDataN1Message = buf.Bytes()
+		}
 	}
 
 	// guti format is defined at TS 29.518 Table 6.1.3.2.2-1 5g-guti-[0-9]{5,6}[0-9a-fA-F]{14}
@@ -224,8 +331,8 @@ func UEContextTransferRequest(
 	defer cancel()
 	res, httpResp, localErr := client.IndividualUeContextDocumentApi.UEContextTransfer(ctx, ueContextId, req)
 	if localErr == nil {
-		ueContextTransferRspData = res.JsonData
-		logger.ConsumerLog.Debugf("UeContextTransferRspData: %+v", *ueContextTransferRspData)
+		ueContextTransferRsp = &res
+		logger.ConsumerLog.Debugf("UeContextTransferRspData: %+v", res.JsonData)
 	} else if httpResp != nil {
 		if httpResp.Status != localErr.Error() {
 			err = localErr
@@ -236,7 +343,7 @@ func UEContextTransferRequest(
 	} else {
 		err = openapi.ReportError("%s: server no response", ue.TargetAmfUri)
 	}
-	return ueContextTransferRspData, problemDetails, err
+	return ueContextTransferRsp, problemDetails, err
 }
 
 // This operation is called "RegistrationCompleteNotify" at TS 23.502
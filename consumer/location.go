@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	amf_context "github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/openapi/models"
+)
+
+// the positioning procedure of the LMF with the UE and the RAN runs while the request is pending
+const determineLocationTimeout = 60 * time.Second
+
+// lmfInputData is the InputData of Nlmf_Location DetermineLocation (TS 29.572 6.1.6.2.2)
+type lmfInputData struct {
+	ExternalClientType models.ExternalClientType   `json:"externalClientType,omitempty"`
+	CorrelationId      string                      `json:"correlationID,omitempty"`
+	AmfId              string                      `json:"amfId,omitempty"`
+	LocationQoS        *models.LocationQoS         `json:"locationQoS,omitempty"`
+	SupportedGADShapes []models.SupportedGadShapes `json:"supportedGADShapes,omitempty"`
+	Supi               string                      `json:"supi,omitempty"`
+	Pei                string                      `json:"pei,omitempty"`
+	Gpsi               string                      `json:"gpsi,omitempty"`
+	Ncgi               *models.Ncgi                `json:"ncgi,omitempty"`
+	Priority           models.LcsPriority          `json:"priority,omitempty"`
+	VelocityRequested  models.VelocityRequested    `json:"velocityRequested,omitempty"`
+}
+
+// SendDetermineLocationRequest invokes Nlmf_Location_DetermineLocation (TS 29.572 5.2.2.2) at the LMF
+// of the positioning session, the LocationData of the LMF shares its attributes with ProvidePosInfo
+func SendDetermineLocationRequest(ue *amf_context.AmfUe, session amf_context.LcsSession,
+	requestPosInfo models.RequestPosInfo) (*models.ProvidePosInfo, *models.ProblemDetails, error) {
+	body, err := json.Marshal(buildLmfInputData(ue, session.CorrelationId, requestPosInfo))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := &http.Client{Timeout: determineLocationTimeout}
+	httpResp, err := client.Post(session.LmfUri+"/nlmf-loc/v1/determine-location", "application/json",
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if rspCloseErr := httpResp.Body.Close(); rspCloseErr != nil {
+			logger.ConsumerLog.Errorf("DetermineLocation response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+
+	if httpResp.StatusCode != http.StatusOK {
+		var problemDetails models.ProblemDetails
+		if err := json.NewDecoder(httpResp.Body).Decode(&problemDetails); err != nil {
+			return nil, nil, fmt.Errorf("DetermineLocation failed: %s", httpResp.Status)
+		}
+		if problemDetails.Status == 0 {
+			problemDetails.Status = int32(httpResp.StatusCode)
+		}
+		return nil, &problemDetails, nil
+	}
+
+	var providePosInfo models.ProvidePosInfo
+	if err := json.NewDecoder(httpResp.Body).Decode(&providePosInfo); err != nil {
+		return nil, nil, fmt.Errorf("LocationData of the LMF cannot be decoded: %+v", err)
+	}
+	return &providePosInfo, nil, nil
+}
+
+func buildLmfInputData(ue *amf_context.AmfUe, correlationId string,
+	requestPosInfo models.RequestPosInfo) lmfInputData {
+	inputData := lmfInputData{
+		ExternalClientType: requestPosInfo.LcsClientType,
+		CorrelationId:      correlationId,
+		AmfId:              amf_context.AMF_Self().NfId,
+		LocationQoS:        requestPosInfo.LcsQoS,
+		Supi:               ue.Supi,
+		Pei:                ue.Pei,
+		Gpsi:               requestPosInfo.Gpsi,
+		Priority:           requestPosInfo.Priority,
+		VelocityRequested:  requestPosInfo.VelocityRequested,
+	}
+	if requestPosInfo.LcsSupportedGADShapes != "" {
+		inputData.SupportedGADShapes = []models.SupportedGadShapes{requestPosInfo.LcsSupportedGADShapes}
+	}
+	if ue.Gpsi != "" {
+		inputData.Gpsi = ue.Gpsi
+	}
+	if nrLocation := ue.Location.NrLocation; nrLocation != nil {
+		inputData.Ncgi = nrLocation.Ncgi
+	}
+	return inputData
+}
@@ -107,3 +107,22 @@ func SearchAmfCommunicationInstance(ue *amf_context.AmfUe, nrfUri string, target
 	}
 	return
 }
+
+// SearchLmfLocationInstance returns the URI and the profile of the LMF selected for a positioning session
+func SearchLmfLocationInstance(nrfUri string, targetNfType, requestNfType models.NfType,
+	param *Nnrf_NFDiscovery.SearchNFInstancesParamOpts) (string, *models.NfProfile, error) {
+	resp, localErr := SendSearchNFInstances(nrfUri, targetNfType, requestNfType, param)
+	if localErr != nil {
+		return "", nil, localErr
+	}
+
+	// select the first LMF, TODO: select base on the requested location QoS
+	for i := range resp.NfInstances {
+		nfProfile := resp.NfInstances[i]
+		lmfUri := util.SearchNFServiceUri(nfProfile, models.ServiceName_NLMF_LOC, models.NfServiceStatus_REGISTERED)
+		if lmfUri != "" {
+			return lmfUri, &nfProfile, nil
+		}
+	}
+	return "", nil, fmt.Errorf("AMF can not select an LMF by NRF")
+}
@@ -166,11 +166,51 @@ func SelectSmf(
 	return smContext, 0, nil
 }
 
+// TS 23.501 5.16.4.9: the SMF of an emergency PDU session is the locally configured one or
+// an SMF supporting the emergency DNN, no NSSF is involved
+func SelectEmergencySmf(ue *amf_context.AmfUe, anType models.AccessType, pduSessionID int32) (
+	*amf_context.SmContext, uint8, error) {
+	emergencyCfg := amf_context.AMF_Self().EmergencyCfg
+
+	ue.GmmLog.Infof("Select emergency SMF [snssai: %+v, dnn: %+v]", emergencyCfg.Snssai, emergencyCfg.Dnn)
+
+	smContext := amf_context.NewSmContext(pduSessionID)
+	smContext.SetSnssai(emergencyCfg.Snssai)
+	smContext.SetDnn(emergencyCfg.Dnn)
+	smContext.SetAccessType(anType)
+
+	if emergencyCfg.SmfUri != "" {
+		smContext.SetSmfUri(emergencyCfg.SmfUri)
+		return smContext, 0, nil
+	}
+
+	param := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
+		ServiceNames: optional.NewInterface([]models.ServiceName{models.ServiceName_NSMF_PDUSESSION}),
+		Dnn:          optional.NewString(emergencyCfg.Dnn),
+		Snssais:      optional.NewInterface(util.MarshToJsonString([]models.Snssai{emergencyCfg.Snssai})),
+	}
+	result, err := SendSearchNFInstances(ue.ServingAMF().NrfUri, models.NfType_SMF, models.NfType_AMF, &param)
+	if err != nil {
+		return nil, nasMessage.Cause5GMMPayloadWasNotForwarded, err
+	}
+	if len(result.NfInstances) == 0 {
+		err = fmt.Errorf("No SMF supports the emergency DNN[%s]", emergencyCfg.Dnn)
+		return nil, nasMessage.Cause5GMMPayloadWasNotForwarded, err
+	}
+
+	smContext.SmfProfiles = result.NfInstances
+	nfProfile := result.NfInstances[getServingSmfIndex(len(result.NfInstances))]
+	smContext.SetSmfID(nfProfile.NfInstanceId)
+	smContext.SetSmfUri(util.SearchNFServiceUri(nfProfile, models.ServiceName_NSMF_PDUSESSION,
+		models.NfServiceStatus_REGISTERED))
+	return smContext, 0, nil
+}
+
 func SendCreateSmContextRequest(ue *amf_context.AmfUe, smContext *amf_context.SmContext,
 	requestType *models.RequestType, nasPdu []byte) (
 	response *models.PostSmContextsResponse, smContextRef string, errorResponse *models.PostSmContextsErrorResponse,
 	problemDetail *models.ProblemDetails, err1 error) {
-	smContextCreateData := buildCreateSmContextRequest(ue, smContext, nil)
+	smContextCreateData := buildCreateSmContextRequest(ue, smContext, requestType)
 
 	postSmContextsRequest := models.PostSmContextsRequest{
 		JsonData:              &smContextCreateData,
@@ -184,8 +224,10 @@ func SendCreateSmContextRequest(ue *amf_context.AmfUe, smContext *amf_context.Sm
 	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
 	defer cancel()
 
+	start := time.Now()
 	postSmContextReponse, httpResponse, err :=
 		client.SMContextsCollectionApi.PostSmContexts(ctx, postSmContextsRequest)
+	amf_context.AMF_Self().ObserveSbiLatency(time.Since(start))
 
 	if err == nil {
 		response = &postSmContextReponse
@@ -476,9 +518,11 @@ func SendUpdateSmContextRequest(smContext *amf_context.SmContext,
 	updateSmContextRequest.BinaryDataN1SmMessage = n1Msg
 	updateSmContextRequest.BinaryDataN2SmInformation = n2Info
 
+	start := time.Now()
 	updateSmContextReponse, httpResponse, err :=
 		client.IndividualSMContextApi.UpdateSmContext(ctx, smContext.SmContextRef(),
 			updateSmContextRequest)
+	amf_context.AMF_Self().ObserveSbiLatency(time.Since(start))
 
 	//retry on alternate SMF
 	if err != nil {
@@ -534,8 +578,10 @@ func SendReleaseSmContextRequest(ue *amf_context.AmfUe, smContext *amf_context.S
 	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
 	defer cancel()
 
+	start := time.Now()
 	response, err1 := client.IndividualSMContextApi.ReleaseSmContext(
 		ctx, smContext.SmContextRef(), releaseSmContextRequest)
+	amf_context.AMF_Self().ObserveSbiLatency(time.Since(start))
 
 	if err1 == nil {
 		ue.SmContextList.Delete(smContext.PduSessionID())
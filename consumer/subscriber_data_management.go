@@ -8,12 +8,19 @@ package consumer
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/antihax/optional"
 
 	amf_context "github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/util"
 	"github.com/omec-project/openapi"
+	"github.com/omec-project/openapi/Nnrf_NFDiscovery"
 	"github.com/omec-project/openapi/Nudm_SubscriberDataManagement"
 	"github.com/omec-project/openapi/models"
 )
@@ -36,6 +43,26 @@ func PutUpuAck(ue *amf_context.AmfUe, upuMacIue string) error {
 	return err
 }
 
+// PutSorAck provides the UDM with the SOR-MAC-IUE of the UE's Steering of Roaming acknowledgement
+// with Nudm_SDM_Info, the UDM verifies it against the expected XMAC-IUE (TS 33.501 6.14.2.1)
+func PutSorAck(ue *amf_context.AmfUe, sorMacIue string) error {
+	configuration := Nudm_SubscriberDataManagement.NewConfiguration()
+	configuration.SetBasePath(ue.NudmSDMUri)
+	client := Nudm_SubscriberDataManagement.NewAPIClient(configuration)
+
+	ackInfo := models.AcknowledgeInfo{
+		SorMacIue: sorMacIue,
+	}
+	sorOpt := Nudm_SubscriberDataManagement.SorAckInfoParamOpts{
+		AcknowledgeInfo: optional.NewInterface(ackInfo),
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+	defer cancel()
+	_, err := client.ProvidingAcknowledgementOfSteeringOfRoamingApi.SorAckInfo(ctx, ue.Supi, &sorOpt)
+	return err
+}
+
 func SDMGetAmData(ue *amf_context.AmfUe) (problemDetails *models.ProblemDetails, err error) {
 	configuration := Nudm_SubscriberDataManagement.NewConfiguration()
 	configuration.SetBasePath(ue.NudmSDMUri)
@@ -53,6 +80,13 @@ func SDMGetAmData(ue *amf_context.AmfUe) (problemDetails *models.ProblemDetails,
 	if localErr == nil {
 		ue.AccessAndMobilitySubscriptionData = &data
 		ue.Gpsi = data.Gpsis[0] // TODO: select GPSI
+		// SOR information and UPU data to be delivered to the UE
+		if data.SorInfo != nil {
+			ue.SorInfo = data.SorInfo
+		}
+		if data.UpuInfo != nil {
+			ue.UpuInfo = data.UpuInfo
+		}
 	} else if httpResp != nil {
 		if httpResp.Status != localErr.Error() {
 			err = localErr
@@ -126,8 +160,10 @@ func SDMSubscribe(ue *amf_context.AmfUe) (problemDetails *models.ProblemDetails,
 
 	amfSelf := amf_context.AMF_Self()
 	sdmSubscription := models.SdmSubscription{
-		NfInstanceId: amfSelf.NfId,
-		PlmnId:       &ue.PlmnId,
+		NfInstanceId:          amfSelf.NfId,
+		PlmnId:                &ue.PlmnId,
+		CallbackReference:     fmt.Sprintf("%s/namf-callback/v1/sdm-change-notify/%s", amfSelf.GetIPv4Uri(), ue.Supi),
+		MonitoredResourceUris: []string{fmt.Sprintf("/%s/am-data", ue.Supi)},
 	}
 	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
 	defer cancel()
@@ -193,3 +229,64 @@ func SDMGetSliceSelectionSubscriptionData(ue *amf_context.AmfUe) (problemDetails
 	}
 	return problemDetails, err
 }
+
+// groupIdentifiers is the GroupIdentifiers of Nudm_SDM (TS 29.503 6.1.6.2.46), the members of the group
+// are listed with their SUPIs
+type groupIdentifiers struct {
+	ExtGroupId string `json:"extGroupId,omitempty"`
+	IntGroupId string `json:"intGroupId,omitempty"`
+	UeIdList   []struct {
+		Supi string `json:"supi"`
+	} `json:"ueIdList,omitempty"`
+}
+
+// SDMGetGroupMembers resolves the SUPIs of the members of the internal group with the UDM selected by the NRF
+// (Nudm_SDM_Get, TS 29.503 5.2.2.2.17)
+func SDMGetGroupMembers(groupID string) ([]string, error) {
+	amfSelf := amf_context.AMF_Self()
+	resp, err := SendSearchNFInstances(amfSelf.NrfUri, models.NfType_UDM, models.NfType_AMF,
+		&Nnrf_NFDiscovery.SearchNFInstancesParamOpts{})
+	if err != nil {
+		return nil, err
+	}
+	var sdmUri string
+	for _, nfProfile := range resp.NfInstances {
+		sdmUri = util.SearchNFServiceUri(nfProfile, models.ServiceName_NUDM_SDM, models.NfServiceStatus_REGISTERED)
+		if sdmUri != "" {
+			break
+		}
+	}
+	if sdmUri == "" {
+		return nil, fmt.Errorf("AMF can not select an UDM by NRF")
+	}
+
+	query := url.Values{
+		"int-group-id": {groupID},
+		"ue-id-ind":    {"true"},
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	httpResp, err := client.Get(sdmUri + "/nudm-sdm/v2/group-data/group-identifiers?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rspCloseErr := httpResp.Body.Close(); rspCloseErr != nil {
+			logger.ConsumerLog.Errorf("GetGroupIdentifiers response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GetGroupIdentifiers failed: %s", httpResp.Status)
+	}
+
+	var identifiers groupIdentifiers
+	if err := json.NewDecoder(httpResp.Body).Decode(&identifiers); err != nil {
+		return nil, fmt.Errorf("GroupIdentifiers of the UDM cannot be decoded: %+v", err)
+	}
+	var supis []string
+	for _, ueId := range identifiers.UeIdList {
+		if ueId.Supi != "" {
+			supis = append(supis, ueId.Supi)
+		}
+	}
+	return supis, nil
+}
@@ -55,7 +55,9 @@ func SendUEAuthenticationAuthenticateRequest(ue *amf_context.AmfUe,
 	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
 	defer cancel()
 
+	start := time.Now()
 	ueAuthenticationCtx, httpResponse, err := client.DefaultApi.UeAuthenticationsPost(ctx, authInfo)
+	amfSelf.ObserveSbiLatency(time.Since(start))
 	if err == nil {
 		return &ueAuthenticationCtx, nil, nil
 	} else if httpResponse != nil {
@@ -71,11 +73,9 @@ func SendUEAuthenticationAuthenticateRequest(ue *amf_context.AmfUe,
 
 func SendAuth5gAkaConfirmRequest(ue *amf_context.AmfUe, resStar string) (
 	*models.ConfirmationDataResponse, *models.ProblemDetails, error) {
-	var ausfUri string
-	if confirmUri, err := url.Parse(ue.AuthenticationCtx.Links["link"].Href); err != nil {
+	ausfUri, err := authConfirmApiRoot(ue, "5g-aka")
+	if err != nil {
 		return nil, nil, err
-	} else {
-		ausfUri = fmt.Sprintf("%s://%s", confirmUri.Scheme, confirmUri.Host)
 	}
 
 	configuration := Nausf_UEAuthentication.NewConfiguration()
@@ -111,11 +111,12 @@ func SendAuth5gAkaConfirmRequest(ue *amf_context.AmfUe, resStar string) (
 
 func SendEapAuthConfirmRequest(ue *amf_context.AmfUe, eapMsg nasType.EAPMessage) (
 	response *models.EapSession, problemDetails *models.ProblemDetails, err1 error) {
-	confirmUri, err := url.Parse(ue.AuthenticationCtx.Links["link"].Href)
+	ausfUri, err := authConfirmApiRoot(ue, "eap-session")
 	if err != nil {
-		logger.ConsumerLog.Errorf("url Parse failed: %+v", err)
+		logger.ConsumerLog.Errorf("EAP session link of the authentication context: %+v", err)
+		err1 = err
+		return
 	}
-	ausfUri := fmt.Sprintf("%s://%s", confirmUri.Scheme, confirmUri.Host)
 
 	configuration := Nausf_UEAuthentication.NewConfiguration()
 	configuration.SetBasePath(ausfUri)
@@ -141,6 +142,8 @@ func SendEapAuthConfirmRequest(ue *amf_context.AmfUe, eapMsg nasType.EAPMessage)
 		case 400, 500:
 			problem := err.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
 			problemDetails = &problem
+		default:
+			err1 = err
 		}
 	} else {
 		err1 = openapi.ReportError("server no response")
@@ -148,3 +151,23 @@ func SendEapAuthConfirmRequest(ue *amf_context.AmfUe, eapMsg nasType.EAPMessage)
 
 	return response, problemDetails, err1
 }
+
+// authConfirmApiRoot returns the AUSF API root of the confirmation link of the authentication context,
+// the link is named after the authentication method (TS 29.509 6.1.6.2.3) or "link" by older AUSFs
+func authConfirmApiRoot(ue *amf_context.AmfUe, rel string) (string, error) {
+	if ue.AuthenticationCtx == nil {
+		return "", fmt.Errorf("authentication context is nil")
+	}
+	link, ok := ue.AuthenticationCtx.Links[rel]
+	if !ok {
+		link, ok = ue.AuthenticationCtx.Links["link"]
+	}
+	if !ok {
+		return "", fmt.Errorf("no %s link in the authentication context", rel)
+	}
+	confirmUri, err := url.Parse(link.Href)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s://%s", confirmUri.Scheme, confirmUri.Host), nil
+}
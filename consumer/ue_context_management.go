@@ -8,6 +8,7 @@ package consumer
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	amf_context "github.com/omec-project/amf/context"
@@ -76,3 +77,47 @@ func UeCmRegistration(ue *amf_context.AmfUe, accessType models.AccessType, initi
 
 	return nil, nil
 }
+
+// UeCmDeregistration purges the AMF registration of the access type in the UDM (TS 29.503 5.3.2.4)
+func UeCmDeregistration(ue *amf_context.AmfUe, accessType models.AccessType) (*models.ProblemDetails, error) {
+	configuration := Nudm_UEContextManagement.NewConfiguration()
+	configuration.SetBasePath(ue.NudmUECMUri)
+	client := Nudm_UEContextManagement.NewAPIClient(configuration)
+
+	amfSelf := amf_context.AMF_Self()
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+	defer cancel()
+
+	var httpResp *http.Response
+	var localErr error
+	switch accessType {
+	case models.AccessType__3_GPP_ACCESS:
+		modificationData := models.Amf3GppAccessRegistrationModification{
+			Guami:     &amfSelf.ServedGuamiList[0],
+			PurgeFlag: true,
+		}
+		httpResp, localErr = client.ParameterUpdateInTheAMFRegistrationFor3GPPAccessApi.Update(ctx,
+			ue.Supi, modificationData)
+	case models.AccessType_NON_3_GPP_ACCESS:
+		modificationData := models.AmfNon3GppAccessRegistrationModification{
+			Guami:     &amfSelf.ServedGuamiList[0],
+			PurgeFlag: true,
+		}
+		httpResp, localErr = client.ParameterUpdateInTheAMFRegistrationForNon3GPPAccessApi.Update(ctx,
+			ue.Supi, modificationData)
+	default:
+		return nil, nil
+	}
+
+	if localErr == nil {
+		return nil, nil
+	} else if httpResp != nil {
+		if httpResp.Status != localErr.Error() {
+			return nil, localErr
+		}
+		problem := localErr.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
+		return &problem, nil
+	} else {
+		return nil, openapi.ReportError("server no response")
+	}
+}
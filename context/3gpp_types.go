@@ -27,6 +27,7 @@ const (
 	MaxT3550RetryTimes                int   = 4
 	MaxT3560RetryTimes                int   = 4
 	MaxT3565RetryTimes                int   = 4
+	MaxT3555RetryTimes                int   = 4
 	MAxNumOfAlgorithm                 int   = 8
 	DefaultT3502                      int   = 720  // 12 min
 	DefaultT3512                      int   = 3240 // 54 min
@@ -40,6 +41,7 @@ const (
 	TimeT3550 time.Duration = 6 * time.Second
 	TimeT3560 time.Duration = 6 * time.Second
 	TimeT3565 time.Duration = 6 * time.Second
+	TimeT3555 time.Duration = 6 * time.Second
 )
 
 type LADN struct {
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"reflect"
+
+	"github.com/omec-project/amf/factory"
+	"github.com/omec-project/openapi/models"
+)
+
+// AmfConfigSnapshot is the AMF configuration advertised to a RAN in NG Setup
+// Response or AMF Configuration Update
+type AmfConfigSnapshot struct {
+	AmfName          string
+	ServedGuamiList  []models.Guami
+	RelativeCapacity int64
+	PlmnSupportList  []factory.PlmnSupportItem
+}
+
+// AmfConfigUpdate holds the IEs of an AMF Configuration Update, nil fields are
+// unchanged and not included in the message
+type AmfConfigUpdate struct {
+	AmfName          *string
+	ServedGuamiList  []models.Guami
+	RelativeCapacity *int64
+	PlmnSupportList  []factory.PlmnSupportItem
+}
+
+func (context *AMFContext) AmfConfigSnapshot() *AmfConfigSnapshot {
+	snapshot := &AmfConfigSnapshot{
+		AmfName:          context.Name,
+		RelativeCapacity: context.RelativeCapacity,
+	}
+	snapshot.ServedGuamiList = append(snapshot.ServedGuamiList, context.ServedGuamiList...)
+	// the config update from ROC modifies the slice lists in place
+	for _, plmnItem := range context.PlmnSupportList {
+		item := factory.PlmnSupportItem{PlmnId: plmnItem.PlmnId}
+		item.SNssaiList = append(item.SNssaiList, plmnItem.SNssaiList...)
+		snapshot.PlmnSupportList = append(snapshot.PlmnSupportList, item)
+	}
+	return snapshot
+}
+
+// DiffAmfConfig returns the IEs which changed between the advertised and the
+// current configuration, lists are sent complete as the RAN replaces them
+func DiffAmfConfig(advertised, current *AmfConfigSnapshot) (update AmfConfigUpdate) {
+	if advertised == nil {
+		advertised = &AmfConfigSnapshot{}
+	}
+	if advertised.AmfName != current.AmfName {
+		update.AmfName = &current.AmfName
+	}
+	if !reflect.DeepEqual(advertised.ServedGuamiList, current.ServedGuamiList) {
+		update.ServedGuamiList = current.ServedGuamiList
+	}
+	if advertised.RelativeCapacity != current.RelativeCapacity {
+		update.RelativeCapacity = &current.RelativeCapacity
+	}
+	if !reflect.DeepEqual(advertised.PlmnSupportList, current.PlmnSupportList) {
+		update.PlmnSupportList = current.PlmnSupportList
+	}
+	return update
+}
+
+func (update AmfConfigUpdate) IsEmpty() bool {
+	return update.AmfName == nil && update.ServedGuamiList == nil &&
+		update.RelativeCapacity == nil && update.PlmnSupportList == nil
+}
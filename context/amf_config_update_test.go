@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"testing"
+
+	"github.com/omec-project/amf/factory"
+	"github.com/omec-project/openapi/models"
+)
+
+func testAmfConfigSnapshot() *AmfConfigSnapshot {
+	plmnId := models.PlmnId{Mcc: "208", Mnc: "93"}
+	return &AmfConfigSnapshot{
+		AmfName:          "AMF",
+		ServedGuamiList:  []models.Guami{{PlmnId: &plmnId, AmfId: "cafe00"}},
+		RelativeCapacity: 0xff,
+		PlmnSupportList: []factory.PlmnSupportItem{
+			{PlmnId: plmnId, SNssaiList: []models.Snssai{{Sst: 1, Sd: "010203"}}},
+		},
+	}
+}
+
+func TestDiffAmfConfig(t *testing.T) {
+	testCases := []struct {
+		description      string
+		advertised       *AmfConfigSnapshot
+		change           func(current *AmfConfigSnapshot)
+		amfName          bool
+		servedGuamiList  bool
+		relativeCapacity bool
+		plmnSupportList  bool
+	}{
+		{
+			description: "no change",
+			advertised:  testAmfConfigSnapshot(),
+			change:      func(current *AmfConfigSnapshot) {},
+		},
+		{
+			description:      "nothing advertised",
+			change:           func(current *AmfConfigSnapshot) {},
+			amfName:          true,
+			servedGuamiList:  true,
+			relativeCapacity: true,
+			plmnSupportList:  true,
+		},
+		{
+			description: "AMF name",
+			advertised:  testAmfConfigSnapshot(),
+			change:      func(current *AmfConfigSnapshot) { current.AmfName = "AMF2" },
+			amfName:     true,
+		},
+		{
+			description: "GUAMI added",
+			advertised:  testAmfConfigSnapshot(),
+			change: func(current *AmfConfigSnapshot) {
+				current.ServedGuamiList = append(current.ServedGuamiList,
+					models.Guami{PlmnId: &models.PlmnId{Mcc: "001", Mnc: "01"}, AmfId: "cafe01"})
+			},
+			servedGuamiList: true,
+		},
+		{
+			description: "AMF ID of a GUAMI",
+			advertised:  testAmfConfigSnapshot(),
+			change: func(current *AmfConfigSnapshot) {
+				current.ServedGuamiList[0].AmfId = "cafe02"
+			},
+			servedGuamiList: true,
+		},
+		{
+			description:      "relative capacity",
+			advertised:       testAmfConfigSnapshot(),
+			change:           func(current *AmfConfigSnapshot) { current.RelativeCapacity = 10 },
+			relativeCapacity: true,
+		},
+		{
+			description: "slice added to a PLMN",
+			advertised:  testAmfConfigSnapshot(),
+			change: func(current *AmfConfigSnapshot) {
+				current.PlmnSupportList[0].SNssaiList = append(current.PlmnSupportList[0].SNssaiList,
+					models.Snssai{Sst: 2})
+			},
+			plmnSupportList: true,
+		},
+		{
+			description: "PLMN added",
+			advertised:  testAmfConfigSnapshot(),
+			change: func(current *AmfConfigSnapshot) {
+				current.PlmnSupportList = append(current.PlmnSupportList,
+					factory.PlmnSupportItem{PlmnId: models.PlmnId{Mcc: "001", Mnc: "01"}})
+			},
+			plmnSupportList: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			current := testAmfConfigSnapshot()
+			tc.change(current)
+			update := DiffAmfConfig(tc.advertised, current)
+
+			if changed := update.AmfName != nil; changed != tc.amfName {
+				t.Errorf("AMF name changed, want: %v, got: %v", tc.amfName, changed)
+			} else if changed && *update.AmfName != current.AmfName {
+				t.Errorf("AMF name, want: %s, got: %s", current.AmfName, *update.AmfName)
+			}
+			if changed := update.ServedGuamiList != nil; changed != tc.servedGuamiList {
+				t.Errorf("Served GUAMI list changed, want: %v, got: %v", tc.servedGuamiList, changed)
+			} else if changed && len(update.ServedGuamiList) != len(current.ServedGuamiList) {
+				t.Errorf("Served GUAMI list is not complete: %+v", update.ServedGuamiList)
+			}
+			if changed := update.RelativeCapacity != nil; changed != tc.relativeCapacity {
+				t.Errorf("Relative capacity changed, want: %v, got: %v", tc.relativeCapacity, changed)
+			} else if changed && *update.RelativeCapacity != current.RelativeCapacity {
+				t.Errorf("Relative capacity, want: %d, got: %d", current.RelativeCapacity, *update.RelativeCapacity)
+			}
+			if changed := update.PlmnSupportList != nil; changed != tc.plmnSupportList {
+				t.Errorf("PLMN support list changed, want: %v, got: %v", tc.plmnSupportList, changed)
+			} else if changed && len(update.PlmnSupportList) != len(current.PlmnSupportList) {
+				t.Errorf("PLMN support list is not complete: %+v", update.PlmnSupportList)
+			}
+			unchanged := !tc.amfName && !tc.servedGuamiList && !tc.relativeCapacity && !tc.plmnSupportList
+			if update.IsEmpty() != unchanged {
+				t.Errorf("Update is empty, want: %v, got: %v", unchanged, update.IsEmpty())
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/omec-project/amf/logger"
 	"github.com/omec-project/amf/metrics"
@@ -30,6 +31,9 @@ const (
 	RanDisconnected   = "Disconnected"
 )
 
+// queue length of the per-RAN worker for non-UE-associated NGAP messages
+const RanEventChannelSize = 128
+
 type AmfRan struct {
 	RanPresent int
 	RanId      *models.GlobalRanNodeId
@@ -45,6 +49,17 @@ type AmfRan struct {
 	/* RAN UE List */
 	RanUeList []*RanUe `json:"-"` // RanUeNgapId as key
 
+	/* per-RAN worker for non-UE-associated messages */
+	Mutex        sync.Mutex       `json:"-"`
+	EventChannel *RanEventChannel `json:"-"`
+	/* SCTP stream used by the RAN for UEs whose RanUe is not created yet */
+	ueStreamHints sync.Map // map[RanUeNgapID]uint16
+
+	/* AMF configuration known by the RAN and the AMF Configuration Update in progress */
+	AdvertisedConfig  *AmfConfigSnapshot `json:"-"`
+	PendingConfig     *AmfConfigSnapshot `json:"-"`
+	ConfigUpdateTimer *Timer             `json:"-"`
+
 	/* logger */
 	Amf2RanMsgChan chan *sdcoreAmfServer.AmfMessage `json:"-"`
 	Log            *logrus.Entry                    `json:"-"`
@@ -74,6 +89,13 @@ func (ran *AmfRan) Remove() {
 	ran.SetRanStats(RanDisconnected)
 	ran.Log.Infof("Remove RAN Context[ID: %+v]", ran.RanID())
 	ran.RemoveAllUeInRan()
+	ran.StopEventChannel()
+	ran.Mutex.Lock()
+	if ran.ConfigUpdateTimer != nil {
+		ran.ConfigUpdateTimer.Stop()
+		ran.ConfigUpdateTimer = nil
+	}
+	ran.Mutex.Unlock()
 	if AMF_Self().EnableSctpLb {
 		if ran.GnbId != "" {
 			AMF_Self().DeleteAmfRanId(ran.GnbId)
@@ -83,6 +105,43 @@ func (ran *AmfRan) Remove() {
 	}
 }
 
+// SetEventChannel starts the per-RAN worker if it is not running yet and returns
+// its EventChannel
+func (ran *AmfRan) SetEventChannel(handler func(*AmfRan, NgapMsg)) *RanEventChannel {
+	ran.Mutex.Lock()
+	defer ran.Mutex.Unlock()
+	if ran.EventChannel == nil {
+		ran.Log.Infof("Creating new AmfRan EventChannel")
+		ran.EventChannel = &RanEventChannel{
+			Message:     make(chan NgapMsg, RanEventChannelSize),
+			Quit:        make(chan struct{}),
+			Ran:         ran,
+			NgapHandler: handler,
+		}
+		go ran.EventChannel.Start()
+	}
+	return ran.EventChannel
+}
+
+func (ran *AmfRan) StopEventChannel() {
+	ran.Mutex.Lock()
+	defer ran.Mutex.Unlock()
+	if ran.EventChannel != nil {
+		close(ran.EventChannel.Quit)
+		ran.EventChannel = nil
+	}
+}
+
+// EventQueueDepth returns the number of messages waiting for the per-RAN worker
+func (ran *AmfRan) EventQueueDepth() int {
+	ran.Mutex.Lock()
+	defer ran.Mutex.Unlock()
+	if ran.EventChannel == nil {
+		return 0
+	}
+	return len(ran.EventChannel.Message)
+}
+
 func (ran *AmfRan) NewRanUe(ranUeNgapID int64) (*RanUe, error) {
 	ranUe := RanUe{}
 	self := AMF_Self()
@@ -94,23 +153,80 @@ func (ran *AmfRan) NewRanUe(ranUeNgapID int64) (*RanUe, error) {
 	ranUe.AmfUeNgapId = amfUeNgapID
 	ranUe.RanUeNgapId = ranUeNgapID
 	ranUe.Ran = ran
+	ranUe.SctpStreamId = ran.assignUeStream(ranUeNgapID, amfUeNgapID)
 	ranUe.Log = ran.Log.WithField(logger.FieldAmfUeNgapID, fmt.Sprintf("AMF_UE_NGAP_ID:%d", ranUe.AmfUeNgapId))
-	ran.RanUeList = append(ran.RanUeList, &ranUe)
+	ran.addRanUe(&ranUe)
 	self.RanUePool.Store(ranUe.AmfUeNgapId, &ranUe)
 	return &ranUe, nil
 }
 
+func (ran *AmfRan) addRanUe(ranUe *RanUe) {
+	ran.Mutex.Lock()
+	defer ran.Mutex.Unlock()
+	ran.RanUeList = append(ran.RanUeList, ranUe)
+}
+
+func (ran *AmfRan) removeRanUe(ranUe *RanUe) {
+	ran.Mutex.Lock()
+	defer ran.Mutex.Unlock()
+	for index, ranUe1 := range ran.RanUeList {
+		if ranUe1 == ranUe {
+			ran.RanUeList = append(ran.RanUeList[:index], ran.RanUeList[index+1:]...)
+			break
+		}
+	}
+}
+
+// RanUes returns a copy of ran.RanUeList, which is changed while the UEs of the RAN are released
+func (ran *AmfRan) RanUes() []*RanUe {
+	ran.Mutex.Lock()
+	defer ran.Mutex.Unlock()
+	return append([]*RanUe(nil), ran.RanUeList...)
+}
+
+// SetUeStreamHint records the SCTP stream on which the RAN sent the first
+// message of a UE, so that the RanUe created for it answers on the same stream
+func (ran *AmfRan) SetUeStreamHint(ranUeNgapID int64, streamId uint16) {
+	if streamId == 0 {
+		return
+	}
+	ran.ueStreamHints.Store(ranUeNgapID, streamId)
+}
+
+// TS 38.412 7: stream 0 is reserved for non-UE-associated signalling, UE-associated
+// signalling is spread over the other outbound streams
+func (ran *AmfRan) assignUeStream(ranUeNgapID int64, amfUeNgapID int64) uint16 {
+	numOutStreams := AMF_Self().SctpNumOutStreams
+	if value, ok := ran.ueStreamHints.LoadAndDelete(ranUeNgapID); ok {
+		if streamId := value.(uint16); streamId < numOutStreams {
+			return streamId
+		}
+	}
+	if numOutStreams <= 1 {
+		return 0
+	}
+	return uint16(1 + amfUeNgapID%int64(numOutStreams-1))
+}
+
+// UeConnectionReleasedHandler is invoked when the N2 connection of a UE is lost along with its RAN, e.g. on an
+// SCTP association loss, it is set by the GMM, which starts the mobile reachable timer of the UE
+var UeConnectionReleasedHandler func(ue *AmfUe, anType models.AccessType)
+
 func (ran *AmfRan) RemoveAllUeInRan() {
-	for _, ranUe := range ran.RanUeList {
+	for _, ranUe := range ran.RanUes() {
+		amfUe := ranUe.AmfUe
 		if err := ranUe.Remove(); err != nil {
 			logger.ContextLog.Errorf("Remove RanUe error: %v", err)
 		}
+		if amfUe != nil && UeConnectionReleasedHandler != nil {
+			UeConnectionReleasedHandler(amfUe, ran.AnType)
+		}
 	}
 }
 
 func (ran *AmfRan) RanUeFindByRanUeNgapIDLocal(ranUeNgapID int64) *RanUe {
 	// TODO - need fix..Make this map so search is fast
-	for _, ranUe := range ran.RanUeList {
+	for _, ranUe := range ran.RanUes() {
 		if ranUe.RanUeNgapId == ranUeNgapID {
 			return ranUe
 		}
@@ -130,7 +246,7 @@ func (ran *AmfRan) RanUeFindByRanUeNgapID(ranUeNgapID int64) *RanUe {
 		ranUe := DbFetchRanUeByRanUeNgapID(ranUeNgapID, ran)
 		if ranUe != nil {
 			ranUe.Ran = ran
-			ran.RanUeList = append(ran.RanUeList, ranUe)
+			ran.addRanUe(ranUe)
 			return ranUe
 		}
 	}
@@ -154,6 +270,8 @@ func (ran *AmfRan) SetRanId(ranNodeId *ngapType.GlobalRANNodeID) {
 	}
 	if ranId.GNbId != nil {
 		ran.GnbId += ranId.GNbId.GNBValue
+	} else if ranId.N3IwfId != "" {
+		ran.GnbId += ranId.N3IwfId
 	}
 	AMF_Self().AmfRanPool.Store(ran.GnbId, ran)
 }
@@ -20,6 +20,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mohae/deepcopy"
 	"github.com/sirupsen/logrus"
 
 	"github.com/omec-project/UeauCommon"
@@ -56,6 +57,13 @@ const (
 	RecommendRanNodePresentTAI     int32 = 1
 )
 
+const (
+	// FC of the K_AMF to K_AMF' derivation, TS 33.501 A.13
+	FcForKamfHorizontalDerivation = "72"
+	// the 24-bit NAS COUNT wraps around at 0xffffff, leave room for the messages exchanged while re-keying
+	NasCountRekeyThreshold uint32 = 0xfff000
+)
+
 // GMM state for UE
 const (
 	Deregistered            fsm.StateType = "Deregistered"
@@ -75,13 +83,15 @@ type AmfUe struct {
 	/* Gmm State */
 	State map[models.AccessType]*fsm.State `json:"-"`
 	/* Registration procedure related context */
-	RegistrationType5GS                uint8                           `json:"registrationType5GS,omitempty"`
-	IdentityTypeUsedForRegistration    uint8                           `json:"identityTypeUsedForRegistration,omitempty"`
-	RegistrationRequest                *nasMessage.RegistrationRequest `json:"registrationRequest,omitempty"`
-	ServingAmfChanged                  bool                            `json:"servingAmfChanged,omitempty"`
-	DeregistrationTargetAccessType     uint8                           `json:"deregistrationTargetAccessType,omitempty"` // only used when deregistration procedure is initialized by the network
-	RegistrationAcceptForNon3GPPAccess []byte                          `json:"registrationAcceptForNon3GPPAccess,omitempty"`
-	RetransmissionOfInitialNASMsg      bool                            `json:"retransmissionOfInitialNASMsg,omitempty"`
+	RegistrationType5GS             uint8                           `json:"registrationType5GS,omitempty"`
+	IdentityTypeUsedForRegistration uint8                           `json:"identityTypeUsedForRegistration,omitempty"`
+	RegistrationRequest             *nasMessage.RegistrationRequest `json:"registrationRequest,omitempty"`
+	// the integrity protected Registration Request as received, sent to the old AMF in UE context transfer
+	RegistrationRequestPdu             []byte `json:"-"`
+	ServingAmfChanged                  bool   `json:"servingAmfChanged,omitempty"`
+	DeregistrationTargetAccessType     uint8  `json:"deregistrationTargetAccessType,omitempty"` // only used when deregistration procedure is initialized by the network
+	RegistrationAcceptForNon3GPPAccess []byte `json:"registrationAcceptForNon3GPPAccess,omitempty"`
+	RetransmissionOfInitialNASMsg      bool   `json:"retransmissionOfInitialNASMsg,omitempty"`
 	/* Used for AMF relocation */
 	TargetAmfProfile *models.NfProfile `json:"targetAmfProfile,omitempty"`
 	TargetAmfUri     string            `json:"targetAmfUri,omitempty"`
@@ -90,21 +100,30 @@ type AmfUe struct {
 	Suci                string        `json:"suci,omitempty"`
 	Supi                string        `json:"supi,omitempty"`
 	UnauthenticatedSupi bool          `json:"unauthenticatedSupi,omitempty"`
+	EmergencyRegistered bool          `json:"emergencyRegistered,omitempty"`
 	Gpsi                string        `json:"gpsi,omitempty"`
 	Pei                 string        `json:"pei,omitempty"`
 	Tmsi                int32         `json:"tmsi,omitempty"` // 5G-Tmsi
 	Guti                string        `json:"guti,omitempty"`
+	OldGuti             string        `json:"oldGuti,omitempty"` // reallocated, not acknowledged by the UE yet
+	OldTmsi             int32         `json:"oldTmsi,omitempty"`
 	GroupID             string        `json:"groupID,omitempty"`
 	EBI                 int32         `json:"ebi,omitempty"`
+	/* GUTI reallocation policy */
+	GutiAllocationTime               time.Time `json:"gutiAllocationTime,omitempty"`
+	RegistrationsSinceGutiAllocation int       `json:"registrationsSinceGutiAllocation,omitempty"`
 	/* Ue Identity*/
 	EventSubscriptionsInfo map[string]*AmfUeEventSubscription `json:"eventSubscriptionInfo,omitempty"`
 	/* User Location*/
 	RatType                  models.RatType      `json:"ratType,omitempty"`
 	Location                 models.UserLocation `json:"location,omitempty"`
-	Tai                      models.Tai          `json:"tai,omitempty"`
+	Tai                      models.Tai          `json:"tai,omitempty"`        // TAI of the 3GPP access
+	Non3gppTai               models.Tai          `json:"non3gppTai,omitempty"` // N3GPP TAI of the non-3GPP access
 	LocationChanged          bool                `json:"locationChanged,omitempty"`
 	LastVisitedRegisteredTai models.Tai          `json:"lastVisitedRegisteredTai,omitempty"`
 	TimeZone                 string              `json:"timezone,omitempty"`
+	// the last abnormal release of the UE's signalling connection
+	CommFailure *models.CommunicationFailure `json:"-"`
 	/* context about udm */
 	UdmId                             string                                    `json:"udmId,omitempty"`
 	NudmUECMUri                       string                                    `json:"nudmUECMUri,omitempty"`
@@ -118,6 +137,9 @@ type AmfUe struct {
 	UdmGroupId                        string                                    `json:"udmGroupId,omitempty"`
 	SubscribedNssai                   []models.SubscribedSnssai                 `json:"subscribeNssai,omitempty"`
 	AccessAndMobilitySubscriptionData *models.AccessAndMobilitySubscriptionData `json:"accessAndMobilitySubscriptionData,omitempty"`
+	/* Steering of Roaming and UE Parameters Update, kept until delivered or acknowledged */
+	SorInfo *models.SorInfo `json:"sorInfo,omitempty"`
+	UpuInfo *models.UpuInfo `json:"upuInfo,omitempty"`
 	/* contex abut ausf */
 	AusfGroupId                       string                      `json:"ausfGroupId,omitempty"`
 	AusfId                            string                      `json:"ausfId,omitempty"`
@@ -135,9 +157,16 @@ type AmfUe struct {
 	AmPolicyUri                  string                    `json:"amPolicyUri,omitempty"`
 	AmPolicyAssociation          *models.PolicyAssociation `json:"amPolicyAssociation,omitempty"`
 	RequestTriggerLocationChange bool                      `json:"requestTriggerLocationChange,omitempty"` // true if AmPolicyAssociation.Trigger contains RequestTrigger_LOC_CH
-	ConfigurationUpdateMessage   []byte                    `json:"configurationUpdateMessage,omitempty"`
+	ConfigurationUpdatePending   bool                      `json:"configurationUpdatePending,omitempty"`   // sent once the paged UE is connected
+	/* Positioning session with the LMF, TS 23.273 6.11.1 */
+	lcsSession *LcsSession
+	lcsMu      sync.Mutex
 	/* UeContextForHandover*/
 	HandoverNotifyUri string `json:"handoverNotifyUri,omitempty"`
+	// reason of the last UE context transfer to a new AMF, the PDU sessions are not transferred on an initial registration
+	ContextTransferReason models.TransferReason `json:"contextTransferReason,omitempty"`
+	// target AMF of an inter-AMF N2 handover: outcome of the handover resource allocation
+	InterAmfHandoverResult chan InterAmfHandoverResult `json:"-"`
 	/* N1N2Message */
 	N1N2MessageIDGenerator          *idgenerator.IDGenerator `json:"n1n2MessageIDGenerator,omitempty"`
 	N1N2Message                     *N1N2Message             `json:"-"`
@@ -171,10 +200,13 @@ type AmfUe struct {
 	NCC                      uint8                        `json:"ncc,omitempty"`       // 0..7
 	//ULCount                  security.Count               `json:"ulCount,omitempty" yaml:"ulCount" bson:"ulCount,omitempty"`
 	//DLCount                  security.Count               `json:"dlCount,omitempty" yaml:"dlCount" bson:"dlCount,omitempty"`
-	ULCount      security.Count `json:"-"`
-	DLCount      security.Count `json:"-"`
-	CipheringAlg uint8          `json:"cipheringAlg,omitempty"`
-	IntegrityAlg uint8          `json:"integrityAlg,omitempty"`
+	ULCount        security.Count `json:"-"`
+	DLCount        security.Count `json:"-"`
+	Non3gppULCount security.Count `json:"-"` // NAS COUNTs of the non-3GPP NAS connection (TS 33.501 6.4.2.2)
+	Non3gppDLCount security.Count `json:"-"`
+	CipheringAlg   uint8          `json:"cipheringAlg,omitempty"`
+	IntegrityAlg   uint8          `json:"integrityAlg,omitempty"`
+	KamfChanged    bool           `json:"-"` // K_AMF is horizontally derived, to be indicated in the Security Mode Command
 	/* Registration Area */
 	RegistrationArea map[models.AccessType][]models.Tai `json:"registrationArea,omitempty"`
 	LadnInfo         []LADN                             `json:"ladnInfo,omitempty"`
@@ -191,10 +223,22 @@ type AmfUe struct {
 	T3565 *Timer `json:"t3565Value,omitempty"` // for NAS Notification
 	/* T3560 (for authentication request/security mode command retransmission) */
 	T3560 *Timer `json:"t3560Value,omitempty"`
-	/* T3550 (for registration accept retransmission) */
-	T3550 *Timer `json:"t3550Value,omitempty"`
+	// NAS security context in use until the UE completes a security mode control procedure changing it
+	previousNasSecurity *nasSecurityContext
+	/* T3550 (for registration accept retransmission), per access */
+	t3550   map[models.AccessType]*Timer
+	t3550Mu sync.Mutex
 	/* T3522 (for deregistration request) */
 	T3522 *Timer `json:"t3522Value,omitempty"`
+	/* T3555 (for configuration update command retransmission) */
+	T3555 *Timer `json:"t3555Value,omitempty"`
+	/* Mobile reachable and implicit deregistration timers (network side, TS 24.501 5.3.7) */
+	MobileReachableTimer map[models.AccessType]*Timer `json:"-"`
+	ImplicitDeregTimer   map[models.AccessType]*Timer `json:"-"`
+	reachabilityTimerMu  sync.Mutex
+	/* waits for the UE to become reachable, e.g. for Namf_MT EnableUEReachability */
+	reachabilityWaiters []chan bool
+	reachabilityWaitMu  sync.Mutex
 	/* Ue Context Release Cause */
 	ReleaseCause map[models.AccessType]*CauseAll `json:"releaseCause,omitempty"`
 	/* T3502 (Assigned by AMF, and used by UE to initialize registration procedure) */
@@ -276,14 +320,16 @@ func (ue *AmfUe) MarshalJSON() ([]byte, error) {
 	})
 
 	customAmfUe := CustomFieldsAmfUe{
-		State:       stateVal,
-		SmCtxList:   smCtxListVal,
-		ULCount:     ue.ULCount.Get(),
-		DLCount:     ue.DLCount.Get(),
-		RanUeNgapId: ranUeNgapIDVal,
-		AmfUeNgapId: amfUeNgapIDVal,
-		N1N2Message: n1n2MsgVal,
-		RanId:       gnbId,
+		State:          stateVal,
+		SmCtxList:      smCtxListVal,
+		ULCount:        ue.ULCount.Get(),
+		DLCount:        ue.DLCount.Get(),
+		Non3gppULCount: ue.Non3gppULCount.Get(),
+		Non3gppDLCount: ue.Non3gppDLCount.Get(),
+		RanUeNgapId:    ranUeNgapIDVal,
+		AmfUeNgapId:    amfUeNgapIDVal,
+		N1N2Message:    n1n2MsgVal,
+		RanId:          gnbId,
 	}
 
 	return json.Marshal(&struct {
@@ -337,6 +383,8 @@ func (ue *AmfUe) UnmarshalJSON(data []byte) error {
 	sqn = uint8(aux.DLCount & 0x000000ff)
 	overflow = uint16((aux.DLCount & 0x00ffff00) >> 8)
 	ue.DLCount.Set(overflow, sqn)
+	ue.Non3gppULCount.Set(uint16((aux.Non3gppULCount&0x00ffff00)>>8), uint8(aux.Non3gppULCount&0x000000ff))
+	ue.Non3gppDLCount.Set(uint16((aux.Non3gppDLCount&0x00ffff00)>>8), uint8(aux.Non3gppDLCount&0x000000ff))
 	ue.N1N2Message = &aux.N1N2Message
 	return nil
 }
@@ -385,6 +433,9 @@ type SbiMsg struct {
 	Msg         interface{}
 	UeContextId string
 	ReqUri      string
+	// Handler handles the message instead of the SbiHandler of the EventChannel, the messages
+	// submitted by timers carry their handler so that they do not swap the one of a pending request
+	Handler func(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{})
 
 	Result chan SbiResponseMsg
 }
@@ -400,7 +451,14 @@ type AmfUeEventSubscription struct {
 	Timestamp         time.Time
 	AnyUe             bool
 	RemainReports     *int32
+	ReportCount       int32
 	EventSubscription *models.AmfEventSubscription
+	// slice filter of the events, the S-NSSAIs of their areas of interest
+	EventSnssais map[models.AmfEventType][]models.Snssai
+	// presence of the UE in the areas of interest last reported
+	AoiPresence models.PresenceState
+	// location of the UE last reported
+	ReportedLocation *models.UserLocation
 }
 
 type N1N2Message struct {
@@ -462,6 +520,9 @@ func (ue *AmfUe) init() {
 	ue.onGoing[models.AccessType__3_GPP_ACCESS] = new(OnGoing)
 	ue.onGoing[models.AccessType__3_GPP_ACCESS].Procedure = OnGoingProcedureNothing
 	ue.ReleaseCause = make(map[models.AccessType]*CauseAll)
+	ue.MobileReachableTimer = make(map[models.AccessType]*Timer)
+	ue.ImplicitDeregTimer = make(map[models.AccessType]*Timer)
+	ue.t3550 = make(map[models.AccessType]*Timer)
 	ue.AmfInstanceName = os.Getenv("HOSTNAME")
 	ue.AmfInstanceIp = os.Getenv("POD_IP")
 	//ue.TransientInfo = make(chan AmfUeTransientInfo, 10)
@@ -489,17 +550,117 @@ func (ue *AmfUe) Remove() {
 		}
 	}
 
+	ue.StopReachabilityTimers(models.AccessType__3_GPP_ACCESS)
+	ue.StopReachabilityTimers(models.AccessType_NON_3_GPP_ACCESS)
+
 	//tmsiGenerator.FreeID(int64(ue.Tmsi))
 	AMF_Self().Drsm.ReleaseInt32ID(ue.Tmsi)
+	AMF_Self().FreeOldGuti(ue)
 
 	if len(ue.Supi) > 0 {
 		AMF_Self().UePool.Delete(ue.Supi)
+		// the UE joins the subscriptions for any UE and for its groups again when it registers
+		AMF_Self().EventSubscriptions.Range(func(key, value interface{}) bool {
+			if subscription := value.(*AMFContextEventSubscription); subscription.IsAnyUe || subscription.IsGroupUe {
+				subscription.RemoveUeSupi(ue.Supi)
+			}
+			return true
+		})
+	} else if len(ue.Pei) > 0 {
+		AMF_Self().UePool.Delete(ue.Pei)
 	}
 	if ue.EventChannel != nil {
 		ue.EventChannel.Event <- "quit"
 	}
 }
 
+// ReachabilityChangedHandler reports the reachability of the UE to the subscribers of REACHABILITY_REPORT,
+// it is set by the GMM, which sends the event reports
+var ReachabilityChangedHandler func(ue *AmfUe)
+
+// StartMobileReachableTimer (re)starts the mobile reachable timer of the access type,
+// expiredFunc is called once when it expires
+func (ue *AmfUe) StartMobileReachableTimer(anType models.AccessType, d time.Duration, expiredFunc func()) {
+	ue.reachabilityTimerMu.Lock()
+	defer ue.reachabilityTimerMu.Unlock()
+	if t := ue.MobileReachableTimer[anType]; t != nil {
+		t.Stop()
+	}
+	ue.MobileReachableTimer[anType] = NewTimer(d, 0, func(expireTimes int32) {}, expiredFunc)
+}
+
+// StartImplicitDeregTimer (re)starts the implicit deregistration timer of the access type,
+// expiredFunc is called once when it expires
+func (ue *AmfUe) StartImplicitDeregTimer(anType models.AccessType, d time.Duration, expiredFunc func()) {
+	ue.reachabilityTimerMu.Lock()
+	defer ue.reachabilityTimerMu.Unlock()
+	if t := ue.ImplicitDeregTimer[anType]; t != nil {
+		t.Stop()
+	}
+	ue.ImplicitDeregTimer[anType] = NewTimer(d, 0, func(expireTimes int32) {}, expiredFunc)
+}
+
+// StopReachabilityTimers stops the mobile reachable and implicit deregistration timers of the access type
+func (ue *AmfUe) StopReachabilityTimers(anType models.AccessType) {
+	ue.reachabilityTimerMu.Lock()
+	defer ue.reachabilityTimerMu.Unlock()
+	if t := ue.MobileReachableTimer[anType]; t != nil {
+		t.Stop()
+		delete(ue.MobileReachableTimer, anType)
+	}
+	if t := ue.ImplicitDeregTimer[anType]; t != nil {
+		t.Stop()
+		delete(ue.ImplicitDeregTimer, anType)
+	}
+}
+
+// WaitReachability returns a channel receiving whether the UE became reachable or could not be reached
+func (ue *AmfUe) WaitReachability() <-chan bool {
+	ue.reachabilityWaitMu.Lock()
+	defer ue.reachabilityWaitMu.Unlock()
+	wait := make(chan bool, 1)
+	ue.reachabilityWaiters = append(ue.reachabilityWaiters, wait)
+	return wait
+}
+
+// CancelReachabilityWait removes a wait which is abandoned, e.g. on a timeout
+func (ue *AmfUe) CancelReachabilityWait(wait <-chan bool) {
+	ue.reachabilityWaitMu.Lock()
+	defer ue.reachabilityWaitMu.Unlock()
+	for i, waiter := range ue.reachabilityWaiters {
+		if waiter == wait {
+			ue.reachabilityWaiters = append(ue.reachabilityWaiters[:i], ue.reachabilityWaiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// NotifyReachability ends the waits for the UE to become reachable
+func (ue *AmfUe) NotifyReachability(reachable bool) {
+	ue.reachabilityWaitMu.Lock()
+	defer ue.reachabilityWaitMu.Unlock()
+	for _, wait := range ue.reachabilityWaiters {
+		wait <- reachable
+	}
+	ue.reachabilityWaiters = nil
+}
+
+// SetAccessLocation stores the location reported on the access type, the location of the UE
+// on the other access is kept
+func (ue *AmfUe) SetAccessLocation(anType models.AccessType, location models.UserLocation) {
+	oldLocation := ue.Location
+	ue.Location = deepcopy.Copy(location).(models.UserLocation)
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		ue.Location.EutraLocation = oldLocation.EutraLocation
+		ue.Location.NrLocation = oldLocation.NrLocation
+	} else {
+		ue.Location.N3gaLocation = oldLocation.N3gaLocation
+	}
+	if UeLocationHandler != nil {
+		UeLocationHandler(ue)
+	}
+}
+
 func (ue *AmfUe) DetachRanUe(anType models.AccessType) {
 	delete(ue.RanUe, anType)
 }
@@ -514,6 +675,16 @@ func (ue *AmfUe) AttachRanUe(ranUe *RanUe) {
 	ue.RanUe[ranUe.Ran.AnType] = ranUe
 	ranUe.AmfUe = ue
 
+	// the UE is in CM-CONNECTED, TS 24.501 5.3.7
+	ue.StopReachabilityTimers(ranUe.Ran.AnType)
+	if ue.Reachability != models.UeReachability_REACHABLE {
+		ue.Reachability = models.UeReachability_REACHABLE
+		if ReachabilityChangedHandler != nil {
+			ReachabilityChangedHandler(ue)
+		}
+	}
+	ue.NotifyReachability(true)
+
 	// set log information
 	ue.NASLog = logger.NasLog.WithField(logger.FieldAmfUeNgapID, fmt.Sprintf("AMF_UE_NGAP_ID:%d", ranUe.AmfUeNgapId))
 	ue.GmmLog = logger.GmmLog.WithField(logger.FieldAmfUeNgapID, fmt.Sprintf("AMF_UE_NGAP_ID:%d", ranUe.AmfUeNgapId))
@@ -603,16 +774,16 @@ func (ue *AmfUe) SecurityContextIsValid() bool {
 }
 
 // Kamf Derivation function defined in TS 33.501 Annex A.7
-func (ue *AmfUe) DerivateKamf() {
+func (ue *AmfUe) DerivateKamf() error {
 	supiRegexp, err := regexp.Compile("(?:imsi|supi)-([0-9]{5,15})")
 	if err != nil {
 		logger.ContextLog.Error(err)
-		return
+		return err
 	}
 	groups := supiRegexp.FindStringSubmatch(ue.Supi)
 	if groups == nil {
 		logger.NasLog.Errorln("supi is not correct")
-		return
+		return fmt.Errorf("supi[%s] is not correct", ue.Supi)
 	}
 
 	P0 := []byte(groups[1])
@@ -623,10 +794,143 @@ func (ue *AmfUe) DerivateKamf() {
 	KseafDecode, err := hex.DecodeString(ue.Kseaf)
 	if err != nil {
 		logger.ContextLog.Error(err)
-		return
+		return err
+	}
+	if len(KseafDecode) == 0 {
+		return fmt.Errorf("Kseaf is empty")
 	}
 	KamfBytes := UeauCommon.GetKDFValue(KseafDecode, UeauCommon.FC_FOR_KAMF_DERIVATION, P0, L0, P1, L1)
 	ue.Kamf = hex.EncodeToString(KamfBytes)
+	ue.KamfChanged = false
+	return nil
+}
+
+// Horizontal Kamf Derivation function defined in TS 33.501 Annex A.13, the uplink NAS COUNT of
+// the last NAS message received from the UE on the access is used as input
+func (ue *AmfUe) DerivateHorizontalKamf(anType models.AccessType) error {
+	P0 := []byte{security.DirectionUplink}
+	L0 := UeauCommon.KDFLen(P0)
+	P1 := make([]byte, 4)
+	binary.BigEndian.PutUint32(P1, ue.NasULCount(anType).Get())
+	L1 := UeauCommon.KDFLen(P1)
+
+	KamfBytes, err := hex.DecodeString(ue.Kamf)
+	if err != nil {
+		return err
+	}
+	if len(KamfBytes) == 0 {
+		return fmt.Errorf("Kamf is empty")
+	}
+	ue.Kamf = hex.EncodeToString(UeauCommon.GetKDFValue(KamfBytes, FcForKamfHorizontalDerivation, P0, L0, P1, L1))
+	ue.KamfChanged = true
+	return nil
+}
+
+// NasCountNearWrap reports whether the uplink or downlink NAS COUNT of the access is about to wrap
+// around, a new K_AMF has to be established before it does (TS 33.501 6.4.3.1)
+func (ue *AmfUe) NasCountNearWrap(anType models.AccessType) bool {
+	for _, count := range []*security.Count{ue.NasULCount(anType), ue.NasDLCount(anType)} {
+		if count.Get() >= NasCountRekeyThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// NasULCount returns the uplink NAS COUNT of the NAS connection of the access
+func (ue *AmfUe) NasULCount(anType models.AccessType) *security.Count {
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		return &ue.Non3gppULCount
+	}
+	return &ue.ULCount
+}
+
+// NasDLCount returns the downlink NAS COUNT of the NAS connection of the access
+func (ue *AmfUe) NasDLCount(anType models.AccessType) *security.Count {
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		return &ue.Non3gppDLCount
+	}
+	return &ue.DLCount
+}
+
+// NasBearer returns the NAS connection identifier of the access, used as BEARER input of the
+// NAS ciphering and integrity algorithms (TS 33.501 6.4.2.1)
+func NasBearer(anType models.AccessType) uint8 {
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		return security.BearerNon3GPP
+	}
+	return security.Bearer3GPP
+}
+
+// AccessTai returns the last TAI of the UE on the access
+func (ue *AmfUe) AccessTai(anType models.AccessType) models.Tai {
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		return ue.Non3gppTai
+	}
+	return ue.Tai
+}
+
+func (ue *AmfUe) SetAccessTai(anType models.AccessType, tai models.Tai) {
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		ue.Non3gppTai = tai
+	} else {
+		ue.Tai = tai
+	}
+}
+
+// LcsSession is the positioning session of the UE with the LMF, it is started by the Provide Positioning
+// Info request and used by the event loop of the UE to notify the LPP and NRPPa messages to the LMF
+type LcsSession struct {
+	CorrelationId string
+	LmfUri        string
+	LmfProfile    *models.NfProfile
+}
+
+// StartLcsSession starts the positioning session, it returns false if a session of the UE is ongoing
+func (ue *AmfUe) StartLcsSession(session LcsSession) bool {
+	ue.lcsMu.Lock()
+	defer ue.lcsMu.Unlock()
+	if ue.lcsSession != nil {
+		return false
+	}
+	ue.lcsSession = &session
+	return true
+}
+
+func (ue *AmfUe) StopLcsSession() {
+	ue.lcsMu.Lock()
+	defer ue.lcsMu.Unlock()
+	ue.lcsSession = nil
+}
+
+// LcsSession returns the ongoing positioning session of the UE
+func (ue *AmfUe) LcsSession() (LcsSession, bool) {
+	ue.lcsMu.Lock()
+	defer ue.lcsMu.Unlock()
+	if ue.lcsSession == nil {
+		return LcsSession{}, false
+	}
+	return *ue.lcsSession, true
+}
+
+// SetT3550 sets the registration accept retransmission timer of the access, nil clears it
+func (ue *AmfUe) SetT3550(anType models.AccessType, timer *Timer) {
+	ue.t3550Mu.Lock()
+	defer ue.t3550Mu.Unlock()
+	ue.t3550[anType] = timer
+}
+
+// StopT3550 stops the registration accept retransmission of the access, it reports whether the timer was running
+func (ue *AmfUe) StopT3550(anType models.AccessType) bool {
+	ue.t3550Mu.Lock()
+	defer ue.t3550Mu.Unlock()
+	timer := ue.t3550[anType]
+	if timer == nil {
+		return false
+	}
+	timer.Stop()
+	delete(ue.t3550, anType)
+	return true
 }
 
 // Algorithm key Derivation function defined in TS 33.501 Annex A.9
@@ -659,7 +963,7 @@ func (ue *AmfUe) DerivateAlgKey() {
 func (ue *AmfUe) DerivateAnKey(anType models.AccessType) {
 	accessType := security.AccessType3GPP // Defalut 3gpp
 	P0 := make([]byte, 4)
-	binary.BigEndian.PutUint32(P0, ue.ULCount.Get())
+	binary.BigEndian.PutUint32(P0, ue.NasULCount(anType).Get())
 	L0 := UeauCommon.KDFLen(P0)
 	if anType == models.AccessType_NON_3_GPP_ACCESS {
 		accessType = security.AccessTypeNon3GPP
@@ -710,10 +1014,55 @@ func (ue *AmfUe) UpdateNH() {
 	ue.DerivateNH(ue.NH)
 }
 
-func (ue *AmfUe) SelectSecurityAlg(intOrder, encOrder []uint8) {
+// nasSecurityContext is the part of the NAS security context changed by a security mode control procedure
+type nasSecurityContext struct {
+	integrityAlg uint8
+	cipheringAlg uint8
+	knasInt      [16]uint8
+	knasEnc      [16]uint8
+	kamf         string
+}
+
+// SaveNasSecurityContext keeps the NAS security context in use before a security mode control procedure
+// of a registered UE changes its algorithms or its K_AMF
+func (ue *AmfUe) SaveNasSecurityContext() {
+	ue.previousNasSecurity = &nasSecurityContext{
+		integrityAlg: ue.IntegrityAlg,
+		cipheringAlg: ue.CipheringAlg,
+		knasInt:      ue.KnasInt,
+		knasEnc:      ue.KnasEnc,
+		kamf:         ue.Kamf,
+	}
+}
+
+// RestoreNasSecurityContext takes the saved NAS security context into use again, the UE keeps using it
+// if it rejects or does not answer the Security Mode Command (TS 24.501 5.4.2.5). It returns false if
+// no NAS security context is saved.
+func (ue *AmfUe) RestoreNasSecurityContext() bool {
+	previous := ue.previousNasSecurity
+	if previous == nil {
+		return false
+	}
+	ue.IntegrityAlg, ue.CipheringAlg = previous.integrityAlg, previous.cipheringAlg
+	ue.KnasInt, ue.KnasEnc = previous.knasInt, previous.knasEnc
+	ue.Kamf = previous.kamf
+	ue.KamfChanged = false
+	ue.previousNasSecurity = nil
+	return true
+}
+
+// DiscardNasSecurityContext drops the saved NAS security context once the UE uses the new one
+func (ue *AmfUe) DiscardNasSecurityContext() {
+	ue.previousNasSecurity = nil
+}
+
+// SelectSecurityAlg selects the first algorithms of the orders supported by the UE,
+// it returns false if the UE supports none of the integrity or none of the ciphering algorithms
+func (ue *AmfUe) SelectSecurityAlg(intOrder, encOrder []uint8) bool {
 	ue.CipheringAlg = security.AlgCiphering128NEA0
 	ue.IntegrityAlg = security.AlgIntegrity128NIA0
 
+	intSelected := false
 	ueSupported := uint8(0)
 	for _, intAlg := range intOrder {
 		switch intAlg {
@@ -728,10 +1077,12 @@ func (ue *AmfUe) SelectSecurityAlg(intOrder, encOrder []uint8) {
 		}
 		if ueSupported == 1 {
 			ue.IntegrityAlg = intAlg
+			intSelected = true
 			break
 		}
 	}
 
+	encSelected := false
 	ueSupported = uint8(0)
 	for _, encAlg := range encOrder {
 		switch encAlg {
@@ -746,14 +1097,17 @@ func (ue *AmfUe) SelectSecurityAlg(intOrder, encOrder []uint8) {
 		}
 		if ueSupported == 1 {
 			ue.CipheringAlg = encAlg
+			encSelected = true
 			break
 		}
 	}
+	return intSelected && encSelected
 }
 
 //this is clearing the transient data of registration request, this is called entrypoint of Deregistration and Registration state
 func (ue *AmfUe) ClearRegistrationRequestData(accessType models.AccessType) {
 	ue.RegistrationRequest = nil
+	ue.RegistrationRequestPdu = nil
 	ue.RegistrationType5GS = 0
 	ue.IdentityTypeUsedForRegistration = 0
 	ue.AuthFailureCauseSynchFailureTimes = 0
@@ -773,6 +1127,7 @@ func (ue *AmfUe) ClearRegistrationData() {
 	ue.SubscribedNssai = nil
 	ue.AllowedNssai = make(map[models.AccessType][]models.AllowedSnssai)
 	ue.SubscriptionDataValid = false
+	ue.EmergencyRegistered = false
 	//Clearing SMContextList locally
 	ue.SmContextList.Range(func(key, _ interface{}) bool {
 		ue.SmContextList.Delete(key)
@@ -906,9 +1261,11 @@ func (ue *AmfUe) CopyDataFromUeContextModel(ueContext models.UeContext) {
 
 	if len(ueContext.SessionContextList) > 0 {
 		for _, pduSessionContext := range ueContext.SessionContextList {
+			smfUri, smContextRef := SplitSmContextUri(pduSessionContext.SmContextRef)
 			smContext := SmContext{
 				PduSessionIDVal: pduSessionContext.PduSessionId,
-				SmContextRefVal: pduSessionContext.SmContextRef,
+				SmContextRefVal: smContextRef,
+				SmfUriVal:       smfUri,
 				SnssaiVal:       *pduSessionContext.SNssai,
 				DnnVal:          pduSessionContext.Dnn,
 				AccessTypeVal:   pduSessionContext.AccessType,
@@ -974,6 +1331,7 @@ func (ue *AmfUe) CopyDataFromUeContextModel(ueContext models.UeContext) {
 
 			if mmContext.AllowedNssai != nil {
 				for _, snssai := range mmContext.AllowedNssai {
+					snssai := snssai
 					allowedSnssai := models.AllowedSnssai{
 						AllowedSnssai: &snssai,
 					}
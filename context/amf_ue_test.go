@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/omec-project/openapi/models"
+)
+
+func TestNasCountNearWrap(t *testing.T) {
+	testCases := []struct {
+		description string
+		anType      models.AccessType
+		setCount    func(ue *AmfUe)
+		nearWrap    bool
+	}{
+		{
+			description: "fresh security context",
+			anType:      models.AccessType__3_GPP_ACCESS,
+			setCount:    func(ue *AmfUe) {},
+		},
+		{
+			description: "uplink count below the threshold",
+			anType:      models.AccessType__3_GPP_ACCESS,
+			setCount:    func(ue *AmfUe) { ue.ULCount.Set(0xefff, 0xff) },
+		},
+		{
+			description: "uplink count at the threshold",
+			anType:      models.AccessType__3_GPP_ACCESS,
+			setCount:    func(ue *AmfUe) { ue.ULCount.Set(0xfff0, 0x00) },
+			nearWrap:    true,
+		},
+		{
+			description: "downlink count about to wrap",
+			anType:      models.AccessType__3_GPP_ACCESS,
+			setCount:    func(ue *AmfUe) { ue.DLCount.Set(0xffff, 0xfe) },
+			nearWrap:    true,
+		},
+		{
+			description: "non-3GPP uplink count about to wrap",
+			anType:      models.AccessType_NON_3_GPP_ACCESS,
+			setCount:    func(ue *AmfUe) { ue.Non3gppULCount.Set(0xfff8, 0x00) },
+			nearWrap:    true,
+		},
+		{
+			description: "non-3GPP downlink count about to wrap",
+			anType:      models.AccessType_NON_3_GPP_ACCESS,
+			setCount:    func(ue *AmfUe) { ue.Non3gppDLCount.Set(0xffff, 0xff) },
+			nearWrap:    true,
+		},
+		{
+			description: "count of the other access about to wrap",
+			anType:      models.AccessType__3_GPP_ACCESS,
+			setCount:    func(ue *AmfUe) { ue.Non3gppULCount.Set(0xffff, 0xff) },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ue := &AmfUe{}
+			tc.setCount(ue)
+			if nearWrap := ue.NasCountNearWrap(tc.anType); nearWrap != tc.nearWrap {
+				t.Errorf("want: %v, got: %v", tc.nearWrap, nearWrap)
+			}
+		})
+	}
+}
+
+func TestDerivateHorizontalKamf(t *testing.T) {
+	kamf := "f8e1d6f1b0a7c99e2b4e6d8f0a1c3e5b7d9f1a3c5e7b9d1f3a5c7e9b1d3f5a7c"
+	key, _ := hex.DecodeString(kamf)
+
+	testCases := []struct {
+		description string
+		anType      models.AccessType
+	}{
+		{description: "3GPP access", anType: models.AccessType__3_GPP_ACCESS},
+		{description: "non-3GPP access", anType: models.AccessType_NON_3_GPP_ACCESS},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ue := &AmfUe{Kamf: kamf}
+			ue.ULCount.Set(0x0a0b, 0x0c)
+			ue.Non3gppULCount.Set(0x0a0b, 0x0c)
+			ue.NasULCount(tc.anType).Set(0x0102, 0x03)
+
+			// TS 33.501 A.13, S = FC || P0 || L0 || P1 || L1 with the KDF of TS 33.220 B.2.2:
+			// FC = 0x72, P0 = DIRECTION (uplink), L0 = 0x0001, P1 = uplink NAS COUNT of the access, L1 = 0x0004
+			s := []byte{0x72, 0x00, 0x00, 0x01, 0x00, 0x01, 0x02, 0x03, 0x00, 0x04}
+			mac := hmac.New(sha256.New, key)
+			mac.Write(s)
+			want := hex.EncodeToString(mac.Sum(nil))
+
+			if err := ue.DerivateHorizontalKamf(tc.anType); err != nil {
+				t.Fatalf("DerivateHorizontalKamf: %v", err)
+			}
+			if ue.Kamf != want {
+				t.Errorf("K_AMF', want: %s, got: %s", want, ue.Kamf)
+			}
+			if !ue.KamfChanged {
+				t.Error("K_AMF change is not flagged")
+			}
+		})
+	}
+
+	if err := (&AmfUe{}).DerivateHorizontalKamf(models.AccessType__3_GPP_ACCESS); err == nil {
+		t.Error("K_AMF' is derived without K_AMF")
+	}
+}
+
+func TestReachabilityTimersPerAccess(t *testing.T) {
+	ue := &AmfUe{
+		MobileReachableTimer: make(map[models.AccessType]*Timer),
+		ImplicitDeregTimer:   make(map[models.AccessType]*Timer),
+	}
+	expired := make(chan string, 3)
+	expiredFunc := func(name string) func() {
+		return func() { expired <- name }
+	}
+
+	ue.StartMobileReachableTimer(models.AccessType__3_GPP_ACCESS, 20*time.Millisecond, expiredFunc("replaced"))
+	ue.StartMobileReachableTimer(models.AccessType__3_GPP_ACCESS, 20*time.Millisecond, expiredFunc("3GPP"))
+	ue.StartImplicitDeregTimer(models.AccessType_NON_3_GPP_ACCESS, 20*time.Millisecond, expiredFunc("non-3GPP"))
+	ue.StopReachabilityTimers(models.AccessType__3_GPP_ACCESS)
+	if _, ok := ue.MobileReachableTimer[models.AccessType__3_GPP_ACCESS]; ok {
+		t.Error("Mobile reachable timer of 3GPP access is kept after it is stopped")
+	}
+
+	// only the timer of the other access expires
+	select {
+	case name := <-expired:
+		if name != "non-3GPP" {
+			t.Errorf("Expired timer, want: non-3GPP, got: %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Implicit deregistration timer of non-3GPP access does not expire")
+	}
+	select {
+	case name := <-expired:
+		t.Errorf("Timer %s expires after it is stopped or replaced", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/omec-project/amf/factory"
@@ -36,6 +37,7 @@ var (
 func init() {
 	AMF_Self().LadnPool = make(map[string]*LADN)
 	AMF_Self().EventSubscriptionIDGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
+	AMF_Self().NonUeN2SubscriptionIDGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
 	AMF_Self().Name = "amf"
 	AMF_Self().UriScheme = models.UriScheme_HTTPS
 	AMF_Self().RelativeCapacity = 0xff
@@ -68,11 +70,18 @@ type AMFContext struct {
 	SBIPort                         int
 	NgapPort                        int
 	SctpGrpcPort                    int
+	NgapWorkerPoolSize              int
+	SctpNumOutStreams               uint16 // SCTP outbound streams offered on N2
+	ShutdownGracePeriod             time.Duration
+	draining                        int32 // set while UEs are moved away on termination
+	BackupAmfName                   string
 	RegisterIPv4                    string
 	HttpIPv6Address                 string
 	TNLWeightFactor                 int64
 	SupportDnnLists                 []string
 	AMFStatusSubscriptions          sync.Map // map[subscriptionID]models.SubscriptionData
+	NonUeN2SubscriptionIDGenerator  *idgenerator.IDGenerator
+	NonUeN2InfoSubscriptions        sync.Map // map[subscriptionID]models.NonUeN2InfoSubscriptionCreateData
 	NrfUri                          string
 	SecurityAlgorithm               SecurityAlgorithm
 	NetworkName                     factory.NetworkName
@@ -80,27 +89,45 @@ type AMFContext struct {
 	T3502Value                      int      // unit is second
 	T3512Value                      int      // unit is second
 	Non3gppDeregistrationTimerValue int      // unit is second
+	MobileReachableTimerValue       int      // unit is second, 0 means 4 minutes greater than T3512
+	ImplicitDeregTimerValue         int      // unit is second, 0 means 4 minutes greater than T3512
 	// read-only fields
-	T3513Cfg      factory.TimerValue
-	T3522Cfg      factory.TimerValue
-	T3550Cfg      factory.TimerValue
-	T3560Cfg      factory.TimerValue
-	T3565Cfg      factory.TimerValue
-	EnableSctpLb  bool
-	EnableDbStore bool
+	T3513Cfg            factory.TimerValue
+	T3522Cfg            factory.TimerValue
+	T3550Cfg            factory.TimerValue
+	T3560Cfg            factory.TimerValue
+	T3565Cfg            factory.TimerValue
+	T3555Cfg            factory.TimerValue
+	OverloadCfg         *factory.Overload
+	CaptureCfg          *factory.Capture
+	EmergencyCfg        *factory.Emergency
+	GutiReallocationCfg *factory.GutiReallocation
+	Non3gppTaiCfg       *models.Tai
+	EnableSctpLb        bool
+	EnableDbStore       bool
 }
 
 type AMFContextEventSubscription struct {
-	IsAnyUe           bool
-	IsGroupUe         bool
-	UeSupiList        []string
+	IsAnyUe    bool
+	IsGroupUe  bool
+	UeSupiList []string
+	// SUPIs of the members of the group resolved by the UDM
+	GroupSupis        []string
+	ueListMu          sync.Mutex
 	Expiry            *time.Time
 	EventSubscription models.AmfEventSubscription
+	// slice filter of the events, the S-NSSAIs of their areas of interest
+	EventSnssais map[models.AmfEventType][]models.Snssai
+	// scheduler of the expiry and of the periodic reports
+	schedulerMu  sync.Mutex
+	expiryTimer  *time.Timer
+	periodicStop chan struct{}
 }
 
 type SecurityAlgorithm struct {
 	IntegrityOrder []uint8 // slice of security.AlgIntegrityXXX
 	CipheringOrder []uint8 // slice of security.AlgCipheringXXX
+	Policies       []SecurityPolicy
 }
 
 func NewPlmnSupportItem() (item factory.PlmnSupportItem) {
@@ -138,19 +165,28 @@ func (context *AMFContext) AllocateGutiToUe(ue *AmfUe) {
 	plmnID := servedGuami.PlmnId.Mcc + servedGuami.PlmnId.Mnc
 	tmsiStr := fmt.Sprintf("%08x", ue.Tmsi)
 	ue.Guti = plmnID + servedGuami.AmfId + tmsiStr
+	ue.GutiAllocationTime = time.Now()
+	ue.RegistrationsSinceGutiAllocation = 0
 }
 
+// TS 24.501 5.4.4.1: the old GUTI stays valid, and its TMSI owned by this AMF, until the UE has
+// acknowledged the new one (see FreeOldGuti)
 func (context *AMFContext) ReAllocateGutiToUe(ue *AmfUe) {
-	servedGuami := context.ServedGuamiList[0]
-
-	context.Drsm.ReleaseInt32ID(ue.Tmsi)
-	//tmsiGenerator.FreeID(int64(ue.Tmsi))
+	context.FreeOldGuti(ue)
+	ue.OldGuti = ue.Guti
+	ue.OldTmsi = ue.Tmsi
 
-	ue.Tmsi = context.TmsiAllocate()
+	context.AllocateGutiToUe(ue)
+}
 
-	plmnID := servedGuami.PlmnId.Mcc + servedGuami.PlmnId.Mnc
-	tmsiStr := fmt.Sprintf("%08x", ue.Tmsi)
-	ue.Guti = plmnID + servedGuami.AmfId + tmsiStr
+func (context *AMFContext) FreeOldGuti(ue *AmfUe) {
+	if ue.OldGuti == "" {
+		return
+	}
+	context.Drsm.ReleaseInt32ID(ue.OldTmsi)
+	//tmsiGenerator.FreeID(int64(ue.OldTmsi))
+	ue.OldGuti = ""
+	ue.OldTmsi = 0
 }
 
 func (context *AMFContext) AllocateRegistrationArea(ue *AmfUe, anType models.AccessType) {
@@ -159,6 +195,12 @@ func (context *AMFContext) AllocateRegistrationArea(ue *AmfUe, anType models.Acc
 		ue.RegistrationArea[anType] = nil
 	}
 
+	// the registration area of non-3GPP access only contains the N3GPP TAI, TS 24.501 5.5.1.2.4
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		ue.RegistrationArea[anType] = append(ue.RegistrationArea[anType], context.Non3gppTai())
+		return
+	}
+
 	// allocate a new tai list as a registration area to ue
 	// TODO: algorithm to choose TAI list
 
@@ -223,6 +265,9 @@ func (context *AMFContext) FindEventSubscription(subscriptionID string) (*AMFCon
 }
 
 func (context *AMFContext) DeleteEventSubscription(subscriptionID string) {
+	if subscription, ok := context.FindEventSubscription(subscriptionID); ok {
+		subscription.StopScheduler()
+	}
 	context.EventSubscriptions.Delete(subscriptionID)
 	if id, err := strconv.ParseInt(subscriptionID, 10, 32); err != nil {
 		logger.ContextLog.Error(err)
@@ -239,6 +284,44 @@ func (context *AMFContext) AddAmfUeToUePool(ue *AmfUe, supi string) {
 	context.UePool.Store(ue.Supi, ue)
 }
 
+// SetDraining marks the AMF as terminating, it accepts no new registrations while its UEs move
+// to the backup AMF
+func (context *AMFContext) SetDraining(draining bool) {
+	var value int32
+	if draining {
+		value = 1
+	}
+	atomic.StoreInt32(&context.draining, value)
+}
+
+func (context *AMFContext) Draining() bool {
+	return atomic.LoadInt32(&context.draining) == 1
+}
+
+func (context *AMFContext) EmergencyEnabled() bool {
+	return context.EmergencyCfg != nil && context.EmergencyCfg.Enable
+}
+
+// Non3gppTai returns the TAI reported for UEs on non-3GPP access (TS 23.501 5.3.2.3) with a hex TAC,
+// the first supported TAI is used if it is not configured
+func (context *AMFContext) Non3gppTai() models.Tai {
+	var tai models.Tai
+	if context.Non3gppTaiCfg != nil {
+		tai = *context.Non3gppTaiCfg
+	} else if len(context.SupportTaiLists) > 0 {
+		tai = context.SupportTaiLists[0]
+	}
+	tmp, _ := strconv.ParseUint(tai.Tac, 10, 32)
+	tai.Tac = fmt.Sprintf("%06x", tmp)
+	return tai
+}
+
+// An emergency registered UE without SUPI is stored by its PEI
+func (context *AMFContext) AddAmfUeToUePoolByPei(ue *AmfUe, pei string) {
+	ue.Pei = pei
+	context.UePool.Store(pei, ue)
+}
+
 func (context *AMFContext) NewAmfUe(supi string) *AmfUe {
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -376,7 +459,7 @@ func (context *AMFContext) AmfRanFindByRanID(ranNodeID models.GlobalRanNodeId) (
 		amfRan := value.(*AmfRan)
 		switch amfRan.RanPresent {
 		case RanPresentGNbId:
-			if amfRan.RanId.GNbId.GNBValue == ranNodeID.GNbId.GNBValue {
+			if ranNodeID.GNbId != nil && amfRan.RanId.GNbId.GNBValue == ranNodeID.GNbId.GNBValue {
 				ran = amfRan
 				ok = true
 				return false
@@ -435,7 +518,7 @@ func mapToByte(data map[string]interface{}) (ret []byte) {
 func (context *AMFContext) AmfUeFindByGutiLocal(guti string) (ue *AmfUe, ok bool) {
 	context.UePool.Range(func(key, value interface{}) bool {
 		candidate := value.(*AmfUe)
-		if ok = (candidate.Guti == guti); ok {
+		if ok = (candidate.Guti == guti || (candidate.OldGuti != "" && candidate.OldGuti == guti)); ok {
 			ue = candidate
 			return false
 		}
@@ -23,14 +23,16 @@ import (
 var dbMutex sync.Mutex
 
 type CustomFieldsAmfUe struct {
-	State       map[models.AccessType]string `json:"state"`
-	SmCtxList   map[string]SmContext         `json:"smCtxList"`
-	N1N2Message N1N2Message                  `json:"n1n2Msg"`
-	ULCount     uint32                       `json:"ulCount"`
-	DLCount     uint32                       `json:"dlCount"`
-	RanUeNgapId int64                        `json:"ranUeNgapId"`
-	AmfUeNgapId int64                        `json:"amfUeNgapId"`
-	RanId       string                       `json:"ranId"`
+	State          map[models.AccessType]string `json:"state"`
+	SmCtxList      map[string]SmContext         `json:"smCtxList"`
+	N1N2Message    N1N2Message                  `json:"n1n2Msg"`
+	ULCount        uint32                       `json:"ulCount"`
+	DLCount        uint32                       `json:"dlCount"`
+	Non3gppULCount uint32                       `json:"non3gppUlCount"`
+	Non3gppDLCount uint32                       `json:"non3gppDlCount"`
+	RanUeNgapId    int64                        `json:"ranUeNgapId"`
+	AmfUeNgapId    int64                        `json:"amfUeNgapId"`
+	RanId          string                       `json:"ranId"`
 }
 
 var Namespace = os.Getenv("POD_NAMESPACE")
@@ -0,0 +1,353 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/mohae/deepcopy"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// UeLocationHandler evaluates the location related events subscribed for the UE, it is invoked on every
+// location update of the UE and set by the producer, which builds and sends the event reports
+var UeLocationHandler func(ue *AmfUe)
+
+// StopScheduler stops the expiry timer and the periodic reports of the subscription
+func (s *AMFContextEventSubscription) StopScheduler() {
+	s.schedulerMu.Lock()
+	defer s.schedulerMu.Unlock()
+	s.stopExpiryTimer()
+	s.stopPeriodicReports()
+}
+
+func (s *AMFContextEventSubscription) stopExpiryTimer() {
+	if s.expiryTimer != nil {
+		s.expiryTimer.Stop()
+		s.expiryTimer = nil
+	}
+}
+
+func (s *AMFContextEventSubscription) stopPeriodicReports() {
+	if s.periodicStop != nil {
+		close(s.periodicStop)
+		s.periodicStop = nil
+	}
+}
+
+// StartExpiryTimer invokes expire at the expiry time of the subscription, it replaces the previous expiry timer
+func (s *AMFContextEventSubscription) StartExpiryTimer(expire func()) {
+	s.schedulerMu.Lock()
+	defer s.schedulerMu.Unlock()
+	s.stopExpiryTimer()
+	if s.Expiry == nil {
+		return
+	}
+	s.expiryTimer = time.AfterFunc(time.Until(*s.Expiry), expire)
+}
+
+// StartPeriodicReports invokes report every period until the scheduler of the subscription is stopped
+func (s *AMFContextEventSubscription) StartPeriodicReports(period time.Duration, report func()) {
+	s.schedulerMu.Lock()
+	defer s.schedulerMu.Unlock()
+	s.stopPeriodicReports()
+	ticker := time.NewTicker(period)
+	stop := make(chan struct{})
+	s.periodicStop = stop
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// AddUeSupi adds the UE to the subscription, it returns false if the UE was already added
+func (s *AMFContextEventSubscription) AddUeSupi(supi string) bool {
+	s.ueListMu.Lock()
+	defer s.ueListMu.Unlock()
+	for _, ueSupi := range s.UeSupiList {
+		if ueSupi == supi {
+			return false
+		}
+	}
+	s.UeSupiList = append(s.UeSupiList, supi)
+	return true
+}
+
+// RemoveUeSupi removes the UE from the subscription
+func (s *AMFContextEventSubscription) RemoveUeSupi(supi string) {
+	s.ueListMu.Lock()
+	defer s.ueListMu.Unlock()
+	for i, ueSupi := range s.UeSupiList {
+		if ueSupi == supi {
+			s.UeSupiList = append(s.UeSupiList[:i], s.UeSupiList[i+1:]...)
+			return
+		}
+	}
+}
+
+// UeSupis returns the UEs added to the subscription
+func (s *AMFContextEventSubscription) UeSupis() []string {
+	s.ueListMu.Lock()
+	defer s.ueListMu.Unlock()
+	return append([]string(nil), s.UeSupiList...)
+}
+
+// HasGroupMember reports whether the UE is a member of the group of the subscription, by the members
+// resolved by the UDM or by the internal group IDs of the subscription data of the UE
+func (s *AMFContextEventSubscription) HasGroupMember(ue *AmfUe) bool {
+	if !s.IsGroupUe {
+		return false
+	}
+	for _, supi := range s.GroupSupis {
+		if supi == ue.Supi {
+			return true
+		}
+	}
+	return ue.InGroup(s.EventSubscription.GroupId)
+}
+
+// InGroup reports whether the UE belongs to the internal group
+func (ue *AmfUe) InGroup(groupID string) bool {
+	if groupID == "" {
+		return false
+	}
+	if ue.GroupID == groupID {
+		return true
+	}
+	if ue.AccessAndMobilitySubscriptionData != nil {
+		for _, internalGroupID := range ue.AccessAndMobilitySubscriptionData.InternalGroupIds {
+			if internalGroupID == groupID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddEventSubscription stores the subscription for the UE, with the location and the presence in the
+// areas of interest of the UE as reference for the later reports
+func (ue *AmfUe) AddEventSubscription(subscriptionID string, subscription *AMFContextEventSubscription) {
+	ueEventSubscription := &AmfUeEventSubscription{
+		Timestamp:         time.Now().UTC(),
+		AnyUe:             subscription.IsAnyUe || subscription.IsGroupUe,
+		EventSubscription: &subscription.EventSubscription,
+		EventSnssais:      subscription.EventSnssais,
+	}
+	if options := subscription.EventSubscription.Options; options != nil && options.MaxReports > 0 {
+		ueEventSubscription.RemainReports = new(int32)
+		*ueEventSubscription.RemainReports = options.MaxReports
+	}
+	if event, ok := ueEventSubscription.FindEvent(models.AmfEventType_PRESENCE_IN_AOI_REPORT); ok {
+		ueEventSubscription.AoiPresence = ue.AoiPresenceState(event.AreaList)
+	}
+	location := deepcopy.Copy(ue.Location).(models.UserLocation)
+	ueEventSubscription.ReportedLocation = &location
+	ue.EventSubscriptionsInfo[subscriptionID] = ueEventSubscription
+}
+
+// FindEvent returns the event of the given type of the subscription
+func (s *AmfUeEventSubscription) FindEvent(eventType models.AmfEventType) (*models.AmfEvent, bool) {
+	if s.EventSubscription == nil || s.EventSubscription.EventList == nil {
+		return nil, false
+	}
+	for i := range *s.EventSubscription.EventList {
+		if event := &(*s.EventSubscription.EventList)[i]; event.Type == eventType {
+			return event, true
+		}
+	}
+	return nil, false
+}
+
+// State returns the state of the subscription: it is inactive once the maximum number of reports is sent,
+// after a one time report or when it has expired
+func (s *AmfUeEventSubscription) State() *models.AmfEventState {
+	state := &models.AmfEventState{Active: true}
+	if s.RemainReports != nil {
+		state.RemainReports = *s.RemainReports
+		if *s.RemainReports <= 0 {
+			state.Active = false
+		}
+	}
+	if s.EventSubscription == nil || s.EventSubscription.Options == nil {
+		return state
+	}
+	options := s.EventSubscription.Options
+	if options.Trigger == models.AmfEventTrigger_ONE_TIME && s.ReportCount > 0 {
+		state.Active = false
+	}
+	if options.Expiry != nil {
+		if remainDuration := time.Until(*options.Expiry); remainDuration > 0 {
+			state.RemainDuration = int32(remainDuration.Seconds())
+		} else {
+			state.Active = false
+		}
+	}
+	return state
+}
+
+// CountReport accounts a report sent to the subscription and returns the resulting state
+func (s *AmfUeEventSubscription) CountReport() *models.AmfEventState {
+	s.ReportCount++
+	if s.RemainReports != nil {
+		*s.RemainReports--
+	}
+	return s.State()
+}
+
+// MatchAmfEvent reports whether the event filter (TS 29.518 6.2.6.2.3) applies to the UE: the UE uses one of
+// its slices and has a PDU session to one of its DNNs, and it is located in one of its areas. The areas of a
+// presence in area of interest event are evaluated by AoiPresenceState instead
+func (ue *AmfUe) MatchAmfEvent(event *models.AmfEvent, snssais []models.Snssai) bool {
+	if len(snssais) > 0 {
+		allowed := false
+		for _, snssai := range snssais {
+			for anType := range ue.AllowedNssai {
+				if ue.InAllowedNssai(snssai, anType) {
+					allowed = true
+				}
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if event.Type == models.AmfEventType_PRESENCE_IN_AOI_REPORT {
+		return true
+	}
+
+	var dnns []string
+	var areas []models.AmfEventArea
+	for _, area := range event.AreaList {
+		if area.LadnInfo != nil {
+			dnns = append(dnns, area.LadnInfo.Ladn)
+		}
+		if area.PresenceInfo != nil {
+			areas = append(areas, area)
+		}
+	}
+	if len(dnns) > 0 && !ue.hasPduSessionToDnn(dnns) {
+		return false
+	}
+	if len(areas) > 0 && ue.AoiPresenceState(areas) != models.PresenceState_IN_AREA {
+		return false
+	}
+	return true
+}
+
+// AoiPresenceState returns whether the UE is in one of the areas of interest, given by their TAIs, cells
+// and NG-RAN nodes, or by the service area of a LADN
+func (ue *AmfUe) AoiPresenceState(areas []models.AmfEventArea) models.PresenceState {
+	// the location is stored before the TAI of the UE is updated
+	tai := userLocationTai(&ue.Location)
+	if tai == nil && ue.Location.N3gaLocation != nil {
+		tai = ue.Location.N3gaLocation.N3gppTai
+	}
+	if tai == nil {
+		return models.PresenceState_UNKNOWN
+	}
+	for _, area := range areas {
+		if area.LadnInfo != nil {
+			if ladn, ok := ue.ServingAMF().LadnPool[area.LadnInfo.Ladn]; ok && InTaiList(*tai, ladn.TaiLists) {
+				return models.PresenceState_IN_AREA
+			}
+		}
+		if presenceInfo := area.PresenceInfo; presenceInfo != nil {
+			if InTaiList(*tai, presenceInfo.TrackingAreaList) {
+				return models.PresenceState_IN_AREA
+			}
+			if nrLocation := ue.Location.NrLocation; nrLocation != nil && nrLocation.Ncgi != nil {
+				for _, ncgi := range presenceInfo.NcgiList {
+					if reflect.DeepEqual(ncgi, *nrLocation.Ncgi) {
+						return models.PresenceState_IN_AREA
+					}
+				}
+			}
+			if eutraLocation := ue.Location.EutraLocation; eutraLocation != nil && eutraLocation.Ecgi != nil {
+				for _, ecgi := range presenceInfo.EcgiList {
+					if reflect.DeepEqual(ecgi, *eutraLocation.Ecgi) {
+						return models.PresenceState_IN_AREA
+					}
+				}
+			}
+			if ranUe, ok := ue.RanUe[models.AccessType__3_GPP_ACCESS]; ok && ranUe.Ran != nil &&
+				ranUe.Ran.InRanNodeList(presenceInfo.GlobalRanNodeIdList) {
+				return models.PresenceState_IN_AREA
+			}
+		}
+	}
+	return models.PresenceState_OUT_OF_AREA
+}
+
+// LocationChangedSince reports whether the location items of the filter list (TS 29.518 6.2.6.3.5) differ
+// from the given location, the TAI and the cell when the list is empty
+func (ue *AmfUe) LocationChangedSince(location *models.UserLocation, filters []models.LocationFilter) bool {
+	if location == nil {
+		return true
+	}
+	if len(filters) == 0 {
+		filters = []models.LocationFilter{models.LocationFilter_TAI, models.LocationFilter_CELL_ID}
+	}
+	for _, filter := range filters {
+		switch filter {
+		case models.LocationFilter_TAI:
+			if !reflect.DeepEqual(userLocationTai(location), userLocationTai(&ue.Location)) {
+				return true
+			}
+		case models.LocationFilter_CELL_ID:
+			if !reflect.DeepEqual(userLocationCell(location), userLocationCell(&ue.Location)) {
+				return true
+			}
+		case models.LocationFilter_N3_IWF, models.LocationFilter_UE_IP, models.LocationFilter_UDP_PORT:
+			if !reflect.DeepEqual(location.N3gaLocation, ue.Location.N3gaLocation) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func userLocationTai(location *models.UserLocation) *models.Tai {
+	if location.NrLocation != nil {
+		return location.NrLocation.Tai
+	} else if location.EutraLocation != nil {
+		return location.EutraLocation.Tai
+	}
+	return nil
+}
+
+func userLocationCell(location *models.UserLocation) interface{} {
+	if location.NrLocation != nil {
+		return location.NrLocation.Ncgi
+	} else if location.EutraLocation != nil {
+		return location.EutraLocation.Ecgi
+	}
+	return nil
+}
+
+func (ue *AmfUe) hasPduSessionToDnn(dnns []string) bool {
+	found := false
+	ue.SmContextList.Range(func(key, value interface{}) bool {
+		smContext := value.(*SmContext)
+		for _, dnn := range dnns {
+			if smContext.Dnn() == dnn {
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+	return found
+}
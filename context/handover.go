@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"strings"
+
+	"github.com/omec-project/openapi/models"
+)
+
+const smContextResourcePath = "/nsmf-pdusession/v1/sm-contexts/"
+
+// InterAmfHandoverResult is the outcome of the handover resource allocation in the target AMF,
+// returned to the source AMF in the Namf_Communication_CreateUEContext response
+type InterAmfHandoverResult struct {
+	CreatedData *models.UeContextCreatedData
+	// NGAP IEs referenced by the created data, keyed by Content-ID
+	NgapParts   map[string][]byte
+	CreateError *models.UeContextCreateError
+}
+
+// SmContextUri returns the URI of the SM context resource in the SMF, which is transferred
+// to another AMF as smContextRef of the PduSessionContext (TS 29.518 6.1.6.2.19)
+func (c *SmContext) SmContextUri() string {
+	if c.SmfUri() == "" {
+		return c.SmContextRef()
+	}
+	return c.SmfUri() + smContextResourcePath + c.SmContextRef()
+}
+
+// SplitSmContextUri splits an SM context resource URI into the SMF URI and the SM context reference
+func SplitSmContextUri(uri string) (smfUri, smContextRef string) {
+	if idx := strings.Index(uri, smContextResourcePath); idx > 0 {
+		return uri[:idx], uri[idx+len(smContextResourcePath):]
+	}
+	return "", uri
+}
+
+// NotifyInterAmfHandoverResult hands the handover outcome over to the pending CreateUEContext request
+func (ue *AmfUe) NotifyInterAmfHandoverResult(result InterAmfHandoverResult) bool {
+	if ue.InterAmfHandoverResult == nil {
+		return false
+	}
+	select {
+	case ue.InterAmfHandoverResult <- result:
+	default:
+		ue.GmmLog.Warnln("Inter-AMF handover result is already pending")
+	}
+	return true
+}
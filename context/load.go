@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"sync"
+	"time"
+)
+
+// weight of the latest sample in the SBI latency moving average
+const sbiLatencyWeight = 0.2
+
+var sbiLatency struct {
+	sync.Mutex
+	avg     time.Duration
+	sampled bool // a request completed since the last decay
+}
+
+// ObserveSbiLatency records the duration of a request to another NF, it feeds
+// the overload control of the AMF
+func (context *AMFContext) ObserveSbiLatency(d time.Duration) {
+	sbiLatency.Lock()
+	defer sbiLatency.Unlock()
+	sbiLatency.sampled = true
+	if sbiLatency.avg == 0 {
+		sbiLatency.avg = d
+		return
+	}
+	sbiLatency.avg = time.Duration(sbiLatencyWeight*float64(d) + (1-sbiLatencyWeight)*float64(sbiLatency.avg))
+}
+
+// DecaySbiLatency lowers the moving average if no request completed since the
+// last call, otherwise the average of an idle AMF stays at its last value
+func (context *AMFContext) DecaySbiLatency() {
+	sbiLatency.Lock()
+	defer sbiLatency.Unlock()
+	if !sbiLatency.sampled {
+		sbiLatency.avg = time.Duration((1 - sbiLatencyWeight) * float64(sbiLatency.avg))
+	}
+	sbiLatency.sampled = false
+}
+
+// SbiLatency returns the moving average of SBI request durations
+func (context *AMFContext) SbiLatency() time.Duration {
+	sbiLatency.Lock()
+	defer sbiLatency.Unlock()
+	return sbiLatency.avg
+}
+
+// EventQueueDepth returns the number of messages waiting in the EventChannels of
+// all UEs and RANs
+func (context *AMFContext) EventQueueDepth() (depth int) {
+	context.UePool.Range(func(key, value interface{}) bool {
+		ue := value.(*AmfUe)
+		// the EventChannel is created under the lock of the UE by SetEventChannel
+		ue.Mutex.Lock()
+		eventChannel := ue.EventChannel
+		ue.Mutex.Unlock()
+		if eventChannel != nil {
+			depth += len(eventChannel.Message)
+		}
+		return true
+	})
+	for _, ran := range context.AmfRanListInArea(nil, nil) {
+		depth += ran.EventQueueDepth()
+	}
+	return depth
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/openapi/models"
+)
+
+func (context *AMFContext) NewNonUeN2InfoSubscription(
+	subscription models.NonUeN2InfoSubscriptionCreateData) (subscriptionID string) {
+	id, err := context.NonUeN2SubscriptionIDGenerator.Allocate()
+	if err != nil {
+		logger.ContextLog.Errorf("Allocate subscriptionID error: %+v", err)
+		return ""
+	}
+
+	subscriptionID = strconv.FormatInt(id, 10)
+	context.NonUeN2InfoSubscriptions.Store(subscriptionID, subscription)
+	return
+}
+
+func (context *AMFContext) FindNonUeN2InfoSubscription(
+	subscriptionID string) (*models.NonUeN2InfoSubscriptionCreateData, bool) {
+	if value, ok := context.NonUeN2InfoSubscriptions.Load(subscriptionID); ok {
+		subscription := value.(models.NonUeN2InfoSubscriptionCreateData)
+		return &subscription, ok
+	} else {
+		return nil, false
+	}
+}
+
+func (context *AMFContext) DeleteNonUeN2InfoSubscription(subscriptionID string) {
+	context.NonUeN2InfoSubscriptions.Delete(subscriptionID)
+	if id, err := strconv.ParseInt(subscriptionID, 10, 64); err != nil {
+		logger.ContextLog.Error(err)
+	} else {
+		context.NonUeN2SubscriptionIDGenerator.FreeID(id)
+	}
+}
+
+// AmfRanListInArea returns the RANs which serve a TAI of the list or are in the RAN node list,
+// all the RANs if both lists are empty (TS 29.518 6.1.6.2.27)
+func (context *AMFContext) AmfRanListInArea(taiList []models.Tai,
+	ranNodeList []models.GlobalRanNodeId) (ranList []*AmfRan) {
+	// a RAN is stored under its connection and, with direct SCTP, also under its GnbId
+	seen := make(map[*AmfRan]bool)
+	context.AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*AmfRan)
+		if seen[ran] {
+			return true
+		}
+		seen[ran] = true
+		if (len(taiList) == 0 && len(ranNodeList) == 0) || ran.InRanNodeList(ranNodeList) || ran.ServesTaiList(taiList) {
+			ranList = append(ranList, ran)
+		}
+		return true
+	})
+	return ranList
+}
+
+func (ran *AmfRan) InRanNodeList(ranNodeList []models.GlobalRanNodeId) bool {
+	if ran.RanId == nil {
+		return false
+	}
+	for _, ranNodeId := range ranNodeList {
+		if reflect.DeepEqual(*ran.RanId, ranNodeId) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ran *AmfRan) ServesTaiList(taiList []models.Tai) bool {
+	for _, supportedTai := range ran.SupportedTAList {
+		if InTaiList(supportedTai.Tai, taiList) {
+			return true
+		}
+	}
+	return false
+}
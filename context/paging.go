@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"github.com/omec-project/openapi/models"
+)
+
+// maximum value of Paging Attempt Count / Intended Number of Paging Attempts (TS 38.413 9.3.1.72)
+const MaxPagingAttempts int32 = 16
+
+// PagingAttempt describes where a single paging attempt of the UE is sent to
+type PagingAttempt struct {
+	Count    int32 // starts from 1
+	Intended int32
+	// the next attempt is sent to a wider area than this one
+	NextScopeChanged bool
+	TaiList          []models.Tai
+	RanList          []*AmfRan
+}
+
+// IntendedPagingAttempts returns the number of paging attempts the AMF makes before giving up,
+// i.e. the first paging plus the T3513 retransmissions
+func (context *AMFContext) IntendedPagingAttempts() int32 {
+	attempts := int32(1)
+	if context.T3513Cfg.Enable {
+		attempts += int32(context.T3513Cfg.MaxRetryTimes)
+	}
+	if attempts > MaxPagingAttempts {
+		attempts = MaxPagingAttempts
+	}
+	return attempts
+}
+
+// NewPagingAttempt selects the paging area of the given attempt. The first attempt is sent to the
+// last known TAI and the recommended RAN nodes of the UE; later attempts (or the first one if nothing
+// is known about the UE location) cover the whole registration area.
+func (ue *AmfUe) NewPagingAttempt(count int32) *PagingAttempt {
+	amfSelf := AMF_Self()
+	attempt := &PagingAttempt{
+		Count:    count,
+		Intended: amfSelf.IntendedPagingAttempts(),
+	}
+	if attempt.Count > MaxPagingAttempts {
+		attempt.Count = MaxPagingAttempts
+	}
+	if attempt.Intended < attempt.Count {
+		attempt.Intended = attempt.Count
+	}
+
+	registrationArea := ue.RegistrationArea[models.AccessType__3_GPP_ACCESS]
+	if count == 1 && attempt.Intended > 1 {
+		ue.lastKnownPagingArea(attempt, registrationArea)
+		if len(attempt.RanList) != 0 {
+			attempt.NextScopeChanged = true
+			return attempt
+		}
+		attempt.TaiList = nil
+	}
+
+	attempt.TaiList = append(attempt.TaiList, registrationArea...)
+	amfSelf.AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*AmfRan)
+		for _, item := range ran.SupportedTAList {
+			if InTaiList(item.Tai, registrationArea) {
+				attempt.addRan(ran)
+				break
+			}
+		}
+		return true
+	})
+	return attempt
+}
+
+func (ue *AmfUe) lastKnownPagingArea(attempt *PagingAttempt, registrationArea []models.Tai) {
+	amfSelf := AMF_Self()
+	if ue.Tai.PlmnId != nil && InTaiList(ue.Tai, registrationArea) {
+		attempt.addTai(ue.Tai)
+	}
+	if info := ue.InfoOnRecommendedCellsAndRanNodesForPaging; info != nil {
+		for _, node := range info.RecommendedRanNodes {
+			switch node.Present {
+			case RecommendRanNodePresentRanNode:
+				if node.GlobalRanNodeId == nil {
+					continue
+				}
+				if ran, ok := amfSelf.AmfRanFindByRanID(*node.GlobalRanNodeId); ok {
+					attempt.addRan(ran)
+				}
+			case RecommendRanNodePresentTAI:
+				if node.Tai != nil && InTaiList(*node.Tai, registrationArea) {
+					attempt.addTai(*node.Tai)
+				}
+			}
+		}
+	}
+	if nrLocation := ue.Location.NrLocation; nrLocation != nil && nrLocation.GlobalGnbId != nil {
+		if ran, ok := amfSelf.AmfRanFindByRanID(*nrLocation.GlobalGnbId); ok {
+			attempt.addRan(ran)
+		}
+	}
+	if len(attempt.TaiList) == 0 {
+		if len(attempt.RanList) != 0 {
+			// recommended RAN nodes were found, but their TAIs are unknown
+			attempt.TaiList = append(attempt.TaiList, registrationArea...)
+		}
+		return
+	}
+	amfSelf.AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*AmfRan)
+		for _, item := range ran.SupportedTAList {
+			if InTaiList(item.Tai, attempt.TaiList) {
+				attempt.addRan(ran)
+				break
+			}
+		}
+		return true
+	})
+}
+
+func (attempt *PagingAttempt) addTai(tai models.Tai) {
+	if !InTaiList(tai, attempt.TaiList) {
+		attempt.TaiList = append(attempt.TaiList, tai)
+	}
+}
+
+func (attempt *PagingAttempt) addRan(ran *AmfRan) {
+	for _, item := range attempt.RanList {
+		if item == ran {
+			return
+		}
+	}
+	attempt.RanList = append(attempt.RanList, ran)
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/amf/factory"
+	"github.com/omec-project/openapi/models"
+)
+
+// newPagingRan adds a gNB serving tai to the RAN pool
+func newPagingRan(t *testing.T, addr, gnbValue string, tai models.Tai) *AmfRan {
+	self := AMF_Self()
+	ran := self.NewAmfRanAddr(addr)
+	ran.RanPresent = RanPresentGNbId
+	ran.RanId = &models.GlobalRanNodeId{
+		PlmnId: tai.PlmnId,
+		GNbId:  &models.GNbId{BitLength: 24, GNBValue: gnbValue},
+	}
+	ran.SupportedTAList = append(ran.SupportedTAList, SupportedTAI{Tai: tai})
+	t.Cleanup(func() { self.AmfRanPool.Delete(addr) })
+	return ran
+}
+
+func TestNewPagingAttempt(t *testing.T) {
+	self := AMF_Self()
+	t3513Cfg := self.T3513Cfg
+	defer func() { self.T3513Cfg = t3513Cfg }()
+
+	plmnId := &models.PlmnId{Mcc: "208", Mnc: "93"}
+	tai1 := models.Tai{PlmnId: plmnId, Tac: "0000a1"}
+	tai2 := models.Tai{PlmnId: plmnId, Tac: "0000a2"}
+	ran1 := newPagingRan(t, "10.0.0.1:38412", "0000a1", tai1)
+	ran2 := newPagingRan(t, "10.0.0.2:38412", "0000a2", tai2)
+	registrationArea := []models.Tai{tai1, tai2}
+
+	testCases := []struct {
+		description      string
+		t3513            bool
+		count            int32
+		tai              models.Tai
+		recommendedRan   *models.GlobalRanNodeId
+		intended         int32
+		wantCount        int32
+		taiList          []models.Tai
+		ranList          []*AmfRan
+		nextScopeChanged bool
+	}{
+		{
+			description:      "first attempt to the last known TAI",
+			t3513:            true,
+			count:            1,
+			tai:              tai1,
+			intended:         3,
+			wantCount:        1,
+			taiList:          []models.Tai{tai1},
+			ranList:          []*AmfRan{ran1},
+			nextScopeChanged: true,
+		},
+		{
+			description: "retry to the registration area",
+			t3513:       true,
+			count:       2,
+			tai:         tai1,
+			intended:    3,
+			wantCount:   2,
+			taiList:     registrationArea,
+			ranList:     []*AmfRan{ran1, ran2},
+		},
+		{
+			description:      "first attempt to the recommended RAN node",
+			t3513:            true,
+			count:            1,
+			recommendedRan:   ran2.RanId,
+			intended:         3,
+			wantCount:        1,
+			taiList:          registrationArea,
+			ranList:          []*AmfRan{ran2},
+			nextScopeChanged: true,
+		},
+		{
+			description: "first attempt without known location",
+			t3513:       true,
+			count:       1,
+			intended:    3,
+			wantCount:   1,
+			taiList:     registrationArea,
+			ranList:     []*AmfRan{ran1, ran2},
+		},
+		{
+			description: "single attempt without retransmission",
+			count:       1,
+			tai:         tai1,
+			intended:    1,
+			wantCount:   1,
+			taiList:     registrationArea,
+			ranList:     []*AmfRan{ran1, ran2},
+		},
+		{
+			description: "attempt count above the maximum",
+			t3513:       true,
+			count:       MaxPagingAttempts + 4,
+			intended:    MaxPagingAttempts,
+			wantCount:   MaxPagingAttempts,
+			taiList:     registrationArea,
+			ranList:     []*AmfRan{ran1, ran2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			self.T3513Cfg = factory.TimerValue{Enable: tc.t3513, ExpireTime: time.Second, MaxRetryTimes: 2}
+			ue := &AmfUe{
+				Tai: tc.tai,
+				RegistrationArea: map[models.AccessType][]models.Tai{
+					models.AccessType__3_GPP_ACCESS: registrationArea,
+				},
+			}
+			if tc.recommendedRan != nil {
+				ue.InfoOnRecommendedCellsAndRanNodesForPaging = &InfoOnRecommendedCellsAndRanNodesForPaging{
+					RecommendedRanNodes: []RecommendRanNode{
+						{Present: RecommendRanNodePresentRanNode, GlobalRanNodeId: tc.recommendedRan},
+					},
+				}
+			}
+
+			attempt := ue.NewPagingAttempt(tc.count)
+			if attempt.Count != tc.wantCount || attempt.Intended != tc.intended {
+				t.Errorf("Attempt, want: %d/%d, got: %d/%d", tc.wantCount, tc.intended, attempt.Count,
+					attempt.Intended)
+			}
+			if attempt.NextScopeChanged != tc.nextScopeChanged {
+				t.Errorf("Next scope changed, want: %v, got: %v", tc.nextScopeChanged, attempt.NextScopeChanged)
+			}
+			if len(attempt.TaiList) != len(tc.taiList) {
+				t.Errorf("TAI list, want: %+v, got: %+v", tc.taiList, attempt.TaiList)
+			}
+			for _, tai := range tc.taiList {
+				if !InTaiList(tai, attempt.TaiList) {
+					t.Errorf("TAI[%s] is not paged", tai.Tac)
+				}
+			}
+			if len(attempt.RanList) != len(tc.ranList) {
+				t.Errorf("Number of paged RANs, want: %d, got: %d", len(tc.ranList), len(attempt.RanList))
+			}
+			for _, ran := range tc.ranList {
+				if !pagedRan(attempt, ran) {
+					t.Errorf("RAN[%s] is not paged", ran.GnbIp)
+				}
+			}
+		})
+	}
+}
+
+func pagedRan(attempt *PagingAttempt, ran *AmfRan) bool {
+	for _, item := range attempt.RanList {
+		if item == ran {
+			return true
+		}
+	}
+	return false
+}
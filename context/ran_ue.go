@@ -10,7 +10,7 @@ package context
 import (
 	"encoding/hex"
 	"fmt"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/mohae/deepcopy"
@@ -33,6 +33,8 @@ const (
 	UeContextReleaseHandover
 	UeContextReleaseUeContext
 	UeContextReleaseDueToNwInitiatedDeregistraion
+	// the UE is served by another AMF after (or instead of) an inter-AMF N2 handover
+	UeContextReleaseInterAmfHandover
 )
 
 type RanUe struct {
@@ -59,6 +61,10 @@ type RanUe struct {
 	AmfUe *AmfUe `json:"-"`
 	Ran   *AmfRan
 
+	/* SCTP stream used for UE-associated signalling of this UE, guarded by streamMu */
+	SctpStreamId uint16
+	streamMu     sync.Mutex
+
 	/* Routing ID */
 	RoutingID string
 	/* Trace Recording Session Reference */
@@ -98,12 +104,7 @@ func (ranUe *RanUe) Remove() error {
 		ranUe.DetachAmfUe()
 	}
 
-	for index, ranUe1 := range ran.RanUeList {
-		if ranUe1 == ranUe {
-			ran.RanUeList = append(ran.RanUeList[:index], ran.RanUeList[index+1:]...)
-			break
-		}
-	}
+	ran.removeRanUe(ranUe)
 	self := AMF_Self()
 	self.RanUePool.Delete(ranUe.AmfUeNgapId)
 	//amfUeNGAPIDGenerator.FreeID(ranUe.AmfUeNgapId)
@@ -115,6 +116,32 @@ func (ranUe *RanUe) DetachAmfUe() {
 	ranUe.AmfUe = nil
 }
 
+// SetSctpStream echoes the stream chosen by the RAN for this UE, a stream beyond
+// the outbound streams of the AMF is clamped to the last one
+func (ranUe *RanUe) SetSctpStream(streamId uint16) {
+	numOutStreams := AMF_Self().SctpNumOutStreams
+	if streamId == 0 || numOutStreams <= 1 {
+		return
+	}
+	if streamId >= numOutStreams {
+		streamId = numOutStreams - 1
+	}
+	ranUe.streamMu.Lock()
+	defer ranUe.streamMu.Unlock()
+	if streamId == ranUe.SctpStreamId {
+		return
+	}
+	ranUe.Log.Debugf("SCTP stream changed from %d to %d", ranUe.SctpStreamId, streamId)
+	ranUe.SctpStreamId = streamId
+}
+
+// SctpStream returns the SCTP stream of the UE-associated signalling of this UE
+func (ranUe *RanUe) SctpStream() uint16 {
+	ranUe.streamMu.Lock()
+	defer ranUe.streamMu.Unlock()
+	return ranUe.SctpStreamId
+}
+
 func (ranUe *RanUe) SwitchToRan(newRan *AmfRan, ranUeNgapId int64) error {
 	if ranUe == nil {
 		return fmt.Errorf("ranUe is nil")
@@ -127,19 +154,18 @@ func (ranUe *RanUe) SwitchToRan(newRan *AmfRan, ranUeNgapId int64) error {
 	oldRan := ranUe.Ran
 
 	// remove ranUe from oldRan
-	for index, ranUe1 := range oldRan.RanUeList {
-		if ranUe1 == ranUe {
-			oldRan.RanUeList = append(oldRan.RanUeList[:index], oldRan.RanUeList[index+1:]...)
-			break
-		}
-	}
+	oldRan.removeRanUe(ranUe)
 
 	// add ranUe to newRan
-	newRan.RanUeList = append(newRan.RanUeList, ranUe)
+	newRan.addRanUe(ranUe)
 
 	// switch to newRan
 	ranUe.Ran = newRan
 	ranUe.RanUeNgapId = ranUeNgapId
+	streamId := newRan.assignUeStream(ranUeNgapId, ranUe.AmfUeNgapId)
+	ranUe.streamMu.Lock()
+	ranUe.SctpStreamId = streamId
+	ranUe.streamMu.Unlock()
 
 	logger.ContextLog.Infof("RanUe[RanUeNgapID: %d] Switch to new Ran[Name: %s]", ranUe.RanUeNgapId, ranUe.Ran.Name)
 	return nil
@@ -188,7 +214,7 @@ func (ranUe *RanUe) UpdateLocation(userLocationInformation *ngapType.UserLocatio
 			if ranUe.AmfUe.Tai != ranUe.Tai {
 				ranUe.AmfUe.LocationChanged = true
 			}
-			ranUe.AmfUe.Location = deepcopy.Copy(ranUe.Location).(models.UserLocation)
+			ranUe.AmfUe.SetAccessLocation(models.AccessType__3_GPP_ACCESS, ranUe.Location)
 			ranUe.AmfUe.Tai = deepcopy.Copy(*ranUe.AmfUe.Location.EutraLocation.Tai).(models.Tai)
 		}
 	case ngapType.UserLocationInformationPresentUserLocationInformationNR:
@@ -225,7 +251,7 @@ func (ranUe *RanUe) UpdateLocation(userLocationInformation *ngapType.UserLocatio
 			if ranUe.AmfUe.Tai != ranUe.Tai {
 				ranUe.AmfUe.LocationChanged = true
 			}
-			ranUe.AmfUe.Location = deepcopy.Copy(ranUe.Location).(models.UserLocation)
+			ranUe.AmfUe.SetAccessLocation(models.AccessType__3_GPP_ACCESS, ranUe.Location)
 			ranUe.AmfUe.Tai = deepcopy.Copy(*ranUe.AmfUe.Location.NrLocation.Tai).(models.Tai)
 		}
 	case ngapType.UserLocationInformationPresentUserLocationInformationN3IWF:
@@ -242,19 +268,17 @@ func (ranUe *RanUe) UpdateLocation(userLocationInformation *ngapType.UserLocatio
 		ranUe.Location.N3gaLocation.UeIpv4Addr = ipv4Addr
 		ranUe.Location.N3gaLocation.UeIpv6Addr = ipv6Addr
 		ranUe.Location.N3gaLocation.PortNumber = ngapConvert.PortNumberToInt(port)
-		// N3GPP TAI is operator-specific
-		// TODO: define N3GPP TAI
-		tmp, _ := strconv.ParseUint(amfSelf.SupportTaiLists[0].Tac, 10, 32)
-		tac := fmt.Sprintf("%06x", tmp)
-		ranUe.Location.N3gaLocation.N3gppTai = &models.Tai{
-			PlmnId: amfSelf.SupportTaiLists[0].PlmnId,
-			Tac:    tac,
-		}
-		ranUe.Tai = deepcopy.Copy(*ranUe.Location.N3gaLocation.N3gppTai).(models.Tai)
+		// N3GPP TAI is operator-specific (TS 23.501 5.3.2.3)
+		n3gppTai := amfSelf.Non3gppTai()
+		ranUe.Location.N3gaLocation.N3gppTai = &n3gppTai
+		ranUe.Tai = n3gppTai
 
 		if ranUe.AmfUe != nil {
-			ranUe.AmfUe.Location = deepcopy.Copy(ranUe.Location).(models.UserLocation)
-			ranUe.AmfUe.Tai = *ranUe.Location.N3gaLocation.N3gppTai
+			if ranUe.AmfUe.Non3gppTai != ranUe.Tai {
+				ranUe.AmfUe.LocationChanged = true
+			}
+			ranUe.AmfUe.SetAccessLocation(models.AccessType_NON_3_GPP_ACCESS, ranUe.Location)
+			ranUe.AmfUe.SetAccessTai(models.AccessType_NON_3_GPP_ACCESS, *ranUe.Location.N3gaLocation.N3gppTai)
 		}
 	case ngapType.UserLocationInformationPresentNothing:
 	}
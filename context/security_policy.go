@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"reflect"
+
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/security"
+	"github.com/omec-project/openapi/models"
+)
+
+// SecurityPolicy restricts the NAS security algorithms of the UEs of a PLMN, or of the UEs
+// which are allowed to use a slice, to the listed ones
+type SecurityPolicy struct {
+	PlmnId        *models.PlmnId
+	Snssai        *models.Snssai
+	IntegrityAlgs []uint8 // slice of security.AlgIntegrityXXX, all are allowed if empty
+	CipheringAlgs []uint8 // slice of security.AlgCipheringXXX, all are allowed if empty
+}
+
+// appliesTo reports whether the policy applies to the UE, the policy of a slice applies if the slice is
+// allowed to the UE, or requested by the UE or subscribed while its Allowed NSSAI is not known yet
+func (policy *SecurityPolicy) appliesTo(ue *AmfUe) bool {
+	if policy.PlmnId != nil && *policy.PlmnId != ue.PlmnId {
+		return false
+	}
+	if policy.Snssai != nil {
+		for _, snssai := range ue.securityPolicySlices() {
+			if reflect.DeepEqual(snssai, *policy.Snssai) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// securityPolicySlices returns the slices the slice policies are checked against: the Allowed NSSAI once
+// it is known, the security mode control of a registration runs before, with the Requested NSSAI or,
+// without one, the subscribed S-NSSAIs
+func (ue *AmfUe) securityPolicySlices() (slices []models.Snssai) {
+	for _, allowedNssai := range ue.AllowedNssai {
+		for _, allowedSnssai := range allowedNssai {
+			if allowedSnssai.AllowedSnssai != nil {
+				slices = append(slices, *allowedSnssai.AllowedSnssai)
+			}
+		}
+	}
+	if len(slices) > 0 {
+		return slices
+	}
+
+	if ue.RegistrationRequest != nil && ue.RegistrationRequest.RequestedNSSAI != nil {
+		requestedNssai, err := nasConvert.RequestedNssaiToModels(ue.RegistrationRequest.RequestedNSSAI)
+		if err != nil {
+			logger.ContextLog.Warnf("Decode Requested NSSAI error: %+v", err)
+		}
+		for _, requestedSnssai := range requestedNssai {
+			if requestedSnssai.ServingSnssai != nil {
+				slices = append(slices, *requestedSnssai.ServingSnssai)
+			}
+		}
+		if len(slices) > 0 {
+			return slices
+		}
+	}
+
+	for _, subscribedSnssai := range ue.SubscribedNssai {
+		if subscribedSnssai.SubscribedSnssai != nil {
+			slices = append(slices, *subscribedSnssai.SubscribedSnssai)
+		}
+	}
+	return slices
+}
+
+// SecurityAlgOrders returns the integrity and ciphering algorithms the UE may negotiate in the order
+// of preference, the null integrity algorithm is only allowed for emergency services (TS 33.501 5.5.2)
+func (context *AMFContext) SecurityAlgOrders(ue *AmfUe) (intOrder, encOrder []uint8) {
+	emergency := ue.EmergencyRegistered ||
+		ue.RegistrationType5GS == nasMessage.RegistrationType5GSEmergencyRegistration
+	for _, intAlg := range context.SecurityAlgorithm.IntegrityOrder {
+		if intAlg == security.AlgIntegrity128NIA0 && !emergency {
+			continue
+		}
+		intOrder = append(intOrder, intAlg)
+	}
+	encOrder = append(encOrder, context.SecurityAlgorithm.CipheringOrder...)
+
+	for i := range context.SecurityAlgorithm.Policies {
+		policy := &context.SecurityAlgorithm.Policies[i]
+		if !policy.appliesTo(ue) {
+			continue
+		}
+		if len(policy.IntegrityAlgs) > 0 {
+			intOrder = filterAlgs(intOrder, policy.IntegrityAlgs)
+		}
+		if len(policy.CipheringAlgs) > 0 {
+			encOrder = filterAlgs(encOrder, policy.CipheringAlgs)
+		}
+	}
+	return intOrder, encOrder
+}
+
+// SecurityAlgAllowed reports whether the NAS security algorithms in use by the UE comply with
+// the security policy
+func (context *AMFContext) SecurityAlgAllowed(ue *AmfUe) bool {
+	intOrder, encOrder := context.SecurityAlgOrders(ue)
+	return algIncluded(intOrder, ue.IntegrityAlg) && algIncluded(encOrder, ue.CipheringAlg)
+}
+
+func filterAlgs(order, allowed []uint8) (filtered []uint8) {
+	for _, alg := range order {
+		if algIncluded(allowed, alg) {
+			filtered = append(filtered, alg)
+		}
+	}
+	return filtered
+}
+
+func algIncluded(algs []uint8, alg uint8) bool {
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+func IntegrityAlgToString(alg uint8) string {
+	switch alg {
+	case security.AlgIntegrity128NIA0:
+		return "NIA0"
+	case security.AlgIntegrity128NIA1:
+		return "NIA1"
+	case security.AlgIntegrity128NIA2:
+		return "NIA2"
+	case security.AlgIntegrity128NIA3:
+		return "NIA3"
+	}
+	return "unknown"
+}
+
+func CipheringAlgToString(alg uint8) string {
+	switch alg {
+	case security.AlgCiphering128NEA0:
+		return "NEA0"
+	case security.AlgCiphering128NEA1:
+		return "NEA1"
+	case security.AlgCiphering128NEA2:
+		return "NEA2"
+	case security.AlgCiphering128NEA3:
+		return "NEA3"
+	}
+	return "unknown"
+}
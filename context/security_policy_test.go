@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/nasType"
+	"github.com/omec-project/nas/security"
+	"github.com/omec-project/openapi/models"
+)
+
+func TestSecurityAlgOrders(t *testing.T) {
+	plmnId := models.PlmnId{Mcc: "208", Mnc: "93"}
+	otherPlmnId := models.PlmnId{Mcc: "208", Mnc: "01"}
+	snssai := models.Snssai{Sst: 1, Sd: "010203"}
+	otherSnssai := models.Snssai{Sst: 1, Sd: "112233"}
+
+	amfContext := &AMFContext{
+		SecurityAlgorithm: SecurityAlgorithm{
+			IntegrityOrder: []uint8{security.AlgIntegrity128NIA2, security.AlgIntegrity128NIA1,
+				security.AlgIntegrity128NIA0},
+			CipheringOrder: []uint8{security.AlgCiphering128NEA0, security.AlgCiphering128NEA2,
+				security.AlgCiphering128NEA1},
+			Policies: []SecurityPolicy{
+				{
+					PlmnId:        &otherPlmnId,
+					IntegrityAlgs: []uint8{security.AlgIntegrity128NIA1},
+				},
+				{
+					Snssai:        &snssai,
+					CipheringAlgs: []uint8{security.AlgCiphering128NEA2},
+				},
+			},
+		},
+	}
+
+	// the Requested NSSAI is S-NSSAI(SST: 1, SD: 010203)
+	registrationRequest := nasMessage.NewRegistrationRequest(0)
+	registrationRequest.RequestedNSSAI = nasType.NewRequestedNSSAI(nasMessage.RegistrationRequestRequestedNSSAIType)
+	registrationRequest.RequestedNSSAI.SetLen(5)
+	registrationRequest.RequestedNSSAI.SetSNSSAIValue([]uint8{0x04, 0x01, 0x01, 0x02, 0x03})
+
+	testCases := []struct {
+		description string
+		ue          *AmfUe
+		intOrder    []uint8
+		encOrder    []uint8
+	}{
+		{
+			description: "null integrity is not allowed without emergency services",
+			ue:          &AmfUe{PlmnId: plmnId},
+			intOrder:    []uint8{security.AlgIntegrity128NIA2, security.AlgIntegrity128NIA1},
+			encOrder: []uint8{security.AlgCiphering128NEA0, security.AlgCiphering128NEA2,
+				security.AlgCiphering128NEA1},
+		},
+		{
+			description: "null integrity is allowed for an emergency registration",
+			ue: &AmfUe{
+				PlmnId:              plmnId,
+				RegistrationType5GS: nasMessage.RegistrationType5GSEmergencyRegistration,
+			},
+			intOrder: []uint8{security.AlgIntegrity128NIA2, security.AlgIntegrity128NIA1,
+				security.AlgIntegrity128NIA0},
+			encOrder: []uint8{security.AlgCiphering128NEA0, security.AlgCiphering128NEA2,
+				security.AlgCiphering128NEA1},
+		},
+		{
+			description: "policy of the PLMN",
+			ue:          &AmfUe{PlmnId: otherPlmnId},
+			intOrder:    []uint8{security.AlgIntegrity128NIA1},
+			encOrder: []uint8{security.AlgCiphering128NEA0, security.AlgCiphering128NEA2,
+				security.AlgCiphering128NEA1},
+		},
+		{
+			description: "policy of an allowed slice",
+			ue: &AmfUe{
+				PlmnId: plmnId,
+				AllowedNssai: map[models.AccessType][]models.AllowedSnssai{
+					models.AccessType__3_GPP_ACCESS: {{AllowedSnssai: &snssai}},
+				},
+			},
+			intOrder: []uint8{security.AlgIntegrity128NIA2, security.AlgIntegrity128NIA1},
+			encOrder: []uint8{security.AlgCiphering128NEA2},
+		},
+		{
+			description: "policy of a requested slice before the Allowed NSSAI is known",
+			ue:          &AmfUe{PlmnId: plmnId, RegistrationRequest: registrationRequest},
+			intOrder:    []uint8{security.AlgIntegrity128NIA2, security.AlgIntegrity128NIA1},
+			encOrder:    []uint8{security.AlgCiphering128NEA2},
+		},
+		{
+			description: "policy of a subscribed slice without Requested NSSAI",
+			ue: &AmfUe{
+				PlmnId:          plmnId,
+				SubscribedNssai: []models.SubscribedSnssai{{SubscribedSnssai: &snssai}},
+			},
+			intOrder: []uint8{security.AlgIntegrity128NIA2, security.AlgIntegrity128NIA1},
+			encOrder: []uint8{security.AlgCiphering128NEA2},
+		},
+		{
+			description: "policy of a slice which is not allowed",
+			ue: &AmfUe{
+				PlmnId: plmnId,
+				AllowedNssai: map[models.AccessType][]models.AllowedSnssai{
+					models.AccessType__3_GPP_ACCESS: {{AllowedSnssai: &otherSnssai}},
+				},
+				SubscribedNssai: []models.SubscribedSnssai{{SubscribedSnssai: &snssai}},
+			},
+			intOrder: []uint8{security.AlgIntegrity128NIA2, security.AlgIntegrity128NIA1},
+			encOrder: []uint8{security.AlgCiphering128NEA0, security.AlgCiphering128NEA2,
+				security.AlgCiphering128NEA1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			intOrder, encOrder := amfContext.SecurityAlgOrders(tc.ue)
+			if !reflect.DeepEqual(intOrder, tc.intOrder) {
+				t.Errorf("Integrity order, want: %v, got: %v", tc.intOrder, intOrder)
+			}
+			if !reflect.DeepEqual(encOrder, tc.encOrder) {
+				t.Errorf("Ciphering order, want: %v, got: %v", tc.encOrder, encOrder)
+			}
+		})
+	}
+}
@@ -45,7 +45,11 @@ func (tx *EventChannel) Start() {
 			case NgapMsg:
 				tx.NgapHandler(tx.AmfUe, msg.(NgapMsg))
 			case SbiMsg:
-				p_1, p_2, p_3, p_4 := tx.SbiHandler(msg.(SbiMsg).UeContextId, msg.(SbiMsg).ReqUri, msg.(SbiMsg).Msg)
+				handler := tx.SbiHandler
+				if msg.(SbiMsg).Handler != nil {
+					handler = msg.(SbiMsg).Handler
+				}
+				p_1, p_2, p_3, p_4 := handler(msg.(SbiMsg).UeContextId, msg.(SbiMsg).ReqUri, msg.(SbiMsg).Msg)
 				res := SbiResponseMsg{
 					RespData:       p_1,
 					LocationHeader: p_2,
@@ -68,3 +72,35 @@ func (tx *EventChannel) Start() {
 func (tx *EventChannel) SubmitMessage(msg interface{}) {
 	tx.Message <- msg
 }
+
+// RanEventChannel serializes the NGAP messages of one RAN which are not bound to
+// an AmfUe, e.g. NG Setup, NG Reset or RAN Configuration Update
+type RanEventChannel struct {
+	Message     chan NgapMsg
+	Quit        chan struct{} // closed when the RAN is removed
+	Ran         *AmfRan
+	NgapHandler func(*AmfRan, NgapMsg)
+}
+
+func (tx *RanEventChannel) Start() {
+	for {
+		select {
+		case msg := <-tx.Message:
+			tx.NgapHandler(tx.Ran, msg)
+		case <-tx.Quit:
+			tx.Ran.Log.Infof("closed ran goroutine")
+			return
+		}
+	}
+}
+
+// SubmitMessage queues msg to the RAN worker, it returns false if the worker has
+// quit instead of blocking on its full queue
+func (tx *RanEventChannel) SubmitMessage(msg NgapMsg) bool {
+	select {
+	case tx.Message <- msg:
+		return true
+	case <-tx.Quit:
+		return false
+	}
+}
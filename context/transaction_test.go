@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package context
+
+import (
+	"testing"
+
+	"github.com/omec-project/amf/logger"
+)
+
+func TestEventChannelSbiMessageHandler(t *testing.T) {
+	ue := &AmfUe{Supi: "imsi-208930000007510", TxLog: logger.ContextLog}
+	ue.SetEventChannel(nil)
+	defer func() { ue.EventChannel.Event <- "quit" }()
+
+	handler := func(name string) func(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
+		return func(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
+			return name, "", nil, nil
+		}
+	}
+	ue.EventChannel.UpdateSbiHandler(handler("request"))
+
+	testCases := []struct {
+		description string
+		handler     func(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{})
+		handledBy   string
+	}{
+		{description: "handler of the event channel", handledBy: "request"},
+		{description: "handler of the message", handler: handler("timer"), handledBy: "timer"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			sbiMsg := SbiMsg{
+				UeContextId: ue.Supi,
+				Handler:     tc.handler,
+				Result:      make(chan SbiResponseMsg, 1),
+			}
+			ue.EventChannel.SubmitMessage(sbiMsg)
+			if res := <-sbiMsg.Result; res.RespData != tc.handledBy {
+				t.Errorf("Handled by, want: %s, got: %v", tc.handledBy, res.RespData)
+			}
+		})
+	}
+
+	// the handler carried by a message does not replace the one of the event channel
+	sbiMsg := SbiMsg{UeContextId: ue.Supi, Result: make(chan SbiResponseMsg, 1)}
+	ue.EventChannel.SubmitMessage(sbiMsg)
+	if res := <-sbiMsg.Result; res.RespData != "request" {
+		t.Errorf("SbiHandler of the event channel is replaced by: %v", res.RespData)
+	}
+}
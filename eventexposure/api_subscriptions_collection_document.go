@@ -15,6 +15,7 @@
 package eventexposure
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -56,7 +57,23 @@ func HTTPCreateSubscription(c *gin.Context) {
 		return
 	}
 
-	req := http_wrapper.NewRequest(c.Request, createEventSubscription)
+	eventSnssais, err := eventAreaSnssais(requestBody)
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.EeLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, producer.AmfCreateEventSubscriptionRequest{
+		CreateEventSubscription: createEventSubscription,
+		EventSnssais:            eventSnssais,
+	})
 
 	rsp := producer.HandleCreateAMFEventSubscription(req)
 
@@ -73,3 +90,30 @@ func HTTPCreateSubscription(c *gin.Context) {
 		c.Data(rsp.Status, "application/json", responseBody)
 	}
 }
+
+// eventAreaSnssais decodes the S-NSSAIs of the areas of interest of each event type (TS 29.518 6.2.6.2.16),
+// the slice filter of the events
+func eventAreaSnssais(requestBody []byte) (map[models.AmfEventType][]models.Snssai, error) {
+	var body struct {
+		Subscription struct {
+			EventList []struct {
+				Type     models.AmfEventType `json:"type"`
+				AreaList []struct {
+					SNssai *models.Snssai `json:"sNssai,omitempty"`
+				} `json:"areaList,omitempty"`
+			} `json:"eventList"`
+		} `json:"subscription"`
+	}
+	if err := json.Unmarshal(requestBody, &body); err != nil {
+		return nil, err
+	}
+	eventSnssais := make(map[models.AmfEventType][]models.Snssai)
+	for _, event := range body.Subscription.EventList {
+		for _, area := range event.AreaList {
+			if area.SNssai != nil {
+				eventSnssais[event.Type] = append(eventSnssais[event.Type], *area.SNssai)
+			}
+		}
+	}
+	return eventSnssais, nil
+}
@@ -38,6 +38,11 @@ const (
 	AMF_DEFAULT_NRFURI   = "https://127.0.0.10:8000"
 )
 
+const (
+	DefaultSctpNumOutStreams uint16 = 3
+	DefaultSctpMaxInStreams  uint16 = 5
+)
+
 type Mongodb struct {
 	Name string `yaml:"name"`
 	Url  string `yaml:"url"`
@@ -56,6 +61,14 @@ type Configuration struct {
 	NgapIpList                      []string                  `yaml:"ngapIpList,omitempty"`
 	NgapPort                        int                       `yaml:"ngappPort,omitempty"`
 	SctpGrpcPort                    int                       `yaml:"sctpGrpcPort,omitempty"`
+	NgapWorkerPoolSize              int                       `yaml:"ngapWorkerPoolSize,omitempty"`
+	Sctp                            *Sctp                     `yaml:"sctp,omitempty"`
+	Shutdown                        *Shutdown                 `yaml:"shutdown,omitempty"`
+	Overload                        *Overload                 `yaml:"overload,omitempty"`
+	Capture                         *Capture                  `yaml:"capture,omitempty"`
+	Emergency                       *Emergency                `yaml:"emergency,omitempty"`
+	GutiReallocation                *GutiReallocation         `yaml:"gutiReallocation,omitempty"`
+	Non3gppTai                      *models.Tai               `yaml:"non3gppTai,omitempty"`
 	Sbi                             *Sbi                      `yaml:"sbi,omitempty"`
 	NetworkFeatureSupport5GS        *NetworkFeatureSupport5GS `yaml:"networkFeatureSupport5GS,omitempty"`
 	ServiceNameList                 []string                  `yaml:"serviceNameList,omitempty"`
@@ -69,11 +82,14 @@ type Configuration struct {
 	T3502Value                      int                       `yaml:"t3502Value,omitempty"`
 	T3512Value                      int                       `yaml:"t3512Value,omitempty"`
 	Non3gppDeregistrationTimerValue int                       `yaml:"non3gppDeregistrationTimerValue,omitempty"`
+	MobileReachableTimerValue       int                       `yaml:"mobileReachableTimerValue,omitempty"`
+	ImplicitDeregTimerValue         int                       `yaml:"implicitDeregTimerValue,omitempty"`
 	T3513                           TimerValue                `yaml:"t3513"`
 	T3522                           TimerValue                `yaml:"t3522"`
 	T3550                           TimerValue                `yaml:"t3550"`
 	T3560                           TimerValue                `yaml:"t3560"`
 	T3565                           TimerValue                `yaml:"t3565"`
+	T3555                           TimerValue                `yaml:"t3555"`
 
 	//Maintain TaiList per slice
 	SliceTaiList     map[string][]models.Tai `yaml:"sliceTaiList,omitempty"`
@@ -97,15 +113,20 @@ func (c *Configuration) Get5gsNwFeatSuppImsVoPS() uint8 {
 	return 0
 }
 
+// EMC, EMF and EMCN3 are only advertised when emergency services are enabled
 func (c *Configuration) Get5gsNwFeatSuppEmc() uint8 {
-	if c.NetworkFeatureSupport5GS != nil {
+	if !c.EmergencyEnabled() {
+		return 0
+	}
+	if c.NetworkFeatureSupport5GS != nil && c.NetworkFeatureSupport5GS.Emc != 0 {
 		return c.NetworkFeatureSupport5GS.Emc
 	}
-	return 0
+	// emergency services supported in NR connected to 5GCN only
+	return 1
 }
 
 func (c *Configuration) Get5gsNwFeatSuppEmf() uint8 {
-	if c.NetworkFeatureSupport5GS != nil {
+	if c.NetworkFeatureSupport5GS != nil && c.EmergencyEnabled() {
 		return c.NetworkFeatureSupport5GS.Emf
 	}
 	return 0
@@ -126,7 +147,7 @@ func (c *Configuration) Get5gsNwFeatSuppMpsi() uint8 {
 }
 
 func (c *Configuration) Get5gsNwFeatSuppEmcN3() uint8 {
-	if c.NetworkFeatureSupport5GS != nil {
+	if c.NetworkFeatureSupport5GS != nil && c.EmergencyEnabled() {
 		return c.NetworkFeatureSupport5GS.EmcN3
 	}
 	return 0
@@ -157,9 +178,84 @@ type Sbi struct {
 	Port         int    `yaml:"port,omitempty"`
 }
 
+// Graceful shutdown: RANs and AMF status subscribers are told that the served GUAMIs
+// become unavailable, then the AMF waits GracePeriod (seconds) for UEs to move to
+// BackupAmfName before N2 is closed
+type Shutdown struct {
+	GracePeriod   int    `yaml:"gracePeriod,omitempty"`
+	BackupAmfName string `yaml:"backupAmfName,omitempty"`
+}
+
+// NGAP overload control (TS 23.501 5.19.5.2), a threshold set to 0 is not checked.
+// Overload Start is sent to all RANs when one threshold is exceeded, Overload Stop
+// when all of them are below again
+type Overload struct {
+	CheckInterval        int             `yaml:"checkInterval,omitempty"` // seconds
+	QueueDepth           int             `yaml:"queueDepth,omitempty"`    // queued messages of all UEs and RANs
+	Goroutines           int             `yaml:"goroutines,omitempty"`
+	SbiLatency           int             `yaml:"sbiLatency,omitempty"` // milliseconds
+	TrafficLoadReduction int64           `yaml:"trafficLoadReduction,omitempty"`
+	SNssaiList           []models.Snssai `yaml:"snssaiList,omitempty"` // overloaded slices, all if empty
+}
+
+// Files of the NGAP capture started via OAM, the oldest file is removed when
+// more than MaxFiles files of MaxFileSize (MB) were written
+type Capture struct {
+	Dir         string `yaml:"dir,omitempty"`
+	MaxFileSize int    `yaml:"maxFileSize,omitempty"`
+	MaxFiles    int    `yaml:"maxFiles,omitempty"`
+}
+
+// Emergency services (TS 23.501 5.16.4): emergency PDU sessions use Dnn on Snssai
+// and are served by SmfUri, or by an SMF discovered from the NRF if it is empty.
+// AllowUnauthenticated accepts emergency registration of UEs identified by IMEI only
+type Emergency struct {
+	Enable               bool          `yaml:"enable,omitempty"`
+	AllowUnauthenticated bool          `yaml:"allowUnauthenticated,omitempty"`
+	Snssai               models.Snssai `yaml:"snssai,omitempty"`
+	Dnn                  string        `yaml:"dnn,omitempty"`
+	SmfUri               string        `yaml:"smfUri,omitempty"`
+}
+
+func (c *Configuration) EmergencyEnabled() bool {
+	return c.Emergency != nil && c.Emergency.Enable
+}
+
+// GUTI reallocation policy (TS 33.501 6.12.3), a trigger set to 0/false is not used.
+// The new GUTI is sent in the Registration Accept, or in a Configuration Update Command
+// after a Service Request
+type GutiReallocation struct {
+	RegistrationCount      int  `yaml:"registrationCount,omitempty"`      // every N mobility/periodic registrations
+	ServiceRequestInterval int  `yaml:"serviceRequestInterval,omitempty"` // seconds since the GUTI was allocated
+	MobilityRegistration   bool `yaml:"mobilityRegistration,omitempty"`
+}
+
+// SCTP association parameters of the N2 interface, time values are in milliseconds
+type Sctp struct {
+	NumOutStreams      uint16 `yaml:"numOutStreams,omitempty"`
+	MaxInStreams       uint16 `yaml:"maxInStreams,omitempty"`
+	MaxInitRetransmits uint16 `yaml:"maxInitRetransmits,omitempty"`
+	MaxInitTimeout     uint16 `yaml:"maxInitTimeout,omitempty"`
+	RtoInitial         uint32 `yaml:"rtoInitial,omitempty"`
+	RtoMin             uint32 `yaml:"rtoMin,omitempty"`
+	RtoMax             uint32 `yaml:"rtoMax,omitempty"`
+	AssocMaxRetrans    uint16 `yaml:"assocMaxRetrans,omitempty"`
+	HeartbeatInterval  uint32 `yaml:"heartbeatInterval,omitempty"`
+	PathMaxRetrans     uint16 `yaml:"pathMaxRetrans,omitempty"`
+}
+
 type Security struct {
-	IntegrityOrder []string `yaml:"integrityOrder,omitempty"`
-	CipheringOrder []string `yaml:"cipheringOrder,omitempty"`
+	IntegrityOrder []string         `yaml:"integrityOrder,omitempty"`
+	CipheringOrder []string         `yaml:"cipheringOrder,omitempty"`
+	Policies       []SecurityPolicy `yaml:"policies,omitempty"`
+}
+
+// SecurityPolicy restricts the NAS security algorithms per PLMN and/or slice
+type SecurityPolicy struct {
+	PlmnId        *models.PlmnId `yaml:"plmnId,omitempty"`
+	Snssai        *models.Snssai `yaml:"snssai,omitempty"`
+	IntegrityAlgs []string       `yaml:"integrityAlgs,omitempty"`
+	CipheringAlgs []string       `yaml:"cipheringAlgs,omitempty"`
 }
 
 type PlmnSupportItem struct {
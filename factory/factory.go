@@ -98,6 +98,12 @@ func UpdateAmfConfig(f string) error {
 		if reflect.DeepEqual(AmfConfig.Configuration.Non3gppDeregistrationTimerValue, amfConfig.Configuration.Non3gppDeregistrationTimerValue) == false {
 			logger.CfgLog.Infoln("updated Non3gppDeregistrationTimerValue ", amfConfig.Configuration.Non3gppDeregistrationTimerValue)
 		}
+		if reflect.DeepEqual(AmfConfig.Configuration.MobileReachableTimerValue, amfConfig.Configuration.MobileReachableTimerValue) == false {
+			logger.CfgLog.Infoln("updated MobileReachableTimerValue ", amfConfig.Configuration.MobileReachableTimerValue)
+		}
+		if reflect.DeepEqual(AmfConfig.Configuration.ImplicitDeregTimerValue, amfConfig.Configuration.ImplicitDeregTimerValue) == false {
+			logger.CfgLog.Infoln("updated ImplicitDeregTimerValue ", amfConfig.Configuration.ImplicitDeregTimerValue)
+		}
 		if reflect.DeepEqual(AmfConfig.Configuration.T3513, amfConfig.Configuration.T3513) == false {
 			logger.CfgLog.Infoln("updated T3513 ", amfConfig.Configuration.T3513)
 		}
@@ -113,6 +119,9 @@ func UpdateAmfConfig(f string) error {
 		if reflect.DeepEqual(AmfConfig.Configuration.T3565, amfConfig.Configuration.T3565) == false {
 			logger.CfgLog.Infoln("updated T3565 ", amfConfig.Configuration.T3565)
 		}
+		if reflect.DeepEqual(AmfConfig.Configuration.T3555, amfConfig.Configuration.T3555) == false {
+			logger.CfgLog.Infoln("updated T3555 ", amfConfig.Configuration.T3555)
+		}
 
 		AmfConfig = amfConfig
 	}
@@ -131,3 +140,16 @@ func CheckConfigVersion() error {
 
 	return nil
 }
+
+// CheckOverloadConfig checks the NGAP overload control, the Traffic Load Reduction
+// Indication is a percentage in 1..99 (TS 38.413), 0 leaves it out
+func CheckOverloadConfig() error {
+	overload := AmfConfig.Configuration.Overload
+	if overload == nil {
+		return nil
+	}
+	if reduction := overload.TrafficLoadReduction; reduction < 0 || reduction > 99 {
+		return fmt.Errorf("overload trafficLoadReduction is [%d], but expected is in [1..99]", reduction)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package gmm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omec-project/amf/consumer"
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+func setEmergencyCfg(t *testing.T, cfg *factory.Emergency) {
+	self := context.AMF_Self()
+	emergencyCfg := self.EmergencyCfg
+	self.EmergencyCfg = cfg
+	t.Cleanup(func() { self.EmergencyCfg = emergencyCfg })
+}
+
+func TestUnauthenticatedEmergencyAllowed(t *testing.T) {
+	testCases := []struct {
+		description string
+		cfg         *factory.Emergency
+		regType     uint8
+		pei         string
+		allowed     bool
+	}{
+		{
+			description: "emergency registration with PEI",
+			cfg:         &factory.Emergency{Enable: true, AllowUnauthenticated: true},
+			regType:     nasMessage.RegistrationType5GSEmergencyRegistration,
+			pei:         "imei-01010000000001",
+			allowed:     true,
+		},
+		{
+			description: "emergency services are not configured",
+			regType:     nasMessage.RegistrationType5GSEmergencyRegistration,
+			pei:         "imei-01010000000001",
+		},
+		{
+			description: "emergency services are disabled",
+			cfg:         &factory.Emergency{AllowUnauthenticated: true},
+			regType:     nasMessage.RegistrationType5GSEmergencyRegistration,
+			pei:         "imei-01010000000001",
+		},
+		{
+			description: "unauthenticated UEs are not allowed",
+			cfg:         &factory.Emergency{Enable: true},
+			regType:     nasMessage.RegistrationType5GSEmergencyRegistration,
+			pei:         "imei-01010000000001",
+		},
+		{
+			description: "initial registration",
+			cfg:         &factory.Emergency{Enable: true, AllowUnauthenticated: true},
+			regType:     nasMessage.RegistrationType5GSInitialRegistration,
+			pei:         "imei-01010000000001",
+		},
+		{
+			description: "emergency registration without PEI",
+			cfg:         &factory.Emergency{Enable: true, AllowUnauthenticated: true},
+			regType:     nasMessage.RegistrationType5GSEmergencyRegistration,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			setEmergencyCfg(t, tc.cfg)
+			ue := &context.AmfUe{RegistrationType5GS: tc.regType, Pei: tc.pei}
+			if allowed := unauthenticatedEmergencyAllowed(ue); allowed != tc.allowed {
+				t.Errorf("want: %v, got: %v", tc.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestSelectEmergencySmf(t *testing.T) {
+	emergencySnssai := models.Snssai{Sst: 1, Sd: "010203"}
+	var searchedDnn string
+	nrf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searchedDnn = r.URL.Query().Get("dnn")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.SearchResult{
+			NfInstances: []models.NfProfile{{
+				NfInstanceId: "emergency-smf",
+				NfType:       models.NfType_SMF,
+				NfServices: &[]models.NfService{{
+					ServiceName:     models.ServiceName_NSMF_PDUSESSION,
+					NfServiceStatus: models.NfServiceStatus_REGISTERED,
+					ApiPrefix:       "http://emergency-smf:29502",
+				}},
+			}},
+		})
+	}))
+	defer nrf.Close()
+
+	self := context.AMF_Self()
+	nrfUri := self.NrfUri
+	self.NrfUri = nrf.URL
+	defer func() { self.NrfUri = nrfUri }()
+
+	ue := self.NewAmfUe("imsi-208930000007490")
+
+	t.Run("local SMF", func(t *testing.T) {
+		setEmergencyCfg(t, &factory.Emergency{Enable: true, Snssai: emergencySnssai, Dnn: "sos",
+			SmfUri: "http://local-smf:29502"})
+		searchedDnn = ""
+		smContext, _, err := consumer.SelectEmergencySmf(ue, models.AccessType__3_GPP_ACCESS, 1)
+		if err != nil {
+			t.Fatalf("SelectEmergencySmf: %v", err)
+		}
+		if smContext.SmfUri() != "http://local-smf:29502" || searchedDnn != "" {
+			t.Errorf("Local SMF is not selected, SMF: %s, NRF searched for: %s", smContext.SmfUri(), searchedDnn)
+		}
+		if smContext.Dnn() != "sos" || smContext.Snssai() != emergencySnssai {
+			t.Errorf("SM context is not for the emergency DNN: %s, %+v", smContext.Dnn(), smContext.Snssai())
+		}
+	})
+
+	t.Run("discovered SMF", func(t *testing.T) {
+		setEmergencyCfg(t, &factory.Emergency{Enable: true, Snssai: emergencySnssai, Dnn: "sos"})
+		smContext, _, err := consumer.SelectEmergencySmf(ue, models.AccessType__3_GPP_ACCESS, 1)
+		if err != nil {
+			t.Fatalf("SelectEmergencySmf: %v", err)
+		}
+		if searchedDnn != "sos" {
+			t.Errorf("NRF is searched for DNN %q", searchedDnn)
+		}
+		if smContext.SmfUri() != "http://emergency-smf:29502" || smContext.SmfID() != "emergency-smf" {
+			t.Errorf("Discovered SMF is not selected: %s", smContext.SmfUri())
+		}
+	})
+}
+
+func TestEstablishEmergencyPduSessionCreateFailure(t *testing.T) {
+	// the SMF does not answer
+	smf := httptest.NewServer(http.NotFoundHandler())
+	smf.Close()
+	setEmergencyCfg(t, &factory.Emergency{Enable: true, Snssai: models.Snssai{Sst: 1}, Dnn: "sos",
+		SmfUri: smf.URL})
+
+	conn := &ngaputil.TestConn{}
+	self := context.AMF_Self()
+	ran := self.NewAmfRan(conn)
+	defer ran.Remove()
+	ranUe, err := ran.NewRanUe(1)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	ue := self.NewAmfUe("imsi-208930000007491")
+	ue.AttachRanUe(ranUe)
+
+	smMessage := []byte{0x2e, 0x05, 0x01, 0xc1}
+	if err := establishEmergencyPduSession(ue, models.AccessType__3_GPP_ACCESS, 5, smMessage); err != nil {
+		t.Fatalf("establishEmergencyPduSession: %v", err)
+	}
+	if _, ok := ue.SmContextFindByPDUSessionID(5); ok {
+		t.Error("SM context is stored for a failed Create SM Context")
+	}
+
+	pdu, err := ngap.Decoder(conn.Data)
+	if err != nil || pdu.InitiatingMessage == nil || pdu.InitiatingMessage.Value.DownlinkNASTransport == nil {
+		t.Fatalf("No DownlinkNASTransport is sent: %v", err)
+	}
+	for _, ie := range pdu.InitiatingMessage.Value.DownlinkNASTransport.ProtocolIEs.List {
+		if ie.Id.Value != ngapType.ProtocolIEIDNASPDU {
+			continue
+		}
+		m := nas.NewMessage()
+		if err := m.PlainNasDecode(&ie.Value.NASPDU.Value); err != nil {
+			t.Fatalf("Failed to decode the NAS message: %v", err)
+		}
+		dlNasTransport := m.GmmMessage.DLNASTransport
+		if dlNasTransport == nil || dlNasTransport.Cause5GMM == nil ||
+			dlNasTransport.Cause5GMM.GetCauseValue() != nasMessage.Cause5GMMPayloadWasNotForwarded {
+			t.Errorf("5GSM message is not returned with cause payload was not forwarded")
+		}
+		return
+	}
+	t.Error("No NAS-PDU in the DownlinkNASTransport")
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package gmm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/openapi/models"
+)
+
+func TestGutiReallocationRequired(t *testing.T) {
+	self := context.AMF_Self()
+	gutiReallocationCfg := self.GutiReallocationCfg
+	defer func() { self.GutiReallocationCfg = gutiReallocationCfg }()
+
+	testCases := []struct {
+		description      string
+		cfg              *factory.GutiReallocation
+		serviceRequest   bool
+		registrationType uint8
+		allocatedSince   time.Duration
+		registrations    int
+		required         bool
+	}{
+		{
+			description:      "no reallocation policy",
+			registrationType: nasMessage.RegistrationType5GSMobilityRegistrationUpdating,
+		},
+		{
+			description:      "mobility registration",
+			cfg:              &factory.GutiReallocation{MobilityRegistration: true},
+			registrationType: nasMessage.RegistrationType5GSMobilityRegistrationUpdating,
+			required:         true,
+		},
+		{
+			description:      "periodic registration",
+			cfg:              &factory.GutiReallocation{MobilityRegistration: true},
+			registrationType: nasMessage.RegistrationType5GSPeriodicRegistrationUpdating,
+		},
+		{
+			description:      "registration count reached",
+			cfg:              &factory.GutiReallocation{RegistrationCount: 3},
+			registrationType: nasMessage.RegistrationType5GSPeriodicRegistrationUpdating,
+			registrations:    2,
+			required:         true,
+		},
+		{
+			description:      "registration count not reached",
+			cfg:              &factory.GutiReallocation{RegistrationCount: 3},
+			registrationType: nasMessage.RegistrationType5GSPeriodicRegistrationUpdating,
+			registrations:    1,
+		},
+		{
+			description:    "service request after the interval",
+			cfg:            &factory.GutiReallocation{ServiceRequestInterval: 60, RegistrationCount: 1},
+			serviceRequest: true,
+			allocatedSince: 2 * time.Minute,
+			required:       true,
+		},
+		{
+			description:    "service request within the interval",
+			cfg:            &factory.GutiReallocation{ServiceRequestInterval: 60, RegistrationCount: 1},
+			serviceRequest: true,
+			allocatedSince: 30 * time.Second,
+		},
+		{
+			description:    "service request without interval",
+			cfg:            &factory.GutiReallocation{RegistrationCount: 1},
+			serviceRequest: true,
+			allocatedSince: time.Hour,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			self.GutiReallocationCfg = tc.cfg
+			ue := &context.AmfUe{
+				RegistrationType5GS:              tc.registrationType,
+				GutiAllocationTime:               time.Now().Add(-tc.allocatedSince),
+				RegistrationsSinceGutiAllocation: tc.registrations,
+			}
+			if required := gutiReallocationRequired(ue, tc.serviceRequest); required != tc.required {
+				t.Errorf("GUTI reallocation required, want: %v, got: %v", tc.required, required)
+			}
+			// only the registrations are counted
+			wantRegistrations := tc.registrations
+			if !tc.serviceRequest && tc.cfg != nil {
+				wantRegistrations++
+			}
+			if ue.RegistrationsSinceGutiAllocation != wantRegistrations {
+				t.Errorf("Registrations since the GUTI allocation, want: %d, got: %d", wantRegistrations,
+					ue.RegistrationsSinceGutiAllocation)
+			}
+		})
+	}
+}
+
+func TestFreeOldGuti(t *testing.T) {
+	anType := models.AccessType__3_GPP_ACCESS
+	self := context.AMF_Self()
+
+	testCases := []struct {
+		description string
+		supi        string
+		// the acknowledgement of the new GUTI by the UE
+		acknowledge func(ue *context.AmfUe) error
+	}{
+		{
+			description: "Registration Complete",
+			supi:        "imsi-208930000007498",
+			acknowledge: func(ue *context.AmfUe) error {
+				ue.RegistrationRequest = nasMessage.NewRegistrationRequest(0)
+				// the UE is not in the GMM state where the registration completes, only the GUTI is checked
+				HandleRegistrationComplete(ue, anType, nasMessage.NewRegistrationComplete(0))
+				return nil
+			},
+		},
+		{
+			description: "Configuration Update Complete",
+			supi:        "imsi-208930000007499",
+			acknowledge: func(ue *context.AmfUe) error {
+				return HandleConfigurationUpdateComplete(ue, anType, nasMessage.NewConfigurationUpdateComplete(0))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ue, _ := newSliceUe(t, tc.supi, true)
+			oldGuti := ue.Guti
+			self.ReAllocateGutiToUe(ue)
+			newGuti := ue.Guti
+			if newGuti == oldGuti || ue.OldGuti != oldGuti {
+				t.Fatalf("GUTI is not reallocated, old: %s, new: %s", oldGuti, newGuti)
+			}
+
+			// the UE may still use the old GUTI until it acknowledges the new one
+			for _, guti := range []string{oldGuti, newGuti} {
+				if found, ok := self.AmfUeFindByGutiLocal(guti); !ok || found != ue {
+					t.Errorf("GUTI[%s] is not resolved before the acknowledgement", guti)
+				}
+			}
+
+			if err := tc.acknowledge(ue); err != nil {
+				t.Fatalf("Acknowledgement: %v", err)
+			}
+			if _, ok := self.AmfUeFindByGutiLocal(oldGuti); ok {
+				t.Errorf("Old GUTI[%s] is resolved after the acknowledgement", oldGuti)
+			}
+			if ue.OldGuti != "" || ue.OldTmsi != 0 {
+				t.Errorf("Old GUTI is kept, GUTI: %s, TMSI: %d", ue.OldGuti, ue.OldTmsi)
+			}
+			if found, ok := self.AmfUeFindByGutiLocal(newGuti); !ok || found != ue {
+				t.Errorf("New GUTI[%s] is not resolved", newGuti)
+			}
+		})
+	}
+}
@@ -24,7 +24,9 @@ import (
 
 	"github.com/omec-project/amf/consumer"
 	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
 	gmm_message "github.com/omec-project/amf/gmm/message"
+	"github.com/omec-project/amf/metrics"
 	ngap_message "github.com/omec-project/amf/ngap/message"
 	"github.com/omec-project/amf/producer/callback"
 	"github.com/omec-project/amf/util"
@@ -55,19 +57,25 @@ func HandleULNASTransport(ue *context.AmfUe, anType models.AccessType,
 	case nasMessage.PayloadContainerTypeSMS:
 		return fmt.Errorf("PayloadContainerTypeSMS has not been implemented yet in UL NAS TRANSPORT")
 	case nasMessage.PayloadContainerTypeLPP:
-		return fmt.Errorf("PayloadContainerTypeLPP has not been implemented yet in UL NAS TRANSPORT")
+		ue.GmmLog.Infoln("AMF Transfer LPP To LMF")
+		callback.SendLcsN1MessageNotify(ue, ulNasTransport.PayloadContainer.GetPayloadContainerContents())
 	case nasMessage.PayloadContainerTypeSOR:
-		return fmt.Errorf("PayloadContainerTypeSOR has not been implemented yet in UL NAS TRANSPORT")
+		ue.GmmLog.Infoln("AMF Transfer SOR ACK To UDM")
+		return handleSorAck(ue, ulNasTransport.PayloadContainer.GetPayloadContainerContents())
 	case nasMessage.PayloadContainerTypeUEPolicy:
 		ue.GmmLog.Infoln("AMF Transfer UEPolicy To PCF")
 		callback.SendN1MessageNotify(ue, models.N1MessageClass_UPDP,
 			ulNasTransport.PayloadContainer.GetPayloadContainerContents(), nil)
 	case nasMessage.PayloadContainerTypeUEParameterUpdate:
 		ue.GmmLog.Infoln("AMF Transfer UEParameterUpdate To UDM")
+		if ue.UpuInfo == nil || !ue.UpuInfo.UpuAckInd {
+			return fmt.Errorf("no UE parameters update acknowledgement is expected")
+		}
 		upuMac, err := nasConvert.UpuAckToModels(ulNasTransport.PayloadContainer.GetPayloadContainerContents())
 		if err != nil {
 			return err
 		}
+		ue.UpuInfo = nil
 		err = consumer.PutUpuAck(ue, upuMac)
 		if err != nil {
 			return err
@@ -79,6 +87,25 @@ func HandleULNASTransport(ue *context.AmfUe, anType models.AccessType,
 	return nil
 }
 
+// handleSorAck forwards the SOR-MAC-IUE of the UE's acknowledgement (TS 24.501 9.11.3.51) to the UDM,
+// which verifies it against the XMAC-IUE (TS 33.501 6.14.2.1)
+func handleSorAck(ue *context.AmfUe, sorContainer []uint8) error {
+	if ue.SorInfo == nil || !ue.SorInfo.AckInd {
+		return fmt.Errorf("no Steering of Roaming acknowledgement is expected")
+	}
+	// SOR data type: acknowledgement, followed by the 16 octets SOR-MAC-IUE (TS 24.501 9.11.3.51)
+	if len(sorContainer) != 17 || sorContainer[0]&0x01 == 0 {
+		return fmt.Errorf("SOR transparent container is not an acknowledgement")
+	}
+	sorMacIue := hex.EncodeToString(sorContainer[1:17])
+	ue.SorInfo = nil
+	ue.GmmLog.Debugf("SorMacIue[%s] in SOR ACK", sorMacIue)
+	if err := consumer.PutSorAck(ue, sorMacIue); err != nil {
+		return fmt.Errorf("SOR-MAC-IUE is not accepted by the UDM: %+v", err)
+	}
+	return nil
+}
+
 func transport5GSMMessage(ue *context.AmfUe, anType models.AccessType,
 	ulNasTransport *nasMessage.ULNASTransport) error {
 	var pduSessionID int32
@@ -102,12 +129,27 @@ func transport5GSMMessage(ue *context.AmfUe, anType models.AccessType,
 		if requestType != nil {
 			switch requestType.GetRequestTypeValue() {
 			case nasMessage.ULNASTransportRequestTypeInitialEmergencyRequest:
-				fallthrough
+				if smContextExist {
+					// AMF releases context locally as this is duplicate pdu session
+					ue.SmContextList.Delete(pduSessionID)
+				}
+				return establishEmergencyPduSession(ue, anType, pduSessionID, smMessage)
 			case nasMessage.ULNASTransportRequestTypeExistingEmergencyPduSession:
-				ue.GmmLog.Warnf("Emergency PDU Session is not supported")
-				gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
-					smMessage, pduSessionID, nasMessage.Cause5GMMPayloadWasNotForwarded, nil, 0)
-				return nil
+				if !smContextExist || !context.AMF_Self().EmergencyEnabled() {
+					ue.GmmLog.Warnf("Emergency PDU Session[%d] does not exist", pduSessionID)
+					gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+						smMessage, pduSessionID, nasMessage.Cause5GMMPayloadWasNotForwarded, nil, 0)
+					return nil
+				}
+				return forward5GSMMessageToSMF(ue, anType, pduSessionID, smContext, smMessage)
+			case nasMessage.ULNASTransportRequestTypeInitialRequest:
+				// TS 24.501 5.4.5.2.5: an emergency registered UE only gets emergency PDU sessions
+				if ue.EmergencyRegistered {
+					ue.GmmLog.Warnf("Emergency registered UE requested a non emergency PDU Session[%d]", pduSessionID)
+					gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+						smMessage, pduSessionID, nasMessage.Cause5GMMPayloadWasNotForwarded, nil, 0)
+					return nil
+				}
 			}
 		}
 
@@ -173,6 +215,9 @@ func transport5GSMMessage(ue *context.AmfUe, anType models.AccessType,
 			// case ii) AMF has a PDU session routing context, and Request type is "existing PDU session"
 			case nasMessage.ULNASTransportRequestTypeExistingPduSession:
 				if ue.InAllowedNssai(smContext.Snssai(), anType) {
+					if smContext.AccessType() != anType {
+						return handoverPduSessionBetweenAccessType(ue, anType, pduSessionID, smContext, smMessage)
+					}
 					return forward5GSMMessageToSMF(ue, anType, pduSessionID, smContext, smMessage)
 				} else {
 					ue.GmmLog.Errorf("S-NSSAI[%v] is not allowed for access type[%s] (PDU Session ID: %d)",
@@ -287,6 +332,97 @@ func transport5GSMMessage(ue *context.AmfUe, anType models.AccessType,
 	return nil
 }
 
+// TS 23.502 4.9.2.3.2 and 4.9.2.4.2: the UE moves the PDU session to the access the PDU Session
+// Establishment Request was sent on, the SMF moves the user plane and the N2 resources are set up
+// on the target access
+func handoverPduSessionBetweenAccessType(ue *context.AmfUe, anType models.AccessType, pduSessionID int32,
+	smContext *context.SmContext, smMessage []byte) error {
+	ue.GmmLog.Infof("Move PDU Session[%d] from %s to %s", pduSessionID, smContext.AccessType(), anType)
+
+	response, errResponse, problemDetail, err :=
+		consumer.SendUpdateSmContextHandoverBetweenAccessType(ue, smContext, anType, smMessage)
+	if err != nil {
+		return err
+	} else if problemDetail != nil {
+		return fmt.Errorf("Failed to move PDU Session[%d] to %s, Error[%v]", pduSessionID, anType, problemDetail)
+	} else if errResponse != nil {
+		ue.GmmLog.Warnf("PDU Session[%d] handover between access types is rejected by SMF", pduSessionID)
+		if errResponse.BinaryDataN1SmMessage != nil {
+			gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+				errResponse.BinaryDataN1SmMessage, pduSessionID, 0, nil, 0)
+		}
+		return nil
+	}
+
+	smContext.SetAccessType(anType)
+	smContext.SetUserLocation(deepcopy.Copy(ue.Location).(models.UserLocation))
+	ue.PublishUeCtxtInfo()
+
+	n1Msg := response.BinaryDataN1SmMessage
+	n2Info := response.BinaryDataN2SmInformation
+	if n2Info != nil && response.JsonData.N2SmInfoType == models.N2SmInfoType_PDU_RES_SETUP_REQ {
+		var nasPdu []byte
+		if n1Msg != nil {
+			nasPdu, err = gmm_message.BuildDLNASTransport(ue, anType, nasMessage.PayloadContainerTypeN1SMInfo, n1Msg,
+				uint8(pduSessionID), nil, nil, 0)
+			if err != nil {
+				return err
+			}
+		}
+		list := ngapType.PDUSessionResourceSetupListSUReq{}
+		ngap_message.AppendPDUSessionResourceSetupListSUReq(&list, pduSessionID, smContext.Snssai(), nasPdu, n2Info)
+		ngap_message.SendPDUSessionResourceSetupRequest(ue.RanUe[anType], nil, list)
+	} else if n1Msg != nil {
+		gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+			n1Msg, pduSessionID, 0, nil, 0)
+	}
+	return nil
+}
+
+// TS 23.502 4.3.2.2.1: the emergency PDU session is established with the configured emergency
+// DNN and S-NSSAI, whatever the UE requested
+func establishEmergencyPduSession(ue *context.AmfUe, anType models.AccessType, pduSessionID int32,
+	smMessage []byte) error {
+	if !context.AMF_Self().EmergencyEnabled() {
+		ue.GmmLog.Warnf("Emergency PDU Session is not supported")
+		gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+			smMessage, pduSessionID, nasMessage.Cause5GMMPayloadWasNotForwarded, nil, 0)
+		return nil
+	}
+
+	newSmContext, cause, err := consumer.SelectEmergencySmf(ue, anType, pduSessionID)
+	if err != nil {
+		ue.GmmLog.Errorf("Select emergency SMF failed: %+v", err)
+		gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+			smMessage, pduSessionID, cause, nil, 0)
+		return nil
+	}
+
+	requestType := models.RequestType_INITIAL_EMERGENCY_REQUEST
+	_, smContextRef, errResponse, problemDetail, err :=
+		consumer.SendCreateSmContextRequest(ue, newSmContext, &requestType, smMessage)
+	if err != nil || problemDetail != nil {
+		// the UE must not wait for an emergency PDU session which is never established
+		ue.GmmLog.Errorf("Create emergency smContext[pduSessionID: %d] failed, error[%v], problem[%v]",
+			pduSessionID, err, problemDetail)
+		gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+			smMessage, pduSessionID, nasMessage.Cause5GMMPayloadWasNotForwarded, nil, 0)
+		return nil
+	} else if errResponse != nil {
+		ue.GmmLog.Warnf("Emergency PDU Session Establishment Request is rejected by SMF[pduSessionId:%d]",
+			pduSessionID)
+		gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+			errResponse.BinaryDataN1SmMessage, pduSessionID, 0, nil, 0)
+		return nil
+	}
+	newSmContext.SetSmContextRef(smContextRef)
+	newSmContext.SetUserLocation(deepcopy.Copy(ue.Location).(models.UserLocation))
+	ue.StoreSmContext(pduSessionID, newSmContext)
+	ue.GmmLog.Infof("create emergency smContext[pduSessionID: %d] Success", pduSessionID)
+	ue.PublishUeCtxtInfo()
+	return nil
+}
+
 func forward5GSMMessageToSMF(
 	ue *context.AmfUe,
 	accessType models.AccessType,
@@ -338,7 +474,7 @@ func forward5GSMMessageToSMF(
 		n2SmInfo := response.BinaryDataN2SmInformation
 		if response.BinaryDataN1SmMessage != nil {
 			ue.GmmLog.Debug("Receive N1 SM Message from SMF")
-			n1Msg, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo,
+			n1Msg, err = gmm_message.BuildDLNASTransport(ue, accessType, nasMessage.PayloadContainerTypeN1SMInfo,
 				response.BinaryDataN1SmMessage, uint8(pduSessionID), nil, nil, 0)
 			if err != nil {
 				return err
@@ -384,6 +520,14 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 		return fmt.Errorf("RanUe is nil")
 	}
 
+	// the AMF is terminating: UEs of its unavailable GUAMIs are routed to the backup AMF by the RAN,
+	// a new UE is rejected with T3346 and registers through another AMF once it expires
+	if amfSelf.Draining() && procedureCode == ngapType.ProcedureCodeInitialUEMessage {
+		ue.GmmLog.Warnf("AMF is draining, reject the Registration Request")
+		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMCongestion, "")
+		return fmt.Errorf("Registration Reject[AMF is draining]")
+	}
+
 	// MacFailed is set if plain Registration Request message received with GUTI/SUCI or
 	// integrity protected Registration Reguest message received but mac verification Failed
 	if ue.MacFailed == true {
@@ -414,7 +558,7 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 		// TS 24.501 4.4.6: When the UE sends a REGISTRATION REQUEST or SERVICE REQUEST message that includes a NAS
 		// message container IE, the UE shall set the security header type of the initial NAS message to
 		// "integrity protected"; then the AMF shall decipher the value part of the NAS message container IE
-		err := security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.ULCount.Get(), security.Bearer3GPP,
+		err := security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.NasULCount(anType).Get(), context.NasBearer(anType),
 			security.DirectionUplink, contents)
 		if err != nil {
 			ue.SecurityContextAvailable = false
@@ -446,7 +590,11 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 	case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
 		ue.GmmLog.Debugf("RegistrationType: Periodic Registration Updating")
 	case nasMessage.RegistrationType5GSEmergencyRegistration:
-		return fmt.Errorf("Not Supportted RegistrationType: Emergency Registration")
+		ue.GmmLog.Debugf("RegistrationType: Emergency Registration")
+		if !amfSelf.EmergencyEnabled() {
+			gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMProtocolErrorUnspecified, "")
+			return fmt.Errorf("Registration Reject[Emergency services are not supported]")
+		}
 	case nasMessage.RegistrationType5GSReserved:
 		ue.RegistrationType5GS = nasMessage.RegistrationType5GSInitialRegistration
 		ue.GmmLog.Debugf("RegistrationType: Reserved")
@@ -471,12 +619,15 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 		ue.Guti = guti
 		ue.GmmLog.Debugf("GUTI: %s", guti)
 
-		servedGuami := amfSelf.ServedGuamiList[0]
-		if reflect.DeepEqual(guamiFromUeGuti, servedGuami) {
-			ue.ServingAmfChanged = false
-		} else {
-			ue.GmmLog.Debugf("Serving AMF has changed but 5G-Core is not supporting for now")
-			ue.ServingAmfChanged = false
+		ue.ServingAmfChanged = true
+		for _, servedGuami := range amfSelf.ServedGuamiList {
+			if reflect.DeepEqual(guamiFromUeGuti, servedGuami) {
+				ue.ServingAmfChanged = false
+				break
+			}
+		}
+		if ue.ServingAmfChanged {
+			ue.GmmLog.Infof("Serving AMF has changed, GUTI allocated by AMF[%+v]", guamiFromUeGuti)
 		}
 	case nasMessage.MobileIdentity5GSTypeImei:
 		imei := nasConvert.PeiToString(mobileIdentity5GSContents)
@@ -502,9 +653,17 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 		ue.NgKsi.Ksi = 0
 	}
 
+	// TS 33.501 6.4.3.1: the NAS COUNT is about to wrap around, a new K_AMF is established with a
+	// primary authentication identified by a new ngKSI
+	if ue.SecurityContextIsValid() && ue.NasCountNearWrap(anType) {
+		ue.GmmLog.Infof("NAS COUNT about to wrap around (UL: 0x%06x, DL: 0x%06x), run a primary authentication",
+			ue.NasULCount(anType).Get(), ue.NasDLCount(anType).Get())
+		ue.SecurityContextAvailable = false
+	}
+
 	// Copy UserLocation from ranUe
-	ue.Location = ue.RanUe[anType].Location
-	ue.Tai = ue.RanUe[anType].Tai
+	ue.SetAccessLocation(anType, ue.RanUe[anType].Location)
+	ue.SetAccessTai(anType, ue.RanUe[anType].Tai)
 
 	// Check TAI
 	taiList := make([]models.Tai, len(amfSelf.SupportTaiLists))
@@ -512,7 +671,10 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 	for i := range taiList {
 		taiList[i].Tac = util.TACConfigToModels(taiList[i].Tac)
 	}
-	if !context.InTaiList(ue.Tai, taiList) {
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		taiList = append(taiList, amfSelf.Non3gppTai())
+	}
+	if !context.InTaiList(ue.AccessTai(anType), taiList) {
 		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMTrackingAreaNotAllowed, "")
 		return fmt.Errorf("Registration Reject[Tracking area not allowed]")
 	}
@@ -523,50 +685,104 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMProtocolErrorUnspecified, "")
 		return fmt.Errorf("UESecurityCapability is nil")
 	}
-	// TODO (TS 23.502 4.2.2.2 step 4): if UE's 5g-GUTI is included & serving AMF has changed
+	// TS 23.502 4.2.2.2.2 step 4: if UE's 5g-GUTI is included & serving AMF has changed
 	// since last registration procedure, new AMF may invoke Namf_Communication_UEContextTransfer
 	// to old AMF, including the complete registration request nas msg, to request UE's SUPI & UE Context
 	if ue.ServingAmfChanged {
-		var transferReason models.TransferReason
-		switch ue.RegistrationType5GS {
-		case nasMessage.RegistrationType5GSInitialRegistration:
-			transferReason = models.TransferReason_INIT_REG
-		case nasMessage.RegistrationType5GSMobilityRegistrationUpdating:
-			fallthrough
-		case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
-			transferReason = models.TransferReason_MOBI_REG
-		}
+		transferUeContextFromOldAmf(ue, anType, guamiFromUeGuti)
+	}
+	return nil
+}
 
-		searchOpt := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
-			Guami: optional.NewInterface(util.MarshToJsonString(guamiFromUeGuti)),
-		}
-		err := consumer.SearchAmfCommunicationInstance(ue, amfSelf.NrfUri, models.NfType_AMF, models.NfType_AMF, &searchOpt)
-		if err != nil {
-			ue.GmmLog.Errorf("[GMM] %+v", err)
-			return err
-		}
+func transferUeContextFromOldAmf(ue *context.AmfUe, anType models.AccessType, guamiFromUeGuti models.Guami) {
+	amfSelf := context.AMF_Self()
 
-		ueContextTransferRspData, problemDetails, err := consumer.UEContextTransferRequest(ue, anType, transferReason)
-		if problemDetails != nil {
-			if problemDetails.Cause == "INTEGRITY_CHECK_FAIL" || problemDetails.Cause == "CONTEXT_NOT_FOUND" {
-				ue.GmmLog.Warnf("Can not retrieve UE Context from old AMF[Cause: %s]", problemDetails.Cause)
-			} else {
-				ue.GmmLog.Warnf("UE Context Transfer Request Failed Problem[%+v]", problemDetails)
-			}
-			ue.SecurityContextAvailable = false // need to start authentication procedure later
-		} else if err != nil {
-			ue.GmmLog.Errorf("UE Context Transfer Request Error[%+v]", err)
+	var transferReason models.TransferReason
+	switch ue.RegistrationType5GS {
+	case nasMessage.RegistrationType5GSEmergencyRegistration:
+		fallthrough
+	case nasMessage.RegistrationType5GSInitialRegistration:
+		transferReason = models.TransferReason_INIT_REG
+	case nasMessage.RegistrationType5GSMobilityRegistrationUpdating:
+		fallthrough
+	case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
+		transferReason = models.TransferReason_MOBI_REG
+	}
+
+	searchOpt := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
+		Guami: optional.NewInterface(util.MarshToJsonString(guamiFromUeGuti)),
+	}
+	err := consumer.SearchAmfCommunicationInstance(ue, amfSelf.NrfUri, models.NfType_AMF, models.NfType_AMF, &searchOpt)
+	if err != nil {
+		// the UE is identified and authenticated by this AMF instead
+		ue.GmmLog.Warnf("Can not select the old AMF: %+v", err)
+		ue.ServingAmfChanged = false
+		return
+	}
+
+	ueContextTransferRsp, problemDetails, err := consumer.UEContextTransferRequest(ue, anType, transferReason)
+	if problemDetails != nil {
+		if problemDetails.Cause == "INTEGRITY_CHECK_FAIL" || problemDetails.Cause == "CONTEXT_NOT_FOUND" {
+			ue.GmmLog.Warnf("Can not retrieve UE Context from old AMF[Cause: %s]", problemDetails.Cause)
 		} else {
-			ue.CopyDataFromUeContextModel(*ueContextTransferRspData.UeContext)
+			ue.GmmLog.Warnf("UE Context Transfer Request Failed Problem[%+v]", problemDetails)
 		}
+	} else if err != nil {
+		ue.GmmLog.Errorf("UE Context Transfer Request Error[%+v]", err)
+	} else if ueContextTransferRsp.JsonData == nil || ueContextTransferRsp.JsonData.UeContext == nil {
+		ue.GmmLog.Errorln("UE Context Transfer Response without UE Context")
+	} else {
+		ueContext := ueContextTransferRsp.JsonData.UeContext
+		ue.GmmLog.Infof("UE Context[SUPI: %s] transferred from old AMF", ueContext.Supi)
+		ue.CopyDataFromUeContextModel(*ueContext)
+		if len(ueContextTransferRsp.BinaryDataN2Information) > 0 {
+			ue.UeRadioCapability = string(ueContextTransferRsp.BinaryDataN2Information)
+		}
+		// the old AMF has validated the integrity of the Registration Request with its security context,
+		// which is taken over by this AMF (TS 33.501 6.9.3)
+		if ueContext.SeafData != nil && ue.Kamf != "" {
+			ue.SecurityContextAvailable = true
+			ue.MacFailed = false
+			ue.RetransmissionOfInitialNASMsg = false
+			ue.DerivateAlgKey()
+		}
+		return
+	}
+	// need to start authentication procedure later, the old AMF is still notified when
+	// the registration in this AMF is completed
+	ue.SecurityContextAvailable = false
+}
+
+// TS 23.502 4.2.2.2.2 step 10: the new AMF notifies the old AMF that the registration of the UE
+// in the new AMF is completed
+func sendRegistrationStatusUpdate(ue *context.AmfUe, toReleaseSessionList []int32) {
+	req := models.UeRegStatusUpdateReqData{
+		TransferStatus:       models.UeContextTransferStatus_TRANSFERRED,
+		ToReleaseSessionList: toReleaseSessionList,
+	}
+	// TODO: based on locol policy, decide if need to change serving PCF for UE
+	regStatusTransferComplete, problemDetails, err := consumer.RegistrationStatusUpdate(ue, req)
+	if problemDetails != nil {
+		ue.GmmLog.Errorf("Registration Status Update Failed Problem[%+v]", problemDetails)
+	} else if err != nil {
+		ue.GmmLog.Errorf("Registration Status Update Error[%+v]", err)
+	} else if regStatusTransferComplete {
+		ue.GmmLog.Infof("Registration Status Transfer complete")
 	}
-	return nil
 }
 
 func IdentityVerification(ue *context.AmfUe) bool {
 	return ue.Supi != "" || len(ue.Suci) != 0
 }
 
+// TS 33.501 10.2.2: if the local policy allows it, an emergency registration of a UE identified
+// by its PEI only is accepted without authentication
+func unauthenticatedEmergencyAllowed(ue *context.AmfUe) bool {
+	amfSelf := context.AMF_Self()
+	return ue.RegistrationType5GS == nasMessage.RegistrationType5GSEmergencyRegistration &&
+		amfSelf.EmergencyEnabled() && amfSelf.EmergencyCfg.AllowUnauthenticated && ue.Pei != ""
+}
+
 func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) error {
 	ue.GmmLog.Infoln("Handle InitialRegistration")
 
@@ -614,23 +830,9 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 	// TODO: Negotiate DRX value if need (TS 23.501 5.4.5)
 	negotiateDRXParameters(ue, ue.RegistrationRequest.RequestedDRXParameters)
 
-	// TODO (step 10 optional): send Namf_Communication_RegistrationCompleteNotify to old AMF if need
+	// step 10: send Namf_Communication_RegistrationCompleteNotify to old AMF
 	if ue.ServingAmfChanged {
-		// If the AMF has changed the new AMF notifies the old AMF that the registration of the UE in the new AMF is completed
-		req := models.UeRegStatusUpdateReqData{
-			TransferStatus: models.UeContextTransferStatus_TRANSFERRED,
-		}
-		// TODO: based on locol policy, decide if need to change serving PCF for UE
-		regStatusTransferComplete, problemDetails, err := consumer.RegistrationStatusUpdate(ue, req)
-		if problemDetails != nil {
-			ue.GmmLog.Errorf("Registration Status Update Failed Problem[%+v]", problemDetails)
-		} else if err != nil {
-			ue.GmmLog.Errorf("Registration Status Update Error[%+v]", err)
-		} else {
-			if regStatusTransferComplete {
-				ue.GmmLog.Infof("Registration Status Transfer complete")
-			}
-		}
+		sendRegistrationStatusUpdate(ue, nil)
 	}
 
 	// TODO: Not supporting IMEI check with EIR. please uncomment when we support EIR check
@@ -724,6 +926,11 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 		ue.Non3gppDeregistrationTimerValue = amfSelf.Non3gppDeregistrationTimerValue
 	}
 
+	sendInitialRegistrationAccept(ue, anType)
+	return nil
+}
+
+func sendInitialRegistrationAccept(ue *context.AmfUe, anType models.AccessType) {
 	if anType == models.AccessType__3_GPP_ACCESS {
 		gmm_message.SendRegistrationAccept(ue, anType, nil, nil, nil, nil, nil)
 	} else {
@@ -734,10 +941,70 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 		registrationAccept, err := gmm_message.BuildRegistrationAccept(ue, anType, nil, nil, nil, nil)
 		if err != nil {
 			ue.GmmLog.Errorf("Build Registration Accept: %+v", err)
-			return nil
+			return
 		}
 		ue.RegistrationAcceptForNon3GPPAccess = registrationAccept
 	}
+}
+
+// TS 23.502 4.2.2.2.2: emergency registration, the UE only gets the emergency S-NSSAI and
+// the AMF skips the UDM and PCF interactions if the SUPI is not authenticated
+func HandleEmergencyRegistration(ue *context.AmfUe, anType models.AccessType) error {
+	ue.GmmLog.Infoln("Handle EmergencyRegistration")
+
+	amfSelf := context.AMF_Self()
+
+	if anType == models.AccessType_NON_3_GPP_ACCESS && factory.AmfConfig.Configuration.Get5gsNwFeatSuppEmcN3() == 0 {
+		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMProtocolErrorUnspecified, "")
+		return fmt.Errorf("Emergency services are not supported over non-3GPP access")
+	}
+
+	ue.ClearRegistrationData()
+	ue.EmergencyRegistered = true
+
+	if !ue.UnauthenticatedSupi {
+		// update Kgnb/Kn3iwf
+		ue.UpdateSecurityContext(anType)
+	}
+
+	emergencySnssai := amfSelf.EmergencyCfg.Snssai
+	ue.AllowedNssai[anType] = []models.AllowedSnssai{{AllowedSnssai: &emergencySnssai}}
+
+	if ue.RegistrationRequest.Capability5GMM != nil {
+		ue.Capability5GMM = *ue.RegistrationRequest.Capability5GMM
+	}
+
+	storeLastVisitedRegisteredTAI(ue, ue.RegistrationRequest.LastVisitedRegisteredTAI)
+
+	negotiateDRXParameters(ue, ue.RegistrationRequest.RequestedDRXParameters)
+
+	if ue.ServingAmfChanged {
+		sendRegistrationStatusUpdate(ue, nil)
+	}
+
+	if ue.Supi != "" && !ue.UnauthenticatedSupi {
+		// the registration is accepted even if the subscription can not be retrieved
+		if err := communicateWithUDM(ue, anType); err != nil {
+			ue.GmmLog.Warnf("Emergency registration without subscription data: %+v", err)
+		}
+	}
+
+	amfSelf.AllocateRegistrationArea(ue, anType)
+	ue.GmmLog.Debugf("Use original GUTI[%s]", ue.Guti)
+
+	if ue.Supi != "" {
+		amfSelf.AddAmfUeToUePool(ue, ue.Supi)
+	} else {
+		amfSelf.AddAmfUeToUePoolByPei(ue, ue.Pei)
+	}
+	ue.T3502Value = amfSelf.T3502Value
+	if anType == models.AccessType__3_GPP_ACCESS {
+		ue.T3512Value = amfSelf.T3512Value
+	} else {
+		ue.Non3gppDeregistrationTimerValue = amfSelf.Non3gppDeregistrationTimerValue
+	}
+
+	sendInitialRegistrationAccept(ue, anType)
 	return nil
 }
 
@@ -781,10 +1048,11 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 	// TODO: Negotiate DRX value if need (TS 23.501 5.4.5)
 	negotiateDRXParameters(ue, ue.RegistrationRequest.RequestedDRXParameters)
 
-	// TODO (step 10 optional): send Namf_Communication_RegistrationCompleteNotify to old AMF if need
-	// if ue.ServingAmfChanged {
-	// 	If the AMF has changed the new AMF notifies the old AMF that the registration of the UE in the new AMF is completed
-	// }
+	// step 10: send Namf_Communication_RegistrationCompleteNotify to old AMF, the PDU sessions which
+	// can not be served by this AMF are released by the old AMF
+	if ue.ServingAmfChanged {
+		sendRegistrationStatusUpdate(ue, moveSmContextsToThisAmf(ue, anType))
+	}
 
 	if len(ue.Pei) == 0 {
 		gmm_message.SendIdentityRequest(ue.RanUe[anType], nasMessage.MobileIdentity5GSTypeImei)
@@ -986,7 +1254,7 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 				var err error
 				if n1Msg != nil {
 					pduSessionId := uint8(smInfo.PduSessionId)
-					nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo,
+					nasPdu, err = gmm_message.BuildDLNASTransport(ue, anType, nasMessage.PayloadContainerTypeN1SMInfo,
 						n1Msg, pduSessionId, nil, nil, 0)
 					if err != nil {
 						return err
@@ -1021,7 +1289,10 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 	amfSelf.AllocateRegistrationArea(ue, anType)
 	assignLadnInfo(ue, anType)
 
-	// TODO: GUTI reassignment if need (based on operator poilcy)
+	if gutiReallocationRequired(ue, false) {
+		amfSelf.ReAllocateGutiToUe(ue)
+		ue.GmmLog.Infof("Reallocate GUTI[%s]", ue.Guti)
+	}
 	// TODO: T3512/Non3GPP de-registration timer reassignment if need (based on operator policy)
 
 	if ue.RanUe[anType].UeContextRequest {
@@ -1481,7 +1752,7 @@ func HandleNotificationResponse(ue *context.AmfUe, notificationResponse *nasMess
 	return nil
 }
 
-func HandleConfigurationUpdateComplete(ue *context.AmfUe,
+func HandleConfigurationUpdateComplete(ue *context.AmfUe, anType models.AccessType,
 	configurationUpdateComplete *nasMessage.ConfigurationUpdateComplete) error {
 	ue.GmmLog.Info("Handle Configuration Update Complete")
 
@@ -1489,7 +1760,20 @@ func HandleConfigurationUpdateComplete(ue *context.AmfUe,
 		return fmt.Errorf("NAS message integrity check failed")
 	}
 
-	// TODO: Stop timer T3555 in TS 24.501 Figure 5.4.4.1.1 in handler
+	if ue.T3555 != nil {
+		ue.T3555.Stop()
+		ue.T3555 = nil // clear the timer
+	}
+	context.AMF_Self().FreeOldGuti(ue)
+
+	// TS 24.501 5.4.4.3: the NAS signalling connection is released so that the UE re-registers
+	registrationRequested := ue.ConfigurationUpdateIndication.GetRED() == 1
+	ue.ConfigurationUpdateIndication = nasType.ConfigurationUpdateIndication{}
+	if registrationRequested && ue.RanUe[anType] != nil {
+		ngap_message.SendUEContextReleaseCommand(ue.RanUe[anType], context.UeContextN2NormalRelease,
+			ngapType.CausePresentNas, ngapType.CauseNasPresentNormalRelease)
+	}
+
 	// TODO: Send acknowledgment by Nudm_SMD_Info_Service to UDM in handler
 	//		import "github.com/omec-project/openapi/Nudm_SubscriberDataManagement" client.Info
 
@@ -1506,6 +1790,10 @@ func AuthenticationProcedure(ue *context.AmfUe, accessType models.AccessType) (b
 			ue.GmmLog.Debugln("UE has a valid security context - skip the authentication procedure")
 			return true, nil
 		}
+	} else if unauthenticatedEmergencyAllowed(ue) {
+		ue.GmmLog.Infof("Emergency registration of PEI[%s] - skip the authentication procedure", ue.Pei)
+		ue.UnauthenticatedSupi = true
+		return true, nil
 	} else {
 		// Request UE's SUCI by sending identity request
 		gmm_message.SendIdentityRequest(ue.RanUe[accessType], nasMessage.MobileIdentity5GSTypeSuci)
@@ -1614,65 +1902,392 @@ func NetworkInitiatedDeregistrationProcedure(ue *context.AmfUe, accessType model
 	return err
 }
 
-//TODO: to be implemented
-func HandleUeSliceInfoDelete(ue *context.AmfUe, accessType models.AccessType, nssai models.Snssai) (err error) {
+// TS 24.501 5.3.7: while the UE is in CM-IDLE on 3GPP access the mobile reachable timer supervises the
+// periodic registration, when it expires the UE is unreachable and the implicit deregistration timer starts.
+// On non-3GPP access only the implicit deregistration timer runs
+func StartMobileReachableTimer(ue *context.AmfUe, anType models.AccessType) {
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		startImplicitDeregTimer(ue, anType)
+		return
+	}
 
-	//TODO send configuration update to update allowed nssai list with re-registration required to UE
-	//     so that pdu session sync up happen in registration procedure when UE triggers this procedure
-	//gmm_message.SendConfigurationUpdateCommand(ue, models.AccessType__3_GPP_ACCESS, nil)
+	value := context.AMF_Self().MobileReachableTimerValue
+	if value == 0 {
+		value = t3512Value(ue) + 240
+	}
+	ue.GmmLog.Infof("Start Mobile Reachable Timer[%ds]", value)
+	ue.StartMobileReachableTimer(anType, time.Duration(value)*time.Second, func() {
+		submitReachabilityTimerExpiry(ue, reachabilityTimerExpiry{anType: anType})
+	})
+}
+
+func startImplicitDeregTimer(ue *context.AmfUe, anType models.AccessType) {
+	var value int
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		value = ue.Non3gppDeregistrationTimerValue
+		if value == 0 {
+			value = context.DefaultNon3gppDeregistrationTimer
+		}
+		value += 240
+	} else {
+		value = context.AMF_Self().ImplicitDeregTimerValue
+		if value == 0 {
+			value = t3512Value(ue) + 240
+		}
+	}
+	ue.GmmLog.Infof("Start Implicit Deregistration Timer[%ds] for %s", value, anType)
+	ue.StartImplicitDeregTimer(anType, time.Duration(value)*time.Second, func() {
+		submitReachabilityTimerExpiry(ue, reachabilityTimerExpiry{anType: anType, implicitDeregistration: true})
+	})
+}
+
+// reachabilityTimerExpiry is handled in the event loop of the UE, like the NAS and NGAP messages of the UE
+type reachabilityTimerExpiry struct {
+	anType                 models.AccessType
+	implicitDeregistration bool
+	ue                     *context.AmfUe
+}
+
+func submitReachabilityTimerExpiry(ue *context.AmfUe, expiry reachabilityTimerExpiry) {
+	expiry.ue = ue
+	ue.SetEventChannel(nil)
+	ue.EventChannel.SubmitMessage(context.SbiMsg{
+		UeContextId: ue.Supi,
+		Msg:         expiry,
+		Handler:     ReachabilityTimerHandler,
+		Result:      make(chan context.SbiResponseMsg, 1),
+	})
+}
+
+func ReachabilityTimerHandler(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
+	expiry, ok := msg.(reachabilityTimerExpiry)
+	if !ok {
+		return nil, "", nil, nil
+	}
+	ue, anType := expiry.ue, expiry.anType
+	if ue.CmConnect(anType) {
+		// the UE connected again before the expiry was handled
+		return nil, "", nil, nil
+	}
+	if expiry.implicitDeregistration {
+		ue.GmmLog.Warnf("Implicit Deregistration Timer expired for %s", anType)
+		if err := ImplicitDeregistrationProcedure(ue, anType); err != nil {
+			ue.GmmLog.Errorln(err)
+		}
+	} else {
+		ue.GmmLog.Warnln("Mobile Reachable Timer expired, UE is not reachable")
+		setUeUnreachable(ue)
+		startImplicitDeregTimer(ue, anType)
+	}
+	return nil, "", nil, nil
+}
+
+func t3512Value(ue *context.AmfUe) int {
+	if ue.T3512Value != 0 {
+		return ue.T3512Value
+	}
+	return context.DefaultT3512
+}
+
+// the subscribers of REACHABILITY_REPORT are told that the UE can't be reached anymore
+func setUeUnreachable(ue *context.AmfUe) {
+	if ue.Reachability == models.UeReachability_UNREACHABLE {
+		return
+	}
+	ue.Reachability = models.UeReachability_UNREACHABLE
+	sendReachabilityReport(ue)
+}
+
+func sendReachabilityReport(ue *context.AmfUe) {
+	callback.SendAmfEventReport(ue, models.AmfEventReport{
+		Type:         models.AmfEventType_REACHABILITY_REPORT,
+		Reachability: ue.Reachability,
+	})
+}
+
+// TS 23.502 4.2.2.3.1: the UE is implicitly deregistered by the AMF without NAS signalling, its SM contexts
+// are released, the UDM registration is purged and the AM policy association is deleted with the last access
+func ImplicitDeregistrationProcedure(ue *context.AmfUe, anType models.AccessType) error {
+	if !ue.State[anType].Is(context.Registered) {
+		return nil
+	}
+	ue.GmmLog.Infof("Implicit Deregistration for %s", anType)
+
+	otherAnType := models.AccessType_NON_3_GPP_ACCESS
+	if anType == models.AccessType_NON_3_GPP_ACCESS {
+		otherAnType = models.AccessType__3_GPP_ACCESS
+	}
+	if ue.CmIdle(otherAnType) {
+		setUeUnreachable(ue)
+	}
 
-	//we are doing local cleanup for now, below code will be deprecated when we support
-	// Configuration Update
 	ue.SmContextList.Range(func(key, value interface{}) bool {
 		smContext := value.(*context.SmContext)
-		if smContext.Snssai().Sst == int32(nssai.Sst) && smContext.Snssai().Sd == nssai.Sd {
-			logger.GmmLog.Infof("Deleted Slice [sst: %v, sd: %v]matched with smcontext, sending Release SMContext Request to SMF",
-				smContext.Snssai().Sst, smContext.Snssai().Sd)
-			//send smcontext release request
+
+		if smContext.AccessType() == anType {
 			problemDetail, err := consumer.SendReleaseSmContextRequest(ue, smContext, nil, "", nil)
 			if problemDetail != nil {
 				ue.GmmLog.Errorf("Release SmContext Failed Problem[%+v]", problemDetail)
 			} else if err != nil {
 				ue.GmmLog.Errorf("Release SmContext Error[%v]", err.Error())
 			}
+		}
+		return true
+	})
 
+	// an unauthenticated emergency UE has not been registered in the UDM
+	if !ue.UnauthenticatedSupi && ue.NudmUECMUri != "" {
+		problemDetails, err := consumer.UeCmDeregistration(ue, anType)
+		if problemDetails != nil {
+			ue.GmmLog.Errorf("UECM Deregistration Failed Problem[%+v]", problemDetails)
+		} else if err != nil {
+			ue.GmmLog.Errorf("UECM Deregistration Error[%v]", err.Error())
+		}
+	}
+
+	SetDeregisteredState(ue, util.AnTypeToNas(anType))
+
+	if !ue.State[otherAnType].Is(context.Deregistered) {
+		ue.PublishUeCtxtInfo()
+		context.StoreContextInDB(ue)
+		return nil
+	}
+
+	if ue.AmPolicyAssociation != nil {
+		problemDetails, err := consumer.AMPolicyControlDelete(ue)
+		if problemDetails != nil {
+			ue.GmmLog.Errorf("AM Policy Control Delete Failed Problem[%+v]", problemDetails)
+		} else if err != nil {
+			ue.GmmLog.Errorf("AM Policy Control Delete Error[%v]", err.Error())
+		}
+	}
+
+	ue.GmmLog.Infof("Removing UE Context")
+	ue.PublishUeCtxtInfo()
+	ue.Remove()
+	context.DeleteContextFromDB(ue)
+	return nil
+}
+
+// TS 23.502 4.2.4.2: the slice was removed from the subscription of the UE. The PDU sessions on
+// the slice are released through the SMF and the UE gets the updated NSSAIs, re-registration is
+// requested if PDU sessions were released so that the PDU session status is synchronized
+func HandleUeSliceInfoDelete(ue *context.AmfUe, accessType models.AccessType, nssai models.Snssai) (err error) {
+	ue.GmmLog.Infof("Slice[sst: %v, sd: %v] deleted from the subscription", nssai.Sst, nssai.Sd)
+
+	registrationRequested := false
+	ue.SmContextList.Range(func(key, value interface{}) bool {
+		smContext := value.(*context.SmContext)
+		if reflect.DeepEqual(smContext.Snssai(), nssai) {
+			ue.GmmLog.Infof("Release SmContext[pduSessionID: %d] of the deleted slice", smContext.PduSessionID())
+			problemDetail, err := consumer.SendReleaseSmContextRequest(ue, smContext, nil, "", nil)
+			if problemDetail != nil {
+				ue.GmmLog.Errorf("Release SmContext Failed Problem[%+v]", problemDetail)
+			} else if err != nil {
+				ue.GmmLog.Errorf("Release SmContext Error[%v]", err.Error())
+			}
+			registrationRequested = true
 		}
 		return true
 	})
 
+	var subscribedNssai []models.SubscribedSnssai
+	for _, slice := range ue.SubscribedNssai {
+		if !reflect.DeepEqual(*slice.SubscribedSnssai, nssai) {
+			subscribedNssai = append(subscribedNssai, slice)
+		}
+	}
+	ue.SubscribedNssai = subscribedNssai
+
 	var allowedList []models.AllowedSnssai
-	//update Allowed Nssai List
 	for _, slice := range ue.AllowedNssai[accessType] {
-		if slice.AllowedSnssai.Sst != nssai.Sst && slice.AllowedSnssai.Sd != nssai.Sd {
+		if !reflect.DeepEqual(*slice.AllowedSnssai, nssai) {
 			allowedList = append(allowedList, slice)
 		}
 	}
 	ue.AllowedNssai[accessType] = allowedList
 
-	return err
+	var configuredNssai []models.ConfiguredSnssai
+	for _, slice := range ue.ConfiguredNssai {
+		if !reflect.DeepEqual(*slice.ConfiguredSnssai, nssai) {
+			configuredNssai = append(configuredNssai, slice)
+		}
+	}
+	ue.ConfiguredNssai = configuredNssai
+
+	if len(ue.AllowedNssai[accessType]) == 0 {
+		return GmmFSM.SendEvent(ue.State[accessType], NwInitiatedDeregistrationEvent, fsm.ArgsType{
+			ArgAmfUe:      ue,
+			ArgAccessType: accessType,
+		})
+	}
+
+	sendSliceConfigurationUpdate(ue, accessType, registrationRequested)
+	return nil
 }
 
-//TODO: to be implemented
+// TS 33.501 6.7.2: the NAS security algorithms of a connected UE which are no longer allowed by the
+// security policy are changed with a new security mode control procedure, an UE in CM-IDLE gets
+// them at its next registration
+func HandleSecurityPolicyChange(ue *context.AmfUe, accessType models.AccessType) error {
+	amfSelf := context.AMF_Self()
+	if !ue.SecurityContextIsValid() || amfSelf.SecurityAlgAllowed(ue) {
+		return nil
+	}
+	if !ue.CmConnect(accessType) {
+		ue.GmmLog.Infof("NAS security algorithms not allowed by the policy, change them at the next registration")
+		return nil
+	}
+
+	integrityAlg, cipheringAlg := ue.IntegrityAlg, ue.CipheringAlg
+	// the UE keeps the algorithms and keys in use until it completes the security mode control procedure
+	ue.SaveNasSecurityContext()
+	intOrder, encOrder := amfSelf.SecurityAlgOrders(ue)
+	if !ue.SelectSecurityAlg(intOrder, encOrder) {
+		ue.RestoreNasSecurityContext()
+		metrics.IncrementNasSecurityAlgStats("none", "none", "rejected")
+		return fmt.Errorf("no NAS security algorithm allowed by the policy is supported by the UE, "+
+			"integrity: %v, ciphering: %v", intOrder, encOrder)
+	}
+	ue.GmmLog.Infof("NAS security algorithms changed by the policy, integrity: %s -> %s, ciphering: %s -> %s",
+		context.IntegrityAlgToString(integrityAlg), context.IntegrityAlgToString(ue.IntegrityAlg),
+		context.CipheringAlgToString(cipheringAlg), context.CipheringAlgToString(ue.CipheringAlg))
+	metrics.IncrementNasSecurityAlgStats(context.IntegrityAlgToString(ue.IntegrityAlg),
+		context.CipheringAlgToString(ue.CipheringAlg), "accepted")
+	ue.DerivateAlgKey()
+	gmm_message.SendSecurityModeCommand(ue.RanUe[accessType], false, "")
+	return nil
+}
+
+// TS 33.501 6.9.4: the NAS COUNT of the registered UE is about to wrap around, a new K_AMF is
+// derived horizontally and taken into use with a security mode control procedure
+func HandleNasCountRekey(ue *context.AmfUe, accessType models.AccessType) error {
+	if ue.KamfChanged || ue.T3560 != nil {
+		// a security mode control procedure is ongoing
+		return nil
+	}
+	if ue.RanUe[accessType] == nil {
+		return fmt.Errorf("RanUe is nil")
+	}
+
+	ue.GmmLog.Infof("NAS COUNT about to wrap around (UL: 0x%06x, DL: 0x%06x), derive a new K_AMF",
+		ue.NasULCount(accessType).Get(), ue.NasDLCount(accessType).Get())
+	ue.SaveNasSecurityContext()
+	if err := ue.DerivateHorizontalKamf(accessType); err != nil {
+		ue.RestoreNasSecurityContext()
+		return err
+	}
+	ue.DerivateAlgKey()
+	gmm_message.SendSecurityModeCommand(ue.RanUe[accessType], false, "")
+	return nil
+}
+
+// HandleSecurityContextUpdateComplete handles the Security Mode Complete of a registered UE, the NAS
+// COUNTs are reset by the new security context and, if the K_AMF is changed, the AS keys are refreshed
+// with a UE Context Modification (TS 33.501 6.9.4)
+func HandleSecurityContextUpdateComplete(ue *context.AmfUe, accessType models.AccessType) error {
+	if ue.MacFailed {
+		return fmt.Errorf("NAS message integrity check failed")
+	}
+
+	if ue.T3560 != nil {
+		ue.T3560.Stop()
+		ue.T3560 = nil // clear the timer
+	}
+	ue.DiscardNasSecurityContext()
+	ue.GmmLog.Infof("NAS security context updated, integrity: %s, ciphering: %s",
+		context.IntegrityAlgToString(ue.IntegrityAlg), context.CipheringAlgToString(ue.CipheringAlg))
+
+	if !ue.KamfChanged {
+		return nil
+	}
+	ue.KamfChanged = false
+	ue.UpdateSecurityContext(accessType)
+	securityKey := ue.Kgnb
+	if accessType == models.AccessType_NON_3_GPP_ACCESS {
+		securityKey = ue.Kn3iwf
+	}
+	ngap_message.SendUEContextModificationRequest(ue, accessType, nil, securityKey, nil, nil, nil, nil)
+	return nil
+}
+
+// TS 23.502 4.2.4.2: the slice was added to the subscription of the UE, it is allowed at once
+// if this AMF supports it
 func HandleUeSliceInfoAdd(ue *context.AmfUe, accessType models.AccessType, nssai models.Snssai) (err error) {
+	ue.GmmLog.Infof("Slice[sst: %v, sd: %v] added to the subscription", nssai.Sst, nssai.Sd)
 
-	//TODO send configuration update to update allowed nssai list with re-registration required to UE
-	//     so that pdu session sync up happen in registration procedure when UE triggers this procedure
-	//gmm_message.SendConfigurationUpdateCommand(ue, models.AccessType__3_GPP_ACCESS, nil)
+	if ue.InAllowedNssai(nssai, accessType) {
+		ue.GmmLog.Infof("Slice[sst: %v, sd: %v] is already allowed", nssai.Sst, nssai.Sd)
+		return nil
+	}
 
-	var allowedList []models.AllowedSnssai
-	//update Allowed Nssai List
-	for _, slice := range ue.AllowedNssai[accessType] {
-		if slice.AllowedSnssai.Sst != nssai.Sst && slice.AllowedSnssai.Sd != nssai.Sd {
-			allowedList = append(allowedList, slice)
+	if !ue.InSubscribedNssai(nssai) {
+		snssai := nssai
+		ue.SubscribedNssai = append(ue.SubscribedNssai, models.SubscribedSnssai{SubscribedSnssai: &snssai})
+	}
+
+	configured := false
+	for _, slice := range ue.ConfiguredNssai {
+		if reflect.DeepEqual(*slice.ConfiguredSnssai, nssai) {
+			configured = true
+			break
 		}
 	}
-	var allowedNssai models.AllowedSnssai
-	allowedNssai.AllowedSnssai = &nssai
-	allowedList = append(allowedList, allowedNssai)
+	if !configured {
+		snssai := nssai
+		ue.ConfiguredNssai = append(ue.ConfiguredNssai, models.ConfiguredSnssai{ConfiguredSnssai: &snssai})
+	}
 
-	ue.AllowedNssai[accessType] = allowedList
+	if context.AMF_Self().InPlmnSupportList(nssai) {
+		snssai := nssai
+		ue.AllowedNssai[accessType] = append(ue.AllowedNssai[accessType], models.AllowedSnssai{AllowedSnssai: &snssai})
+	}
 
-	return err
+	sendSliceConfigurationUpdate(ue, accessType, false)
+	return nil
+}
+
+// The Configuration Update Command is acknowledged by the UE, an UE in CM-IDLE is paged and gets it
+// once it is connected again
+func sendSliceConfigurationUpdate(ue *context.AmfUe, accessType models.AccessType, registrationRequested bool) {
+	ue.ConfigurationUpdateIndication.SetACK(1)
+	if registrationRequested {
+		ue.ConfigurationUpdateIndication.SetRED(1)
+	}
+
+	if ue.CmConnect(accessType) {
+		gmm_message.SendConfigurationUpdateCommand(ue, accessType, newNetworkSlicingIndication())
+		return
+	}
+	// the UE gets the updated NSSAIs with the pending Configuration Update Command or at its next registration
+	ue.NetworkSlicingSubscriptionChanged = true
+	if accessType == models.AccessType__3_GPP_ACCESS {
+		ue.ConfigurationUpdatePending = true
+		ue.SetOnGoing(accessType, &context.OnGoing{
+			Procedure: context.OnGoingProcedurePaging,
+		})
+		ngap_message.SendPaging(ue, nil, false)
+	}
+}
+
+// sendPendingConfigurationUpdate sends the Configuration Update Command held while the UE was paged,
+// it is built now so that it is protected with the current downlink NAS COUNT
+func sendPendingConfigurationUpdate(ue *context.AmfUe, accessType models.AccessType) {
+	ue.ConfigurationUpdatePending = false
+	var networkSlicingIndication *nasType.NetworkSlicingIndication
+	if ue.NetworkSlicingSubscriptionChanged {
+		networkSlicingIndication = newNetworkSlicingIndication()
+		ue.NetworkSlicingSubscriptionChanged = false
+	}
+	gmm_message.SendConfigurationUpdateCommand(ue, accessType, networkSlicingIndication)
+}
+
+// TS 24.501 9.11.3.36: network slicing subscription changed
+func newNetworkSlicingIndication() *nasType.NetworkSlicingIndication {
+	networkSlicingIndication :=
+		nasType.NewNetworkSlicingIndication(nasMessage.ConfigurationUpdateCommandNetworkSlicingIndicationType)
+	networkSlicingIndication.SetNSSCI(1)
+	return networkSlicingIndication
 }
 
 // TS 24501 5.6.1
@@ -1704,7 +2319,9 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 
 	// Send Authtication / Security Procedure not support
 	// Rejecting ServiceRequest if it is received in Deregistered State
-	if !ue.SecurityContextIsValid() || ue.State[anType].Current() == context.Deregistered {
+	// an unauthenticated emergency registered UE has no security context (TS 33.501 10.2.2.2)
+	if (!ue.SecurityContextIsValid() && !(ue.EmergencyRegistered && ue.UnauthenticatedSupi)) ||
+		ue.State[anType].Current() == context.Deregistered {
 		ue.GmmLog.Warnf("No Security Context : SUPI[%s]", ue.Supi)
 		gmm_message.SendServiceReject(ue.RanUe[anType], nil, nasMessage.Cause5GMMUEIdentityCannotBeDerivedByTheNetwork)
 		ngap_message.SendUEContextReleaseCommand(ue.RanUe[anType],
@@ -1722,7 +2339,7 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 		// TS 24.501 4.4.6: When the UE sends a REGISTRATION REQUEST or SERVICE REQUEST message that includes a NAS
 		// message container IE, the UE shall set the security header type of the initial NAS message to
 		// "integrity protected"; then the AMF shall decipher the value part of the NAS message container IE
-		err := security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.ULCount.Get(), security.Bearer3GPP,
+		err := security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.NasULCount(anType).Get(), context.NasBearer(anType),
 			security.DirectionUplink, contents)
 
 		if err != nil {
@@ -1752,9 +2369,15 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 	suList := ngapType.PDUSessionResourceSetupListSUReq{}
 	ctxList := ngapType.PDUSessionResourceSetupListCxtReq{}
 
-	if serviceType == nasMessage.ServiceTypeEmergencyServices ||
-		serviceType == nasMessage.ServiceTypeEmergencyServicesFallback {
+	// emergency services fallback is only requested when EMF is advertised
+	if (serviceType == nasMessage.ServiceTypeEmergencyServices && !context.AMF_Self().EmergencyEnabled()) ||
+		(serviceType == nasMessage.ServiceTypeEmergencyServicesFallback &&
+			factory.AmfConfig.Configuration.Get5gsNwFeatSuppEmf() == 0) {
 		ue.GmmLog.Warnf("emergency service is not supported")
+		gmm_message.SendServiceReject(ue.RanUe[anType], nil, nasMessage.Cause5GMMProtocolErrorUnspecified)
+		ngap_message.SendUEContextReleaseCommand(ue.RanUe[anType],
+			context.UeContextN2NormalRelease, ngapType.CausePresentNas, ngapType.CauseNasPresentNormalRelease)
+		return nil
 	}
 
 	if ue.MacFailed {
@@ -1937,7 +2560,7 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 				var err error
 				if n1Msg != nil {
 					pduSessionId := uint8(smInfo.PduSessionId)
-					nasPdu, err = gmm_message.BuildDLNASTransport(ue, nasMessage.PayloadContainerTypeN1SMInfo,
+					nasPdu, err = gmm_message.BuildDLNASTransport(ue, anType, nasMessage.PayloadContainerTypeN1SMInfo,
 						n1Msg, pduSessionId, nil, nil, 0)
 					if err != nil {
 						return err
@@ -1957,16 +2580,13 @@ func HandleServiceRequest(ue *context.AmfUe, anType models.AccessType,
 			}
 		}
 		// downlink signaling
-		if ue.ConfigurationUpdateMessage != nil {
+		if ue.ConfigurationUpdatePending {
 			err := sendServiceAccept(ue, anType, ctxList, suList,
 				acceptPduSessionPsi, reactivationResult, errPduSessionId, errCause)
 			if err != nil {
 				return err
 			}
-			mobilityRestrictionList := ngap_message.BuildIEMobilityRestrictionList(ue)
-			ngap_message.SendDownlinkNasTransport(ue.RanUe[models.AccessType__3_GPP_ACCESS],
-				ue.ConfigurationUpdateMessage, &mobilityRestrictionList)
-			ue.ConfigurationUpdateMessage = nil
+			sendPendingConfigurationUpdate(ue, models.AccessType__3_GPP_ACCESS)
 		}
 	case nasMessage.ServiceTypeData:
 		if anType == models.AccessType__3_GPP_ACCESS {
@@ -2013,7 +2633,7 @@ func sendServiceAccept(ue *context.AmfUe, anType models.AccessType, ctxList ngap
 		// update Kgnb/Kn3iwf
 		ue.UpdateSecurityContext(anType)
 
-		nasPdu, err := gmm_message.BuildServiceAccept(ue, pDUSessionStatus, reactivationResult,
+		nasPdu, err := gmm_message.BuildServiceAccept(ue, anType, pDUSessionStatus, reactivationResult,
 			errPduSessionId, errCause)
 		if err != nil {
 			return err
@@ -2024,7 +2644,7 @@ func sendServiceAccept(ue *context.AmfUe, anType models.AccessType, ctxList ngap
 			ngap_message.SendInitialContextSetupRequest(ue, anType, nasPdu, nil, nil, nil, nil)
 		}
 	} else if len(suList.List) != 0 {
-		nasPdu, err := gmm_message.BuildServiceAccept(ue, pDUSessionStatus, reactivationResult,
+		nasPdu, err := gmm_message.BuildServiceAccept(ue, anType, pDUSessionStatus, reactivationResult,
 			errPduSessionId, errCause)
 		if err != nil {
 			return err
@@ -2033,9 +2653,36 @@ func sendServiceAccept(ue *context.AmfUe, anType models.AccessType, ctxList ngap
 	} else {
 		gmm_message.SendServiceAccept(ue.RanUe[anType], pDUSessionStatus, reactivationResult, errPduSessionId, errCause)
 	}
+
+	// the new GUTI is delivered by the generic UE configuration update procedure
+	if gutiReallocationRequired(ue, true) {
+		context.AMF_Self().ReAllocateGutiToUe(ue)
+		ue.GmmLog.Infof("Reallocate GUTI[%s]", ue.Guti)
+		ue.ConfigurationUpdateIndication.SetACK(1)
+		gmm_message.SendConfigurationUpdateCommand(ue, anType, nil)
+	}
 	return nil
 }
 
+// TS 33.501 6.12.3: GUTI reallocation according to the operator policy
+func gutiReallocationRequired(ue *context.AmfUe, serviceRequest bool) bool {
+	cfg := context.AMF_Self().GutiReallocationCfg
+	if cfg == nil {
+		return false
+	}
+	if serviceRequest {
+		return cfg.ServiceRequestInterval > 0 &&
+			time.Since(ue.GutiAllocationTime) >= time.Duration(cfg.ServiceRequestInterval)*time.Second
+	}
+
+	ue.RegistrationsSinceGutiAllocation++
+	if cfg.MobilityRegistration &&
+		ue.RegistrationType5GS == nasMessage.RegistrationType5GSMobilityRegistrationUpdating {
+		return true
+	}
+	return cfg.RegistrationCount > 0 && ue.RegistrationsSinceGutiAllocation >= cfg.RegistrationCount
+}
+
 // TS 24.501 5.4.1
 func HandleAuthenticationResponse(ue *context.AmfUe, accessType models.AccessType,
 	authenticationResponse *nasMessage.AuthenticationResponse) error {
@@ -2095,7 +2742,9 @@ func HandleAuthenticationResponse(ue *context.AmfUe, accessType models.AccessTyp
 			ue.UnauthenticatedSupi = false
 			ue.Kseaf = response.Kseaf
 			ue.Supi = response.Supi
-			ue.DerivateKamf()
+			if err := ue.DerivateKamf(); err != nil {
+				return err
+			}
 			ue.GmmLog.Debugln("ue.DerivateKamf()", ue.Kamf)
 			return GmmFSM.SendEvent(ue.State[accessType], AuthSuccessEvent, fsm.ArgsType{
 				ArgAmfUe:      ue,
@@ -2116,6 +2765,10 @@ func HandleAuthenticationResponse(ue *context.AmfUe, accessType models.AccessTyp
 			}
 		}
 	case models.AuthType_EAP_AKA_PRIME:
+		// TS 24.501 5.4.1.2.2: the EAP-response of the UE is relayed to the AUSF as it is
+		if authenticationResponse.EAPMessage == nil {
+			return fmt.Errorf("EAP message is missing in the Authentication Response")
+		}
 		response, problemDetails, err := consumer.SendEapAuthConfirmRequest(ue, *authenticationResponse.EAPMessage)
 		if err != nil {
 			return err
@@ -2129,10 +2782,18 @@ func HandleAuthenticationResponse(ue *context.AmfUe, accessType models.AccessTyp
 			ue.UnauthenticatedSupi = false
 			ue.Kseaf = response.KSeaf
 			ue.Supi = response.Supi
-			ue.DerivateKamf()
-			// TODO: select enc/int algorithm based on ue security capability & amf's policy,
-			// then generate KnasEnc, KnasInt
-			return GmmFSM.SendEvent(ue.State[accessType], SecurityModeSuccessEvent, fsm.ArgsType{
+			if err := ue.DerivateKamf(); err != nil {
+				// the UE can not be given the EAP-success without a key hierarchy to protect NAS with
+				ue.GmmLog.Errorf("K_AMF derivation from the EAP result failed: %+v", err)
+				gmm_message.SendAuthenticationReject(ue.RanUe[accessType], "")
+				return GmmFSM.SendEvent(ue.State[accessType], AuthFailEvent, fsm.ArgsType{
+					ArgAmfUe:      ue,
+					ArgAccessType: accessType,
+				})
+			}
+			ue.GmmLog.Debugln("ue.DerivateKamf()", ue.Kamf)
+			// the EAP-success is conveyed in the Security Mode Command (TS 24.501 5.4.1.2.2)
+			return GmmFSM.SendEvent(ue.State[accessType], AuthSuccessEvent, fsm.ArgsType{
 				ArgAmfUe:      ue,
 				ArgAccessType: accessType,
 				ArgEAPSuccess: true,
@@ -2151,8 +2812,9 @@ func HandleAuthenticationResponse(ue *context.AmfUe, accessType models.AccessTyp
 				})
 			}
 		case models.AuthResult_ONGOING:
+			// relay the next EAP-request of the AUSF to the UE
 			ue.AuthenticationCtx.Var5gAuthData = response.EapPayload
-			if _, exists := response.Links["link"]; exists {
+			if len(response.Links) > 0 {
 				ue.AuthenticationCtx.Links = response.Links
 			}
 			gmm_message.SendAuthenticationRequest(ue.RanUe[accessType])
@@ -2241,23 +2903,29 @@ func HandleRegistrationComplete(ue *context.AmfUe, accessType models.AccessType,
 	registrationComplete *nasMessage.RegistrationComplete) error {
 	ue.GmmLog.Info("Handle Registration Complete")
 
-	if ue.T3550 != nil {
-		ue.T3550.Stop()
-		ue.T3550 = nil // clear the timer
+	ue.StopT3550(accessType)
+
+	// the UE has acknowledged the GUTI of the Registration Accept
+	context.AMF_Self().FreeOldGuti(ue)
+
+	// the UDM requested an acknowledgement of the SOR information of the Registration Accept
+	if registrationComplete.SORTransparentContainer != nil {
+		if err := handleSorAck(ue, registrationComplete.SORTransparentContainer.Buffer); err != nil {
+			ue.GmmLog.Errorf("Steering of Roaming acknowledgement: %+v", err)
+		}
 	}
 
-	// if registrationComplete.SORTransparentContainer != nil {
-	// 	TODO: if at regsitration procedure 14b, udm provide amf Steering of Roaming info & request an ack,
-	// 	AMF provides the UE's ack with Nudm_SDM_Info (SOR not supportted in this stage)
-	// }
+	// UE parameters update data provided by the UDM during the registration
+	gmm_message.SendUpuTransparentContainer(ue.RanUe[accessType])
 
 	// TODO: if
 	//	1. AMF has evaluated the support of IMS Voice over PS Sessions (TS 23.501 5.16.3.2)
 	//	2. AMF determines that it needs to update the Homogeneous Support of IMS Voice over PS Sessions (TS 23.501 5.16.3.3)
 	// Then invoke Nudm_UECM_Update to send "Homogeneous Support of IMS Voice over PS Sessions" indication to udm
 
+	// keep the signalling connection for the UE parameters update acknowledgement
 	if ue.RegistrationRequest.UplinkDataStatus == nil &&
-		ue.RegistrationRequest.GetFOR() == nasMessage.FollowOnRequestNoPending {
+		ue.RegistrationRequest.GetFOR() == nasMessage.FollowOnRequestNoPending && ue.UpuInfo == nil {
 		ngap_message.SendUEContextReleaseCommand(ue.RanUe[accessType], context.UeContextN2NormalRelease,
 			ngapType.CausePresentNas, ngapType.CauseNasPresentNormalRelease)
 	}
@@ -2292,7 +2960,8 @@ func HandleSecurityModeComplete(ue *context.AmfUe, anType models.AccessType, pro
 		ue.Pei = nasConvert.PeiToString(securityModeComplete.IMEISV.Octet[:])
 	}
 
-	// TODO: AMF shall set the NAS COUNTs to zero if horizontal derivation of KAMF is performed
+	// the NAS COUNTs are set to zero with the new NAS security context, also if the K_AMF is
+	// horizontally derived (TS 33.501 6.9.4)
 	if securityModeComplete.NASMessageContainer != nil {
 		contents := securityModeComplete.NASMessageContainer.GetNASMessageContainerContents()
 		m := nas.NewMessage()
@@ -2332,9 +3001,15 @@ func HandleSecurityModeReject(ue *context.AmfUe, anType models.AccessType,
 
 	cause := securityModeReject.Cause5GMM.GetCauseValue()
 	ue.GmmLog.Warnf("Reject Cause: %s", nasMessage.Cause5GMMToString(cause))
+	if ue.RestoreNasSecurityContext() {
+		// a registered UE keeps using the NAS security context in use
+		ue.GmmLog.Warnln("UE reject the security mode command, keep the NAS security context in use")
+		return nil
+	}
 	ue.GmmLog.Error("UE reject the security mode command, abort the ongoing procedure")
 
 	ue.SecurityContextAvailable = false
+	ue.KamfChanged = false
 
 	ngap_message.SendUEContextReleaseCommand(ue.RanUe[anType], context.UeContextReleaseUeContext,
 		ngapType.CausePresentNas, ngapType.CauseNasPresentNormalRelease)
@@ -2491,3 +3166,25 @@ func HandleAuthenticationError(ue *context.AmfUe, anType models.AccessType) erro
 	}
 	return nil
 }
+
+// TS 23.502 4.2.2.2.2 step 18: the SMFs of the PDU sessions transferred from the old AMF are told about
+// the new serving AMF, the sessions of slices not allowed in this AMF are returned to be released
+func moveSmContextsToThisAmf(ue *context.AmfUe, anType models.AccessType) (toReleaseSessionList []int32) {
+	amfSelf := context.AMF_Self()
+	guami := amfSelf.ServedGuamiList[0]
+	ue.SmContextList.Range(func(key, value interface{}) bool {
+		pduSessionID := key.(int32)
+		smContext := value.(*context.SmContext)
+		if !ue.InAllowedNssai(smContext.Snssai(), anType) {
+			toReleaseSessionList = append(toReleaseSessionList, pduSessionID)
+			ue.SmContextList.Delete(key)
+			return true
+		}
+		_, _, _, err := consumer.SendUpdateSmContextHandoverBetweenAMF(ue, smContext, amfSelf.NfId, &guami, false)
+		if err != nil {
+			ue.GmmLog.Errorf("Update SmContext[PDU Session ID:%d] for AMF change failed: %+v", pduSessionID, err)
+		}
+		return true
+	})
+	return
+}
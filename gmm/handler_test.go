@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package gmm_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/omec-project/UeauCommon"
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
+	"github.com/omec-project/amf/gmm"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/amf/util"
+	"github.com/omec-project/fsm"
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/nasType"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+var (
+	eapRequest  = []byte{0x01, 0x01, 0x00, 0x08, 0x32, 0x01, 0x00, 0x00}
+	eapResponse = []byte{0x02, 0x01, 0x00, 0x08, 0x32, 0x01, 0x00, 0x00}
+	eapSuccess  = []byte{0x03, 0x02, 0x00, 0x04}
+	eapFailure  = []byte{0x04, 0x02, 0x00, 0x04}
+	testKseaf   = "3b2ae3b1f8d5d9b1a5d8e8f9e4a7c1b2d6e3f1a4b7c8d9e0f1a2b3c4d5e6f7a8"
+)
+
+func init() {
+	factory.InitConfigFactory("../amfTest/amfcfg.yaml")
+	util.InitAmfContext(context.AMF_Self())
+	gmm.Mockinit()
+}
+
+// stubAusf serves the EAP session resource of Nausf_UEAuthentication with the given result and
+// records the EAP payloads relayed by the AMF
+type stubAusf struct {
+	*httptest.Server
+	result   models.EapSession
+	payloads []string
+}
+
+func newStubAusf(result models.EapSession) *stubAusf {
+	ausf := &stubAusf{result: result}
+	ausf.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/eap-session") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var eapSession models.EapSession
+		if err := json.NewDecoder(r.Body).Decode(&eapSession); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ausf.payloads = append(ausf.payloads, eapSession.EapPayload)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ausf.result)
+	}))
+	return ausf
+}
+
+func newEapAuthenticatingUe(t *testing.T, ausfUri string) (*context.AmfUe, *ngaputil.TestConn) {
+	conn := &ngaputil.TestConn{}
+	self := context.AMF_Self()
+	ran := self.NewAmfRan(conn)
+	ranUe, err := ran.NewRanUe(1)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	ue := self.NewAmfUe("")
+	ue.AttachRanUe(ranUe)
+	ue.Suci = "suci-0-208-93-0000-0-0-0000007487"
+	ue.ABBA = []uint8{0x00, 0x00}
+	ue.State[models.AccessType__3_GPP_ACCESS] = fsm.NewState(context.Authentication)
+	ue.AuthenticationCtx = &models.UeAuthenticationCtx{
+		AuthType:      models.AuthType_EAP_AKA_PRIME,
+		Var5gAuthData: base64.StdEncoding.EncodeToString(eapRequest),
+		Links: map[string]models.LinksValueSchema{
+			"eap-session": {Href: ausfUri + "/nausf-auth/v1/ue-authentications/" + ue.Suci + "/eap-session"},
+		},
+	}
+	return ue, conn
+}
+
+func eapAuthenticationResponse() *nasMessage.AuthenticationResponse {
+	authenticationResponse := nasMessage.NewAuthenticationResponse(0)
+	authenticationResponse.EAPMessage = nasType.NewEAPMessage(nasMessage.AuthenticationResponseEAPMessageType)
+	authenticationResponse.EAPMessage.SetLen(uint16(len(eapResponse)))
+	authenticationResponse.EAPMessage.SetEAPMessage(eapResponse)
+	return authenticationResponse
+}
+
+// sentGmmMessage decodes the plain GMM message of the last DownlinkNASTransport sent to the RAN
+func sentGmmMessage(t *testing.T, conn *ngaputil.TestConn) *nas.GmmMessage {
+	pdu, err := ngap.Decoder(conn.Data)
+	if err != nil {
+		t.Fatalf("Failed to decode the NGAP message: %v", err)
+	}
+	if pdu.InitiatingMessage == nil || pdu.InitiatingMessage.Value.DownlinkNASTransport == nil {
+		t.Fatal("No DownlinkNASTransport is sent")
+	}
+	for _, ie := range pdu.InitiatingMessage.Value.DownlinkNASTransport.ProtocolIEs.List {
+		if ie.Id.Value != ngapType.ProtocolIEIDNASPDU {
+			continue
+		}
+		m := nas.NewMessage()
+		if err := m.PlainNasDecode(&ie.Value.NASPDU.Value); err != nil {
+			t.Fatalf("Failed to decode the NAS message: %v", err)
+		}
+		return m.GmmMessage
+	}
+	t.Fatal("No NAS-PDU in the DownlinkNASTransport")
+	return nil
+}
+
+func TestEapAuthenticationSuccess(t *testing.T) {
+	supi := "imsi-208930000007487"
+	ausf := newStubAusf(models.EapSession{
+		EapPayload: base64.StdEncoding.EncodeToString(eapSuccess),
+		KSeaf:      testKseaf,
+		AuthResult: models.AuthResult_SUCCESS,
+		Supi:       supi,
+	})
+	defer ausf.Close()
+	ue, _ := newEapAuthenticatingUe(t, ausf.URL)
+	securityModeCallCount := gmm.MockSecurityModeCallCount
+
+	if err := gmm.HandleAuthenticationResponse(ue, models.AccessType__3_GPP_ACCESS,
+		eapAuthenticationResponse()); err != nil {
+		t.Fatalf("HandleAuthenticationResponse: %v", err)
+	}
+
+	if len(ausf.payloads) != 1 || ausf.payloads[0] != base64.StdEncoding.EncodeToString(eapResponse) {
+		t.Errorf("EAP response is not relayed to the AUSF: %v", ausf.payloads)
+	}
+	if ue.Supi != supi || ue.UnauthenticatedSupi {
+		t.Errorf("SUPI of the EAP result is not stored: %s", ue.Supi)
+	}
+	kseaf, _ := hex.DecodeString(testKseaf)
+	p0 := []byte("208930000007487")
+	p1 := []byte{0x00, 0x00}
+	kamf := UeauCommon.GetKDFValue(kseaf, UeauCommon.FC_FOR_KAMF_DERIVATION,
+		p0, UeauCommon.KDFLen(p0), p1, UeauCommon.KDFLen(p1))
+	if ue.Kamf != hex.EncodeToString(kamf) {
+		t.Errorf("K_AMF, want: %x, got: %s", kamf, ue.Kamf)
+	}
+	if !ue.State[models.AccessType__3_GPP_ACCESS].Is(context.SecurityMode) ||
+		gmm.MockSecurityModeCallCount != securityModeCallCount+1 {
+		t.Errorf("UE is not moved to the security mode state: %s", ue.State[models.AccessType__3_GPP_ACCESS].Current())
+	}
+}
+
+func TestEapAuthenticationFailure(t *testing.T) {
+	ausf := newStubAusf(models.EapSession{
+		EapPayload: base64.StdEncoding.EncodeToString(eapFailure),
+		AuthResult: models.AuthResult_FAILURE,
+	})
+	defer ausf.Close()
+	ue, conn := newEapAuthenticatingUe(t, ausf.URL)
+
+	if err := gmm.HandleAuthenticationResponse(ue, models.AccessType__3_GPP_ACCESS,
+		eapAuthenticationResponse()); err != nil {
+		t.Fatalf("HandleAuthenticationResponse: %v", err)
+	}
+
+	gmmMessage := sentGmmMessage(t, conn)
+	if gmmMessage.GetMessageType() != nas.MsgTypeAuthenticationReject {
+		t.Fatalf("Message type, want: %d, got: %d", nas.MsgTypeAuthenticationReject, gmmMessage.GetMessageType())
+	}
+	if eap := gmmMessage.AuthenticationReject.EAPMessage; eap == nil || !bytes.Equal(eap.GetEAPMessage(), eapFailure) {
+		t.Errorf("EAP-failure is not conveyed in the Authentication Reject")
+	}
+	if ue.Kamf != "" {
+		t.Errorf("K_AMF is derived for a failed authentication")
+	}
+	if !ue.State[models.AccessType__3_GPP_ACCESS].Is(context.Deregistered) {
+		t.Errorf("UE is not deregistered: %s", ue.State[models.AccessType__3_GPP_ACCESS].Current())
+	}
+}
+
+func TestEapAuthenticationOngoing(t *testing.T) {
+	nextEapRequest := []byte{0x01, 0x02, 0x00, 0x08, 0x32, 0x05, 0x00, 0x00}
+	ausf := newStubAusf(models.EapSession{
+		EapPayload: base64.StdEncoding.EncodeToString(nextEapRequest),
+		AuthResult: models.AuthResult_ONGOING,
+	})
+	defer ausf.Close()
+	ue, conn := newEapAuthenticatingUe(t, ausf.URL)
+
+	if err := gmm.HandleAuthenticationResponse(ue, models.AccessType__3_GPP_ACCESS,
+		eapAuthenticationResponse()); err != nil {
+		t.Fatalf("HandleAuthenticationResponse: %v", err)
+	}
+	if ue.T3560 != nil {
+		ue.T3560.Stop()
+		ue.T3560 = nil
+	}
+
+	gmmMessage := sentGmmMessage(t, conn)
+	if gmmMessage.GetMessageType() != nas.MsgTypeAuthenticationRequest {
+		t.Fatalf("Message type, want: %d, got: %d", nas.MsgTypeAuthenticationRequest, gmmMessage.GetMessageType())
+	}
+	if eap := gmmMessage.AuthenticationRequest.EAPMessage; eap == nil || !bytes.Equal(eap.GetEAPMessage(), nextEapRequest) {
+		t.Errorf("EAP-request of the AUSF is not relayed in the Authentication Request")
+	}
+	if !ue.State[models.AccessType__3_GPP_ACCESS].Is(context.Authentication) {
+		t.Errorf("UE left the authentication state: %s", ue.State[models.AccessType__3_GPP_ACCESS].Current())
+	}
+}
+
+func TestEapAuthenticationResponseWithoutEapMessage(t *testing.T) {
+	ausf := newStubAusf(models.EapSession{AuthResult: models.AuthResult_SUCCESS})
+	defer ausf.Close()
+	ue, _ := newEapAuthenticatingUe(t, ausf.URL)
+
+	if err := gmm.HandleAuthenticationResponse(ue, models.AccessType__3_GPP_ACCESS,
+		nasMessage.NewAuthenticationResponse(0)); err == nil {
+		t.Error("Authentication Response without EAP message is accepted")
+	}
+	if len(ausf.payloads) != 0 {
+		t.Errorf("AUSF is called without an EAP response")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/omec-project/amf/context"
 	"github.com/omec-project/amf/logger"
 	"github.com/omec-project/fsm"
+	"github.com/omec-project/openapi/models"
 )
 
 const (
@@ -30,6 +31,8 @@ const (
 	SliceInfoDeleteEvent           fsm.EventType = "Slice Info Delete Event"
 	SliceInfoAddEvent              fsm.EventType = "Slice Info Add Event"
 	DeregistrationAcceptEvent      fsm.EventType = "Deregistration Accept"
+	SecurityPolicyChangeEvent      fsm.EventType = "Security Policy Change"
+	NasCountRekeyEvent             fsm.EventType = "NAS COUNT Rekey"
 )
 
 const (
@@ -50,6 +53,10 @@ var transitions = fsm.Transitions{
 	{Event: GmmMessageEvent, From: context.SecurityMode, To: context.SecurityMode},
 	{Event: GmmMessageEvent, From: context.ContextSetup, To: context.ContextSetup},
 	{Event: GmmMessageEvent, From: context.Registered, To: context.Registered},
+	{Event: SliceInfoAddEvent, From: context.Registered, To: context.Registered},
+	{Event: SliceInfoDeleteEvent, From: context.Registered, To: context.Registered},
+	{Event: SecurityPolicyChangeEvent, From: context.Registered, To: context.Registered},
+	{Event: NasCountRekeyEvent, From: context.Registered, To: context.Registered},
 	{Event: GmmMessageEvent, From: context.DeregistrationInitiated, To: context.DeregistrationInitiated},
 	{Event: StartAuthEvent, From: context.Deregistered, To: context.Authentication},
 	{Event: StartAuthEvent, From: context.Registered, To: context.Authentication},
@@ -85,4 +92,10 @@ func init() {
 	} else {
 		GmmFSM = f
 	}
+	context.ReachabilityChangedHandler = sendReachabilityReport
+	context.UeConnectionReleasedHandler = func(ue *context.AmfUe, anType models.AccessType) {
+		if ue.State[anType] != nil && ue.State[anType].Is(context.Registered) {
+			StartMobileReachableTimer(ue, anType)
+		}
+	}
 }
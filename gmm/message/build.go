@@ -9,6 +9,8 @@ package message
 import (
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 
 	"github.com/mitchellh/mapstructure"
 
@@ -23,7 +25,7 @@ import (
 	"github.com/omec-project/openapi/models"
 )
 
-func BuildDLNASTransport(ue *context.AmfUe, payloadContainerType uint8, nasPdu []byte,
+func BuildDLNASTransport(ue *context.AmfUe, anType models.AccessType, payloadContainerType uint8, nasPdu []byte,
 	pduSessionId uint8, cause *uint8, backoffTimerUint *uint8, backoffTimer uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GmmMessage = nas.NewGmmMessage()
@@ -62,7 +64,7 @@ func BuildDLNASTransport(ue *context.AmfUe, payloadContainerType uint8, nasPdu [
 
 	m.GmmMessage.DLNASTransport = dLNASTransport
 
-	return nas_security.Encode(ue, m)
+	return nas_security.Encode(ue, anType, m)
 }
 
 func BuildNotification(ue *context.AmfUe, accessType models.AccessType) ([]byte, error) {
@@ -87,7 +89,7 @@ func BuildNotification(ue *context.AmfUe, accessType models.AccessType) ([]byte,
 
 	m.GmmMessage.Notification = notification
 
-	return nas_security.Encode(ue, m)
+	return nas_security.Encode(ue, models.AccessType__3_GPP_ACCESS, m)
 }
 
 func BuildIdentityRequest(typeOfIdentity uint8) ([]byte, error) {
@@ -150,7 +152,10 @@ func BuildAuthenticationRequest(ue *context.AmfUe) ([]byte, error) {
 		copy(tmpArray[:], autn[0:16])
 		authenticationRequest.AuthenticationParameterAUTN.SetAUTN(tmpArray)
 	case models.AuthType_EAP_AKA_PRIME:
-		eapMsg := ue.AuthenticationCtx.Var5gAuthData.(string)
+		eapMsg, ok := ue.AuthenticationCtx.Var5gAuthData.(string)
+		if !ok {
+			return nil, fmt.Errorf("Var5gAuthData of EAP-AKA' is not an EAP payload")
+		}
 		rawEapMsg, err := base64.StdEncoding.DecodeString(eapMsg)
 		if err != nil {
 			return nil, err
@@ -165,7 +170,7 @@ func BuildAuthenticationRequest(ue *context.AmfUe) ([]byte, error) {
 	return m.PlainNasEncode()
 }
 
-func BuildServiceAccept(ue *context.AmfUe, pDUSessionStatus *[16]bool,
+func BuildServiceAccept(ue *context.AmfUe, anType models.AccessType, pDUSessionStatus *[16]bool,
 	reactivationResult *[16]bool, errPduSessionId, errCause []uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GmmMessage = nas.NewGmmMessage()
@@ -202,7 +207,7 @@ func BuildServiceAccept(ue *context.AmfUe, pDUSessionStatus *[16]bool,
 	}
 	m.GmmMessage.ServiceAccept = serviceAccept
 
-	return nas_security.Encode(ue, m)
+	return nas_security.Encode(ue, anType, m)
 }
 
 func BuildAuthenticationReject(ue *context.AmfUe, eapMsg string) ([]byte, error) {
@@ -283,7 +288,11 @@ func BuildServiceReject(pDUSessionStatus *[16]bool, cause uint8) ([]byte, error)
 	return m.PlainNasEncode()
 }
 
-// T3346 timer are not supported
+// t3346Value is the back-off timer of a UE rejected for congestion (TS 24.501 5.3.9), in seconds.
+// The UE does not retry before it expires and its next registration may be routed to another AMF
+const t3346Value = 30
+
+// T3346 timer is only sent with the 5GMM cause congestion
 func BuildRegistrationReject(ue *context.AmfUe, cause5GMM uint8, eapMessage string) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GmmMessage = nas.NewGmmMessage()
@@ -303,6 +312,13 @@ func BuildRegistrationReject(ue *context.AmfUe, cause5GMM uint8, eapMessage stri
 		registrationReject.T3502Value.SetGPRSTimer2Value(t3502)
 	}
 
+	if cause5GMM == nasMessage.Cause5GMMCongestion {
+		registrationReject.T3346Value = nasType.NewT3346Value(nasMessage.RegistrationRejectT3346ValueType)
+		registrationReject.T3346Value.SetLen(1)
+		t3346 := nasConvert.GPRSTimer2ToNas(t3346Value)
+		registrationReject.T3346Value.SetGPRSTimer2Value(t3346)
+	}
+
 	if eapMessage != "" {
 		registrationReject.EAPMessage = nasType.NewEAPMessage(nasMessage.RegistrationRejectEAPMessageType)
 		rawEapMsg, err := base64.StdEncoding.DecodeString(eapMessage)
@@ -319,7 +335,7 @@ func BuildRegistrationReject(ue *context.AmfUe, cause5GMM uint8, eapMessage stri
 }
 
 // TS 24.501 8.2.25
-func BuildSecurityModeCommand(ue *context.AmfUe, eapSuccess bool, eapMessage string) ([]byte, error) {
+func BuildSecurityModeCommand(ue *context.AmfUe, anType models.AccessType, eapSuccess bool, eapMessage string) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GmmMessage = nas.NewGmmMessage()
 	m.GmmHeader.SetMessageType(nas.MsgTypeSecurityModeCommand)
@@ -360,7 +376,7 @@ func BuildSecurityModeCommand(ue *context.AmfUe, eapSuccess bool, eapMessage str
 		securityModeCommand.Additional5GSecurityInformation.SetRINMR(0)
 	}
 
-	if ue.RegistrationType5GS == nasMessage.RegistrationType5GSPeriodicRegistrationUpdating ||
+	if ue.KamfChanged || ue.RegistrationType5GS == nasMessage.RegistrationType5GSPeriodicRegistrationUpdating ||
 		ue.RegistrationType5GS == nasMessage.RegistrationType5GSMobilityRegistrationUpdating {
 		securityModeCommand.Additional5GSecurityInformation.SetHDP(1)
 	} else {
@@ -385,7 +401,7 @@ func BuildSecurityModeCommand(ue *context.AmfUe, eapSuccess bool, eapMessage str
 
 	ue.SecurityContextAvailable = true
 	m.GmmMessage.SecurityModeCommand = securityModeCommand
-	payload, err := nas_security.Encode(ue, m)
+	payload, err := nas_security.Encode(ue, anType, m)
 	if err != nil {
 		ue.SecurityContextAvailable = false
 		return nil, err
@@ -427,7 +443,7 @@ func BuildDeregistrationRequest(ue *context.RanUe, accessType uint8, reRegistrat
 			ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
 			SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
 		}
-		return nas_security.Encode(ue.AmfUe, m)
+		return nas_security.Encode(ue.AmfUe, ue.Ran.AnType, m)
 	}
 	return m.PlainNasEncode()
 }
@@ -483,6 +499,10 @@ func BuildRegistrationAccept(
 		}
 	}
 	registrationAccept.RegistrationResult5GS.SetRegistrationResultValue5GS(registrationResult)
+	if ue.EmergencyRegistered {
+		// TS 24.501 9.11.3.6: emergency registered
+		registrationAccept.RegistrationResult5GS.Octet |= 0x20
+	}
 	// TODO: set smsAllowed value of RegistrationResult5GS if need
 
 	if ue.Guti != "" {
@@ -589,6 +609,21 @@ func BuildRegistrationAccept(
 		registrationAccept.LADNInformation.SetLADND(buf)
 	}
 
+	// TS 23.122 C.2: the SOR information of the UDM is delivered during registration
+	if ue.SorInfo != nil {
+		if sorContainer, err := BuildSorTransparentContainer(*ue.SorInfo); err != nil {
+			logger.GmmLog.Errorf("Build SOR Transparent Container failed: %+v", err)
+		} else {
+			registrationAccept.SORTransparentContainer =
+				nasType.NewSORTransparentContainer(nasMessage.RegistrationAcceptSORTransparentContainerType)
+			registrationAccept.SORTransparentContainer.SetLen(uint16(len(sorContainer)))
+			registrationAccept.SORTransparentContainer.Buffer = sorContainer
+			if !ue.SorInfo.AckInd {
+				ue.SorInfo = nil // no acknowledgement is awaited
+			}
+		}
+	}
+
 	if ue.NetworkSlicingSubscriptionChanged {
 		registrationAccept.NetworkSlicingIndication =
 			nasType.NewNetworkSlicingIndication(nasMessage.RegistrationAcceptNetworkSlicingIndicationType)
@@ -638,7 +673,7 @@ func BuildRegistrationAccept(
 
 	m.GmmMessage.RegistrationAccept = registrationAccept
 
-	return nas_security.Encode(ue, m)
+	return nas_security.Encode(ue, anType, m)
 }
 
 func includeConfiguredNssaiCheck(ue *context.AmfUe) bool {
@@ -681,6 +716,11 @@ func BuildConfigurationUpdateCommand(ue *context.AmfUe, anType models.AccessType
 	m.GmmMessage = nas.NewGmmMessage()
 	m.GmmHeader.SetMessageType(nas.MsgTypeConfigurationUpdateCommand)
 
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
 	configurationUpdateCommand := nasMessage.NewConfigurationUpdateCommand(0)
 	configurationUpdateCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
 	configurationUpdateCommand.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
@@ -690,7 +730,8 @@ func BuildConfigurationUpdateCommand(ue *context.AmfUe, anType models.AccessType
 	if ue.ConfigurationUpdateIndication.Octet != 0 {
 		configurationUpdateCommand.ConfigurationUpdateIndication =
 			nasType.NewConfigurationUpdateIndication(nasMessage.ConfigurationUpdateCommandConfigurationUpdateIndicationType)
-		configurationUpdateCommand.ConfigurationUpdateIndication = &ue.ConfigurationUpdateIndication
+		configurationUpdateCommand.ConfigurationUpdateIndication.SetACK(ue.ConfigurationUpdateIndication.GetACK())
+		configurationUpdateCommand.ConfigurationUpdateIndication.SetRED(ue.ConfigurationUpdateIndication.GetRED())
 	}
 
 	if networkSlicingIndication != nil {
@@ -796,5 +837,138 @@ func BuildConfigurationUpdateCommand(ue *context.AmfUe, anType models.AccessType
 
 	m.GmmMessage.ConfigurationUpdateCommand = configurationUpdateCommand
 
-	return m.PlainNasEncode()
+	return nas_security.Encode(ue, anType, m)
+}
+
+// BuildSorTransparentContainer encodes the value of the SOR transparent container carrying
+// steering of roaming information (TS 24.501 9.11.3.51)
+func BuildSorTransparentContainer(sorInfo models.SorInfo) ([]byte, error) {
+	sorMacIausf, err := hex.DecodeString(sorInfo.SorMacIausf)
+	if err != nil || len(sorMacIausf) != 16 {
+		return nil, fmt.Errorf("invalid SOR-MAC-IAUSF[%s]", sorInfo.SorMacIausf)
+	}
+	counterSor, err := hex.DecodeString(sorInfo.Countersor)
+	if err != nil || len(counterSor) != 2 {
+		return nil, fmt.Errorf("invalid CounterSOR[%s]", sorInfo.Countersor)
+	}
+
+	// SOR data type: steering of roaming information
+	header := uint8(0x00)
+	if sorInfo.AckInd {
+		header |= 0x08
+	}
+	var list []byte
+	if sorInfo.SteeringContainer != nil {
+		// list indication: a list of preferred PLMN/access technology combinations is provided
+		header |= 0x02
+		raw, err := json.Marshal(sorInfo.SteeringContainer)
+		if err != nil {
+			return nil, err
+		}
+		var securedPacket string
+		var steeringInfoList []models.SteeringInfo
+		if err := json.Unmarshal(raw, &securedPacket); err == nil {
+			// list type: secured packet
+			if list, err = base64.StdEncoding.DecodeString(securedPacket); err != nil {
+				return nil, err
+			}
+		} else if err := json.Unmarshal(raw, &steeringInfoList); err == nil {
+			// list type: PLMN ID and access technology list
+			header |= 0x04
+			for _, steeringInfo := range steeringInfoList {
+				if steeringInfo.PlmnId == nil {
+					continue
+				}
+				list = append(list, nasConvert.PlmnIDToNas(*steeringInfo.PlmnId)...)
+				list = append(list, accessTechToNas(steeringInfo.AccessTechList)...)
+			}
+		} else {
+			return nil, fmt.Errorf("unknown steering container: %s", raw)
+		}
+	}
+
+	buf := []byte{header}
+	buf = append(buf, sorMacIausf...)
+	buf = append(buf, counterSor...)
+	return append(buf, list...), nil
+}
+
+// accessTechToNas encodes the access technology identifier of TS 31.102 4.2.5
+func accessTechToNas(accessTechList []models.AccessTech) []byte {
+	accessTech := make([]byte, 2)
+	for _, tech := range accessTechList {
+		switch string(tech) {
+		case "NR":
+			accessTech[0] |= 0x08
+		case "EUTRAN_IN_WBS1_MODE_AND_NBS1_MODE":
+			accessTech[0] |= 0x40
+		case "EUTRAN_IN_WBS1_MODE_ONLY":
+			accessTech[0] |= 0x60
+		case "EUTRAN_IN_NBS1_MODE_ONLY":
+			accessTech[0] |= 0x50
+		case "UTRAN":
+			accessTech[0] |= 0x80
+		case "GSM_AND_ECGSM_IoT":
+			accessTech[1] |= 0x80
+		case "GSM_WITHOUT_ECGSM_IoT":
+			accessTech[1] |= 0x84
+		case "ECGSM_IoT_ONLY":
+			accessTech[1] |= 0x88
+		case "GSM_COMPACT":
+			accessTech[1] |= 0x40
+		case "CDMA_HRPD":
+			accessTech[1] |= 0x20
+		case "CDMA_1xRTT":
+			accessTech[1] |= 0x10
+		}
+	}
+	return accessTech
+}
+
+// BuildUpuTransparentContainer encodes the value of the UE parameters update transparent container
+// (TS 24.501 9.11.3.53)
+func BuildUpuTransparentContainer(upuInfo models.UpuInfo) ([]byte, error) {
+	upuMacIausf, err := hex.DecodeString(upuInfo.UpuMacIausf)
+	if err != nil || len(upuMacIausf) != 16 {
+		return nil, fmt.Errorf("invalid UPU-MAC-IAUSF[%s]", upuInfo.UpuMacIausf)
+	}
+	counterUpu, err := hex.DecodeString(upuInfo.CounterUpu)
+	if err != nil || len(counterUpu) != 2 {
+		return nil, fmt.Errorf("invalid CounterUPU[%s]", upuInfo.CounterUpu)
+	}
+
+	// UPU data type: UE parameters update data
+	header := uint8(0x00)
+	if upuInfo.UpuAckInd {
+		header |= 0x02
+	}
+	if upuInfo.UpuRegInd {
+		header |= 0x04
+	}
+	buf := []byte{header}
+	buf = append(buf, upuMacIausf...)
+	buf = append(buf, counterUpu...)
+
+	for _, upuData := range upuInfo.UpuDataList {
+		var dataSetType uint8
+		var contents []byte
+		if upuData.SecPacket != "" {
+			// routing indicator update data
+			dataSetType = 0x01
+			if contents, err = base64.StdEncoding.DecodeString(upuData.SecPacket); err != nil {
+				return nil, err
+			}
+		} else if len(upuData.DefaultConfNssai) > 0 {
+			// default configured NSSAI update data
+			dataSetType = 0x02
+			for _, snssai := range upuData.DefaultConfNssai {
+				contents = append(contents, nasConvert.SnssaiToNas(snssai)...)
+			}
+		} else {
+			continue
+		}
+		buf = append(buf, dataSetType, uint8(len(contents)>>8), uint8(len(contents)))
+		buf = append(buf, contents...)
+	}
+	return buf, nil
 }
@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasConvert"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/openapi/models"
+)
+
+var (
+	testMacIausf = "000102030405060708090a0b0c0d0e0f"
+	testCounter  = "0102"
+)
+
+// containerHeader is the header octet followed by the 16 octets MAC-IAUSF and the 2 octets counter
+func containerHeader(header byte) []byte {
+	mac, _ := hex.DecodeString(testMacIausf)
+	buf := append([]byte{header}, mac...)
+	return append(buf, 0x01, 0x02)
+}
+
+func TestBuildSorTransparentContainer(t *testing.T) {
+	securedPacket := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	testCases := []struct {
+		description string
+		sorInfo     models.SorInfo
+		want        []byte
+	}{
+		{
+			description: "no list, acknowledgement not requested",
+			sorInfo:     models.SorInfo{SorMacIausf: testMacIausf, Countersor: testCounter},
+			want:        containerHeader(0x00),
+		},
+		{
+			description: "no list, acknowledgement requested",
+			sorInfo:     models.SorInfo{SorMacIausf: testMacIausf, Countersor: testCounter, AckInd: true},
+			want:        containerHeader(0x08),
+		},
+		{
+			description: "secured packet",
+			sorInfo: models.SorInfo{SorMacIausf: testMacIausf, Countersor: testCounter,
+				SteeringContainer: base64.StdEncoding.EncodeToString(securedPacket)},
+			// list indication, list type: secured packet
+			want: append(containerHeader(0x02), securedPacket...),
+		},
+		{
+			description: "PLMN ID and access technology list",
+			sorInfo: models.SorInfo{SorMacIausf: testMacIausf, Countersor: testCounter, AckInd: true,
+				SteeringContainer: []models.SteeringInfo{
+					{
+						PlmnId:         &models.PlmnId{Mcc: "208", Mnc: "93"},
+						AccessTechList: []models.AccessTech{"NR"},
+					},
+					{
+						PlmnId:         &models.PlmnId{Mcc: "001", Mnc: "001"},
+						AccessTechList: []models.AccessTech{"EUTRAN_IN_WBS1_MODE_ONLY", "UTRAN", "GSM_COMPACT"},
+					},
+				}},
+			// acknowledgement requested, list indication, list type: PLMN ID and access technology list
+			want: append(containerHeader(0x0e),
+				0x02, 0xf8, 0x39, 0x08, 0x00,
+				0x00, 0x11, 0x00, 0xe0, 0x40),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			container, err := BuildSorTransparentContainer(tc.sorInfo)
+			if err != nil {
+				t.Fatalf("BuildSorTransparentContainer: %v", err)
+			}
+			if !bytes.Equal(container, tc.want) {
+				t.Errorf("want: %x, got: %x", tc.want, container)
+			}
+		})
+	}
+
+	invalid := []models.SorInfo{
+		{SorMacIausf: "0001", Countersor: testCounter},
+		{SorMacIausf: testMacIausf, Countersor: "01"},
+		{SorMacIausf: testMacIausf, Countersor: testCounter, SteeringContainer: 42},
+	}
+	for _, sorInfo := range invalid {
+		if _, err := BuildSorTransparentContainer(sorInfo); err == nil {
+			t.Errorf("Invalid SOR information is encoded: %+v", sorInfo)
+		}
+	}
+}
+
+func TestBuildUpuTransparentContainer(t *testing.T) {
+	routingIndicator := []byte{0x12, 0x34}
+
+	testCases := []struct {
+		description string
+		upuInfo     models.UpuInfo
+		want        []byte
+	}{
+		{
+			description: "no UE parameters update data",
+			upuInfo:     models.UpuInfo{UpuMacIausf: testMacIausf, CounterUpu: testCounter},
+			want:        containerHeader(0x00),
+		},
+		{
+			description: "routing indicator update data",
+			upuInfo: models.UpuInfo{UpuMacIausf: testMacIausf, CounterUpu: testCounter, UpuAckInd: true,
+				UpuDataList: []models.UpuData{{SecPacket: base64.StdEncoding.EncodeToString(routingIndicator)}}},
+			// acknowledgement requested, data set type, length of the contents
+			want: append(containerHeader(0x02), 0x01, 0x00, 0x02, 0x12, 0x34),
+		},
+		{
+			description: "default configured NSSAI update data",
+			upuInfo: models.UpuInfo{UpuMacIausf: testMacIausf, CounterUpu: testCounter, UpuAckInd: true,
+				UpuRegInd: true, UpuDataList: []models.UpuData{
+					{DefaultConfNssai: []models.Snssai{{Sst: 1, Sd: "010203"}, {Sst: 2}}},
+				}},
+			// acknowledgement and re-registration requested
+			want: append(containerHeader(0x06), 0x02, 0x00, 0x07, 0x04, 0x01, 0x01, 0x02, 0x03, 0x01, 0x02),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			container, err := BuildUpuTransparentContainer(tc.upuInfo)
+			if err != nil {
+				t.Fatalf("BuildUpuTransparentContainer: %v", err)
+			}
+			if !bytes.Equal(container, tc.want) {
+				t.Errorf("want: %x, got: %x", tc.want, container)
+			}
+		})
+	}
+
+	invalid := []models.UpuInfo{
+		{UpuMacIausf: "zz", CounterUpu: testCounter},
+		{UpuMacIausf: testMacIausf, CounterUpu: "010203"},
+	}
+	for _, upuInfo := range invalid {
+		if _, err := BuildUpuTransparentContainer(upuInfo); err == nil {
+			t.Errorf("Invalid UPU information is encoded: %+v", upuInfo)
+		}
+	}
+}
+
+func TestBuildRegistrationRejectT3346(t *testing.T) {
+	testCases := []struct {
+		description string
+		cause5GMM   uint8
+		t3346       bool
+	}{
+		{description: "congestion", cause5GMM: nasMessage.Cause5GMMCongestion, t3346: true},
+		{description: "other cause", cause5GMM: nasMessage.Cause5GMM5GSServicesNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			buf, err := BuildRegistrationReject(&context.AmfUe{}, tc.cause5GMM, "")
+			if err != nil {
+				t.Fatalf("BuildRegistrationReject: %v", err)
+			}
+			m := nas.NewMessage()
+			if err := m.PlainNasDecode(&buf); err != nil || m.GmmMessage.RegistrationReject == nil {
+				t.Fatalf("No Registration Reject is built: %v", err)
+			}
+			registrationReject := m.GmmMessage.RegistrationReject
+			if cause := registrationReject.Cause5GMM.GetCauseValue(); cause != tc.cause5GMM {
+				t.Errorf("5GMM cause, want: %d, got: %d", tc.cause5GMM, cause)
+			}
+			if !tc.t3346 {
+				if registrationReject.T3346Value != nil {
+					t.Error("T3346 value is sent")
+				}
+				return
+			}
+			if registrationReject.T3346Value == nil ||
+				registrationReject.T3346Value.GetGPRSTimer2Value() != nasConvert.GPRSTimer2ToNas(t3346Value) {
+				t.Errorf("T3346 value, want: %d seconds, got: %+v", t3346Value, registrationReject.T3346Value)
+			}
+		})
+	}
+}
@@ -25,7 +25,7 @@ func SendDLNASTransport(ue *context.RanUe, payloadContainerType uint8, nasPdu []
 	if cause != 0 {
 		causePtr = &cause
 	}
-	nasMsg, err := BuildDLNASTransport(ue.AmfUe, payloadContainerType, nasPdu,
+	nasMsg, err := BuildDLNASTransport(ue.AmfUe, ue.Ran.AnType, payloadContainerType, nasPdu,
 		uint8(pduSessionId), causePtr, backOffTimerUint, backOffTimer)
 	if err != nil {
 		ue.AmfUe.GmmLog.Error(err.Error())
@@ -34,6 +34,42 @@ func SendDLNASTransport(ue *context.RanUe, payloadContainerType uint8, nasPdu []
 	ngap_message.SendDownlinkNasTransport(ue, nasMsg, nil)
 }
 
+// SendSorTransparentContainer delivers the steering of roaming information of the UE after registration
+// (TS 23.122 C.3), it is kept until the UE acknowledges it if the UDM requested an acknowledgement
+func SendSorTransparentContainer(ue *context.RanUe) {
+	amfUe := ue.AmfUe
+	if amfUe.SorInfo == nil {
+		return
+	}
+	sorContainer, err := BuildSorTransparentContainer(*amfUe.SorInfo)
+	if err != nil {
+		amfUe.GmmLog.Errorf("Build SOR Transparent Container failed: %+v", err)
+		return
+	}
+	SendDLNASTransport(ue, nasMessage.PayloadContainerTypeSOR, sorContainer, 0, 0, nil, 0)
+	if !amfUe.SorInfo.AckInd {
+		amfUe.SorInfo = nil
+	}
+}
+
+// SendUpuTransparentContainer delivers the UE parameters update data of the UDM (TS 23.502 4.20.2),
+// it is kept until the UE acknowledges it if the UDM requested an acknowledgement
+func SendUpuTransparentContainer(ue *context.RanUe) {
+	amfUe := ue.AmfUe
+	if amfUe.UpuInfo == nil {
+		return
+	}
+	upuContainer, err := BuildUpuTransparentContainer(*amfUe.UpuInfo)
+	if err != nil {
+		amfUe.GmmLog.Errorf("Build UPU Transparent Container failed: %+v", err)
+		return
+	}
+	SendDLNASTransport(ue, nasMessage.PayloadContainerTypeUEParameterUpdate, upuContainer, 0, 0, nil, 0)
+	if !amfUe.UpuInfo.UpuAckInd {
+		amfUe.UpuInfo = nil
+	}
+}
+
 func SendNotification(ue *context.RanUe, nasMsg []byte) {
 	ue.AmfUe.GmmLog.Info("Send Notification")
 
@@ -107,7 +143,7 @@ func SendServiceAccept(ue *context.RanUe, pDUSessionStatus *[16]bool, reactivati
 	errPduSessionId, errCause []uint8) {
 	ue.AmfUe.GmmLog.Info("Send Service Accept")
 
-	nasMsg, err := BuildServiceAccept(ue.AmfUe, pDUSessionStatus, reactivationResult, errPduSessionId, errCause)
+	nasMsg, err := BuildServiceAccept(ue.AmfUe, ue.Ran.AnType, pDUSessionStatus, reactivationResult, errPduSessionId, errCause)
 	if err != nil {
 		ue.AmfUe.GmmLog.Error(err.Error())
 		return
@@ -126,6 +162,27 @@ func SendConfigurationUpdateCommand(amfUe *context.AmfUe, accessType models.Acce
 	}
 	mobilityRestrictionList := ngap_message.BuildIEMobilityRestrictionList(amfUe)
 	ngap_message.SendDownlinkNasTransport(amfUe.RanUe[accessType], nasMsg, &mobilityRestrictionList)
+
+	// TS 24.501 5.4.4.2: T3555 is only started when the UE is requested to acknowledge
+	if amfUe.ConfigurationUpdateIndication.GetACK() == 1 && context.AMF_Self().T3555Cfg.Enable {
+		if amfUe.T3555 != nil {
+			amfUe.T3555.Stop()
+		}
+		cfg := context.AMF_Self().T3555Cfg
+		amfUe.T3555 = context.NewTimer(cfg.ExpireTime, cfg.MaxRetryTimes, func(expireTimes int32) {
+			if amfUe.RanUe[accessType] == nil {
+				amfUe.GmmLog.Warnf("[NAS] UE Context released, abort retransmission of Configuration Update Command")
+				amfUe.T3555 = nil
+			} else {
+				amfUe.GmmLog.Warnf("T3555 expires, retransmit Configuration Update Command (retry: %d)", expireTimes)
+				ngap_message.SendDownlinkNasTransport(amfUe.RanUe[accessType], nasMsg, &mobilityRestrictionList)
+			}
+		}, func() {
+			amfUe.GmmLog.Warnf("T3555 Expires %d times, abort configuration update procedure", cfg.MaxRetryTimes)
+			amfUe.T3555 = nil // clear the timer
+			amfUe.ConfigurationUpdateIndication = nasType.ConfigurationUpdateIndication{}
+		})
+	}
 }
 
 func SendAuthenticationReject(ue *context.RanUe, eapMsg string) {
@@ -184,7 +241,7 @@ func SendRegistrationReject(ue *context.RanUe, cause5GMM uint8, eapMessage strin
 func SendSecurityModeCommand(ue *context.RanUe, eapSuccess bool, eapMessage string) {
 	ue.AmfUe.GmmLog.Info("Send Security Mode Command")
 
-	nasMsg, err := BuildSecurityModeCommand(ue.AmfUe, eapSuccess, eapMessage)
+	nasMsg, err := BuildSecurityModeCommand(ue.AmfUe, ue.Ran.AnType, eapSuccess, eapMessage)
 	if err != nil {
 		ue.AmfUe.GmmLog.Error(err.Error())
 		return
@@ -200,6 +257,11 @@ func SendSecurityModeCommand(ue *context.RanUe, eapSuccess bool, eapMessage stri
 			ngap_message.SendDownlinkNasTransport(ue, nasMsg, nil)
 		}, func() {
 			amfUe.GmmLog.Warnf("T3560 Expires %d times, abort security mode control procedure", cfg.MaxRetryTimes)
+			if amfUe.RestoreNasSecurityContext() {
+				// a registered UE keeps using the NAS security context in use
+				amfUe.T3560 = nil
+				return
+			}
 			amfUe.Remove()
 		})
 	}
@@ -276,15 +338,33 @@ func SendRegistrationAccept(
 	if ue.RanUe[anType].UeContextRequest {
 		ngap_message.SendInitialContextSetupRequest(ue, anType, nasMsg, pduSessionResourceSetupList, nil, nil, nil)
 	} else {
-		ngap_message.SendDownlinkNasTransport(ue.RanUe[models.AccessType__3_GPP_ACCESS], nasMsg, nil)
+		ngap_message.SendDownlinkNasTransport(ue.RanUe[anType], nasMsg, nil)
 	}
+	startT3550(ue, anType, nasMsg, pduSessionResourceSetupList)
+}
+
+// TS 23.502 4.12.2.2 step 13: the Registration Accept built for non-3GPP access is sent once the N3IWF
+// has answered the Initial Context Setup Request, i.e. the IPsec SA with the UE is established
+func SendRegistrationAcceptForNon3GPPAccess(ue *context.AmfUe) {
+	anType := models.AccessType_NON_3_GPP_ACCESS
+	nasMsg := ue.RegistrationAcceptForNon3GPPAccess
+	if nasMsg == nil || ue.RanUe[anType] == nil {
+		return
+	}
+	ue.GmmLog.Info("Send Registration Accept for Non-3GPP Access")
 
+	ngap_message.SendDownlinkNasTransport(ue.RanUe[anType], nasMsg, nil)
+	startT3550(ue, anType, nasMsg, nil)
+}
+
+func startT3550(ue *context.AmfUe, anType models.AccessType, nasMsg []byte,
+	pduSessionResourceSetupList *ngapType.PDUSessionResourceSetupListCxtReq) {
 	if context.AMF_Self().T3550Cfg.Enable {
 		cfg := context.AMF_Self().T3550Cfg
-		ue.T3550 = context.NewTimer(cfg.ExpireTime, cfg.MaxRetryTimes, func(expireTimes int32) {
+		ue.SetT3550(anType, context.NewTimer(cfg.ExpireTime, cfg.MaxRetryTimes, func(expireTimes int32) {
 			if ue.RanUe[anType] == nil {
 				ue.GmmLog.Warnf("[NAS] UE Context released, abort retransmission of Registration Accept")
-				ue.T3550 = nil
+				ue.SetT3550(anType, nil)
 			} else {
 				if ue.RanUe[anType].UeContextRequest && !ue.RanUe[anType].RecvdInitialContextSetupResponse {
 					ngap_message.SendInitialContextSetupRequest(ue, anType, nasMsg, pduSessionResourceSetupList, nil, nil, nil)
@@ -295,11 +375,11 @@ func SendRegistrationAccept(
 			}
 		}, func() {
 			ue.GmmLog.Warnf("T3550 Expires %d times, abort retransmission of Registration Accept", cfg.MaxRetryTimes)
-			ue.T3550 = nil // clear the timer
+			ue.SetT3550(anType, nil) // clear the timer
 			// TS 24.501 5.5.1.2.8 case c, 5.5.1.3.8 case c
 			ue.State[anType].Set(context.Registered)
 			ue.ClearRegistrationRequestData(anType)
-		})
+		}))
 	}
 }
 
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package gmm
+
+import (
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/openapi/models"
+)
+
+func newRegisteredUe(t *testing.T, supi string, registered ...models.AccessType) *context.AmfUe {
+	ue := context.AMF_Self().NewAmfUe(supi)
+	ue.Reachability = models.UeReachability_REACHABLE
+	for _, anType := range registered {
+		ue.State[anType].Set(context.Registered)
+	}
+	t.Cleanup(func() {
+		ue.StopReachabilityTimers(models.AccessType__3_GPP_ACCESS)
+		ue.StopReachabilityTimers(models.AccessType_NON_3_GPP_ACCESS)
+	})
+	return ue
+}
+
+func TestReachabilityTimerHandler(t *testing.T) {
+	anType := models.AccessType__3_GPP_ACCESS
+
+	t.Run("mobile reachable timer", func(t *testing.T) {
+		ue := newRegisteredUe(t, "imsi-208930000007520", anType)
+		ReachabilityTimerHandler(ue.Supi, "", reachabilityTimerExpiry{anType: anType, ue: ue})
+		if ue.Reachability != models.UeReachability_UNREACHABLE {
+			t.Errorf("Reachability, want: UNREACHABLE, got: %s", ue.Reachability)
+		}
+		if ue.ImplicitDeregTimer[anType] == nil {
+			t.Error("Implicit deregistration timer is not started")
+		}
+		if !ue.State[anType].Is(context.Registered) {
+			t.Error("UE is deregistered on the mobile reachable timer")
+		}
+	})
+
+	t.Run("UE connected before the expiry is handled", func(t *testing.T) {
+		ue := newRegisteredUe(t, "imsi-208930000007521", anType)
+		ran := context.AMF_Self().NewAmfRan(&ngaputil.TestConn{})
+		defer ran.Remove()
+		ranUe, err := ran.NewRanUe(1)
+		if err != nil {
+			t.Fatalf("Failed to create RanUe: %v", err)
+		}
+		ue.AttachRanUe(ranUe)
+
+		ReachabilityTimerHandler(ue.Supi, "", reachabilityTimerExpiry{anType: anType, ue: ue})
+		if ue.Reachability != models.UeReachability_REACHABLE || ue.ImplicitDeregTimer[anType] != nil {
+			t.Error("Expiry is handled for a connected UE")
+		}
+	})
+
+	t.Run("implicit deregistration timer", func(t *testing.T) {
+		ue := newRegisteredUe(t, "imsi-208930000007522", anType)
+		ReachabilityTimerHandler(ue.Supi, "", reachabilityTimerExpiry{anType: anType, implicitDeregistration: true, ue: ue})
+		if !ue.State[anType].Is(context.Deregistered) {
+			t.Error("UE is not deregistered")
+		}
+	})
+}
+
+func TestImplicitDeregistrationProcedure(t *testing.T) {
+	testCases := []struct {
+		description string
+		supi        string
+		registered  []models.AccessType
+		anType      models.AccessType
+		removed     bool
+	}{
+		{
+			description: "last registered access",
+			supi:        "imsi-208930000007523",
+			registered:  []models.AccessType{models.AccessType__3_GPP_ACCESS},
+			anType:      models.AccessType__3_GPP_ACCESS,
+			removed:     true,
+		},
+		{
+			description: "UE stays registered on 3GPP access",
+			supi:        "imsi-208930000007524",
+			registered:  []models.AccessType{models.AccessType__3_GPP_ACCESS, models.AccessType_NON_3_GPP_ACCESS},
+			anType:      models.AccessType_NON_3_GPP_ACCESS,
+		},
+		{
+			description: "access is not registered",
+			supi:        "imsi-208930000007525",
+			registered:  []models.AccessType{models.AccessType__3_GPP_ACCESS},
+			anType:      models.AccessType_NON_3_GPP_ACCESS,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ue := newRegisteredUe(t, tc.supi, tc.registered...)
+			if err := ImplicitDeregistrationProcedure(ue, tc.anType); err != nil {
+				t.Fatalf("ImplicitDeregistrationProcedure: %v", err)
+			}
+			if !ue.State[tc.anType].Is(context.Deregistered) {
+				t.Errorf("UE is not deregistered on %s", tc.anType)
+			}
+			for _, anType := range tc.registered {
+				if anType != tc.anType && !ue.State[anType].Is(context.Registered) {
+					t.Errorf("UE is deregistered on %s", anType)
+				}
+			}
+			if _, ok := context.AMF_Self().AmfUeFindBySupi(tc.supi); ok == tc.removed {
+				t.Errorf("UE context removed, want: %v, got: %v", tc.removed, !ok)
+			}
+			if !tc.removed {
+				ue.Remove()
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package gmm
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+var (
+	sliceA = models.Snssai{Sst: 1, Sd: "010203"}
+	sliceB = models.Snssai{Sst: 1, Sd: "112233"}
+)
+
+// recordingConn keeps every message sent to the RAN, the retransmissions are sent by the timers
+type recordingConn struct {
+	ngaputil.TestConn
+	mu   sync.Mutex
+	msgs [][]byte
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, b)
+	return len(b), nil
+}
+
+func (c *recordingConn) sent() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.msgs...)
+}
+
+func newSliceUe(t *testing.T, supi string, connected bool, allowed ...models.Snssai) (*context.AmfUe, *recordingConn) {
+	conn := &recordingConn{}
+	self := context.AMF_Self()
+	ran := self.NewAmfRan(conn)
+	t.Cleanup(ran.Remove)
+
+	anType := models.AccessType__3_GPP_ACCESS
+	tai := models.Tai{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: "000001"}
+	ran.SupportedTAList = []context.SupportedTAI{{Tai: tai}}
+
+	ue := self.NewAmfUe(supi)
+	self.AllocateGutiToUe(ue)
+	ue.RegistrationArea[anType] = []models.Tai{tai}
+	for i := range allowed {
+		ue.SubscribedNssai = append(ue.SubscribedNssai, models.SubscribedSnssai{SubscribedSnssai: &allowed[i]})
+		ue.ConfiguredNssai = append(ue.ConfiguredNssai, models.ConfiguredSnssai{ConfiguredSnssai: &allowed[i]})
+		ue.AllowedNssai[anType] = append(ue.AllowedNssai[anType], models.AllowedSnssai{AllowedSnssai: &allowed[i]})
+	}
+	if connected {
+		ranUe, err := ran.NewRanUe(1)
+		if err != nil {
+			t.Fatalf("Failed to create RanUe: %v", err)
+		}
+		ue.AttachRanUe(ranUe)
+	}
+	t.Cleanup(func() {
+		if ue.T3555 != nil {
+			ue.T3555.Stop()
+		}
+		if ue.T3513 != nil {
+			ue.T3513.Stop()
+		}
+		ue.Remove()
+	})
+	return ue, conn
+}
+
+func setT3555Cfg(t *testing.T, cfg factory.TimerValue) {
+	self := context.AMF_Self()
+	t3555Cfg := self.T3555Cfg
+	self.T3555Cfg = cfg
+	t.Cleanup(func() { self.T3555Cfg = t3555Cfg })
+}
+
+func decodeNgap(t *testing.T, b []byte) *ngapType.NGAPPDU {
+	pdu, err := ngap.Decoder(b)
+	if err != nil || pdu.InitiatingMessage == nil {
+		t.Fatalf("Failed to decode the NGAP message: %v", err)
+	}
+	return pdu
+}
+
+// decodeConfigurationUpdateCommand decodes the plain Configuration Update Command of a DownlinkNASTransport
+func decodeConfigurationUpdateCommand(t *testing.T, b []byte) *nasMessage.ConfigurationUpdateCommand {
+	pdu := decodeNgap(t, b)
+	if pdu.InitiatingMessage.Value.DownlinkNASTransport == nil {
+		t.Fatal("No DownlinkNASTransport is sent")
+	}
+	for _, ie := range pdu.InitiatingMessage.Value.DownlinkNASTransport.ProtocolIEs.List {
+		if ie.Id.Value != ngapType.ProtocolIEIDNASPDU {
+			continue
+		}
+		m := nas.NewMessage()
+		if err := m.PlainNasDecode(&ie.Value.NASPDU.Value); err != nil {
+			t.Fatalf("Failed to decode the NAS message: %v", err)
+		}
+		if m.GmmMessage == nil || m.GmmMessage.ConfigurationUpdateCommand == nil {
+			t.Fatal("No Configuration Update Command is sent")
+		}
+		return m.GmmMessage.ConfigurationUpdateCommand
+	}
+	t.Fatal("No NAS-PDU in the DownlinkNASTransport")
+	return nil
+}
+
+func checkSliceConfigurationUpdate(t *testing.T, cuc *nasMessage.ConfigurationUpdateCommand, allowed int,
+	registrationRequested bool) {
+	if cuc.NetworkSlicingIndication == nil || cuc.NetworkSlicingIndication.GetNSSCI() != 1 {
+		t.Error("Network slicing subscription change is not indicated")
+	}
+	if cuc.ConfigurationUpdateIndication == nil || cuc.ConfigurationUpdateIndication.GetACK() != 1 {
+		t.Error("Acknowledgement is not requested")
+	} else if red := cuc.ConfigurationUpdateIndication.GetRED() == 1; red != registrationRequested {
+		t.Errorf("Registration requested, want: %v, got: %v", registrationRequested, red)
+	}
+	// an S-NSSAI with SD takes 5 octets
+	if cuc.AllowedNSSAI == nil || int(cuc.AllowedNSSAI.GetLen()) != 5*allowed {
+		t.Errorf("Allowed NSSAI does not have %d S-NSSAIs", allowed)
+	}
+}
+
+func TestHandleUeSliceInfoAdd(t *testing.T) {
+	setT3555Cfg(t, factory.TimerValue{})
+	anType := models.AccessType__3_GPP_ACCESS
+
+	t.Run("connected UE", func(t *testing.T) {
+		ue, conn := newSliceUe(t, "imsi-208930000007501", true, sliceA)
+		if err := HandleUeSliceInfoAdd(ue, anType, sliceB); err != nil {
+			t.Fatalf("HandleUeSliceInfoAdd: %v", err)
+		}
+		if !ue.InAllowedNssai(sliceB, anType) {
+			t.Error("Added slice is not allowed")
+		}
+		msgs := conn.sent()
+		if len(msgs) != 1 {
+			t.Fatalf("Sent messages, want: 1, got: %d", len(msgs))
+		}
+		checkSliceConfigurationUpdate(t, decodeConfigurationUpdateCommand(t, msgs[0]), 2, false)
+	})
+
+	t.Run("slice already allowed", func(t *testing.T) {
+		ue, conn := newSliceUe(t, "imsi-208930000007502", true, sliceA, sliceB)
+		if err := HandleUeSliceInfoAdd(ue, anType, sliceB); err != nil {
+			t.Fatalf("HandleUeSliceInfoAdd: %v", err)
+		}
+		if len(ue.AllowedNssai[anType]) != 2 {
+			t.Errorf("Allowed NSSAI is changed: %+v", ue.AllowedNssai[anType])
+		}
+		if msgs := conn.sent(); len(msgs) != 0 {
+			t.Errorf("Configuration Update Command is sent for an unchanged NSSAI")
+		}
+	})
+
+	t.Run("idle UE", func(t *testing.T) {
+		ue, conn := newSliceUe(t, "imsi-208930000007503", false, sliceA)
+		if err := HandleUeSliceInfoAdd(ue, anType, sliceB); err != nil {
+			t.Fatalf("HandleUeSliceInfoAdd: %v", err)
+		}
+		msgs := conn.sent()
+		if len(msgs) != 1 || decodeNgap(t, msgs[0]).InitiatingMessage.Value.Paging == nil {
+			t.Fatal("UE is not paged")
+		}
+		if !ue.ConfigurationUpdatePending || ue.OnGoing(anType).Procedure != context.OnGoingProcedurePaging {
+			t.Fatal("Configuration Update Command is not pending on the paging")
+		}
+
+		// the UE answers the paging, the command is built with the security context of the new connection
+		ran, _ := context.AMF_Self().AmfRanFindByConn(conn)
+		ranUe, err := ran.NewRanUe(1)
+		if err != nil {
+			t.Fatalf("Failed to create RanUe: %v", err)
+		}
+		ue.AttachRanUe(ranUe)
+		sendPendingConfigurationUpdate(ue, anType)
+		msgs = conn.sent()
+		if len(msgs) != 2 {
+			t.Fatalf("Sent messages, want: 2, got: %d", len(msgs))
+		}
+		checkSliceConfigurationUpdate(t, decodeConfigurationUpdateCommand(t, msgs[1]), 2, false)
+		if ue.ConfigurationUpdatePending || ue.NetworkSlicingSubscriptionChanged {
+			t.Error("Pending Configuration Update Command is not cleared")
+		}
+	})
+}
+
+func TestHandleUeSliceInfoDelete(t *testing.T) {
+	setT3555Cfg(t, factory.TimerValue{})
+	anType := models.AccessType__3_GPP_ACCESS
+
+	ue, conn := newSliceUe(t, "imsi-208930000007504", true, sliceA, sliceB)
+	if err := HandleUeSliceInfoDelete(ue, anType, sliceB); err != nil {
+		t.Fatalf("HandleUeSliceInfoDelete: %v", err)
+	}
+	if ue.InAllowedNssai(sliceB, anType) || ue.InSubscribedNssai(sliceB) {
+		t.Error("Deleted slice is still allowed")
+	}
+	msgs := conn.sent()
+	if len(msgs) != 1 {
+		t.Fatalf("Sent messages, want: 1, got: %d", len(msgs))
+	}
+	// no PDU session is released, the UE does not need to re-register
+	checkSliceConfigurationUpdate(t, decodeConfigurationUpdateCommand(t, msgs[0]), 1, false)
+}
+
+func TestConfigurationUpdateCommandRetransmission(t *testing.T) {
+	anType := models.AccessType__3_GPP_ACCESS
+
+	t.Run("T3555 expires", func(t *testing.T) {
+		setT3555Cfg(t, factory.TimerValue{Enable: true, ExpireTime: 20 * time.Millisecond, MaxRetryTimes: 2})
+		ue, conn := newSliceUe(t, "imsi-208930000007505", true, sliceA)
+		if err := HandleUeSliceInfoAdd(ue, anType, sliceB); err != nil {
+			t.Fatalf("HandleUeSliceInfoAdd: %v", err)
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for len(conn.sent()) < 3 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		// the procedure is aborted after the last retransmission
+		time.Sleep(100 * time.Millisecond)
+		msgs := conn.sent()
+		if len(msgs) != 3 {
+			t.Fatalf("Sent messages, want: 3, got: %d", len(msgs))
+		}
+		for _, msg := range msgs {
+			checkSliceConfigurationUpdate(t, decodeConfigurationUpdateCommand(t, msg), 2, false)
+		}
+	})
+
+	t.Run("Configuration Update Complete", func(t *testing.T) {
+		setT3555Cfg(t, factory.TimerValue{Enable: true, ExpireTime: 50 * time.Millisecond, MaxRetryTimes: 2})
+		ue, conn := newSliceUe(t, "imsi-208930000007506", true, sliceA)
+		if err := HandleUeSliceInfoAdd(ue, anType, sliceB); err != nil {
+			t.Fatalf("HandleUeSliceInfoAdd: %v", err)
+		}
+		if ue.T3555 == nil {
+			t.Fatal("T3555 is not started")
+		}
+		if err := HandleConfigurationUpdateComplete(ue, anType, nil); err != nil {
+			t.Fatalf("HandleConfigurationUpdateComplete: %v", err)
+		}
+		time.Sleep(150 * time.Millisecond)
+		if msgs := conn.sent(); len(msgs) != 1 {
+			t.Errorf("Configuration Update Command is retransmitted after the Complete: %d messages", len(msgs))
+		}
+	})
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/omec-project/amf/context"
 	gmm_message "github.com/omec-project/amf/gmm/message"
 	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/metrics"
+	"github.com/omec-project/amf/producer/callback"
 	"github.com/omec-project/amf/util"
 	"github.com/omec-project/fsm"
 	"github.com/omec-project/nas"
@@ -79,6 +81,8 @@ func Registered(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 		//store context in DB. Registration procedure is complete.
 		amfUe.PublishUeCtxtInfo()
 		context.StoreContextInDB(amfUe)
+		// the UE joins the event subscriptions for any UE and for its groups
+		callback.JoinEventSubscriptions(amfUe)
 	case GmmMessageEvent:
 		amfUe := args[ArgAmfUe].(*context.AmfUe)
 		procedureCode := args[ArgProcedureCode].(int64)
@@ -104,7 +108,7 @@ func Registered(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 				logger.GmmLog.Errorln(err)
 			}
 		case nas.MsgTypeConfigurationUpdateComplete:
-			if err := HandleConfigurationUpdateComplete(amfUe, gmmMessage.ConfigurationUpdateComplete); err != nil {
+			if err := HandleConfigurationUpdateComplete(amfUe, accessType, gmmMessage.ConfigurationUpdateComplete); err != nil {
 				logger.GmmLog.Errorln(err)
 			}
 		case nas.MsgTypeServiceRequest:
@@ -127,6 +131,15 @@ func Registered(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 			if err := HandleStatus5GMM(amfUe, accessType, gmmMessage.Status5GMM); err != nil {
 				logger.GmmLog.Errorln(err)
 			}
+		// Security mode control procedure re-run on a security policy change or NAS COUNT wrap-around
+		case nas.MsgTypeSecurityModeComplete:
+			if err := HandleSecurityContextUpdateComplete(amfUe, accessType); err != nil {
+				logger.GmmLog.Errorln(err)
+			}
+		case nas.MsgTypeSecurityModeReject:
+			if err := HandleSecurityModeReject(amfUe, accessType, gmmMessage.SecurityModeReject); err != nil {
+				logger.GmmLog.Errorln(err)
+			}
 		default:
 			amfUe.GmmLog.Errorf("state mismatch: receieve gmm message[message type 0x%0x] at %s state",
 				gmmMessage.GetMessageType(), state.Current())
@@ -139,9 +152,32 @@ func Registered(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 		amfUe := args[ArgAmfUe].(*context.AmfUe)
 		accessType := args[ArgAccessType].(models.AccessType)
 		NetworkInitiatedDeregistrationProcedure(amfUe, accessType)
-	/*TODO */
 	case SliceInfoAddEvent:
+		amfUe := args[ArgAmfUe].(*context.AmfUe)
+		accessType := args[ArgAccessType].(models.AccessType)
+		nssai := args[ArgNssai].(models.Snssai)
+		if err := HandleUeSliceInfoAdd(amfUe, accessType, nssai); err != nil {
+			logger.GmmLog.Errorln(err)
+		}
 	case SliceInfoDeleteEvent:
+		amfUe := args[ArgAmfUe].(*context.AmfUe)
+		accessType := args[ArgAccessType].(models.AccessType)
+		nssai := args[ArgNssai].(models.Snssai)
+		if err := HandleUeSliceInfoDelete(amfUe, accessType, nssai); err != nil {
+			logger.GmmLog.Errorln(err)
+		}
+	case SecurityPolicyChangeEvent:
+		amfUe := args[ArgAmfUe].(*context.AmfUe)
+		accessType := args[ArgAccessType].(models.AccessType)
+		if err := HandleSecurityPolicyChange(amfUe, accessType); err != nil {
+			logger.GmmLog.Errorln(err)
+		}
+	case NasCountRekeyEvent:
+		amfUe := args[ArgAmfUe].(*context.AmfUe)
+		accessType := args[ArgAccessType].(models.AccessType)
+		if err := HandleNasCountRekey(amfUe, accessType); err != nil {
+			logger.GmmLog.Errorln(err)
+		}
 	case fsm.ExitEvent:
 		logger.GmmLog.Debugln(event)
 	default:
@@ -249,7 +285,7 @@ func SecurityMode(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 		amfUe.ProducerLog = logger.ProducerLog.WithField(logger.FieldSupi, fmt.Sprintf("SUPI:%s", amfUe.Supi))
 		amfUe.PublishUeCtxtInfo()
 		amfUe.GmmLog.Debugln("EntryEvent at GMM State[SecurityMode]")
-		if amfUe.SecurityContextIsValid() {
+		if amfUe.SecurityContextIsValid() && context.AMF_Self().SecurityAlgAllowed(amfUe) {
 			amfUe.GmmLog.Debugln("UE has a valid security context - skip security mode control procedure")
 			if err := GmmFSM.SendEvent(state, SecurityModeSuccessEvent, fsm.ArgsType{
 				ArgAmfUe:      amfUe,
@@ -259,14 +295,46 @@ func SecurityMode(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 				logger.GmmLog.Errorln(err)
 			}
 		} else {
-			eapSuccess := args[ArgEAPSuccess].(bool)
-			eapMessage := args[ArgEAPMessage].(string)
+			// not set when the authentication is skipped for an UE whose algorithms are changed
+			eapSuccess, _ := args[ArgEAPSuccess].(bool)
+			eapMessage, _ := args[ArgEAPMessage].(string)
+			// the security context of an abandoned security mode control of the registered UE is not restored
+			amfUe.DiscardNasSecurityContext()
 			// Select enc/int algorithm based on ue security capability & amf's policy,
 			amfSelf := context.AMF_Self()
-			amfUe.SelectSecurityAlg(amfSelf.SecurityAlgorithm.IntegrityOrder, amfSelf.SecurityAlgorithm.CipheringOrder)
-			// Generate KnasEnc, KnasInt
-			amfUe.DerivateAlgKey()
+			if amfUe.UnauthenticatedSupi &&
+				amfUe.RegistrationType5GS == nasMessage.RegistrationType5GSEmergencyRegistration {
+				// TS 33.501 10.2.2.2: NULL algorithms are used for an unauthenticated emergency registration
+				amfUe.CipheringAlg = security.AlgCiphering128NEA0
+				amfUe.IntegrityAlg = security.AlgIntegrity128NIA0
+			} else {
+				intOrder, encOrder := amfSelf.SecurityAlgOrders(amfUe)
+				if !amfUe.SelectSecurityAlg(intOrder, encOrder) {
+					amfUe.GmmLog.Warnf("No NAS security algorithm allowed by the policy is supported by the UE, "+
+						"integrity: %v, ciphering: %v", intOrder, encOrder)
+					metrics.IncrementNasSecurityAlgStats("none", "none", "rejected")
+					gmm_message.SendRegistrationReject(amfUe.RanUe[accessType],
+						nasMessage.Cause5GMMUESecurityCapabilitiesMismatch, "")
+					if err := GmmFSM.SendEvent(state, SecurityModeFailEvent, fsm.ArgsType{
+						ArgAmfUe:      amfUe,
+						ArgAccessType: accessType,
+					}); err != nil {
+						logger.GmmLog.Errorln(err)
+					}
+					return
+				}
+				amfUe.GmmLog.Infof("NAS security algorithms negotiated, integrity: %s, ciphering: %s",
+					context.IntegrityAlgToString(amfUe.IntegrityAlg), context.CipheringAlgToString(amfUe.CipheringAlg))
+				metrics.IncrementNasSecurityAlgStats(context.IntegrityAlgToString(amfUe.IntegrityAlg),
+					context.CipheringAlgToString(amfUe.CipheringAlg), "accepted")
+				// Generate KnasEnc, KnasInt
+				amfUe.DerivateAlgKey()
+			}
 			if amfUe.CipheringAlg == security.AlgCiphering128NEA0 && amfUe.IntegrityAlg == security.AlgIntegrity128NIA0 {
+				if eapSuccess {
+					// without a Security Mode Command the EAP-success is conveyed in the Authentication Result
+					gmm_message.SendAuthenticationResult(amfUe.RanUe[accessType], true, eapMessage)
+				}
 				GmmFSM.SendEvent(state, SecuritySkipEvent, fsm.ArgsType{
 					ArgAmfUe:      amfUe,
 					ArgAccessType: accessType,
@@ -368,6 +436,10 @@ func ContextSetup(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 				if err := HandleInitialRegistration(amfUe, accessType); err != nil {
 					logger.GmmLog.Errorln(err)
 				}
+			case nasMessage.RegistrationType5GSEmergencyRegistration:
+				if err := HandleEmergencyRegistration(amfUe, accessType); err != nil {
+					logger.GmmLog.Errorln(err)
+				}
 			case nasMessage.RegistrationType5GSMobilityRegistrationUpdating:
 				fallthrough
 			case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
@@ -404,6 +476,17 @@ func ContextSetup(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 						logger.GmmLog.Errorln(err)
 					}
 				}
+			case nasMessage.RegistrationType5GSEmergencyRegistration:
+				if err := HandleEmergencyRegistration(amfUe, accessType); err != nil {
+					logger.GmmLog.Errorln(err)
+					err = GmmFSM.SendEvent(state, ContextSetupFailEvent, fsm.ArgsType{
+						ArgAmfUe:      amfUe,
+						ArgAccessType: accessType,
+					})
+					if err != nil {
+						logger.GmmLog.Errorln(err)
+					}
+				}
 			case nasMessage.RegistrationType5GSMobilityRegistrationUpdating:
 				fallthrough
 			case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
@@ -436,8 +519,7 @@ func ContextSetup(state *fsm.State, event fsm.EventType, args fsm.ArgsType) {
 		logger.GmmLog.Debugln(event)
 		amfUe := args[ArgAmfUe].(*context.AmfUe)
 		accessType := args[ArgAccessType].(models.AccessType)
-		amfUe.T3550.Stop()
-		amfUe.T3550 = nil
+		amfUe.StopT3550(accessType)
 		amfUe.State[accessType].Set(context.Registered)
 		NetworkInitiatedDeregistrationProcedure(amfUe, accessType)
 	case ContextSetupFailEvent:
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package gmm
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/openapi/models"
+)
+
+func TestHandleSorAck(t *testing.T) {
+	var acknowledged []string
+	udm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ackInfo models.AcknowledgeInfo
+		if r.Method != http.MethodPut || !strings.HasSuffix(r.URL.Path, "/am-data/sor-ack") ||
+			json.NewDecoder(r.Body).Decode(&ackInfo) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		acknowledged = append(acknowledged, ackInfo.SorMacIue)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer udm.Close()
+
+	sorMacIue := bytes.Repeat([]byte{0xa5}, 16)
+	ack := append([]byte{0x01}, sorMacIue...)
+
+	testCases := []struct {
+		description string
+		sorInfo     *models.SorInfo
+		container   []byte
+		accepted    bool
+	}{
+		{
+			description: "acknowledgement",
+			sorInfo:     &models.SorInfo{AckInd: true},
+			container:   ack,
+			accepted:    true,
+		},
+		{
+			description: "no SOR information sent",
+			container:   ack,
+		},
+		{
+			description: "acknowledgement not requested",
+			sorInfo:     &models.SorInfo{},
+			container:   ack,
+		},
+		{
+			description: "SOR-MAC-IUE too short",
+			sorInfo:     &models.SorInfo{AckInd: true},
+			container:   ack[:16],
+		},
+		{
+			description: "SOR-MAC-IUE too long",
+			sorInfo:     &models.SorInfo{AckInd: true},
+			container:   append(append([]byte(nil), ack...), 0x00),
+		},
+		{
+			description: "SOR data type is not acknowledgement",
+			sorInfo:     &models.SorInfo{AckInd: true},
+			container:   append([]byte{0x00}, sorMacIue...),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			acknowledged = nil
+			ue := &context.AmfUe{Supi: "imsi-208930000007540", NudmSDMUri: udm.URL, SorInfo: tc.sorInfo,
+				GmmLog: logger.GmmLog}
+
+			err := handleSorAck(ue, tc.container)
+			if accepted := err == nil; accepted != tc.accepted {
+				t.Fatalf("Accepted, want: %v, got: %v (%v)", tc.accepted, accepted, err)
+			}
+			if !tc.accepted {
+				if len(acknowledged) != 0 {
+					t.Error("Invalid acknowledgement is sent to the UDM")
+				}
+				return
+			}
+			if len(acknowledged) != 1 || acknowledged[0] != "a5a5a5a5a5a5a5a5a5a5a5a5a5a5a5a5" {
+				t.Errorf("SOR-MAC-IUE sent to the UDM: %v", acknowledged)
+			}
+			if ue.SorInfo != nil {
+				t.Error("SOR information is kept after the acknowledgement")
+			}
+		})
+	}
+}
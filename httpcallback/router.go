@@ -104,4 +104,18 @@ var routes = Routes{
 		"/n1-message-notify",
 		HTTPN1MessageNotify,
 	},
+
+	{
+		"N2InfoNotify",
+		strings.ToUpper("Post"),
+		"/n2-info-notify/:ueContextId",
+		HTTPN2InfoNotify,
+	},
+
+	{
+		"SdmChangeNotify",
+		strings.ToUpper("Post"),
+		"/sdm-change-notify/:supi",
+		HTTPSdmChangeNotify,
+	},
 }
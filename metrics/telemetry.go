@@ -23,6 +23,9 @@ import (
 type AmfStats struct {
 	ngapMsg           *prometheus.CounterVec
 	gnbSessionProfile *prometheus.GaugeVec
+	sctpNotification  *prometheus.CounterVec
+	load              *prometheus.GaugeVec
+	nasSecurity       *prometheus.CounterVec
 }
 
 var amfStats *AmfStats
@@ -38,6 +41,21 @@ func initAmfStats() *AmfStats {
 			Name: "gnb_session_profile",
 			Help: "gNB session Profile",
 		}, []string{"id", "ip", "state", "tac"}),
+
+		sctpNotification: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sctp_notifications_total",
+			Help: "SCTP notifications received on N2 associations",
+		}, []string{"gnb_id", "type", "state"}),
+
+		load: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "amf_load",
+			Help: "AMF load as seen by the overload control",
+		}, []string{"type"}),
+
+		nasSecurity: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nas_security_negotiations_total",
+			Help: "NAS security algorithms negotiated with the UEs",
+		}, []string{"integrity", "ciphering", "result"}),
 	}
 }
 
@@ -50,6 +68,15 @@ func (ps *AmfStats) register() error {
 	if err := prometheus.Register(ps.gnbSessionProfile); err != nil {
 		return err
 	}
+	if err := prometheus.Register(ps.sctpNotification); err != nil {
+		return err
+	}
+	if err := prometheus.Register(ps.load); err != nil {
+		return err
+	}
+	if err := prometheus.Register(ps.nasSecurity); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -76,3 +103,19 @@ func IncrementNgapMsgStats(amfID, msgType, direction, result, reason string) {
 func SetGnbSessProfileStats(id, ip, state, tac string, count uint64) {
 	amfStats.gnbSessionProfile.WithLabelValues(id, ip, state, tac).Set(float64(count))
 }
+
+// IncrementSctpNotificationStats counts SCTP notifications of the N2 associations,
+// including the path failovers of multi-homed associations
+func IncrementSctpNotificationStats(gnbID, notificationType, state string) {
+	amfStats.sctpNotification.WithLabelValues(gnbID, notificationType, state).Inc()
+}
+
+// SetAmfLoadStats maintains load info (queue depth, goroutines, SBI latency, overload state)
+func SetAmfLoadStats(loadType string, value float64) {
+	amfStats.load.WithLabelValues(loadType).Set(value)
+}
+
+// IncrementNasSecurityAlgStats counts the NAS security algorithms negotiated with the UEs
+func IncrementNasSecurityAlgStats(integrity, ciphering, result string) {
+	amfStats.nasSecurity.WithLabelValues(integrity, ciphering, result).Inc()
+}
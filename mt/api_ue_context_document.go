@@ -37,6 +37,9 @@ func HTTPProvideDomainSelectionInfo(c *gin.Context) {
 
 	rsp := producer.HandleProvideDomainSelectionInfoRequest(req)
 
+	for key, val := range rsp.Header {
+		c.Header(key, val[0])
+	}
 	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
 	if err != nil {
 		logger.MtLog.Errorln(err)
@@ -29,10 +29,21 @@ func Dispatch(ue *context.AmfUe, accessType models.AccessType, procedureCode int
 		return fmt.Errorf("UE State is empty (accessType=%q). Can't send GSM Message", accessType)
 	}
 
-	return gmm.GmmFSM.SendEvent(ue.State[accessType], gmm.GmmMessageEvent, fsm.ArgsType{
+	if err := gmm.GmmFSM.SendEvent(ue.State[accessType], gmm.GmmMessageEvent, fsm.ArgsType{
 		gmm.ArgAmfUe:         ue,
 		gmm.ArgAccessType:    accessType,
 		gmm.ArgNASMessage:    msg.GmmMessage,
 		gmm.ArgProcedureCode: procedureCode,
-	})
+	}); err != nil {
+		return err
+	}
+
+	// TS 33.501 6.4.3.1: the NAS COUNT shall not wrap around with the same K_AMF
+	if ue.State[accessType].Is(context.Registered) && ue.SecurityContextIsValid() && ue.NasCountNearWrap(accessType) {
+		return gmm.GmmFSM.SendEvent(ue.State[accessType], gmm.NasCountRekeyEvent, fsm.ArgsType{
+			gmm.ArgAmfUe:      ue,
+			gmm.ArgAccessType: accessType,
+		})
+	}
+	return nil
 }
@@ -23,7 +23,9 @@ import (
 
 var mutex sync.Mutex
 
-func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
+// Encode encodes the NAS message, a security protected message is protected with the NAS COUNT and the
+// NAS connection identifier of the access the message is sent on (TS 33.501 6.4.2)
+func Encode(ue *context.AmfUe, anType models.AccessType, msg *nas.Message) ([]byte, error) {
 	if ue == nil {
 		return nil, fmt.Errorf("amfUe is nil")
 	}
@@ -36,6 +38,8 @@ func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
 		return msg.PlainNasEncode()
 	} else {
 		// Security protected NAS Message
+		ulCount, dlCount := ue.NasULCount(anType), ue.NasDLCount(anType)
+		bearer := context.NasBearer(anType)
 		// a security protected NAS message must be integrity protected, and ciphering is optional
 		needCiphering := false
 		switch msg.SecurityHeader.SecurityHeaderType {
@@ -46,8 +50,8 @@ func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
 			needCiphering = true
 		case nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext:
 			ue.NASLog.Debugln("Security header type: Integrity Protected With New 5G Security Context")
-			ue.ULCount.Set(0, 0)
-			ue.DLCount.Set(0, 0)
+			ulCount.Set(0, 0)
+			dlCount.Set(0, 0)
 		default:
 			return nil, fmt.Errorf("Wrong security header type: 0x%0x", msg.SecurityHeader.SecurityHeaderType)
 		}
@@ -61,22 +65,22 @@ func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
 		ue.NASLog.Tracef("plain payload:\n%+v", hex.Dump(payload))
 
 		if needCiphering {
-			ue.NASLog.Debugf("Encrypt NAS message (algorithm: %+v, DLCount: 0x%0x)", ue.CipheringAlg, ue.DLCount.Get())
+			ue.NASLog.Debugf("Encrypt NAS message (algorithm: %+v, DLCount: 0x%0x)", ue.CipheringAlg, dlCount.Get())
 			ue.NASLog.Tracef("NAS ciphering key: %0x", ue.KnasEnc)
-			if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.DLCount.Get(), security.Bearer3GPP,
+			if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, dlCount.Get(), bearer,
 				security.DirectionDownlink, payload); err != nil {
 				return nil, fmt.Errorf("Encrypt error: %+v", err)
 			}
 		}
 
 		// add sequece number
-		payload = append([]byte{ue.DLCount.SQN()}, payload[:]...)
+		payload = append([]byte{dlCount.SQN()}, payload[:]...)
 
-		ue.NASLog.Debugf("Calculate NAS MAC (algorithm: %+v, DLCount: 0x%0x)", ue.IntegrityAlg, ue.DLCount.Get())
+		ue.NASLog.Debugf("Calculate NAS MAC (algorithm: %+v, DLCount: 0x%0x)", ue.IntegrityAlg, dlCount.Get())
 		ue.NASLog.Debugf("NAS integrity key: %0x", ue.KnasInt)
 		mutex.Lock()
 		defer mutex.Unlock()
-		mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.DLCount.Get(), security.Bearer3GPP,
+		mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, dlCount.Get(), bearer,
 			security.DirectionDownlink, payload)
 		if err != nil {
 			return nil, fmt.Errorf("MAC calcuate error: %+v", err)
@@ -90,7 +94,7 @@ func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
 		payload = append(msgSecurityHeader, payload[:]...)
 
 		// Increase DL Count
-		ue.DLCount.AddOne()
+		dlCount.AddOne()
 		return payload, nil
 	}
 }
@@ -240,6 +244,9 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 			return msg, err
 		}
 	} else { // Security protected NAS message
+		ulCount := ue.NasULCount(accessType)
+		bearer := context.NasBearer(accessType)
+		protectedPdu := payload
 		securityHeader := payload[0:6]
 		ue.NASLog.Traceln("securityHeader is ", securityHeader)
 		sequenceNumber := payload[6]
@@ -260,22 +267,22 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 		case nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext:
 			ue.NASLog.Debugln("Security header type: Integrity Protected And Ciphered With New 5G Security Context")
 			ciphered = true
-			ue.ULCount.Set(0, 0)
+			ulCount.Set(0, 0)
 		default:
 			return nil, fmt.Errorf("Wrong security header type: 0x%0x", msg.SecurityHeader.SecurityHeaderType)
 		}
 
-		if ue.ULCount.SQN() > sequenceNumber {
+		if ulCount.SQN() > sequenceNumber {
 			ue.NASLog.Debugf("set ULCount overflow")
-			ue.ULCount.SetOverflow(ue.ULCount.Overflow() + 1)
+			ulCount.SetOverflow(ulCount.Overflow() + 1)
 		}
-		ue.ULCount.SetSQN(sequenceNumber)
+		ulCount.SetSQN(sequenceNumber)
 
-		ue.NASLog.Debugf("Calculate NAS MAC (algorithm: %+v, ULCount: 0x%0x)", ue.IntegrityAlg, ue.ULCount.Get())
+		ue.NASLog.Debugf("Calculate NAS MAC (algorithm: %+v, ULCount: 0x%0x)", ue.IntegrityAlg, ulCount.Get())
 		ue.NASLog.Debugf("NAS integrity key0x: %0x", ue.KnasInt)
 		mutex.Lock()
 		defer mutex.Unlock()
-		mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.ULCount.Get(), security.Bearer3GPP,
+		mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ulCount.Get(), bearer,
 			security.DirectionUplink, payload)
 		if err != nil {
 			return nil, fmt.Errorf("MAC calcuate error: %+v", err)
@@ -290,10 +297,10 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 		}
 
 		if ciphered {
-			ue.NASLog.Debugf("Decrypt NAS message (algorithm: %+v, ULCount: 0x%0x)", ue.CipheringAlg, ue.ULCount.Get())
+			ue.NASLog.Debugf("Decrypt NAS message (algorithm: %+v, ULCount: 0x%0x)", ue.CipheringAlg, ulCount.Get())
 			ue.NASLog.Tracef("NAS ciphering key: %0x", ue.KnasEnc)
 			// decrypt payload without sequence number (payload[1])
-			if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.ULCount.Get(), security.Bearer3GPP,
+			if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ulCount.Get(), bearer,
 				security.DirectionUplink, payload[1:]); err != nil {
 				return nil, fmt.Errorf("Encrypt error: %+v", err)
 			}
@@ -302,6 +309,11 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 		// remove sequece Number
 		payload = payload[1:]
 		err = msg.PlainNasDecode(&payload)
+		if err == nil && !ciphered && msg.GmmMessage != nil &&
+			msg.GmmHeader.GetMessageType() == nas.MsgTypeRegistrationRequest {
+			// kept for the integrity check in the old AMF (TS 23.502 4.2.2.2.2 step 4)
+			ue.RegistrationRequestPdu = append([]byte(nil), protectedPdu...)
+		}
 
 		/*
 			integrity check failed, as per spec 24501 section 4.4.4.3 AMF shouldnt process or forward to SMF
@@ -333,3 +345,35 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 		return msg, err
 	}
 }
+
+// VerifyIntegrity checks the MAC of a security protected NAS message which was received by another AMF on
+// the access anType, e.g. the Registration Request forwarded in a UE context transfer. The NAS COUNT of the
+// UE is not updated.
+func VerifyIntegrity(ue *context.AmfUe, anType models.AccessType, payload []byte) bool {
+	if ue == nil || !ue.SecurityContextAvailable || len(payload) < 7 {
+		return false
+	}
+	switch nas.GetSecurityHeaderType(payload) & 0x0f {
+	case nas.SecurityHeaderTypeIntegrityProtected, nas.SecurityHeaderTypeIntegrityProtectedAndCiphered:
+	default:
+		return false
+	}
+	receivedMac32 := payload[2:6]
+	sequenceNumber := payload[6]
+
+	count := *ue.NasULCount(anType)
+	if count.SQN() > sequenceNumber {
+		count.SetOverflow(count.Overflow() + 1)
+	}
+	count.SetSQN(sequenceNumber)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, count.Get(), context.NasBearer(anType),
+		security.DirectionUplink, payload[6:])
+	if err != nil {
+		ue.NASLog.Errorf("MAC calcuate error: %+v", err)
+		return false
+	}
+	return reflect.DeepEqual(mac32, receivedMac32)
+}
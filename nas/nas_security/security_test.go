@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package nas_security_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
+	gmm_message "github.com/omec-project/amf/gmm/message"
+	"github.com/omec-project/amf/nas/nas_security"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/amf/util"
+	"github.com/omec-project/fsm"
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/security"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+func init() {
+	factory.InitConfigFactory("../../amfTest/amfcfg.yaml")
+	util.InitAmfContext(context.AMF_Self())
+}
+
+// testUe is the UE side of the NAS connections, it keeps its own NAS COUNTs per access
+type testUe struct {
+	ulCount map[models.AccessType]*security.Count
+	dlCount map[models.AccessType]*security.Count
+}
+
+func newTestUe() *testUe {
+	return &testUe{
+		ulCount: map[models.AccessType]*security.Count{
+			models.AccessType__3_GPP_ACCESS:    new(security.Count),
+			models.AccessType_NON_3_GPP_ACCESS: new(security.Count),
+		},
+		dlCount: map[models.AccessType]*security.Count{
+			models.AccessType__3_GPP_ACCESS:    new(security.Count),
+			models.AccessType_NON_3_GPP_ACCESS: new(security.Count),
+		},
+	}
+}
+
+// protect ciphers and integrity protects an uplink 5GMM Status with the UE's NAS COUNT and the bearer
+func (tu *testUe) protect(t *testing.T, amfUe *context.AmfUe, anType models.AccessType, bearer uint8) []byte {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeStatus5GMM)
+	status5GMM := nasMessage.NewStatus5GMM(0)
+	status5GMM.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	status5GMM.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	status5GMM.SetMessageType(nas.MsgTypeStatus5GMM)
+	status5GMM.SetCauseValue(nasMessage.Cause5GMMProtocolErrorUnspecified)
+	m.GmmMessage.Status5GMM = status5GMM
+	payload, err := m.PlainNasEncode()
+	if err != nil {
+		t.Fatalf("Failed to encode 5GMM Status: %v", err)
+	}
+
+	count := tu.ulCount[anType]
+	if err := security.NASEncrypt(amfUe.CipheringAlg, amfUe.KnasEnc, count.Get(), bearer,
+		security.DirectionUplink, payload); err != nil {
+		t.Fatalf("Failed to cipher: %v", err)
+	}
+	payload = append([]byte{count.SQN()}, payload...)
+	mac32, err := security.NASMacCalculate(amfUe.IntegrityAlg, amfUe.KnasInt, count.Get(), bearer,
+		security.DirectionUplink, payload)
+	if err != nil {
+		t.Fatalf("Failed to calculate MAC: %v", err)
+	}
+	count.AddOne()
+	header := []byte{nasMessage.Epd5GSMobilityManagementMessage, nas.SecurityHeaderTypeIntegrityProtectedAndCiphered}
+	return append(append(header, mac32...), payload...)
+}
+
+// verify checks the MAC of a downlink NAS message with the UE's NAS COUNT of the access
+func (tu *testUe) verify(t *testing.T, amfUe *context.AmfUe, anType models.AccessType, pdu []byte) bool {
+	count := tu.dlCount[anType]
+	if len(pdu) < 7 || pdu[6] != count.SQN() {
+		t.Errorf("Sequence number on %s, want: %d, got: %v", anType, count.SQN(), pdu)
+		return false
+	}
+	mac32, err := security.NASMacCalculate(amfUe.IntegrityAlg, amfUe.KnasInt, count.Get(), context.NasBearer(anType),
+		security.DirectionDownlink, pdu[6:])
+	if err != nil {
+		t.Fatalf("Failed to calculate MAC: %v", err)
+	}
+	count.AddOne()
+	return bytes.Equal(mac32, pdu[2:6])
+}
+
+func newAccessRanUe(t *testing.T, anType models.AccessType, ranUeNgapID int64) *context.RanUe {
+	ran := context.AMF_Self().NewAmfRan(&ngaputil.TestConn{})
+	ran.AnType = anType
+	ranUe, err := ran.NewRanUe(ranUeNgapID)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	return ranUe
+}
+
+// TestDualAccessNas registers a UE on both accesses and exchanges NAS messages on each of them, each access
+// has its own NAS COUNTs and is protected with its own NAS connection identifier (TS 33.501 6.4.2)
+func TestDualAccessNas(t *testing.T) {
+	amfUe := context.AMF_Self().NewAmfUe("imsi-208930000007491")
+	ranUe3gpp := newAccessRanUe(t, models.AccessType__3_GPP_ACCESS, 1)
+	ranUeNon3gpp := newAccessRanUe(t, models.AccessType_NON_3_GPP_ACCESS, 1)
+	amfUe.AttachRanUe(ranUe3gpp)
+	amfUe.AttachRanUe(ranUeNon3gpp)
+	amfUe.State[models.AccessType__3_GPP_ACCESS] = fsm.NewState(context.Registered)
+	amfUe.State[models.AccessType_NON_3_GPP_ACCESS] = fsm.NewState(context.Registered)
+
+	amfUe.Kamf = "3b2ae3b1f8d5d9b1a5d8e8f9e4a7c1b2d6e3f1a4b7c8d9e0f1a2b3c4d5e6f7a8"
+	amfUe.IntegrityAlg = security.AlgIntegrity128NIA2
+	amfUe.CipheringAlg = security.AlgCiphering128NEA2
+	amfUe.DerivateAlgKey()
+	amfUe.SecurityContextAvailable = true
+
+	// the location of the non-3GPP access does not replace the TAI of the 3GPP access
+	tai3gpp := models.Tai{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: "000001"}
+	amfUe.SetAccessTai(models.AccessType__3_GPP_ACCESS, tai3gpp)
+	initialUeMessage := ngaputil.BuildN3iwfInitialUEMessage(1, nil, "10.0.0.1", 4500)
+	for _, ie := range initialUeMessage.InitiatingMessage.Value.InitialUEMessage.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDUserLocationInformation {
+			ranUeNon3gpp.UpdateLocation(ie.Value.UserLocationInformation)
+		}
+	}
+	if amfUe.Tai.Tac != tai3gpp.Tac {
+		t.Errorf("TAI of the 3GPP access, want: %+v, got: %+v", tai3gpp, amfUe.Tai)
+	}
+	if tai := amfUe.AccessTai(models.AccessType_NON_3_GPP_ACCESS); tai != context.AMF_Self().Non3gppTai() {
+		t.Errorf("TAI of the non-3GPP access, want: %+v, got: %+v", context.AMF_Self().Non3gppTai(), tai)
+	}
+
+	ue := newTestUe()
+	exchanges := []models.AccessType{
+		models.AccessType__3_GPP_ACCESS,
+		models.AccessType__3_GPP_ACCESS,
+		models.AccessType_NON_3_GPP_ACCESS,
+		models.AccessType__3_GPP_ACCESS,
+		models.AccessType_NON_3_GPP_ACCESS,
+	}
+	for i, anType := range exchanges {
+		uplink := ue.protect(t, amfUe, anType, context.NasBearer(anType))
+		msg, err := nas_security.Decode(amfUe, anType, uplink)
+		if err != nil {
+			t.Fatalf("Exchange %d on %s, uplink is not decoded: %v", i, anType, err)
+		}
+		if amfUe.MacFailed || msg.GmmMessage == nil || msg.GmmHeader.GetMessageType() != nas.MsgTypeStatus5GMM {
+			t.Fatalf("Exchange %d on %s, uplink fails the integrity check", i, anType)
+		}
+
+		downlink, err := gmm_message.BuildDLNASTransport(amfUe, anType, nasMessage.PayloadContainerTypeN1SMInfo,
+			[]byte{0x2e, 0x01, 0x01, 0xc1}, 1, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("Exchange %d on %s, downlink is not built: %v", i, anType, err)
+		}
+		if !ue.verify(t, amfUe, anType, downlink) {
+			t.Errorf("Exchange %d on %s, downlink fails the integrity check of the UE", i, anType)
+		}
+	}
+
+	for _, anType := range []models.AccessType{models.AccessType__3_GPP_ACCESS, models.AccessType_NON_3_GPP_ACCESS} {
+		if got, want := amfUe.NasDLCount(anType).Get(), ue.dlCount[anType].Get(); got != want {
+			t.Errorf("Downlink NAS COUNT of %s, want: %d, got: %d", anType, want, got)
+		}
+	}
+	if amfUe.ULCount.Get() != 2 || amfUe.Non3gppULCount.Get() != 1 {
+		t.Errorf("Uplink NAS COUNTs, want: 3GPP 2 and non-3GPP 1, got: %d and %d",
+			amfUe.ULCount.Get(), amfUe.Non3gppULCount.Get())
+	}
+
+	// a message protected for the 3GPP NAS connection is not accepted on the non-3GPP access
+	uplink := ue.protect(t, amfUe, models.AccessType_NON_3_GPP_ACCESS, security.Bearer3GPP)
+	if _, err := nas_security.Decode(amfUe, models.AccessType_NON_3_GPP_ACCESS, uplink); err == nil && !amfUe.MacFailed {
+		t.Error("Uplink protected with the 3GPP bearer passes the integrity check on the non-3GPP access")
+	}
+}
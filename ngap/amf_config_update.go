@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package ngap
+
+import (
+	"time"
+
+	"github.com/omec-project/amf/context"
+	ngap_message "github.com/omec-project/amf/ngap/message"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+const (
+	// retransmission of AMF Configuration Update without response from the RAN
+	amfConfigUpdateGuardTime = 10 * time.Second
+	amfConfigUpdateMaxRetry  = 3
+)
+
+// SendAMFConfigurationUpdateToRans sends the changes of the AMF configuration since
+// the last NG Setup Response/AMF Configuration Update to every connected RAN
+func SendAMFConfigurationUpdateToRans() {
+	for _, ran := range context.AMF_Self().AmfRanListInArea(nil, nil) {
+		startAmfConfigurationUpdate(ran)
+	}
+}
+
+func startAmfConfigurationUpdate(ran *context.AmfRan) {
+	ran.Mutex.Lock()
+	defer ran.Mutex.Unlock()
+
+	if ran.AdvertisedConfig == nil {
+		// NG Setup not completed, the RAN gets the current configuration in NG Setup Response
+		return
+	}
+	if ran.PendingConfig != nil {
+		// the update in progress is followed by another one on its acknowledge
+		return
+	}
+	current := context.AMF_Self().AmfConfigSnapshot()
+	update := context.DiffAmfConfig(ran.AdvertisedConfig, current)
+	if update.IsEmpty() {
+		return
+	}
+
+	ran.PendingConfig = current
+	ngap_message.SendAMFConfigurationUpdate(ran, update)
+	var timer *context.Timer
+	timer = context.NewTimer(amfConfigUpdateGuardTime, amfConfigUpdateMaxRetry,
+		func(expireTimes int32) {
+			ran.Log.Warnf("AMF Configuration Update not answered, retransmit [%d]", expireTimes)
+			ngap_message.SendAMFConfigurationUpdate(ran, update)
+		},
+		func() {
+			ran.Log.Errorf("AMF Configuration Update not answered after %d retransmissions, abort",
+				amfConfigUpdateMaxRetry)
+			ran.Mutex.Lock()
+			defer ran.Mutex.Unlock()
+			// a newer update may have replaced this one meanwhile
+			if ran.PendingConfig == current {
+				ran.PendingConfig = nil
+			}
+			if ran.ConfigUpdateTimer == timer {
+				ran.ConfigUpdateTimer = nil
+			}
+		})
+	ran.ConfigUpdateTimer = timer
+}
+
+func stopAmfConfigUpdateTimer(ran *context.AmfRan) {
+	if ran.ConfigUpdateTimer != nil {
+		ran.ConfigUpdateTimer.Stop()
+		ran.ConfigUpdateTimer = nil
+	}
+}
+
+// amfConfigurationUpdateAcknowledged records the pending configuration as known by
+// the RAN and sends the changes which happened meanwhile
+func amfConfigurationUpdateAcknowledged(ran *context.AmfRan) {
+	ran.Mutex.Lock()
+	if ran.PendingConfig == nil {
+		ran.Mutex.Unlock()
+		ran.Log.Warn("AMF Configuration Update Acknowledge without pending update")
+		return
+	}
+	stopAmfConfigUpdateTimer(ran)
+	ran.AdvertisedConfig = ran.PendingConfig
+	ran.PendingConfig = nil
+	ran.Mutex.Unlock()
+
+	startAmfConfigurationUpdate(ran)
+}
+
+// amfConfigurationUpdateFailed retries the update after timeToWait, without
+// timeToWait the RAN keeps the configuration advertised before
+func amfConfigurationUpdateFailed(ran *context.AmfRan, timeToWait *ngapType.TimeToWait) {
+	ran.Mutex.Lock()
+	stopAmfConfigUpdateTimer(ran)
+	ran.PendingConfig = nil
+	ran.Mutex.Unlock()
+
+	if timeToWait == nil {
+		ran.Log.Warn("AMF Configuration Update failed, no retry")
+		return
+	}
+	wait := timeToWaitDuration(timeToWait)
+	ran.Log.Infof("AMF Configuration Update failed, retry in %v", wait)
+	time.AfterFunc(wait, func() {
+		if !ranConnected(ran) {
+			return
+		}
+		startAmfConfigurationUpdate(ran)
+	})
+}
+
+func ranConnected(ran *context.AmfRan) (connected bool) {
+	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		connected = value.(*context.AmfRan) == ran
+		return !connected
+	})
+	return connected
+}
+
+func timeToWaitDuration(timeToWait *ngapType.TimeToWait) time.Duration {
+	switch timeToWait.Value {
+	case ngapType.TimeToWaitPresentV1s:
+		return 1 * time.Second
+	case ngapType.TimeToWaitPresentV2s:
+		return 2 * time.Second
+	case ngapType.TimeToWaitPresentV5s:
+		return 5 * time.Second
+	case ngapType.TimeToWaitPresentV10s:
+		return 10 * time.Second
+	case ngapType.TimeToWaitPresentV20s:
+		return 20 * time.Second
+	default:
+		return 60 * time.Second
+	}
+}
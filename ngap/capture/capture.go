@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+// Package capture writes the NGAP PDUs exchanged with the RANs to rotating
+// pcapng files. The PDUs are wrapped in synthetic IP/SCTP headers (PPID 60),
+// so the capture looks the same for direct SCTP and for the SCTP-LB gRPC path.
+package capture
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/logger"
+)
+
+const (
+	defaultDir         = "/tmp"
+	defaultMaxFileSize = 10 // MB
+	defaultMaxFiles    = 5
+	ngapPort           = 38412
+)
+
+// Filter selects the captured PDUs, an empty field matches everything. With a
+// SUPI only UE-associated PDUs of this UE are captured.
+type Filter struct {
+	GnbId string `json:"gnbId,omitempty"`
+	Supi  string `json:"supi,omitempty"`
+}
+
+type Status struct {
+	Running bool     `json:"running"`
+	Filter  Filter   `json:"filter"`
+	File    string   `json:"file,omitempty"`
+	Files   []string `json:"files,omitempty"`
+	Packets uint64   `json:"packets"`
+}
+
+type capturer struct {
+	sync.Mutex
+	filter      Filter
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+	file        *os.File
+	fileSize    int64
+	files       []string
+	packets     uint64
+	tsn         map[string]uint32 // per association and direction
+	ssn         map[string]uint16 // per association, direction and stream
+}
+
+var (
+	running int32
+	current *capturer
+	mutex   sync.Mutex
+)
+
+// Enabled is a cheap check for the message path before a PDU is handed over
+func Enabled() bool {
+	return atomic.LoadInt32(&running) == 1
+}
+
+// Start begins a new capture, a running capture is stopped first
+func Start(filter Filter) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if current != nil {
+		stopLocked()
+	}
+
+	c := &capturer{
+		filter:      filter,
+		dir:         defaultDir,
+		maxFileSize: defaultMaxFileSize << 20,
+		maxFiles:    defaultMaxFiles,
+		tsn:         make(map[string]uint32),
+		ssn:         make(map[string]uint16),
+	}
+	if cfg := context.AMF_Self().CaptureCfg; cfg != nil {
+		if cfg.Dir != "" {
+			c.dir = cfg.Dir
+		}
+		if cfg.MaxFileSize > 0 {
+			c.maxFileSize = int64(cfg.MaxFileSize) << 20
+		}
+		if cfg.MaxFiles > 0 {
+			c.maxFiles = cfg.MaxFiles
+		}
+	}
+	if err := c.rotate(); err != nil {
+		return err
+	}
+
+	logger.NgapLog.Infof("Start NGAP capture[gnbId: %q, supi: %q] to %s", filter.GnbId, filter.Supi, c.file.Name())
+	current = c
+	atomic.StoreInt32(&running, 1)
+	return nil
+}
+
+// Stop ends the capture and closes the file
+func Stop() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	stopLocked()
+}
+
+func stopLocked() {
+	atomic.StoreInt32(&running, 0)
+	if current == nil {
+		return
+	}
+	current.Lock()
+	defer current.Unlock()
+	if current.file != nil {
+		logger.NgapLog.Infof("Stop NGAP capture, %d packets written", current.packets)
+		if err := current.file.Close(); err != nil {
+			logger.NgapLog.Errorf("Close capture file error: %+v", err)
+		}
+		current.file = nil
+	}
+	current = nil
+}
+
+func GetStatus() Status {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if current == nil {
+		return Status{}
+	}
+	current.Lock()
+	defer current.Unlock()
+	status := Status{
+		Running: true,
+		Filter:  current.filter,
+		Packets: current.packets,
+	}
+	status.Files = append(status.Files, current.files...)
+	if current.file != nil {
+		status.File = current.file.Name()
+	}
+	return status
+}
+
+// RanMessage captures a PDU exchanged with ran, supi is empty for non-UE-associated
+// PDUs. uplink is true for PDUs received from the RAN.
+func RanMessage(ran *context.AmfRan, supi string, uplink bool, streamId uint16, pdu []byte) {
+	if !Enabled() || ran == nil {
+		return
+	}
+	mutex.Lock()
+	c := current
+	mutex.Unlock()
+	if c == nil || !c.match(ran.GnbId, supi) {
+		return
+	}
+
+	gnbIP, gnbPort, amfIP, amfPort := ranEndpoints(ran)
+	c.write(ran.GnbId, supi, gnbIP, gnbPort, amfIP, amfPort, uplink, streamId, pdu)
+}
+
+func (c *capturer) match(gnbId, supi string) bool {
+	if c.filter.GnbId != "" && c.filter.GnbId != gnbId {
+		return false
+	}
+	if c.filter.Supi != "" && c.filter.Supi != supi {
+		return false
+	}
+	return true
+}
+
+func (c *capturer) write(gnbId, supi string, gnbIP net.IP, gnbPort uint16, amfIP net.IP, amfPort uint16,
+	uplink bool, streamId uint16, pdu []byte) {
+	c.Lock()
+	defer c.Unlock()
+	if c.file == nil {
+		return
+	}
+
+	pkt := sctpPacket{
+		src:     amfIP,
+		dst:     gnbIP,
+		srcPort: amfPort,
+		dstPort: gnbPort,
+		stream:  streamId,
+		payload: pdu,
+	}
+	direction := "DL"
+	if uplink {
+		pkt.src, pkt.dst = gnbIP, amfIP
+		pkt.srcPort, pkt.dstPort = gnbPort, amfPort
+		direction = "UL"
+	}
+	assoc := gnbId + "/" + gnbIP.String() + "/" + direction
+	pkt.tsn = c.tsn[assoc]
+	c.tsn[assoc]++
+	streamKey := assoc + "/" + strconv.Itoa(int(streamId))
+	pkt.ssn = c.ssn[streamKey]
+	c.ssn[streamKey]++
+
+	comment := "gNB " + gnbId
+	if supi != "" {
+		comment += " UE " + supi
+	}
+	n, err := writePacket(c.file, time.Now(), pkt.marshal(), comment)
+	if err != nil {
+		logger.NgapLog.Errorf("Write capture file error: %+v", err)
+		return
+	}
+	c.packets++
+	c.fileSize += int64(n)
+	if c.fileSize >= c.maxFileSize {
+		if err := c.rotate(); err != nil {
+			logger.NgapLog.Errorf("Rotate capture file error: %+v", err)
+		}
+	}
+}
+
+// rotate closes the current file, opens a new one and removes the oldest files
+// beyond maxFiles
+func (c *capturer) rotate() error {
+	if c.file != nil {
+		if err := c.file.Close(); err != nil {
+			logger.NgapLog.Errorf("Close capture file error: %+v", err)
+		}
+		c.file = nil
+	}
+
+	name := filepath.Join(c.dir, fmt.Sprintf("ngap-%s.pcapng", time.Now().Format("20060102-150405.000000")))
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("create capture file: %w", err)
+	}
+	n, err := writeHeader(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("write capture file header: %w", err)
+	}
+	c.file = file
+	c.fileSize = int64(n)
+	c.files = append(c.files, name)
+
+	for len(c.files) > c.maxFiles {
+		if err := os.Remove(c.files[0]); err != nil {
+			logger.NgapLog.Warnf("Remove capture file error: %+v", err)
+		}
+		c.files = c.files[1:]
+	}
+	return nil
+}
+
+// ranEndpoints returns the addresses put in the synthetic headers, the real
+// ones for direct SCTP and the gNB IP reported by the SCTP-LB otherwise
+func ranEndpoints(ran *context.AmfRan) (gnbIP net.IP, gnbPort uint16, amfIP net.IP, amfPort uint16) {
+	gnbPort, amfPort = ngapPort, ngapPort
+	if ran.Conn != nil {
+		if addr := ran.Conn.RemoteAddr(); addr != nil {
+			gnbIP, gnbPort = parseAddr(addr.String(), gnbPort)
+		}
+		if addr := ran.Conn.LocalAddr(); addr != nil {
+			amfIP, amfPort = parseAddr(addr.String(), amfPort)
+		}
+	}
+	if gnbIP == nil {
+		gnbIP, _ = parseAddr(ran.GnbIp, gnbPort)
+	}
+	if amfIP == nil {
+		if ngapIpList := context.AMF_Self().NgapIpList; len(ngapIpList) > 0 {
+			amfIP = net.ParseIP(ngapIpList[0])
+		}
+	}
+	if gnbIP == nil {
+		gnbIP = net.IPv4(127, 0, 0, 2)
+	}
+	if amfIP == nil {
+		amfIP = net.IPv4(127, 0, 0, 1)
+	}
+	return gnbIP, gnbPort, amfIP, amfPort
+}
+
+// parseAddr parses "ip:port", "[ip]:port", "ip" and the multi-homed SCTP form
+// "ip1/ip2:port", of which the first address is used
+func parseAddr(addr string, defaultPort uint16) (net.IP, uint16) {
+	port := defaultPort
+	host := addr
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host = h
+		if v, err := strconv.ParseUint(p, 10, 16); err == nil {
+			port = uint16(v)
+		}
+	}
+	host = strings.Trim(strings.Split(host, "/")[0], "[]")
+	return net.ParseIP(host), port
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package capture
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	blockTypeSHB = 0x0A0D0D0A
+	blockTypeIDB = 0x00000001
+	blockTypeEPB = 0x00000006
+
+	byteOrderMagic = 0x1A2B3C4D
+	linkTypeRaw    = 101 // raw IPv4/IPv6, no link layer header
+	optComment     = 1
+
+	ipProtoSctp     = 132
+	sctpChunkData   = 0
+	sctpDataFlagsBE = 0x03 // unfragmented user message
+	ngapPPID        = 60
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// sctpPacket is one NGAP PDU as seen on the wire, wrapped in synthetic IP and
+// SCTP headers so that Wireshark decodes it as NGAP
+type sctpPacket struct {
+	src, dst         net.IP
+	srcPort, dstPort uint16
+	stream, ssn      uint16
+	tsn              uint32
+	payload          []byte
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func (p *sctpPacket) marshalSctp() []byte {
+	chunkLen := 16 + len(p.payload)
+	b := make([]byte, 12+pad4(chunkLen))
+	binary.BigEndian.PutUint16(b[0:], p.srcPort)
+	binary.BigEndian.PutUint16(b[2:], p.dstPort)
+	// verification tag and checksum stay 0 until the checksum is computed
+
+	chunk := b[12:]
+	chunk[0] = sctpChunkData
+	chunk[1] = sctpDataFlagsBE
+	binary.BigEndian.PutUint16(chunk[2:], uint16(chunkLen))
+	binary.BigEndian.PutUint32(chunk[4:], p.tsn)
+	binary.BigEndian.PutUint16(chunk[8:], p.stream)
+	binary.BigEndian.PutUint16(chunk[10:], p.ssn)
+	binary.BigEndian.PutUint32(chunk[12:], ngapPPID)
+	copy(chunk[16:], p.payload)
+
+	// SCTP checksum is CRC32c in little endian byte order (RFC 4960 appendix B)
+	binary.LittleEndian.PutUint32(b[8:], crc32.Checksum(b, crc32c))
+	return b
+}
+
+func (p *sctpPacket) marshal() []byte {
+	sctpBytes := p.marshalSctp()
+	if src4, dst4 := p.src.To4(), p.dst.To4(); src4 != nil && dst4 != nil {
+		ip := make([]byte, 20, 20+len(sctpBytes))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(sctpBytes)))
+		ip[6] = 0x40 // don't fragment
+		ip[8] = 64
+		ip[9] = ipProtoSctp
+		copy(ip[12:16], src4)
+		copy(ip[16:20], dst4)
+		binary.BigEndian.PutUint16(ip[10:], ipv4Checksum(ip))
+		return append(ip, sctpBytes...)
+	}
+
+	ip := make([]byte, 40, 40+len(sctpBytes))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(sctpBytes)))
+	ip[6] = ipProtoSctp
+	ip[7] = 64
+	copy(ip[8:24], p.src.To16())
+	copy(ip[24:40], p.dst.To16())
+	return append(ip, sctpBytes...)
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// writeBlock writes a pcapng block, body is padded to 32 bits
+func writeBlock(w io.Writer, blockType uint32, body []byte) (int, error) {
+	total := 12 + pad4(len(body))
+	b := make([]byte, total)
+	binary.LittleEndian.PutUint32(b[0:], blockType)
+	binary.LittleEndian.PutUint32(b[4:], uint32(total))
+	copy(b[8:], body)
+	binary.LittleEndian.PutUint32(b[total-4:], uint32(total))
+	return w.Write(b)
+}
+
+// writeHeader writes the section header and the interface description of a new file
+func writeHeader(w io.Writer) (int, error) {
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1) // major version
+	binary.LittleEndian.PutUint16(shb[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(shb[8:], 0xffffffffffffffff)
+	n1, err := writeBlock(w, blockTypeSHB, shb)
+	if err != nil {
+		return n1, err
+	}
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], linkTypeRaw)
+	// snap length 0: no limit, timestamps in microseconds (default resolution)
+	n2, err := writeBlock(w, blockTypeIDB, idb)
+	return n1 + n2, err
+}
+
+// writePacket writes an enhanced packet block with a comment naming gNB and UE
+func writePacket(w io.Writer, ts time.Time, data []byte, comment string) (int, error) {
+	body := make([]byte, 20+pad4(len(data)))
+	usec := uint64(ts.UnixNano() / int64(time.Microsecond))
+	binary.LittleEndian.PutUint32(body[0:], 0) // interface ID
+	binary.LittleEndian.PutUint32(body[4:], uint32(usec>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(usec))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(data)))
+	copy(body[20:], data)
+
+	if comment != "" {
+		opt := make([]byte, 4+pad4(len(comment)))
+		binary.LittleEndian.PutUint16(opt[0:], optComment)
+		binary.LittleEndian.PutUint16(opt[2:], uint16(len(comment)))
+		copy(opt[4:], comment)
+		body = append(body, opt...)
+		body = append(body, 0, 0, 0, 0) // opt_endofopt
+	}
+	return writeBlock(w, blockTypeEPB, body)
+}
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+type pcapngBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+// readBlocks splits a pcapng file into its blocks and checks their framing
+func readBlocks(t *testing.T, b []byte) []pcapngBlock {
+	var blocks []pcapngBlock
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("Truncated block: %d bytes left", len(b))
+		}
+		blockType := binary.LittleEndian.Uint32(b[0:])
+		total := int(binary.LittleEndian.Uint32(b[4:]))
+		if total%4 != 0 || total < 12 || total > len(b) {
+			t.Fatalf("Block 0x%x has an invalid length %d", blockType, total)
+		}
+		if trailer := int(binary.LittleEndian.Uint32(b[total-4:])); trailer != total {
+			t.Fatalf("Block 0x%x, leading length %d, trailing length %d", blockType, total, trailer)
+		}
+		blocks = append(blocks, pcapngBlock{blockType: blockType, body: b[8 : total-4]})
+		b = b[total:]
+	}
+	return blocks
+}
+
+func TestPcapngRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := writeHeader(&buf)
+	if err != nil {
+		t.Fatalf("writeHeader: %v", err)
+	}
+
+	ts := time.Unix(1650000000, 123456000)
+	packets := []struct {
+		data    []byte
+		comment string
+	}{
+		{data: []byte{0x00, 0x15, 0x00, 0x33}, comment: "gnb-1"},             // data without padding
+		{data: []byte{0x20, 0x15, 0x00, 0x2b, 0x00}, comment: "gnb-1 ue-42"}, // padded data and comment
+		{data: []byte{0x00, 0x0e, 0x00}},                                     // no comment
+	}
+	for _, p := range packets {
+		written, err := writePacket(&buf, ts, p.data, p.comment)
+		if err != nil {
+			t.Fatalf("writePacket: %v", err)
+		}
+		n += written
+	}
+	if n != buf.Len() {
+		t.Errorf("Written bytes, reported: %d, actual: %d", n, buf.Len())
+	}
+
+	blocks := readBlocks(t, buf.Bytes())
+	if len(blocks) != 2+len(packets) {
+		t.Fatalf("Number of blocks, want: %d, got: %d", 2+len(packets), len(blocks))
+	}
+
+	shb := blocks[0]
+	if shb.blockType != blockTypeSHB || len(shb.body) != 16 {
+		t.Fatalf("Section header block, type: 0x%x, body: %d bytes", shb.blockType, len(shb.body))
+	}
+	if magic := binary.LittleEndian.Uint32(shb.body); magic != byteOrderMagic {
+		t.Errorf("Byte order magic: 0x%x", magic)
+	}
+	if sectionLen := binary.LittleEndian.Uint64(shb.body[8:]); sectionLen != 0xffffffffffffffff {
+		t.Errorf("Section length is not unspecified: 0x%x", sectionLen)
+	}
+
+	idb := blocks[1]
+	if idb.blockType != blockTypeIDB || len(idb.body) != 8 {
+		t.Fatalf("Interface description block, type: 0x%x, body: %d bytes", idb.blockType, len(idb.body))
+	}
+	if linkType := binary.LittleEndian.Uint16(idb.body); linkType != linkTypeRaw {
+		t.Errorf("Link type: %d", linkType)
+	}
+
+	usec := uint64(ts.UnixNano() / int64(time.Microsecond))
+	for i, p := range packets {
+		epb := blocks[2+i]
+		if epb.blockType != blockTypeEPB {
+			t.Fatalf("Packet %d, block type: 0x%x", i, epb.blockType)
+		}
+		body := epb.body
+		tsHigh, tsLow := binary.LittleEndian.Uint32(body[4:]), binary.LittleEndian.Uint32(body[8:])
+		if uint64(tsHigh)<<32|uint64(tsLow) != usec {
+			t.Errorf("Packet %d, timestamp: %d", i, uint64(tsHigh)<<32|uint64(tsLow))
+		}
+		capLen, origLen := int(binary.LittleEndian.Uint32(body[12:])), int(binary.LittleEndian.Uint32(body[16:]))
+		if capLen != len(p.data) || origLen != len(p.data) {
+			t.Fatalf("Packet %d, captured length: %d, original length: %d", i, capLen, origLen)
+		}
+		data := body[20 : 20+pad4(capLen)]
+		if !bytes.Equal(data[:capLen], p.data) || !bytes.Equal(data[capLen:], make([]byte, pad4(capLen)-capLen)) {
+			t.Errorf("Packet %d, data: %x", i, data)
+		}
+
+		options := body[20+pad4(capLen):]
+		if p.comment == "" {
+			if len(options) != 0 {
+				t.Errorf("Packet %d, unexpected options: %x", i, options)
+			}
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(options[2:]))
+		if code := binary.LittleEndian.Uint16(options); code != optComment || commentLen != len(p.comment) {
+			t.Fatalf("Packet %d, option code: %d, length: %d", i, code, commentLen)
+		}
+		comment := options[4 : 4+pad4(commentLen)]
+		if string(comment[:commentLen]) != p.comment ||
+			!bytes.Equal(comment[commentLen:], make([]byte, pad4(commentLen)-commentLen)) {
+			t.Errorf("Packet %d, comment: %q", i, comment)
+		}
+		if endOfOpt := options[4+pad4(commentLen):]; !bytes.Equal(endOfOpt, []byte{0, 0, 0, 0}) {
+			t.Errorf("Packet %d, options are not terminated: %x", i, endOfOpt)
+		}
+	}
+}
+
+func TestSctpPacketMarshal(t *testing.T) {
+	payload := []byte{0x00, 0x15, 0x00, 0x33, 0x00}
+	p := &sctpPacket{
+		src:     net.ParseIP("192.168.1.1"),
+		dst:     net.ParseIP("192.168.1.2"),
+		srcPort: 38412,
+		dstPort: 38412,
+		stream:  1,
+		tsn:     7,
+		payload: payload,
+	}
+	b := p.marshal()
+
+	if ipv4Checksum(b[:20]) != 0 {
+		t.Error("IPv4 header checksum is not valid")
+	}
+	if totalLen := int(binary.BigEndian.Uint16(b[2:])); totalLen != len(b) {
+		t.Errorf("IPv4 total length, want: %d, got: %d", len(b), totalLen)
+	}
+	sctp := b[20:]
+	if len(sctp) != 12+pad4(16+len(payload)) {
+		t.Fatalf("SCTP packet is not padded: %d bytes", len(sctp))
+	}
+	if chunkLen := int(binary.BigEndian.Uint16(sctp[14:])); chunkLen != 16+len(payload) {
+		t.Errorf("DATA chunk length excludes the padding, want: %d, got: %d", 16+len(payload), chunkLen)
+	}
+	if !bytes.Equal(sctp[28:28+len(payload)], payload) {
+		t.Errorf("DATA chunk payload: %x", sctp[28:])
+	}
+
+	p.src, p.dst = net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	b = p.marshal()
+	if b[0]>>4 != 6 || int(binary.BigEndian.Uint16(b[4:])) != len(b)-40 {
+		t.Errorf("IPv6 header, version: %d, payload length: %d", b[0]>>4, binary.BigEndian.Uint16(b[4:]))
+	}
+}
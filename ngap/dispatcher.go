@@ -20,6 +20,7 @@ import (
 	"github.com/omec-project/amf/logger"
 	"github.com/omec-project/amf/metrics"
 	"github.com/omec-project/amf/msgtypes/ngapmsgtypes"
+	"github.com/omec-project/amf/ngap/capture"
 	"github.com/omec-project/amf/protos/sdcoreAmfServer"
 	"github.com/omec-project/ngap"
 	"github.com/omec-project/ngap/ngapType"
@@ -64,6 +65,7 @@ func DispatchLb(sctplbMsg *sdcoreAmfServer.SctplbMessage, Amf2RanMsgChan chan *s
 	}
 
 	ranUe, ngapId := FetchRanUeContext(ran, pdu)
+	capture.RanMessage(ran, ranUeSupi(ranUe), true, 0, sctplbMsg.Msg)
 	if ngapId != nil {
 		//ranUe.Log.Debugln("RanUe RanNgapId AmfNgapId: ", ranUe.RanUeNgapId, ranUe.AmfUeNgapId)
 		/* checking whether same AMF instance can handle this message */
@@ -95,6 +97,9 @@ func DispatchLb(sctplbMsg *sdcoreAmfServer.SctplbMessage, Amf2RanMsgChan chan *s
 			ran.Log.Debugf("DispatchLb, amfNgapId: %v for this amf instance", ngapId.Value)
 		}
 	}
+	if !checkUeNgapIdPair(ran, ranUe, ngapId) {
+		return
+	}
 
 	/* uecontext is found, submit the message to transaction queue*/
 	if ranUe != nil && ranUe.AmfUe != nil {
@@ -114,6 +119,12 @@ func DispatchLb(sctplbMsg *sdcoreAmfServer.SctplbMessage, Amf2RanMsgChan chan *s
 }
 
 func Dispatch(conn net.Conn, msg []byte) {
+	DispatchStream(conn, msg, 0)
+}
+
+// DispatchStream handles a message received on the given SCTP stream, the
+// stream is remembered on the RanUe so that responses are sent on it
+func DispatchStream(conn net.Conn, msg []byte, streamId uint16) {
 	var ran *context.AmfRan
 	amfSelf := context.AMF_Self()
 
@@ -135,7 +146,16 @@ func Dispatch(conn net.Conn, msg []byte) {
 		return
 	}
 
-	ranUe, _ := FetchRanUeContext(ran, pdu)
+	ranUe, aMFUENGAPID := FetchRanUeContext(ran, pdu)
+	capture.RanMessage(ran, ranUeSupi(ranUe), true, streamId, msg)
+	if !checkUeNgapIdPair(ran, ranUe, aMFUENGAPID) {
+		return
+	}
+	if ranUe != nil {
+		ranUe.SetSctpStream(streamId)
+	} else if ranUeNgapID := initialUeMessageRanUeNgapID(pdu); ranUeNgapID != nil {
+		ran.SetUeStreamHint(*ranUeNgapID, streamId)
+	}
 
 	/* uecontext is found, submit the message to transaction queue*/
 	if ranUe != nil && ranUe.AmfUe != nil {
@@ -151,8 +171,20 @@ func Dispatch(conn net.Conn, msg []byte) {
 		ranUe.Ran.Conn = conn
 		ranUe.AmfUe.EventChannel.SubmitMessage(ngapMsg)
 	} else {
-		go DispatchNgapMsg(ran, pdu, nil)
+		ngapMsg := context.NgapMsg{
+			Ran:       ran,
+			NgapMsg:   pdu,
+			SctplbMsg: nil,
+		}
+		dispatchWithoutAmfUe(ran, ranUe, ngapMsg)
+	}
+}
+
+func ranUeSupi(ranUe *context.RanUe) string {
+	if ranUe == nil || ranUe.AmfUe == nil {
+		return ""
 	}
+	return ranUe.AmfUe.Supi
 }
 
 func NgapMsgHandler(ue *context.AmfUe, msg context.NgapMsg) {
@@ -221,6 +253,8 @@ func DispatchNgapMsg(ran *context.AmfRan, pdu *ngapType.NGAPPDU, sctplbMsg *sdco
 			HandleUplinkRanStatusTransfer(ran, pdu)
 		case ngapType.ProcedureCodeUplinkNonUEAssociatedNRPPaTransport:
 			HandleUplinkNonUEAssociatedNRPPATransport(ran, pdu)
+		case ngapType.ProcedureCodePWSRestartIndication, ngapType.ProcedureCodePWSFailureIndication:
+			HandlePWSMessage(ran, pdu)
 		default:
 			ran.Log.Warnf("Not implemented(choice:%d, procedureCode:%d)\n", pdu.Present, initiatingMessage.ProcedureCode.Value)
 		}
@@ -256,6 +290,8 @@ func DispatchNgapMsg(ran *context.AmfRan, pdu *ngapType.NGAPPDU, sctplbMsg *sdco
 			HandlePDUSessionResourceModifyResponse(ran, pdu)
 		case ngapType.ProcedureCodeHandoverResourceAllocation:
 			HandleHandoverRequestAcknowledge(ran, pdu)
+		case ngapType.ProcedureCodeWriteReplaceWarning, ngapType.ProcedureCodePWSCancel:
+			HandlePWSMessage(ran, pdu)
 		default:
 			ran.Log.Warnf("Not implemented(choice:%d, procedureCode:%d)\n", pdu.Present, successfulOutcome.ProcedureCode.Value)
 		}
@@ -313,6 +349,7 @@ func HandleSCTPNotification(conn net.Conn, notification sctp.Notification) {
 	case sctp.SCTP_ASSOC_CHANGE:
 		ran.Log.Infof("SCTP_ASSOC_CHANGE notification")
 		event := notification.(*sctp.SCTPAssocChangeEvent)
+		metrics.IncrementSctpNotificationStats(ran.GnbId, "SCTP_ASSOC_CHANGE", fmt.Sprintf("%d", event.State()))
 		switch event.State() {
 		case sctp.SCTP_COMM_LOST:
 			ran.Log.Infof("SCTP state is SCTP_COMM_LOST, close the connection")
@@ -325,12 +362,26 @@ func HandleSCTPNotification(conn net.Conn, notification sctp.Notification) {
 		}
 	case sctp.SCTP_SHUTDOWN_EVENT:
 		ran.Log.Infof("SCTP_SHUTDOWN_EVENT notification, close the connection")
+		metrics.IncrementSctpNotificationStats(ran.GnbId, "SCTP_SHUTDOWN_EVENT", "")
 		ran.Remove()
 	default:
 		ran.Log.Warnf("Non handled notification type: 0x%x", notification.Type())
 	}
 }
 
+// HandleSCTPPeerAddrChange handles a path state change of a multi-homed association,
+// SCTP fails over to another path by itself, the association is kept
+func HandleSCTPPeerAddrChange(conn net.Conn, addr net.IP, state string) {
+	ran, ok := context.AMF_Self().AmfRanFindByConn(conn)
+	if !ok {
+		logger.NgapLog.Warnf("RAN context has been removed[addr: %+v]", conn.RemoteAddr())
+		return
+	}
+
+	ran.Log.Warnf("SCTP_PEER_ADDR_CHANGE notification, path[%s] state is %s", addr, state)
+	metrics.IncrementSctpNotificationStats(ran.GnbId, "SCTP_PEER_ADDR_CHANGE", state)
+}
+
 func HandleSCTPNotificationLb(gnbId string) {
 
 	logger.NgapLog.Infof("Handle SCTP Notification[GnbId: %+v]", gnbId)
@@ -14,11 +14,13 @@ import (
 
 	"github.com/omec-project/amf/consumer"
 	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/gmm"
 	gmm_message "github.com/omec-project/amf/gmm/message"
 	"github.com/omec-project/amf/logger"
 	"github.com/omec-project/amf/metrics"
 	"github.com/omec-project/amf/nas"
 	ngap_message "github.com/omec-project/amf/ngap/message"
+	"github.com/omec-project/amf/producer/callback"
 	"github.com/omec-project/amf/protos/sdcoreAmfServer"
 	"github.com/omec-project/amf/util"
 	"github.com/omec-project/aper"
@@ -637,6 +639,7 @@ func HandleNGSetupRequest(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 
 	if cause.Present == ngapType.CausePresentNothing {
 		ngap_message.SendNGSetupResponse(ran)
+		SendOverloadStateToRan(ran)
 		//send nf(gnb) status notification
 		gnbStatus := mi.MetricEvent{EventType: mi.CNfStatusEvt,
 			NfStatusData: mi.CNfStatus{NfType: mi.NfTypeGnb,
@@ -786,7 +789,7 @@ func HandleNGReset(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	switch resetType.Present {
 	case ngapType.ResetTypePresentNGInterface:
 		ran.Log.Trace("ResetType Present: NG Interface")
-		ran.RemoveAllUeInRan()
+		resetAllUeInRan(ran, *cause)
 		ngap_message.SendNGResetAcknowledge(ran, nil, nil)
 	case ngapType.ResetTypePresentPartOfNGInterface:
 		ran.Log.Trace("ResetType Present: Part of NG Interface")
@@ -797,12 +800,12 @@ func HandleNGReset(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 			return
 		}
 
-		var ranUe *context.RanUe
-
+		var ranUeList []*context.RanUe
 		for _, ueAssociatedLogicalNGConnectionItem := range partOfNGInterface.List {
+			var ranUe *context.RanUe
 			if ueAssociatedLogicalNGConnectionItem.AMFUENGAPID != nil {
 				ran.Log.Tracef("AmfUeNgapID[%d]", ueAssociatedLogicalNGConnectionItem.AMFUENGAPID.Value)
-				for _, ue := range ran.RanUeList {
+				for _, ue := range ran.RanUes() {
 					if ue.AmfUeNgapId == ueAssociatedLogicalNGConnectionItem.AMFUENGAPID.Value {
 						ranUe = ue
 						break
@@ -821,13 +824,11 @@ func HandleNGReset(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 				if ueAssociatedLogicalNGConnectionItem.RANUENGAPID != nil {
 					ran.Log.Warnf("RanUeNgapID[%d]", ueAssociatedLogicalNGConnectionItem.RANUENGAPID.Value)
 				}
+				continue
 			}
-
-			err := ranUe.Remove()
-			if err != nil {
-				ran.Log.Error(err.Error())
-			}
+			ranUeList = append(ranUeList, ranUe)
 		}
+		resetRanUes(ranUeList, *cause)
 		ngap_message.SendNGResetAcknowledge(ran, partOfNGInterface, nil)
 	default:
 		ran.Log.Warnf("Invalid ResetType[%d]", resetType.Present)
@@ -937,9 +938,6 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		case ngapType.ProtocolIEIDInfoOnRecommendedCellsAndRANNodesForPaging:
 			infoOnRecommendedCellsAndRANNodesForPaging = ie.Value.InfoOnRecommendedCellsAndRANNodesForPaging
 			ran.Log.Trace("Decode IE InfoOnRecommendedCellsAndRANNodesForPaging")
-			if infoOnRecommendedCellsAndRANNodesForPaging != nil {
-				ran.Log.Warn("IE infoOnRecommendedCellsAndRANNodesForPaging is not support")
-			}
 		case ngapType.ProtocolIEIDPDUSessionResourceListCxtRelCpl:
 			pDUSessionResourceList = ie.Value.PDUSessionResourceListCxtRelCpl
 			ran.Log.Trace("Decode IE PDUSessionResourceList")
@@ -979,7 +977,7 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		}
 		return
 	}
-	// TODO: AMF shall, if supported, store it and may use it for subsequent paging
+	// store it and use it for subsequent paging (TS 23.502 4.2.6)
 	if infoOnRecommendedCellsAndRANNodesForPaging != nil {
 		amfUe.InfoOnRecommendedCellsAndRanNodesForPaging = new(context.InfoOnRecommendedCellsAndRanNodesForPaging)
 
@@ -1019,8 +1017,8 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 			switch item.AMFPagingTarget.Present {
 			case ngapType.AMFPagingTargetPresentGlobalRANNodeID:
 				recommendedRanNode.Present = context.RecommendRanNodePresentRanNode
-				recommendedRanNode.GlobalRanNodeId = new(models.GlobalRanNodeId)
-				// TODO: recommendedRanNode.GlobalRanNodeId = ngapConvert.RanIdToModels(item.AMFPagingTarget.GlobalRANNodeID)
+				ranNodeId := ngapConvert.RanIdToModels(*item.AMFPagingTarget.GlobalRANNodeID)
+				recommendedRanNode.GlobalRanNodeId = &ranNodeId
 			case ngapType.AMFPagingTargetPresentTAI:
 				recommendedRanNode.Present = context.RecommendRanNodePresentTAI
 				tai := ngapConvert.TaiToModels(*item.AMFPagingTarget.TAI)
@@ -1037,7 +1035,10 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 			cause = *tmp
 		}
 	}
-	if amfUe.State[ran.AnType].Is(context.Registered) {
+	// the user plane of a handed over UE is moved, not deactivated
+	handoverRelease := ranUe.ReleaseAction == context.UeContextReleaseHandover ||
+		ranUe.ReleaseAction == context.UeContextReleaseInterAmfHandover
+	if amfUe.State[ran.AnType].Is(context.Registered) && !handoverRelease {
 		ranUe.Log.Info("Rel Ue Context in GMM-Registered")
 		if pDUSessionResourceList != nil {
 			for _, pduSessionReourceItem := range pDUSessionResourceList.List {
@@ -1078,6 +1079,9 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		if err != nil {
 			ran.Log.Errorln(err.Error())
 		}
+		if amfUe.State[ran.AnType].Is(context.Registered) {
+			gmm.StartMobileReachableTimer(amfUe, ran.AnType)
+		}
 		amfUe.PublishUeCtxtInfo()
 		context.StoreContextInDB(amfUe)
 	case context.UeContextReleaseUeContext:
@@ -1094,6 +1098,9 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 			amfUe.Remove()
 			context.DeleteContextFromDB(amfUe)
 		} else {
+			if amfUe.State[ran.AnType].Is(context.Registered) {
+				gmm.StartMobileReachableTimer(amfUe, ran.AnType)
+			}
 			amfUe.PublishUeCtxtInfo()
 			context.StoreContextInDB(amfUe)
 		}
@@ -1108,6 +1115,14 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		context.DeleteContextFromDB(amfUe)
 	case context.UeContextReleaseHandover:
 		ran.Log.Infof("Release UE[%s] Context : Release for Handover", amfUe.Supi)
+		if ranUe.TargetUe == nil {
+			// the target UE of a failed or cancelled handover
+			context.DetachSourceUeTargetUe(ranUe)
+			if err := ranUe.Remove(); err != nil {
+				ran.Log.Errorln(err.Error())
+			}
+			return
+		}
 		// TODO: it's a workaround, need to fix it.
 		targetRanUe := context.AMF_Self().RanUeFindByAmfUeNgapID(ranUe.TargetUe.AmfUeNgapId)
 
@@ -1120,6 +1135,17 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		amfUe.AttachRanUe(targetRanUe)
 		amfUe.PublishUeCtxtInfo()
 		// Todo: remove indirect tunnel
+	case context.UeContextReleaseInterAmfHandover:
+		ran.Log.Infof("Release UE[%s] Context : UE Context moved to another AMF", amfUe.Supi)
+		if amfUe.RanUe[ran.AnType] == ranUe {
+			amfUe.DetachRanUe(ran.AnType)
+		}
+		if err := ranUe.Remove(); err != nil {
+			ran.Log.Errorln(err.Error())
+		}
+		amfUe.PublishUeCtxtInfo()
+		amfUe.Remove()
+		context.DeleteContextFromDB(amfUe)
 	default:
 		ran.Log.Errorf("Invalid Release Action[%d]", ranUe.ReleaseAction)
 	}
@@ -1544,7 +1570,7 @@ func HandleInitialUEMessage(ran *context.AmfRan, message *ngapType.NGAPPDU, sctp
 					ranUe.Log.Tracef("RanUeNgapID[%d]", amfUe.RanUe[ran.AnType].RanUeNgapId)
 					amfUe.DetachRanUe(ran.AnType)
 				}
-				// TODO: stop Implicit Deregistration timer
+				// the mobile reachable and implicit deregistration timers are stopped on attach
 				ranUe.Log.Debugf("AmfUe Attach RanUe [RanUeNgapID: %d]", ranUe.RanUeNgapId)
 				amfUe.AttachRanUe(ranUe)
 			}
@@ -1745,7 +1771,7 @@ func BuildAndSendN1N2Msg(ranUe *context.RanUe, n1Msg, n2Info []byte, N2SmInfoTyp
 				pduSessionId := uint8(pduSessId)
 				var err error
 				nasPdu, err = gmm_message.BuildDLNASTransport(
-					amfUe, nasMessage.PayloadContainerTypeN1SMInfo, n1Msg, pduSessionId, nil, nil, 0)
+					amfUe, ranUe.Ran.AnType, nasMessage.PayloadContainerTypeN1SMInfo, n1Msg, pduSessionId, nil, nil, 0)
 				if err != nil {
 					ranUe.Log.Warnf("GMM Message build DL NAS Transport filaed: %v", err)
 				}
@@ -1999,7 +2025,8 @@ func HandlePDUSessionResourceNotify(ran *context.AmfRan, message *ngapType.NGAPP
 					if n1Msg != nil {
 						pduSessionId := uint8(pduSessionID)
 						nasPdu, err =
-							gmm_message.BuildDLNASTransport(amfUe, nasMessage.PayloadContainerTypeN1SMInfo, n1Msg, pduSessionId, nil, nil, 0)
+							gmm_message.BuildDLNASTransport(amfUe, ranUe.Ran.AnType, nasMessage.PayloadContainerTypeN1SMInfo,
+								n1Msg, pduSessionId, nil, nil, 0)
 						if err != nil {
 							ranUe.Log.Warnf("GMM Message build DL NAS Transport filaed: %v", err)
 						}
@@ -2343,7 +2370,7 @@ func HandleInitialContextSetupResponse(ran *context.AmfRan, message *ngapType.NG
 	}
 
 	if ranUe.Ran.AnType == models.AccessType_NON_3_GPP_ACCESS {
-		ngap_message.SendDownlinkNasTransport(ranUe, amfUe.RegistrationAcceptForNon3GPPAccess, nil)
+		gmm_message.SendRegistrationAcceptForNon3GPPAccess(amfUe)
 	}
 
 	if criticalityDiagnostics != nil {
@@ -2433,9 +2460,7 @@ func HandleInitialContextSetupFailure(ran *context.AmfRan, message *ngapType.NGA
 		return
 	}
 
-	if amfUe.T3550 != nil {
-		amfUe.T3550.Stop()
-		amfUe.T3550 = nil
+	if amfUe.StopT3550(ran.AnType) {
 		amfUe.State[ran.AnType].Set(context.Deregistered)
 		amfUe.ClearRegistrationRequestData(ran.AnType)
 	}
@@ -2552,6 +2577,15 @@ func HandleUEContextReleaseRequest(ran *context.AmfRan, message *ngapType.NGAPPD
 				Value: int32(causeValue),
 			},
 		}
+		if !normalReleaseCause(causeGroup, causeValue) {
+			amfUe.CommFailure = &models.CommunicationFailure{
+				RanReleaseCode: causeAll.NgapCause,
+			}
+			callback.SendAmfEventReport(amfUe, models.AmfEventReport{
+				Type:        models.AmfEventType_COMMUNICATION_FAILURE_REPORT,
+				CommFailure: amfUe.CommFailure,
+			})
+		}
 		if amfUe.State[ran.AnType].Is(context.Registered) {
 			ranUe.Log.Info("Ue Context in GMM-Registered")
 			if pDUSessionResourceList != nil {
@@ -2940,9 +2974,13 @@ func HandleHandoverNotify(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	}
 	sourceUe := targetUe.SourceUe
 	if sourceUe == nil {
-		// TODO: Send to S-AMF
-		// Desciibed in (23.502 4.9.1.3.3) [conditional] 6a.Namf_Communication_N2InfoNotify.
-		ran.Log.Error("N2 Handover between AMF has not been implemented yet")
+		if amfUe.HandoverNotifyUri == "" {
+			ran.Log.Error("No handover in progress for this UE")
+			return
+		}
+		// Described in (23.502 4.9.1.3.3) [conditional] 6a.Namf_Communication_N2InfoNotify.
+		ran.Log.Info("Handle inter-AMF Handover notification")
+		interAmfHandoverCompleted(targetUe)
 	} else {
 		ran.Log.Info("Handle Handover notification Finshed ")
 		for _, pduSessionid := range targetUe.SuccessPduSessionId {
@@ -3307,8 +3345,14 @@ func HandleHandoverRequestAcknowledge(ran *context.AmfRan, message *ngapType.NGA
 
 	sourceUe := targetUe.SourceUe
 	if sourceUe == nil {
-		// TODO: Send Namf_Communication_CreateUEContext Response to S-AMF
-		ran.Log.Error("handover between different Ue has not been implement yet")
+		// Send Namf_Communication_CreateUEContext Response to S-AMF
+		if targetToSourceTransparentContainer == nil {
+			interAmfHandoverFailed(targetUe, ngapType.CausePresentRadioNetwork,
+				ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+			return
+		}
+		interAmfHandoverPrepared(targetUe, pduSessionResourceHandoverList, pduSessionResourceToReleaseList,
+			*targetToSourceTransparentContainer)
 	} else {
 		ran.Log.Tracef("Source: RanUeNgapID[%d] AmfUeNgapID[%d]", sourceUe.RanUeNgapId, sourceUe.AmfUeNgapId)
 		ran.Log.Tracef("Target: RanUeNgapID[%d] AmfUeNgapID[%d]", targetUe.RanUeNgapId, targetUe.AmfUeNgapId)
@@ -3396,8 +3440,12 @@ func HandleHandoverFailure(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	targetUe.Ran = ran
 	sourceUe := targetUe.SourceUe
 	if sourceUe == nil {
-		// TODO: handle N2 Handover between AMF
-		ran.Log.Error("N2 Handover between AMF has not been implemented yet")
+		if targetUe.AmfUe != nil {
+			// N2 Handover between AMF, answer the source AMF and release the target UE
+			interAmfHandoverFailed(targetUe, causePresent, causeValue)
+			return
+		}
+		ran.Log.Error("AmfUe is nil")
 	} else {
 		amfUe := targetUe.AmfUe
 		if amfUe != nil {
@@ -3570,11 +3618,11 @@ func HandleHandoverRequired(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	targetRan, ok := aMFSelf.AmfRanFindByRanID(targetRanNodeId)
 	if !ok {
 		// handover between different AMF
-		sourceUe.Log.Warnf("Handover required : cannot find target Ran Node Id[%+v] in this AMF", targetRanNodeId)
-		sourceUe.Log.Error("Handover between different AMF has not been implemented yet")
-		return
-		// TODO: Send to T-AMF
+		sourceUe.Log.Infof("Handover required : cannot find target Ran Node Id[%+v] in this AMF", targetRanNodeId)
+		sourceUe.HandOverType.Value = handoverType.Value
 		// Described in (23.502 4.9.1.3.2) step 3.Namf_Communication_CreateUEContext Request
+		sendCreateUeContextToTargetAmf(sourceUe, cause, targetID, pDUSessionResourceListHORqd,
+			sourceToTargetTransparentContainer)
 	} else {
 		// Handover in same AMF
 		sourceUe.HandOverType.Value = handoverType.Value
@@ -3697,9 +3745,15 @@ func HandleHandoverCancel(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	}
 	targetUe := sourceUe.TargetUe
 	if targetUe == nil {
-		// Described in (23.502 4.11.1.2.3) step 2
-		// Todo : send to T-AMF invoke Namf_UeContextReleaseRequest(targetUe)
-		ran.Log.Error("N2 Handover between AMF has not been implemented yet")
+		amfUe := sourceUe.AmfUe
+		if amfUe == nil || amfUe.TargetAmfUri == "" {
+			ran.Log.Error("No handover in progress for this UE")
+			return
+		}
+		// Described in (23.502 4.11.1.2.3) step 2, the target AMF cancels the handover
+		// at the SMFs and releases the target RAN
+		cancelInterAmfHandover(sourceUe, causePresent, causeValue)
+		ngap_message.SendHandoverCancelAcknowledge(sourceUe, nil)
 	} else {
 		ran.Log.Tracef("Target : RAN_UE_NGAP_ID[%d] AMF_UE_NGAP_ID[%d]", targetUe.RanUeNgapId, targetUe.AmfUeNgapId)
 		amfUe := sourceUe.AmfUe
@@ -4093,6 +4147,11 @@ func HandleUplinkUEAssociatedNRPPATransport(ran *context.AmfRan, message *ngapTy
 		}
 	}
 
+	if routingID == nil || nRPPaPDU == nil {
+		ran.Log.Error("RoutingID or NRPPaPDU is missing")
+		return
+	}
+
 	ranUe := ran.RanUeFindByRanUeNgapID(rANUENGAPID.Value)
 	if ranUe == nil {
 		ran.Log.Errorf("No UE Context[RanUeNgapID: %d]", rANUENGAPID.Value)
@@ -4103,7 +4162,13 @@ func HandleUplinkUEAssociatedNRPPATransport(ran *context.AmfRan, message *ngapTy
 
 	ranUe.RoutingID = hex.EncodeToString(routingID.Value)
 
-	// TODO: Forward NRPPaPDU to LMF
+	amfUe := ranUe.AmfUe
+	if amfUe == nil {
+		ranUe.Log.Error("AmfUe is nil")
+		return
+	}
+	// the Routing ID is the NF ID of the LMF which sent the NRPPa request
+	callback.SendLcsN2InfoNotify(amfUe, nRPPaPDU.Value, string(routingID.Value))
 }
 
 func HandleUplinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -4148,14 +4213,47 @@ func HandleUplinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, message *nga
 		ran.Log.Error("RoutingID is nil")
 		return
 	}
-	// Forward routingID to LMF
-	// Described in (23.502 4.13.5.6)
-
 	if nRPPaPDU == nil {
 		ran.Log.Error("NRPPaPDU is nil")
 		return
 	}
-	// TODO: Forward NRPPaPDU to LMF
+
+	// Forward NRPPaPDU to the LMF identified by the routingID, described in (23.502 4.13.5.6)
+	callback.SendNonUeN2InfoNotify(ran, models.N2InformationClass_NRP_PA, nRPPaPDU.Value, string(routingID.Value))
+}
+
+// TS 23.041 9.1.3.5: the Write-Replace Warning and PWS Cancel responses carry the broadcast completed
+// area list, the PWS Restart and Failure indications the restart/failure of the warning broadcast,
+// they are forwarded to the CBCF which subscribed to them with Non UE N2 Info Subscribe
+func HandlePWSMessage(ran *context.AmfRan, message *ngapType.NGAPPDU) {
+	if ran == nil {
+		logger.NgapLog.Error("ran is nil")
+		return
+	}
+	if message == nil {
+		ran.Log.Error("NGAP Message is nil")
+		return
+	}
+
+	var n2InformationClass models.N2InformationClass
+	switch message.Present {
+	case ngapType.NGAPPDUPresentSuccessfulOutcome:
+		ran.Log.Info("Handle Write-Replace Warning / PWS Cancel Response")
+		n2InformationClass = models.N2InformationClass_PWS_BCAL
+	case ngapType.NGAPPDUPresentInitiatingMessage:
+		ran.Log.Info("Handle PWS Restart / Failure Indication")
+		n2InformationClass = models.N2InformationClass_PWS_RF
+	default:
+		ran.Log.Errorf("Unexpected PWS message[choice: %d]", message.Present)
+		return
+	}
+
+	pwsMessage, err := libngap.Encoder(*message)
+	if err != nil {
+		ran.Log.Errorf("Encode PWS message error: %+v", err)
+		return
+	}
+	callback.SendNonUeN2InfoNotify(ran, n2InformationClass, pwsMessage, "")
 }
 
 func HandleLocationReport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -4362,6 +4460,7 @@ func HandleUERadioCapabilityInfoIndication(ran *context.AmfRan, message *ngapTyp
 
 func HandleAMFconfigurationUpdateFailure(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	var cause *ngapType.Cause
+	var timeToWait *ngapType.TimeToWait
 	var criticalityDiagnostics *ngapType.CriticalityDiagnostics
 	if ran == nil {
 		logger.NgapLog.Error("ran is nil")
@@ -4394,17 +4493,24 @@ func HandleAMFconfigurationUpdateFailure(ran *context.AmfRan, message *ngapType.
 				ran.Log.Error("Cause is nil")
 				return
 			}
+		case ngapType.ProtocolIEIDTimeToWait:
+			timeToWait = ie.Value.TimeToWait
+			ran.Log.Trace("Decode IE TimeToWait")
 		case ngapType.ProtocolIEIDCriticalityDiagnostics:
 			criticalityDiagnostics = ie.Value.CriticalityDiagnostics
 			ran.Log.Trace("Decode IE CriticalityDiagnostics")
 		}
 	}
 
-	//	TODO: Time To Wait
+	if cause != nil {
+		printAndGetCause(ran, cause)
+	}
 
 	if criticalityDiagnostics != nil {
 		printCriticalityDiagnostics(ran, criticalityDiagnostics)
 	}
+
+	amfConfigurationUpdateFailed(ran, timeToWait)
 }
 
 func HandleAMFconfigurationUpdateAcknowledge(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -4459,6 +4565,8 @@ func HandleAMFconfigurationUpdateAcknowledge(ran *context.AmfRan, message *ngapT
 	if criticalityDiagnostics != nil {
 		printCriticalityDiagnostics(ran, criticalityDiagnostics)
 	}
+
+	amfConfigurationUpdateAcknowledged(ran)
 }
 
 func HandleErrorIndication(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -4648,6 +4756,18 @@ func HandleCellTrafficTrace(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	// to the Trace Collection Entity.
 }
 
+// normalReleaseCause reports whether the UE context is released by the RAN for a normal reason, other
+// releases are communication failures of the UE (TS 29.518 6.2.6.2.19)
+func normalReleaseCause(causeGroup int, causeValue aper.Enumerated) bool {
+	switch causeGroup {
+	case ngapType.CausePresentRadioNetwork:
+		return causeValue == ngapType.CauseRadioNetworkPresentUserInactivity
+	case ngapType.CausePresentNas:
+		return causeValue == ngapType.CauseNasPresentNormalRelease || causeValue == ngapType.CauseNasPresentDeregister
+	}
+	return false
+}
+
 func printAndGetCause(ran *context.AmfRan, cause *ngapType.Cause) (present int, value aper.Enumerated) {
 	present = cause.Present
 	switch cause.Present {
@@ -0,0 +1,419 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package ngap
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/antihax/optional"
+
+	"github.com/omec-project/amf/consumer"
+	"github.com/omec-project/amf/context"
+	ngap_message "github.com/omec-project/amf/ngap/message"
+	"github.com/omec-project/amf/producer/callback"
+	"github.com/omec-project/amf/util"
+	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap/ngapConvert"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/Nnrf_NFDiscovery"
+	"github.com/omec-project/openapi/models"
+)
+
+// N2 handover between AMFs, TS 23.502 4.9.1.3.
+// The NGAP IEs exchanged between the AMFs are the binary parts of the multipart/related bodies,
+// referenced by the Content-ID in the NgapData of their N2InfoContent.
+
+// source AMF, step 2-3: select the target AMF serving the target TAI and send
+// Namf_Communication_CreateUEContext Request
+func sendCreateUeContextToTargetAmf(sourceUe *context.RanUe, cause *ngapType.Cause, targetID *ngapType.TargetID,
+	pDUSessionResourceListHORqd *ngapType.PDUSessionResourceListHORqd,
+	sourceToTargetTransparentContainer *ngapType.SourceToTargetTransparentContainer) {
+	amfSelf := context.AMF_Self()
+	amfUe := sourceUe.AmfUe
+
+	targetRanNodeId := ngapConvert.RanIdToModels(targetID.TargetRANNodeID.GlobalRANNodeID)
+	tai := ngapConvert.TaiToModels(targetID.TargetRANNodeID.SelectedTAI)
+	targetId := models.NgRanTargetId{
+		RanNodeId: &targetRanNodeId,
+		Tai:       &tai,
+	}
+
+	searchOpt := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
+		Tai: optional.NewInterface(util.MarshToJsonString(tai)),
+	}
+	err := consumer.SearchAmfCommunicationInstance(amfUe, amfSelf.NrfUri, models.NfType_AMF, models.NfType_AMF,
+		&searchOpt)
+	if err == nil && amfUe.TargetAmfProfile != nil && amfUe.TargetAmfProfile.NfInstanceId == amfSelf.NfId {
+		err = fmt.Errorf("target TAI is served by this AMF but the target RAN is not connected")
+	}
+	if err != nil {
+		sourceUe.Log.Errorf("Handover Required: select target AMF failed: %+v", err)
+		sendHandoverPreparationFailure(sourceUe, ngapType.CauseRadioNetworkPresentUnknownTargetID)
+		return
+	}
+	sourceUe.Log.Infof("Handover Required: target AMF[%s]", amfUe.TargetAmfUri)
+
+	ngapParts := make(map[string][]byte)
+	var pduSessionList []models.N2SmInformation
+	for _, item := range pDUSessionResourceListHORqd.List {
+		pduSessionId := int32(item.PDUSessionID.Value)
+		smContext, exist := amfUe.SmContextFindByPDUSessionID(pduSessionId)
+		if !exist {
+			sourceUe.Log.Warnf("SmContext[PDU Session ID:%d] not found", pduSessionId)
+			continue
+		}
+		snssai := smContext.Snssai()
+		smInfo := buildN2SmInformation(ngapParts, item.PDUSessionID.Value, models.NgapIeType_HANDOVER_REQUIRED,
+			item.HandoverRequiredTransfer)
+		smInfo.SNssai = &snssai
+		pduSessionList = append(pduSessionList, smInfo)
+	}
+	if len(pduSessionList) == 0 {
+		sendHandoverPreparationFailure(sourceUe,
+			ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+		return
+	}
+
+	sourceToTargetData := buildN2InfoContent(ngapParts, models.NgapIeType_SRC_TO_TAR_CONTAINER,
+		sourceToTargetTransparentContainer.Value)
+	var ngapCause *models.NgApCause
+	if cause != nil {
+		ngapCause = &models.NgApCause{
+			Group: int32(cause.Present),
+			Value: int32(ngapCauseValue(*cause)),
+		}
+	}
+	n2NotifyUri := fmt.Sprintf("%s/namf-callback/v1/n2-info-notify/%s", amfSelf.GetIPv4Uri(), amfUe.Supi)
+
+	// the target AMF forwards {NH, NCC} to the target RAN
+	amfUe.UpdateNH()
+	ueContextCreateData := consumer.BuildUeContextCreateData(amfUe, targetId, sourceToTargetData, pduSessionList,
+		n2NotifyUri, ngapCause)
+
+	// the response is only received when the target RAN has allocated the resources,
+	// do not block the UE while waiting for it, the response is handled in its event loop
+	go func() {
+		createdData, createdNgapParts, createError, problemDetails, err := consumer.CreateUEContextRequest(amfUe,
+			ueContextCreateData, ngapParts)
+		submitInterAmfHandoverResponse(amfUe, createUeContextResponse{
+			sourceUe:       sourceUe,
+			createdData:    createdData,
+			ngapParts:      createdNgapParts,
+			createError:    createError,
+			problemDetails: problemDetails,
+			err:            err,
+		})
+	}()
+}
+
+// createUeContextResponse is the Namf_Communication_CreateUEContext Response of the target AMF
+type createUeContextResponse struct {
+	sourceUe       *context.RanUe
+	createdData    *models.UeContextCreatedData
+	ngapParts      map[string][]byte
+	createError    *models.UeContextCreateError
+	problemDetails *models.ProblemDetails
+	err            error
+}
+
+// releaseUeContextResponse is the Namf_Communication_ReleaseUEContext Response of the target AMF
+type releaseUeContextResponse struct {
+	sourceUe       *context.RanUe
+	problemDetails *models.ProblemDetails
+	err            error
+}
+
+func InterAmfHandoverHandler(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
+	switch rsp := msg.(type) {
+	case createUeContextResponse:
+		handleCreateUeContextResponse(rsp.sourceUe, rsp.createdData, rsp.ngapParts, rsp.createError,
+			rsp.problemDetails, rsp.err)
+	case releaseUeContextResponse:
+		handleReleaseUeContextResponse(rsp.sourceUe, rsp.problemDetails, rsp.err)
+	}
+	return nil, "", nil, nil
+}
+
+// submitInterAmfHandoverResponse submits a response of the target AMF to the event loop of amfUe
+func submitInterAmfHandoverResponse(amfUe *context.AmfUe, rsp interface{}) {
+	amfUe.SetEventChannel(NgapMsgHandler)
+	amfUe.EventChannel.SubmitMessage(context.SbiMsg{
+		UeContextId: amfUe.Supi,
+		Msg:         rsp,
+		Handler:     InterAmfHandoverHandler,
+		Result:      make(chan context.SbiResponseMsg, 1),
+	})
+}
+
+// source AMF, step 12: Namf_Communication_CreateUEContext Response
+func handleCreateUeContextResponse(sourceUe *context.RanUe, createdData *models.UeContextCreatedData,
+	ngapParts map[string][]byte, createError *models.UeContextCreateError, problemDetails *models.ProblemDetails,
+	err error) {
+	amfUe := sourceUe.AmfUe
+	if amfUe == nil || amfUe.OnGoing(sourceUe.Ran.AnType).Procedure != context.OnGoingProcedureN2Handover {
+		sourceUe.Log.Warnln("Handover preparation is not ongoing anymore, ignore Create UE Context Response")
+		return
+	}
+
+	causeValue := ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem
+	switch {
+	case err != nil:
+		sourceUe.Log.Errorf("Create UE Context Request Error[%+v]", err)
+	case createError != nil:
+		sourceUe.Log.Warnf("Create UE Context Request Failed[%+v]", createError.Error)
+		if ngapCause := createError.NgapCause; ngapCause != nil &&
+			ngapCause.Group == int32(ngapType.CausePresentRadioNetwork) {
+			causeValue = aper.Enumerated(ngapCause.Value)
+		}
+	case problemDetails != nil:
+		sourceUe.Log.Warnf("Create UE Context Request Failed Problem[%+v]", problemDetails)
+	case createdData == nil || createdData.TargetToSourceData == nil ||
+		createdData.TargetToSourceData.NgapData == nil:
+		sourceUe.Log.Errorln("Create UE Context Response without TargetToSourceData")
+	default:
+		sendHandoverCommandFromCreatedData(sourceUe, createdData, ngapParts)
+		return
+	}
+	sendHandoverPreparationFailure(sourceUe, causeValue)
+}
+
+func sendHandoverCommandFromCreatedData(sourceUe *context.RanUe, createdData *models.UeContextCreatedData,
+	ngapParts map[string][]byte) {
+	var container ngapType.TargetToSourceTransparentContainer
+	if container.Value = ngapParts[createdData.TargetToSourceData.NgapData.ContentId]; len(container.Value) == 0 {
+		sourceUe.Log.Errorln("TargetToSourceData is missing in Create UE Context Response")
+		sendHandoverPreparationFailure(sourceUe,
+			ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+		return
+	}
+
+	var pduSessionResourceHandoverList ngapType.PDUSessionResourceHandoverList
+	var pduSessionResourceToReleaseList ngapType.PDUSessionResourceToReleaseListHOCmd
+	for _, smInfo := range createdData.PduSessionList {
+		transfer, ok := n2SmInfoData(smInfo, ngapParts)
+		if !ok {
+			continue
+		}
+		handoverItem := ngapType.PDUSessionResourceHandoverItem{}
+		handoverItem.PDUSessionID.Value = int64(smInfo.PduSessionId)
+		handoverItem.HandoverCommandTransfer = transfer
+		pduSessionResourceHandoverList.List = append(pduSessionResourceHandoverList.List, handoverItem)
+	}
+	for _, smInfo := range createdData.FailedSessionList {
+		transfer, ok := n2SmInfoData(smInfo, ngapParts)
+		if !ok {
+			continue
+		}
+		releaseItem := ngapType.PDUSessionResourceToReleaseItemHOCmd{}
+		releaseItem.PDUSessionID.Value = int64(smInfo.PduSessionId)
+		releaseItem.HandoverPreparationUnsuccessfulTransfer = transfer
+		pduSessionResourceToReleaseList.List = append(pduSessionResourceToReleaseList.List, releaseItem)
+	}
+	if len(pduSessionResourceHandoverList.List) == 0 {
+		sendHandoverPreparationFailure(sourceUe,
+			ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+		return
+	}
+	ngap_message.SendHandoverCommand(sourceUe, pduSessionResourceHandoverList, pduSessionResourceToReleaseList,
+		container, nil)
+}
+
+// source AMF, TS 23.502 4.9.1.4 step 2: Namf_Communication_ReleaseUEContext Request to the target AMF,
+// the response is handled in the event loop of the UE
+func cancelInterAmfHandover(sourceUe *context.RanUe, causePresent int, causeValue aper.Enumerated) {
+	amfUe := sourceUe.AmfUe
+	ngapCause := models.NgApCause{
+		Group: int32(causePresent),
+		Value: int32(causeValue),
+	}
+	go func() {
+		problemDetails, err := consumer.ReleaseUEContextRequest(amfUe, ngapCause)
+		submitInterAmfHandoverResponse(amfUe, releaseUeContextResponse{
+			sourceUe:       sourceUe,
+			problemDetails: problemDetails,
+			err:            err,
+		})
+	}()
+}
+
+func handleReleaseUeContextResponse(sourceUe *context.RanUe, problemDetails *models.ProblemDetails, err error) {
+	amfUe := sourceUe.AmfUe
+	if amfUe == nil {
+		return
+	}
+	if problemDetails != nil {
+		sourceUe.Log.Warnf("Release UE Context Request Failed Problem[%+v]", problemDetails)
+	} else if err != nil {
+		sourceUe.Log.Errorf("Release UE Context Request Error[%+v]", err)
+	}
+	amfUe.SetOnGoing(sourceUe.Ran.AnType, &context.OnGoing{
+		Procedure: context.OnGoingProcedureNothing,
+	})
+}
+
+func sendHandoverPreparationFailure(sourceUe *context.RanUe, causeValue aper.Enumerated) {
+	sourceUe.Log.Infof("Handle Handover Preparation Failure [RadioNetwork cause: %d]", causeValue)
+	cause := ngapType.Cause{
+		Present: ngapType.CausePresentRadioNetwork,
+		RadioNetwork: &ngapType.CauseRadioNetwork{
+			Value: causeValue,
+		},
+	}
+	ngap_message.SendHandoverPreparationFailure(sourceUe, cause, nil)
+}
+
+// target AMF, step 10: the target RAN has allocated the resources, answer the source AMF
+func interAmfHandoverPrepared(targetUe *context.RanUe,
+	pduSessionResourceHandoverList ngapType.PDUSessionResourceHandoverList,
+	pduSessionResourceToReleaseList ngapType.PDUSessionResourceToReleaseListHOCmd,
+	container ngapType.TargetToSourceTransparentContainer) {
+	amfUe := targetUe.AmfUe
+	if len(pduSessionResourceHandoverList.List) == 0 {
+		interAmfHandoverFailed(targetUe, ngapType.CausePresentRadioNetwork,
+			ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+		return
+	}
+
+	ngapParts := make(map[string][]byte)
+	targetToSourceData := buildN2InfoContent(ngapParts, models.NgapIeType_TAR_TO_SRC_CONTAINER, container.Value)
+	createdData := &models.UeContextCreatedData{
+		UeContext: &models.UeContext{
+			Supi: amfUe.Supi,
+		},
+		TargetToSourceData: &targetToSourceData,
+		// TODO: When Target AMF selects a nw PCF for AM policy, set the flag to true.
+		PcfReselectedInd: false,
+	}
+	for _, item := range pduSessionResourceHandoverList.List {
+		createdData.PduSessionList = append(createdData.PduSessionList,
+			buildN2SmInformation(ngapParts, item.PDUSessionID.Value, models.NgapIeType_HANDOVER_CMD,
+				item.HandoverCommandTransfer))
+	}
+	for _, item := range pduSessionResourceToReleaseList.List {
+		createdData.FailedSessionList = append(createdData.FailedSessionList,
+			buildN2SmInformation(ngapParts, item.PDUSessionID.Value, models.NgapIeType_HANDOVER_PREP_FAIL,
+				item.HandoverPreparationUnsuccessfulTransfer))
+	}
+	if !amfUe.NotifyInterAmfHandoverResult(context.InterAmfHandoverResult{
+		CreatedData: createdData,
+		NgapParts:   ngapParts,
+	}) {
+		targetUe.Log.Warnln("No pending Create UE Context Request, release the target UE")
+		ngap_message.SendUEContextReleaseCommand(targetUe, context.UeContextReleaseInterAmfHandover,
+			ngapType.CausePresentRadioNetwork, ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+	}
+}
+
+// target AMF: the handover resource allocation failed, cancel the handover at the SMF,
+// release the target UE and answer the source AMF
+func interAmfHandoverFailed(targetUe *context.RanUe, causePresent int, causeValue aper.Enumerated) {
+	amfUe := targetUe.AmfUe
+	ngapCause := &models.NgApCause{
+		Group: int32(causePresent),
+		Value: int32(causeValue),
+	}
+	amfUe.SmContextList.Range(func(key, value interface{}) bool {
+		pduSessionID := key.(int32)
+		smContext := value.(*context.SmContext)
+		_, _, _, err := consumer.SendUpdateSmContextN2HandoverCanceled(amfUe, smContext,
+			context.CauseAll{NgapCause: ngapCause})
+		if err != nil {
+			targetUe.Log.Errorf("Send UpdateSmContextN2HandoverCanceled Error for PduSessionId[%d]", pduSessionID)
+		}
+		return true
+	})
+	amfUe.NotifyInterAmfHandoverResult(context.InterAmfHandoverResult{
+		CreateError: &models.UeContextCreateError{
+			Error: &models.ProblemDetails{
+				Status: http.StatusForbidden,
+				Cause:  "HANDOVER_FAILURE",
+			},
+			NgapCause: ngapCause,
+		},
+	})
+	ngap_message.SendUEContextReleaseCommand(targetUe, context.UeContextReleaseInterAmfHandover,
+		causePresent, causeValue)
+}
+
+// target AMF, TS 23.502 4.9.1.3.3 step 2-3: the UE arrived in the target RAN
+func interAmfHandoverCompleted(targetUe *context.RanUe) {
+	amfUe := targetUe.AmfUe
+	amfSelf := context.AMF_Self()
+
+	var guami *models.Guami
+	if len(amfSelf.ServedGuamiList) > 0 {
+		guami = &amfSelf.ServedGuamiList[0]
+	}
+	amfUe.SmContextList.Range(func(key, value interface{}) bool {
+		pduSessionID := key.(int32)
+		smContext := value.(*context.SmContext)
+		if !targetUeAdmittedPduSession(targetUe, pduSessionID) {
+			return true
+		}
+		_, _, _, err := consumer.SendUpdateSmContextN2HandoverComplete(amfUe, smContext, amfSelf.NfId, guami)
+		if err != nil {
+			targetUe.Log.Errorf("Send UpdateSmContextN2HandoverComplete Error[%s]", err.Error())
+		}
+		return true
+	})
+
+	amfUe.AttachRanUe(targetUe)
+	amfUe.State[targetUe.Ran.AnType].Set(context.Registered)
+	amfUe.SetOnGoing(targetUe.Ran.AnType, &context.OnGoing{
+		Procedure: context.OnGoingProcedureNothing,
+	})
+	if err := callback.SendN2InfoNotifyN2Handover(amfUe, nil); err != nil {
+		targetUe.Log.Errorf("Send N2InfoNotify to source AMF failed: %+v", err)
+	}
+	amfUe.HandoverNotifyUri = ""
+	amfUe.PublishUeCtxtInfo()
+	context.StoreContextInDB(amfUe)
+}
+
+func targetUeAdmittedPduSession(targetUe *context.RanUe, pduSessionID int32) bool {
+	for _, id := range targetUe.SuccessPduSessionId {
+		if id == pduSessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// buildN2InfoContent references the NGAP IE by its Content-ID and adds it to the binary parts
+func buildN2InfoContent(ngapParts map[string][]byte, ieType models.NgapIeType, data []byte) models.N2InfoContent {
+	contentId := string(ieType)
+	ngapParts[contentId] = data
+	return models.N2InfoContent{
+		NgapIeType: ieType,
+		NgapData: &models.RefToBinaryData{
+			ContentId: contentId,
+		},
+	}
+}
+
+func buildN2SmInformation(ngapParts map[string][]byte, pduSessionID int64, ieType models.NgapIeType,
+	transfer []byte) models.N2SmInformation {
+	contentId := fmt.Sprintf("%s-%d", ieType, pduSessionID)
+	ngapParts[contentId] = transfer
+	return models.N2SmInformation{
+		PduSessionId: int32(pduSessionID),
+		N2InfoContent: &models.N2InfoContent{
+			NgapIeType: ieType,
+			NgapData: &models.RefToBinaryData{
+				ContentId: contentId,
+			},
+		},
+	}
+}
+
+func n2SmInfoData(smInfo models.N2SmInformation, ngapParts map[string][]byte) ([]byte, bool) {
+	if smInfo.N2InfoContent == nil || smInfo.N2InfoContent.NgapData == nil {
+		return nil, false
+	}
+	data, ok := ngapParts[smInfo.N2InfoContent.NgapData.ContentId]
+	return data, ok && len(data) > 0
+}
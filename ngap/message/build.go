@@ -16,6 +16,7 @@ import (
 	"github.com/omec-project/amf/metrics"
 	"github.com/omec-project/amf/msgtypes/ngapmsgtypes"
 	"github.com/omec-project/aper"
+	"github.com/omec-project/nas/nasMessage"
 	"github.com/omec-project/ngap"
 	"github.com/omec-project/ngap/ngapConvert"
 	"github.com/omec-project/ngap/ngapType"
@@ -1273,6 +1274,7 @@ func BuildUEContextModificationRequest(
 	amfUe *context.AmfUe,
 	anType models.AccessType,
 	oldAmfUeNgapID *int64,
+	securityKey []byte,
 	rrcInactiveTransitionReportRequest *ngapType.RRCInactiveTransitionReportRequest,
 	coreNetworkAssistanceInfo *ngapType.CoreNetworkAssistanceInformation,
 	mobilityRestrictionList *ngapType.MobilityRestrictionList,
@@ -1280,10 +1282,11 @@ func BuildUEContextModificationRequest(
 	// accessType indicate amfUe send this msg for which accessType
 	// oldAmfUeNgapID: if amf allocate a new amf ue ngap id to amfUe, the caller should
 	// update the context by itself, and pass the old AmfUeNgapID to this function
+	// securityKey: the new KgNB/KN3IWF when the AS keys of the UE are changed (TS 33.501 6.9.4)
 	// for other parameters, please reference the comments in BuildInitialContextSetupRequest
 
 	// TODO: Ran Paging Priority (optional) [int: 1~256] TS 38.413 9.3.3.15, TS 23.501
-	// TODO: fill IE securityKey & ueSecurityCapabilities to code
+	// TODO: fill IE ueSecurityCapabilities to code
 
 	if amfUe == nil {
 		return nil, fmt.Errorf("amfUe is nil")
@@ -1340,6 +1343,16 @@ func BuildUEContextModificationRequest(
 	// Ran Paging Priority (optional)
 
 	// Security Key (optional)
+	if securityKey != nil {
+		ie = ngapType.UEContextModificationRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDSecurityKey
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentSecurityKey
+		ie.Value.SecurityKey = new(ngapType.SecurityKey)
+		ie.Value.SecurityKey.Value = ngapConvert.ByteToBitString(securityKey, 256)
+
+		uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+	}
 
 	// Index to RAT/Frequency Selection Priority (optional)
 	if amfUe.AmPolicyAssociation != nil && amfUe.AmPolicyAssociation.Rfsp != 0 {
@@ -2139,10 +2152,9 @@ func BuildDownlinkRanStatusTransfer(ue *context.RanUe,
 // is associated with non-3GPP access, the AMF sends a Paging message with associated access "non-3GPP" to
 // NG-RAN node(s) via 3GPP access.
 // more paging policy with 3gpp/non-3gpp access is described in TS 23.501 5.6.8
-func BuildPaging(
-	ue *context.AmfUe, pagingPriority *ngapType.PagingPriority, pagingOriginNon3GPP bool) ([]byte, error) {
-	// TODO: Paging DRX (optional)
-
+// attempt: paging area and attempt information, the whole registration area is paged if it is nil
+func BuildPaging(ue *context.AmfUe, pagingPriority *ngapType.PagingPriority, pagingOriginNon3GPP bool,
+	attempt *context.PagingAttempt) ([]byte, error) {
 	var pdu ngapType.NGAPPDU
 	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
 	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
@@ -2168,14 +2180,19 @@ func BuildPaging(
 	uePagingIdentity.Present = ngapType.UEPagingIdentityPresentFiveGSTMSI
 	uePagingIdentity.FiveGSTMSI = new(ngapType.FiveGSTMSI)
 
+	// TS 24.501 5.4.4.4: the UE is paged with the old 5G-S-TMSI until it acknowledged the new GUTI
+	guti := ue.Guti
+	if ue.OldGuti != "" {
+		guti = ue.OldGuti
+	}
 	var amfID string
 	var tmsi string
-	if len(ue.Guti) == 19 {
-		amfID = ue.Guti[5:11]
-		tmsi = ue.Guti[11:]
+	if len(guti) == 19 {
+		amfID = guti[5:11]
+		tmsi = guti[11:]
 	} else {
-		amfID = ue.Guti[6:12]
-		tmsi = ue.Guti[12:]
+		amfID = guti[6:12]
+		tmsi = guti[12:]
 	}
 	_, amfSetID, amfPointer := ngapConvert.AmfIdToNgap(amfID)
 
@@ -2190,6 +2207,15 @@ func BuildPaging(
 	pagingIEs.List = append(pagingIEs.List, ie)
 
 	// Paging DRX (optional)
+	if pagingDRX, ok := pagingDrxFromNas(ue.UESpecificDRX); ok {
+		ie = ngapType.PagingIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDPagingDRX
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.PagingIEsPresentPagingDRX
+		ie.Value.PagingDRX = new(ngapType.PagingDRX)
+		ie.Value.PagingDRX.Value = pagingDRX
+		pagingIEs.List = append(pagingIEs.List, ie)
+	}
 
 	// TAI List for Paging
 	ie = ngapType.PagingIEs{}
@@ -2199,11 +2225,15 @@ func BuildPaging(
 	ie.Value.TAIListForPaging = new(ngapType.TAIListForPaging)
 
 	taiListForPaging := ie.Value.TAIListForPaging
-	if ue.RegistrationArea[models.AccessType__3_GPP_ACCESS] == nil {
+	taiList := ue.RegistrationArea[models.AccessType__3_GPP_ACCESS]
+	if attempt != nil && len(attempt.TaiList) != 0 {
+		taiList = attempt.TaiList
+	}
+	if taiList == nil {
 		err = fmt.Errorf("Registration Area of Ue[%s] is empty", ue.Supi)
 		return nil, err
 	} else {
-		for _, tai := range ue.RegistrationArea[models.AccessType__3_GPP_ACCESS] {
+		for _, tai := range taiList {
 			var tac []byte
 			taiListforPagingItem := ngapType.TAIListForPagingItem{}
 			taiListforPagingItem.TAI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*tai.PlmnId)
@@ -2255,7 +2285,7 @@ func BuildPaging(
 	}
 
 	// Assistance Data for Paing (optional)
-	if ue.InfoOnRecommendedCellsAndRanNodesForPaging != nil {
+	if ue.InfoOnRecommendedCellsAndRanNodesForPaging != nil || attempt != nil {
 		ie = ngapType.PagingIEs{}
 		ie.Id.Value = ngapType.ProtocolIEIDAssistanceDataForPaging
 		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
@@ -2263,12 +2293,18 @@ func BuildPaging(
 		ie.Value.AssistanceDataForPaging = new(ngapType.AssistanceDataForPaging)
 
 		assistanceDataForPaging := ie.Value.AssistanceDataForPaging
-		assistanceDataForPaging.AssistanceDataForRecommendedCells =
-			new(ngapType.AssistanceDataForRecommendedCells)
-		recommendedCellList := &assistanceDataForPaging.
-			AssistanceDataForRecommendedCells.RecommendedCellsForPaging.RecommendedCellList
+		var recommendedCells []context.RecommendedCell
+		if ue.InfoOnRecommendedCellsAndRanNodesForPaging != nil {
+			recommendedCells = ue.InfoOnRecommendedCellsAndRanNodesForPaging.RecommendedCells
+		}
+		if len(recommendedCells) != 0 {
+			assistanceDataForPaging.AssistanceDataForRecommendedCells =
+				new(ngapType.AssistanceDataForRecommendedCells)
+		}
+		for _, recommendedCell := range recommendedCells {
+			recommendedCellList := &assistanceDataForPaging.
+				AssistanceDataForRecommendedCells.RecommendedCellsForPaging.RecommendedCellList
 
-		for _, recommendedCell := range ue.InfoOnRecommendedCellsAndRanNodesForPaging.RecommendedCells {
 			recommendedCellItem := ngapType.RecommendedCellItem{}
 			switch recommendedCell.NgRanCGI.Present {
 			case context.NgRanCgiPresentNRCGI:
@@ -2292,7 +2328,21 @@ func BuildPaging(
 			recommendedCellList.List = append(recommendedCellList.List, recommendedCellItem)
 		}
 
-		// TODO: Paging Attempt Information (optional): provided by AMF (TS 23.502 4.2.3.3, TS 38.300 9.2.5)
+		// Paging Attempt Information (optional): provided by AMF (TS 23.502 4.2.3.3, TS 38.300 9.2.5)
+		if attempt != nil {
+			assistanceDataForPaging.PagingAttemptInformation = new(ngapType.PagingAttemptInformation)
+			pagingAttemptInformation := assistanceDataForPaging.PagingAttemptInformation
+			pagingAttemptInformation.PagingAttemptCount.Value = int64(attempt.Count)
+			pagingAttemptInformation.IntendedNumberOfPagingAttempts.Value = int64(attempt.Intended)
+			if attempt.Count < attempt.Intended {
+				pagingAttemptInformation.NextPagingAreaScope = new(ngapType.NextPagingAreaScope)
+				if attempt.NextScopeChanged {
+					pagingAttemptInformation.NextPagingAreaScope.Value = ngapType.NextPagingAreaScopePresentChanged
+				} else {
+					pagingAttemptInformation.NextPagingAreaScope.Value = ngapType.NextPagingAreaScopePresentSame
+				}
+			}
+		}
 		pagingIEs.List = append(pagingIEs.List, ie)
 	}
 
@@ -2311,6 +2361,42 @@ func BuildPaging(
 	return ngap.Encoder(pdu)
 }
 
+// BuildCause builds the NGAP Cause from the cause group and value, e.g. as received in a models.NgApCause
+func BuildCause(present int, value aper.Enumerated) (cause ngapType.Cause, err error) {
+	cause.Present = present
+	switch present {
+	case ngapType.CausePresentRadioNetwork:
+		cause.RadioNetwork = &ngapType.CauseRadioNetwork{Value: value}
+	case ngapType.CausePresentTransport:
+		cause.Transport = &ngapType.CauseTransport{Value: value}
+	case ngapType.CausePresentNas:
+		cause.Nas = &ngapType.CauseNas{Value: value}
+	case ngapType.CausePresentProtocol:
+		cause.Protocol = &ngapType.CauseProtocol{Value: value}
+	case ngapType.CausePresentMisc:
+		cause.Misc = &ngapType.CauseMisc{Value: value}
+	default:
+		err = fmt.Errorf("Cause Present is Unknown")
+	}
+	return
+}
+
+// map the UE specific DRX negotiated over NAS (TS 24.501 9.11.3.2A) to the NGAP Paging DRX
+func pagingDrxFromNas(drx uint8) (aper.Enumerated, bool) {
+	switch drx {
+	case nasMessage.DRXcycleParameterT32:
+		return ngapType.PagingDRXPresentV32, true
+	case nasMessage.DRXcycleParameterT64:
+		return ngapType.PagingDRXPresentV64, true
+	case nasMessage.DRXcycleParameterT128:
+		return ngapType.PagingDRXPresentV128, true
+	case nasMessage.DRXcycleParameterT256:
+		return ngapType.PagingDRXPresentV256, true
+	default:
+		return 0, false
+	}
+}
+
 // TS 23.502 4.2.2.2.3
 // anType: indicate amfUe send this msg for which accessType
 // amfUeNgapID: initial AMF get it from target AMF
@@ -2644,8 +2730,7 @@ func BuildDownlinkRanConfigurationTransfer(
 	return ngap.Encoder(pdu)
 }
 
-func BuildDownlinkNonUEAssociatedNRPPATransport(
-	ue *context.RanUe, nRPPaPDU ngapType.NRPPaPDU) ([]byte, error) {
+func BuildDownlinkNonUEAssociatedNRPPATransport(routingID []byte, nRPPaPDU ngapType.NRPPaPDU) ([]byte, error) {
 	// NRPPa PDU is by pass
 	// NRPPa PDU is from LMF define in 4.13.5.6
 
@@ -2665,19 +2750,13 @@ func BuildDownlinkNonUEAssociatedNRPPATransport(
 	downlinkNonUEAssociatedNRPPaTransportIEs := &downlinkNonUEAssociatedNRPPaTransport.ProtocolIEs
 
 	// Routing ID
-	// Routing id in the ran context
+	// Routing id of the LMF, returned by the RAN in the uplink transport
 	ie := ngapType.DownlinkNonUEAssociatedNRPPaTransportIEs{}
 	ie.Id.Value = ngapType.ProtocolIEIDRoutingID
 	ie.Criticality.Value = ngapType.CriticalityPresentReject
 	ie.Value.Present = ngapType.DownlinkNonUEAssociatedNRPPaTransportIEsPresentRoutingID
 	ie.Value.RoutingID = new(ngapType.RoutingID)
-
-	var err error
-	routingID := ie.Value.RoutingID
-	routingID.Value, err = hex.DecodeString(ue.RoutingID)
-	if err != nil {
-		logger.NgapLog.Errorf("[Build Error] DecodeString ue.RoutingID error: %+v", err)
-	}
+	ie.Value.RoutingID.Value = routingID
 
 	downlinkNonUEAssociatedNRPPaTransportIEs.List = append(downlinkNonUEAssociatedNRPPaTransportIEs.List, ie)
 
@@ -2919,10 +2998,8 @@ func BuildUETNLABindingReleaseRequest(ue *context.RanUe) ([]byte, error) {
 	return ngap.Encoder(pdu)
 }
 
-// Weight Factor associated with each of the TNL association within the AMF
-func BuildAMFConfigurationUpdate(tNLassociationUsage ngapType.TNLAssociationUsage,
-	tNLAddressWeightFactor ngapType.TNLAddressWeightFactor) ([]byte, error) {
-	amfSelf := context.AMF_Self()
+// AMF Configuration Update carries only the changed IEs of update (TS 38.413 8.7.3)
+func BuildAMFConfigurationUpdate(update context.AmfConfigUpdate) ([]byte, error) {
 	var pdu ngapType.NGAPPDU
 
 	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
@@ -2938,151 +3015,77 @@ func BuildAMFConfigurationUpdate(tNLassociationUsage ngapType.TNLAssociationUsag
 	aMFConfigurationUpdateIEs := &aMFConfigurationUpdate.ProtocolIEs
 
 	//	AMF Name(optional)
-	ie := ngapType.AMFConfigurationUpdateIEs{}
-	ie.Id.Value = ngapType.ProtocolIEIDAMFName
-	ie.Criticality.Value = ngapType.CriticalityPresentReject
-	ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFName
-	ie.Value.AMFName = new(ngapType.AMFName)
-
-	aMFName := ie.Value.AMFName
-	aMFName.Value = amfSelf.Name
-
-	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+	if update.AmfName != nil {
+		ie := ngapType.AMFConfigurationUpdateIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAMFName
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFName
+		ie.Value.AMFName = new(ngapType.AMFName)
 
-	//	Served GUAMI List
-	ie = ngapType.AMFConfigurationUpdateIEs{}
-	ie.Id.Value = ngapType.ProtocolIEIDServedGUAMIList
-	ie.Criticality.Value = ngapType.CriticalityPresentReject
-	ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentServedGUAMIList
-	ie.Value.ServedGUAMIList = new(ngapType.ServedGUAMIList)
+		aMFName := ie.Value.AMFName
+		aMFName.Value = *update.AmfName
 
-	servedGUAMIList := ie.Value.ServedGUAMIList
-	for _, guami := range amfSelf.ServedGuamiList {
-		servedGUAMIItem := ngapType.ServedGUAMIItem{}
-		servedGUAMIItem.GUAMI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*guami.PlmnId)
-		regionId, setId, prtId := ngapConvert.AmfIdToNgap(guami.AmfId)
-		servedGUAMIItem.GUAMI.AMFRegionID.Value = regionId
-		servedGUAMIItem.GUAMI.AMFSetID.Value = setId
-		servedGUAMIItem.GUAMI.AMFPointer.Value = prtId
-		servedGUAMIList.List = append(servedGUAMIList.List, servedGUAMIItem)
+		aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
 	}
 
-	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
-
-	//	relative AMF Capability
-	ie = ngapType.AMFConfigurationUpdateIEs{}
-	ie.Id.Value = ngapType.ProtocolIEIDRelativeAMFCapacity
-	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
-	ie.Value.Present = ngapType.NGSetupResponseIEsPresentRelativeAMFCapacity
-	ie.Value.RelativeAMFCapacity = new(ngapType.RelativeAMFCapacity)
-	relativeAMFCapacity := ie.Value.RelativeAMFCapacity
-	relativeAMFCapacity.Value = amfSelf.RelativeCapacity
-
-	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
-
-	//	PLMN Support List
-	ie = ngapType.AMFConfigurationUpdateIEs{}
-	ie.Id.Value = ngapType.ProtocolIEIDPLMNSupportList
-	ie.Criticality.Value = ngapType.CriticalityPresentReject
-	ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentPLMNSupportList
-	ie.Value.PLMNSupportList = new(ngapType.PLMNSupportList)
-
-	pLMNSupportList := ie.Value.PLMNSupportList
-	for _, plmnItem := range amfSelf.PlmnSupportList {
-		pLMNSupportItem := ngapType.PLMNSupportItem{}
-		pLMNSupportItem.PLMNIdentity = ngapConvert.PlmnIdToNgap(plmnItem.PlmnId)
-		for _, snssai := range plmnItem.SNssaiList {
-			sliceSupportItem := ngapType.SliceSupportItem{}
-			sliceSupportItem.SNSSAI = ngapConvert.SNssaiToNgap(snssai)
-			pLMNSupportItem.SliceSupportList.List =
-				append(pLMNSupportItem.SliceSupportList.List, sliceSupportItem)
+	//	Served GUAMI List(optional)
+	if update.ServedGuamiList != nil {
+		ie := ngapType.AMFConfigurationUpdateIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDServedGUAMIList
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentServedGUAMIList
+		ie.Value.ServedGUAMIList = new(ngapType.ServedGUAMIList)
+
+		servedGUAMIList := ie.Value.ServedGUAMIList
+		for _, guami := range update.ServedGuamiList {
+			servedGUAMIItem := ngapType.ServedGUAMIItem{}
+			servedGUAMIItem.GUAMI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*guami.PlmnId)
+			regionId, setId, prtId := ngapConvert.AmfIdToNgap(guami.AmfId)
+			servedGUAMIItem.GUAMI.AMFRegionID.Value = regionId
+			servedGUAMIItem.GUAMI.AMFSetID.Value = setId
+			servedGUAMIItem.GUAMI.AMFPointer.Value = prtId
+			servedGUAMIList.List = append(servedGUAMIList.List, servedGUAMIItem)
 		}
-		pLMNSupportList.List = append(pLMNSupportList.List, pLMNSupportItem)
-	}
-
-	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
 
-	//	AMF TNL Association to Add List
-	ie = ngapType.AMFConfigurationUpdateIEs{}
-	ie.Id.Value = ngapType.ProtocolIEIDAMFTNLAssociationToAddList
-	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
-	ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFTNLAssociationToAddList
-	ie.Value.AMFTNLAssociationToAddList = new(ngapType.AMFTNLAssociationToAddList)
-
-	aMFTNLAssociationToAddList := ie.Value.AMFTNLAssociationToAddList
+		aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+	}
 
-	//	AMFTNLAssociationToAddItem in AMFTNLAssociationToAddList
-	aMFTNLAssociationToAddItem := ngapType.AMFTNLAssociationToAddItem{}
-	aMFTNLAssociationToAddItem.AMFTNLAssociationAddress.Present =
-		ngapType.CPTransportLayerInformationPresentEndpointIPAddress
-	aMFTNLAssociationToAddItem.AMFTNLAssociationAddress.EndpointIPAddress =
-		new(ngapType.TransportLayerAddress)
-	*aMFTNLAssociationToAddItem.AMFTNLAssociationAddress.EndpointIPAddress =
-		ngapConvert.IPAddressToNgap(amfSelf.RegisterIPv4, amfSelf.HttpIPv6Address)
+	//	relative AMF Capability(optional)
+	if update.RelativeCapacity != nil {
+		ie := ngapType.AMFConfigurationUpdateIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDRelativeAMFCapacity
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentRelativeAMFCapacity
+		ie.Value.RelativeAMFCapacity = new(ngapType.RelativeAMFCapacity)
+		relativeAMFCapacity := ie.Value.RelativeAMFCapacity
+		relativeAMFCapacity.Value = *update.RelativeCapacity
 
-	//	AMF TNL Association Usage[optional]
-	if aMFTNLAssociationToAddItem.TNLAssociationUsage != nil {
-		aMFTNLAssociationToAddItem.TNLAssociationUsage = new(ngapType.TNLAssociationUsage)
-		aMFTNLAssociationToAddItem.TNLAssociationUsage = &tNLassociationUsage
+		aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
 	}
 
-	//	AMF TNL Address Weight Factor
-	aMFTNLAssociationToAddItem.TNLAddressWeightFactor = tNLAddressWeightFactor
-
-	aMFTNLAssociationToAddList.List = append(aMFTNLAssociationToAddList.List, aMFTNLAssociationToAddItem)
-	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+	//	PLMN Support List(optional)
+	if update.PlmnSupportList != nil {
+		ie := ngapType.AMFConfigurationUpdateIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDPLMNSupportList
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentPLMNSupportList
+		ie.Value.PLMNSupportList = new(ngapType.PLMNSupportList)
+
+		pLMNSupportList := ie.Value.PLMNSupportList
+		for _, plmnItem := range update.PlmnSupportList {
+			pLMNSupportItem := ngapType.PLMNSupportItem{}
+			pLMNSupportItem.PLMNIdentity = ngapConvert.PlmnIdToNgap(plmnItem.PlmnId)
+			for _, snssai := range plmnItem.SNssaiList {
+				sliceSupportItem := ngapType.SliceSupportItem{}
+				sliceSupportItem.SNSSAI = ngapConvert.SNssaiToNgap(snssai)
+				pLMNSupportItem.SliceSupportList.List =
+					append(pLMNSupportItem.SliceSupportList.List, sliceSupportItem)
+			}
+			pLMNSupportList.List = append(pLMNSupportList.List, pLMNSupportItem)
+		}
 
-	//	AMF TNL Association to Remove List
-	ie = ngapType.AMFConfigurationUpdateIEs{}
-	ie.Id.Value = ngapType.ProtocolIEIDAMFTNLAssociationToRemoveList
-	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
-	ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFTNLAssociationToRemoveList
-	ie.Value.AMFTNLAssociationToRemoveList = new(ngapType.AMFTNLAssociationToRemoveList)
-
-	aMFTNLAssociationToRemoveList := ie.Value.AMFTNLAssociationToRemoveList
-
-	//	AMFTNLAssociationToRemoveItem
-	aMFTNLAssociationToRemoveItem := ngapType.AMFTNLAssociationToRemoveItem{}
-	aMFTNLAssociationToRemoveItem.AMFTNLAssociationAddress.Present =
-		ngapType.CPTransportLayerInformationPresentEndpointIPAddress
-	aMFTNLAssociationToRemoveItem.AMFTNLAssociationAddress.EndpointIPAddress =
-		new(ngapType.TransportLayerAddress)
-	*aMFTNLAssociationToRemoveItem.AMFTNLAssociationAddress.EndpointIPAddress =
-		ngapConvert.IPAddressToNgap(amfSelf.RegisterIPv4, amfSelf.HttpIPv6Address)
-
-	aMFTNLAssociationToRemoveList.List = append(aMFTNLAssociationToRemoveList.List, aMFTNLAssociationToRemoveItem)
-	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
-
-	//	AMFTNLAssociationToUpdateList
-	ie = ngapType.AMFConfigurationUpdateIEs{}
-	ie.Id.Value = ngapType.ProtocolIEIDAMFTNLAssociationToUpdateList
-	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
-	ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFTNLAssociationToUpdateList
-	ie.Value.AMFTNLAssociationToUpdateList = new(ngapType.AMFTNLAssociationToUpdateList)
-
-	aMFTNLAssociationToUpdateList := ie.Value.AMFTNLAssociationToUpdateList
-
-	//	AMFTNLAssociationAddress in AMFTNLAssociationtoUpdateItem
-	aMFTNLAssociationToUpdateItem := ngapType.AMFTNLAssociationToUpdateItem{}
-	aMFTNLAssociationToUpdateItem.AMFTNLAssociationAddress.Present =
-		ngapType.CPTransportLayerInformationPresentEndpointIPAddress
-	aMFTNLAssociationToUpdateItem.AMFTNLAssociationAddress.EndpointIPAddress =
-		new(ngapType.TransportLayerAddress)
-	*aMFTNLAssociationToUpdateItem.AMFTNLAssociationAddress.EndpointIPAddress =
-		ngapConvert.IPAddressToNgap(amfSelf.RegisterIPv4, amfSelf.HttpIPv6Address)
-
-	//	TNLAssociationUsage in AMFTNLAssociationtoUpdateItem [optional]
-	if aMFTNLAssociationToUpdateItem.TNLAssociationUsage != nil {
-		aMFTNLAssociationToUpdateItem.TNLAssociationUsage = new(ngapType.TNLAssociationUsage)
-		aMFTNLAssociationToUpdateItem.TNLAssociationUsage = &tNLassociationUsage
-	}
-	//	TNLAddressWeightFactor in AMFTNLAssociationtoUpdateItem [optional]
-	if aMFTNLAssociationToUpdateItem.TNLAddressWeightFactor != nil {
-		aMFTNLAssociationToUpdateItem.TNLAddressWeightFactor = new(ngapType.TNLAddressWeightFactor)
-		aMFTNLAssociationToUpdateItem.TNLAddressWeightFactor = &tNLAddressWeightFactor
-	}
-	aMFTNLAssociationToUpdateList.List = append(aMFTNLAssociationToUpdateList.List, aMFTNLAssociationToUpdateItem)
-	aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+		aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+	}
 
 	IncrementNGAPMsgCount(pdu)
 	return ngap.Encoder(pdu)
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package message
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+func TestBuildUEContextModificationRequestSecurityKey(t *testing.T) {
+	anType := models.AccessType__3_GPP_ACCESS
+	amfUe := &context.AmfUe{
+		RanUe: map[models.AccessType]*context.RanUe{
+			anType: {AmfUeNgapId: 1, RanUeNgapId: 2},
+		},
+	}
+	kgnb := bytes.Repeat([]byte{0xa5, 0x5a}, 16)
+
+	testCases := []struct {
+		description string
+		securityKey []byte
+	}{
+		{description: "new AS keys", securityKey: kgnb},
+		{description: "AS keys are kept"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			pkt, err := BuildUEContextModificationRequest(amfUe, anType, nil, tc.securityKey, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("BuildUEContextModificationRequest: %v", err)
+			}
+			pdu, err := ngap.Decoder(pkt)
+			if err != nil {
+				t.Fatalf("Failed to decode the NGAP message: %v", err)
+			}
+
+			var securityKey *ngapType.SecurityKey
+			for _, ie := range pdu.InitiatingMessage.Value.UEContextModificationRequest.ProtocolIEs.List {
+				if ie.Id.Value == ngapType.ProtocolIEIDSecurityKey {
+					if ie.Criticality.Value != ngapType.CriticalityPresentReject {
+						t.Errorf("Criticality of the Security Key, want: reject, got: %d", ie.Criticality.Value)
+					}
+					securityKey = ie.Value.SecurityKey
+				}
+			}
+			if tc.securityKey == nil {
+				if securityKey != nil {
+					t.Error("Security Key is sent without new AS keys")
+				}
+				return
+			}
+			if securityKey == nil {
+				t.Fatal("Security Key is not sent")
+			}
+			if securityKey.Value.BitLength != 256 || !bytes.Equal(securityKey.Value.Bytes, tc.securityKey) {
+				t.Errorf("Security Key, want: %x, got: %x (%d bits)", tc.securityKey, securityKey.Value.Bytes,
+					securityKey.Value.BitLength)
+			}
+		})
+	}
+}
+
+func TestBuildAMFConfigurationUpdate(t *testing.T) {
+	amfName := "AMF2"
+	relativeCapacity := int64(10)
+	plmnId := models.PlmnId{Mcc: "208", Mnc: "93"}
+	servedGuamiList := []models.Guami{
+		{PlmnId: &plmnId, AmfId: "cafe00"},
+		{PlmnId: &models.PlmnId{Mcc: "001", Mnc: "01"}, AmfId: "cafe01"},
+	}
+	plmnSupportList := []factory.PlmnSupportItem{
+		{PlmnId: plmnId, SNssaiList: []models.Snssai{{Sst: 1, Sd: "010203"}, {Sst: 2}}},
+	}
+
+	testCases := []struct {
+		description string
+		update      context.AmfConfigUpdate
+		ies         []int64
+	}{
+		{
+			description: "AMF name",
+			update:      context.AmfConfigUpdate{AmfName: &amfName},
+			ies:         []int64{ngapType.ProtocolIEIDAMFName},
+		},
+		{
+			description: "served GUAMI list",
+			update:      context.AmfConfigUpdate{ServedGuamiList: servedGuamiList},
+			ies:         []int64{ngapType.ProtocolIEIDServedGUAMIList},
+		},
+		{
+			description: "relative capacity",
+			update:      context.AmfConfigUpdate{RelativeCapacity: &relativeCapacity},
+			ies:         []int64{ngapType.ProtocolIEIDRelativeAMFCapacity},
+		},
+		{
+			description: "PLMN support list",
+			update:      context.AmfConfigUpdate{PlmnSupportList: plmnSupportList},
+			ies:         []int64{ngapType.ProtocolIEIDPLMNSupportList},
+		},
+		{
+			description: "all IEs",
+			update: context.AmfConfigUpdate{AmfName: &amfName, ServedGuamiList: servedGuamiList,
+				RelativeCapacity: &relativeCapacity, PlmnSupportList: plmnSupportList},
+			ies: []int64{ngapType.ProtocolIEIDAMFName, ngapType.ProtocolIEIDServedGUAMIList,
+				ngapType.ProtocolIEIDRelativeAMFCapacity, ngapType.ProtocolIEIDPLMNSupportList},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			pkt, err := BuildAMFConfigurationUpdate(tc.update)
+			if err != nil {
+				t.Fatalf("BuildAMFConfigurationUpdate: %v", err)
+			}
+			pdu, err := ngap.Decoder(pkt)
+			if err != nil || pdu.InitiatingMessage == nil ||
+				pdu.InitiatingMessage.Value.AMFConfigurationUpdate == nil {
+				t.Fatalf("No AMF Configuration Update is built: %v", err)
+			}
+
+			list := pdu.InitiatingMessage.Value.AMFConfigurationUpdate.ProtocolIEs.List
+			if len(list) != len(tc.ies) {
+				t.Fatalf("Number of IEs, want: %d, got: %d", len(tc.ies), len(list))
+			}
+			for i, ie := range list {
+				if ie.Id.Value != tc.ies[i] {
+					t.Errorf("IE %d, want: %d, got: %d", i, tc.ies[i], ie.Id.Value)
+				}
+				switch ie.Id.Value {
+				case ngapType.ProtocolIEIDAMFName:
+					if ie.Value.AMFName.Value != amfName {
+						t.Errorf("AMF name, want: %s, got: %s", amfName, ie.Value.AMFName.Value)
+					}
+				case ngapType.ProtocolIEIDServedGUAMIList:
+					if n := len(ie.Value.ServedGUAMIList.List); n != len(servedGuamiList) {
+						t.Errorf("Number of served GUAMIs, want: %d, got: %d", len(servedGuamiList), n)
+					}
+				case ngapType.ProtocolIEIDRelativeAMFCapacity:
+					if ie.Value.RelativeAMFCapacity.Value != relativeCapacity {
+						t.Errorf("Relative capacity, want: %d, got: %d", relativeCapacity,
+							ie.Value.RelativeAMFCapacity.Value)
+					}
+				case ngapType.ProtocolIEIDPLMNSupportList:
+					if plmns := ie.Value.PLMNSupportList.List; len(plmns) != 1 ||
+						len(plmns[0].SliceSupportList.List) != len(plmnSupportList[0].SNssaiList) {
+						t.Errorf("PLMN support list: %+v", plmns)
+					}
+				}
+			}
+		})
+	}
+}
@@ -152,7 +152,8 @@ func BuildIEMobilityRestrictionList(ue *context.AmfUe) ngapType.MobilityRestrict
 	return mobilityRestrictionList
 }
 
-func BuildUnavailableGUAMIList(guamiList []models.Guami) (unavailableGUAMIList ngapType.UnavailableGUAMIList) {
+func BuildUnavailableGUAMIList(guamiList []models.Guami,
+	backupAmfName string) (unavailableGUAMIList ngapType.UnavailableGUAMIList) {
 	for _, guami := range guamiList {
 		item := ngapType.UnavailableGUAMIItem{}
 		item.GUAMI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*guami.PlmnId)
@@ -160,8 +161,33 @@ func BuildUnavailableGUAMIList(guamiList []models.Guami) (unavailableGUAMIList n
 		item.GUAMI.AMFRegionID.Value = regionId
 		item.GUAMI.AMFSetID.Value = setId
 		item.GUAMI.AMFPointer.Value = ptrId
-		// TODO: item.TimerApproachForGUAMIRemoval and item.BackupAMFName not support yet
+		// TODO: item.TimerApproachForGUAMIRemoval not support yet
+		if backupAmfName != "" {
+			item.BackupAMFName = &ngapType.AMFName{Value: backupAmfName}
+		}
 		unavailableGUAMIList.List = append(unavailableGUAMIList.List, item)
 	}
 	return
 }
+
+// BuildOverloadStartNSSAIList builds one Overload Start NSSAI item for the overloaded
+// slices, the RAN applies the traffic load reduction of the item to each of them
+func BuildOverloadStartNSSAIList(snssaiList []models.Snssai,
+	trafficLoadReduction int64) (overloadStartNSSAIList ngapType.OverloadStartNSSAIList) {
+	if len(snssaiList) == 0 {
+		return
+	}
+	item := ngapType.OverloadStartNSSAIItem{}
+	for _, snssai := range snssaiList {
+		sliceOverloadItem := ngapType.SliceOverloadItem{}
+		sliceOverloadItem.SNSSAI = ngapConvert.SNssaiToNgap(snssai)
+		item.SliceOverloadList.List = append(item.SliceOverloadList.List, sliceOverloadItem)
+	}
+	if trafficLoadReduction != 0 {
+		item.SliceTrafficLoadReductionIndication = &ngapType.TrafficLoadReductionIndication{
+			Value: trafficLoadReduction,
+		}
+	}
+	overloadStartNSSAIList.List = append(overloadStartNSSAIList.List, item)
+	return
+}
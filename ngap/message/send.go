@@ -6,18 +6,28 @@
 package message
 
 import (
+	"fmt"
 	"os"
 
+	"git.cs.nctu.edu.tw/calee/sctp"
+
 	"github.com/omec-project/amf/context"
 	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/ngap/capture"
 	"github.com/omec-project/amf/producer/callback"
 	"github.com/omec-project/amf/protos/sdcoreAmfServer"
 	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap"
 	"github.com/omec-project/ngap/ngapType"
 	"github.com/omec-project/openapi/models"
 )
 
+// SendToRan sends a non-UE-associated message on SCTP stream 0
 func SendToRan(ran *context.AmfRan, packet []byte) {
+	sendToRan(ran, packet, 0, "")
+}
+
+func sendToRan(ran *context.AmfRan, packet []byte, streamId uint16, supi string) {
 	defer func() {
 		err := recover()
 		if err != nil {
@@ -35,6 +45,8 @@ func SendToRan(ran *context.AmfRan, packet []byte) {
 		return
 	}
 
+	capture.RanMessage(ran, supi, false, streamId, packet)
+
 	if context.AMF_Self().EnableSctpLb {
 		msg := &sdcoreAmfServer.AmfMessage{VerboseMsg: "Message from AMF"}
 		msg.Msg = packet
@@ -54,9 +66,9 @@ func SendToRan(ran *context.AmfRan, packet []byte) {
 			return
 		}
 
-		ran.Log.Debugf("Send NGAP message To Ran")
+		ran.Log.Debugf("Send NGAP message To Ran on stream %d", streamId)
 
-		if n, err := ran.Conn.Write(packet); err != nil {
+		if n, err := writeToRan(ran, packet, streamId); err != nil {
 			ran.Log.Errorf("Send error: %+v", err)
 			return
 		} else {
@@ -66,6 +78,22 @@ func SendToRan(ran *context.AmfRan, packet []byte) {
 
 }
 
+func writeToRan(ran *context.AmfRan, packet []byte, streamId uint16) (int, error) {
+	if sctpConn, ok := ran.Conn.(*sctp.SCTPConn); ok && streamId != 0 {
+		info := &sctp.SndRcvInfo{
+			Stream: streamId,
+			PPID:   ngap.PPID,
+		}
+		n, err := sctpConn.SCTPWrite(packet, info)
+		if err == nil {
+			return n, nil
+		}
+		// the association may have less outbound streams than configured
+		ran.Log.Warnf("Send on stream %d error: %+v, retry on stream 0", streamId, err)
+	}
+	return ran.Conn.Write(packet)
+}
+
 func SendToRanUe(ue *context.RanUe, packet []byte) {
 	var ran *context.AmfRan
 
@@ -79,11 +107,14 @@ func SendToRanUe(ue *context.RanUe, packet []byte) {
 		return
 	}
 
+	var supi string
 	if ue.AmfUe == nil {
 		ue.Log.Warn("AmfUe is nil")
+	} else {
+		supi = ue.AmfUe.Supi
 	}
 
-	SendToRan(ran, packet)
+	sendToRan(ran, packet, ue.SctpStream(), supi)
 }
 
 func NasSendToRan(ue *context.AmfUe, accessType models.AccessType, packet []byte) {
@@ -110,6 +141,10 @@ func SendNGSetupResponse(ran *context.AmfRan) {
 		return
 	}
 	ran.SetRanStats(context.RanConnected)
+	advertisedConfig := context.AMF_Self().AmfConfigSnapshot()
+	ran.Mutex.Lock()
+	ran.AdvertisedConfig = advertisedConfig
+	ran.Mutex.Unlock()
 	SendToRan(ran, pkt)
 }
 
@@ -387,6 +422,7 @@ func SendUEContextModificationRequest(
 	amfUe *context.AmfUe,
 	anType models.AccessType,
 	oldAmfUeNgapID *int64,
+	securityKey []byte,
 	rrcInactiveTransitionReportRequest *ngapType.RRCInactiveTransitionReportRequest,
 	coreNetworkAssistanceInfo *ngapType.CoreNetworkAssistanceInformation,
 	mobilityRestrictionList *ngapType.MobilityRestrictionList,
@@ -398,8 +434,8 @@ func SendUEContextModificationRequest(
 
 	amfUe.RanUe[anType].Log.Info("Send UE Context Modification Request")
 
-	pkt, err := BuildUEContextModificationRequest(amfUe, anType, oldAmfUeNgapID, rrcInactiveTransitionReportRequest,
-		coreNetworkAssistanceInfo, mobilityRestrictionList, emergencyFallbackIndicator)
+	pkt, err := BuildUEContextModificationRequest(amfUe, anType, oldAmfUeNgapID, securityKey,
+		rrcInactiveTransitionReportRequest, coreNetworkAssistanceInfo, mobilityRestrictionList, emergencyFallbackIndicator)
 	if err != nil {
 		amfUe.RanUe[anType].Log.Errorf("Build UEContextModificationRequest failed : %s", err.Error())
 		return
@@ -533,6 +569,46 @@ func SendHandoverRequest(sourceUe *context.RanUe, targetRan *context.AmfRan, cau
 	SendToRanUe(targetUe, pkt)
 }
 
+// N2 handover between AMFs (TS 23.502 4.9.1.3.2 step 6): the target AMF has no source UE, the target UE
+// is bound to the AmfUe created by the Namf_Communication_CreateUEContext request
+func SendHandoverRequestToTargetRan(amfUe *context.AmfUe, targetRan *context.AmfRan, cause ngapType.Cause,
+	pduSessionResourceSetupListHOReq ngapType.PDUSessionResourceSetupListHOReq,
+	sourceToTargetTransparentContainer ngapType.SourceToTargetTransparentContainer, nsci bool) error {
+	if amfUe == nil {
+		return fmt.Errorf("amfUe is nil")
+	}
+	if targetRan == nil {
+		return fmt.Errorf("targetRan is nil")
+	}
+
+	amfUe.GmmLog.Info("Send Handover Request")
+
+	if len(pduSessionResourceSetupListHOReq.List) > context.MaxNumOfPDUSessions {
+		return fmt.Errorf("Pdu List out of range")
+	}
+	if len(sourceToTargetTransparentContainer.Value) == 0 {
+		return fmt.Errorf("Source To Target TransparentContainer is nil")
+	}
+
+	targetUe, err := targetRan.NewRanUe(context.RanUeNgapIdUnspecified)
+	if err != nil {
+		return fmt.Errorf("Create target UE error: %+v", err)
+	}
+	targetUe.AmfUe = amfUe
+	targetUe.Log.Tracef("Target : AMF_UE_NGAP_ID[%d], RAN_UE_NGAP_ID[Unknown]", targetUe.AmfUeNgapId)
+
+	pkt, err := BuildHandoverRequest(targetUe, cause, pduSessionResourceSetupListHOReq,
+		sourceToTargetTransparentContainer, nsci)
+	if err != nil {
+		if removeErr := targetUe.Remove(); removeErr != nil {
+			targetUe.Log.Errorln(removeErr.Error())
+		}
+		return fmt.Errorf("Build HandoverRequest failed : %s", err.Error())
+	}
+	SendToRanUe(targetUe, pkt)
+	return nil
+}
+
 // pduSessionResourceSwitchedList: provided by AMF, and the transfer data is from SMF
 // pduSessionResourceReleasedList: provided by AMF, and the transfer data is from SMF
 // newSecurityContextIndicator: if AMF has activated a new 5G NAS security context, set it to true,
@@ -633,55 +709,70 @@ func SendDownlinkRanStatusTransfer(ue *context.RanUe, container ngapType.RANStat
 // is associated with non-3GPP access, the AMF sends a Paging message with associated access "non-3GPP" to
 // NG-RAN node(s) via 3GPP access.
 // more paging policy with 3gpp/non-3gpp access is described in TS 23.501 5.6.8
-func SendPaging(ue *context.AmfUe, ngapBuf []byte) {
-	// var pagingPriority *ngapType.PagingPriority
+// TS 23.502 4.2.3.3: the first paging is sent to the last known cells and RAN nodes of the UE,
+// the retransmissions on T3513 expiry escalate to the whole registration area
+func SendPaging(ue *context.AmfUe, pagingPriority *ngapType.PagingPriority, pagingOriginNon3GPP bool) {
 	if ue == nil {
 		logger.NgapLog.Error("AmfUe is nil")
 		return
 	}
 
-	// if ppi != nil {
-	// pagingPriority = new(ngapType.PagingPriority)
-	// pagingPriority.Value = aper.Enumerated(*ppi)
-	// }
-	// pkt, err := BuildPaging(ue, pagingPriority, pagingOriginNon3GPP)
-	// if err != nil {
-	// 	ngaplog.Errorf("Build Paging failed : %s", err.Error())
-	// }
-	taiList := ue.RegistrationArea[models.AccessType__3_GPP_ACCESS]
-	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
-		ran := value.(*context.AmfRan)
-		for _, item := range ran.SupportedTAList {
-			if context.InTaiList(item.Tai, taiList) {
-				ue.GmmLog.Infof("Send Paging to TAI(%+v, Tac:%+v)",
-					item.Tai.PlmnId, item.Tai.Tac)
-				SendToRan(ran, ngapBuf)
-				break
-			}
-		}
-		return true
-	})
+	anType := models.AccessType__3_GPP_ACCESS
+	if pagingOriginNon3GPP {
+		anType = models.AccessType_NON_3_GPP_ACCESS
+	}
+	if !sendPagingAttempt(ue, 1, pagingPriority, pagingOriginNon3GPP) {
+		pagingFailed(ue, anType)
+		return
+	}
 
 	if context.AMF_Self().T3513Cfg.Enable {
 		cfg := context.AMF_Self().T3513Cfg
 		ue.T3513 = context.NewTimer(cfg.ExpireTime, cfg.MaxRetryTimes, func(expireTimes int32) {
 			ue.GmmLog.Warnf("T3513 expires, retransmit Paging (retry: %d)", expireTimes)
-			context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
-				ran := value.(*context.AmfRan)
-				for _, item := range ran.SupportedTAList {
-					if context.InTaiList(item.Tai, taiList) {
-						SendToRan(ran, ngapBuf)
-						break
-					}
-				}
-				return true
-			})
+			sendPagingAttempt(ue, expireTimes+1, pagingPriority, pagingOriginNon3GPP)
 		}, func() {
 			ue.GmmLog.Warnf("T3513 expires %d times, abort paging procedure", cfg.MaxRetryTimes)
 			ue.T3513 = nil // clear the timer
-			if ue.OnGoing(models.AccessType__3_GPP_ACCESS).Procedure != context.OnGoingProcedureN2Handover {
-				callback.SendN1N2TransferFailureNotification(ue, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
-			}
+			pagingFailed(ue, anType)
+		})
+	}
+}
+
+func sendPagingAttempt(ue *context.AmfUe, count int32, pagingPriority *ngapType.PagingPriority,
+	pagingOriginNon3GPP bool) bool {
+	attempt := ue.NewPagingAttempt(count)
+	pkt, err := BuildPaging(ue, pagingPriority, pagingOriginNon3GPP, attempt)
+	if err != nil {
+		ue.GmmLog.Errorf("Build Paging failed : %s", err.Error())
+		return false
+	}
+	if len(attempt.RanList) == 0 {
+		ue.GmmLog.Warnf("No RAN serves the paging area of attempt %d", attempt.Count)
+	}
+	for _, ran := range attempt.RanList {
+		ue.GmmLog.Infof("Send Paging (attempt %d/%d) to RAN[%s]", attempt.Count, attempt.Intended, ran.GnbId)
+		SendToRan(ran, pkt)
+	}
+	return true
+}
+
+// report the paging failure to the N1N2 message transfer initiator (TS 29.518 5.2.2.3.1.2)
+// and to the consumers waiting for the UE to become reachable
+// anType: access type the paging was triggered for
+func pagingFailed(ue *context.AmfUe, anType models.AccessType) {
+	if ue.OnGoing(models.AccessType__3_GPP_ACCESS).Procedure == context.OnGoingProcedureN2Handover {
+		return
+	}
+	ue.NotifyReachability(false)
+	callback.SendN1N2TransferFailureNotification(ue, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
+	if ue.N1N2Message != nil {
+		// no failure notification uri or the notification failed, keep the outcome for status queries
+		ue.N1N2Message.Status = models.N1N2MessageTransferCause_UE_NOT_RESPONDING
+	}
+	if ue.OnGoing(anType).Procedure == context.OnGoingProcedurePaging {
+		ue.SetOnGoing(anType, &context.OnGoing{
+			Procedure: context.OnGoingProcedureNothing,
 		})
 	}
 }
@@ -849,25 +940,25 @@ func SendDownlinkRanConfigurationTransfer(ran *context.AmfRan, transfer *ngapTyp
 
 // NRPPa PDU is by pass
 // NRPPa PDU is from LMF define in 4.13.5.6
-func SendDownlinkNonUEAssociatedNRPPATransport(ue *context.RanUe, nRPPaPDU ngapType.NRPPaPDU) {
-	if ue == nil {
-		logger.NgapLog.Error("RanUe is nil")
+func SendDownlinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, routingID []byte, nRPPaPDU ngapType.NRPPaPDU) {
+	if ran == nil {
+		logger.NgapLog.Error("Ran is nil")
 		return
 	}
 
-	ue.Log.Info("Send Downlink Non UE Associated NRPPA Transport")
+	ran.Log.Info("Send Downlink Non UE Associated NRPPA Transport")
 
 	if len(nRPPaPDU.Value) == 0 {
-		ue.Log.Error("length of NRPPA-PDU is 0")
+		ran.Log.Error("length of NRPPA-PDU is 0")
 		return
 	}
 
-	pkt, err := BuildDownlinkNonUEAssociatedNRPPATransport(ue, nRPPaPDU)
+	pkt, err := BuildDownlinkNonUEAssociatedNRPPATransport(routingID, nRPPaPDU)
 	if err != nil {
-		ue.Log.Errorf("Build DownlinkNonUEAssociatedNRPPATransport failed : %s", err.Error())
+		ran.Log.Errorf("Build DownlinkNonUEAssociatedNRPPATransport failed : %s", err.Error())
 		return
 	}
-	SendToRanUe(ue, pkt)
+	SendToRan(ran, pkt)
 }
 
 func SendDeactivateTrace(amfUe *context.AmfUe, anType models.AccessType) {
@@ -951,8 +1042,7 @@ func SendUETNLABindingReleaseRequest(ue *context.RanUe) {
 }
 
 // Weight Factor associated with each of the TNL association within the AMF
-func SendAMFConfigurationUpdate(ran *context.AmfRan, usage ngapType.TNLAssociationUsage,
-	weightfactor ngapType.TNLAddressWeightFactor) {
+func SendAMFConfigurationUpdate(ran *context.AmfRan, update context.AmfConfigUpdate) {
 	if ran == nil {
 		logger.NgapLog.Error("Ran is nil")
 		return
@@ -960,7 +1050,7 @@ func SendAMFConfigurationUpdate(ran *context.AmfRan, usage ngapType.TNLAssociati
 
 	ran.Log.Info("Send AMF Configuration Update")
 
-	pkt, err := BuildAMFConfigurationUpdate(usage, weightfactor)
+	pkt, err := BuildAMFConfigurationUpdate(update)
 	if err != nil {
 		ran.Log.Errorf("Build AMFConfigurationUpdate failed : %s", err.Error())
 		return
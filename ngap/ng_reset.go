@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package ngap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/omec-project/amf/consumer"
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/gmm"
+	"github.com/omec-project/amf/logger"
+	ngap_message "github.com/omec-project/amf/ngap/message"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+// how long an NG Reset waits for the event loops of the UEs to reset their NG connections,
+// longer than the timeout of the requests to the SMF which deactivate the user plane
+const ueResetTimeout = 40 * time.Second
+
+// ueReset is the reset of the UE-associated logical NG connection of ranUe, it is
+// handled in the event loop of the UE as it changes the state of the UE
+type ueReset struct {
+	ranUe *context.RanUe
+	cause ngapType.Cause
+}
+
+func NgResetHandler(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
+	if reset, ok := msg.(ueReset); ok {
+		resetUeConnection(reset.ranUe, reset.cause)
+	}
+	return nil, "", nil, nil
+}
+
+// submitRanUeReset submits the reset of ranUe to the event loop of its UE, the
+// returned channel receives once the reset is done
+func submitRanUeReset(ranUe *context.RanUe, cause ngapType.Cause) chan context.SbiResponseMsg {
+	result := make(chan context.SbiResponseMsg, 1)
+	amfUe := ranUe.AmfUe
+	if amfUe == nil {
+		resetUeConnection(ranUe, cause)
+		result <- context.SbiResponseMsg{}
+		return result
+	}
+	amfUe.SetEventChannel(NgapMsgHandler)
+	amfUe.EventChannel.SubmitMessage(context.SbiMsg{
+		UeContextId: amfUe.Supi,
+		Msg:         ueReset{ranUe: ranUe, cause: cause},
+		Handler:     NgResetHandler,
+		Result:      result,
+	})
+	return result
+}
+
+// resetRanUes resets the UE-associated logical NG connections in the event loops
+// of their UEs and returns once they are reset
+func resetRanUes(ranUeList []*context.RanUe, cause ngapType.Cause) {
+	results := make([]chan context.SbiResponseMsg, 0, len(ranUeList))
+	for _, ranUe := range ranUeList {
+		results = append(results, submitRanUeReset(ranUe, cause))
+	}
+	timeout := time.After(ueResetTimeout)
+	for i, result := range results {
+		select {
+		case <-result:
+		case <-timeout:
+			logger.NgapLog.Warnf("Reset of %d UE-associated NG connection(s) timed out", len(results)-i)
+			return
+		}
+	}
+}
+
+func resetRanUe(ranUe *context.RanUe, cause ngapType.Cause) {
+	resetRanUes([]*context.RanUe{ranUe}, cause)
+}
+
+// resetUeConnection releases the UE-associated logical NG connection of ranUe as part of
+// an NG Reset: the user plane of its PDU sessions is deactivated at the SMF and
+// the UE enters CM-IDLE, the registration is kept
+func resetUeConnection(ranUe *context.RanUe, cause ngapType.Cause) {
+	ran := ranUe.Ran
+	amfUe := ranUe.AmfUe
+	ranUe.Log.Infof("Reset UE-associated NG connection[RanUeNgapID: %d, AmfUeNgapID: %d]",
+		ranUe.RanUeNgapId, ranUe.AmfUeNgapId)
+
+	if amfUe != nil && amfUe.State[ran.AnType] != nil && amfUe.State[ran.AnType].Is(context.Registered) {
+		causeAll := context.CauseAll{
+			NgapCause: &models.NgApCause{
+				Group: int32(cause.Present),
+				Value: int32(ngapCauseValue(cause)),
+			},
+		}
+		amfUe.SmContextList.Range(func(key, value interface{}) bool {
+			smContext := value.(*context.SmContext)
+			if smContext.AccessType() != ran.AnType {
+				return true
+			}
+			response, _, _, err := consumer.SendUpdateSmContextDeactivateUpCnxState(amfUe, smContext, causeAll)
+			if err != nil {
+				ranUe.Log.Errorf("Send Update SmContextDeactivate UpCnxState Error[%s]", err.Error())
+			} else if response == nil {
+				ranUe.Log.Errorln("Send Update SmContextDeactivate UpCnxState Error")
+			}
+			return true
+		})
+	}
+
+	if err := ranUe.Remove(); err != nil {
+		ran.Log.Errorln(err.Error())
+	}
+	if amfUe != nil {
+		if amfUe.State[ran.AnType] != nil && amfUe.State[ran.AnType].Is(context.Registered) {
+			gmm.StartMobileReachableTimer(amfUe, ran.AnType)
+		}
+		amfUe.PublishUeCtxtInfo()
+		context.StoreContextInDB(amfUe)
+	}
+}
+
+func resetAllUeInRan(ran *context.AmfRan, cause ngapType.Cause) {
+	resetRanUes(ran.RanUes(), cause)
+}
+
+func ngapCauseValue(cause ngapType.Cause) int64 {
+	switch cause.Present {
+	case ngapType.CausePresentRadioNetwork:
+		return int64(cause.RadioNetwork.Value)
+	case ngapType.CausePresentTransport:
+		return int64(cause.Transport.Value)
+	case ngapType.CausePresentNas:
+		return int64(cause.Nas.Value)
+	case ngapType.CausePresentProtocol:
+		return int64(cause.Protocol.Value)
+	case ngapType.CausePresentMisc:
+		return int64(cause.Misc.Value)
+	}
+	return 0
+}
+
+// SendNGResetToRan starts an AMF initiated NG Reset (TS 38.413 8.7.4.2.2). With an
+// empty ranUeList the whole NG interface is reset, otherwise only the listed
+// UE-associated logical NG connections. The AMF releases its resources before the
+// NG Reset is sent.
+func SendNGResetToRan(ran *context.AmfRan, ranUeList []*context.RanUe, cause ngapType.Cause) {
+	if len(ranUeList) == 0 {
+		ran.Log.Infof("AMF initiated NG Reset of the NG interface")
+		resetAllUeInRan(ran, cause)
+		ngap_message.SendNGReset(ran, cause, nil)
+		return
+	}
+
+	ran.Log.Infof("AMF initiated NG Reset of %d UE-associated NG connection(s)", len(ranUeList))
+	partOfNGInterface := new(ngapType.UEAssociatedLogicalNGConnectionList)
+	for _, ranUe := range ranUeList {
+		item := ngapType.UEAssociatedLogicalNGConnectionItem{
+			AMFUENGAPID: &ngapType.AMFUENGAPID{Value: ranUe.AmfUeNgapId},
+			RANUENGAPID: &ngapType.RANUENGAPID{Value: ranUe.RanUeNgapId},
+		}
+		partOfNGInterface.List = append(partOfNGInterface.List, item)
+	}
+	resetRanUes(ranUeList, cause)
+	ngap_message.SendNGReset(ran, cause, partOfNGInterface)
+}
+
+// ResetRanByGnbId is the OAM trigger of an NG Reset, amfUeNgapIds selects a partial reset
+func ResetRanByGnbId(gnbId string, amfUeNgapIds []int64) error {
+	var ran *context.AmfRan
+	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		if amfRan := value.(*context.AmfRan); amfRan.GnbId == gnbId {
+			ran = amfRan
+			return false
+		}
+		return true
+	})
+	if ran == nil {
+		return fmt.Errorf("no RAN with gNB ID %s", gnbId)
+	}
+
+	var ranUeList []*context.RanUe
+	for _, amfUeNgapId := range amfUeNgapIds {
+		ranUe := context.AMF_Self().RanUeFindByAmfUeNgapID(amfUeNgapId)
+		if ranUe == nil || ranUe.Ran != ran {
+			return fmt.Errorf("no UE with AMF UE NGAP ID %d on gNB %s", amfUeNgapId, gnbId)
+		}
+		ranUeList = append(ranUeList, ranUe)
+	}
+
+	cause := ngapType.Cause{
+		Present: ngapType.CausePresentMisc,
+		Misc: &ngapType.CauseMisc{
+			Value: ngapType.CauseMiscPresentOmIntervention,
+		},
+	}
+	SendNGResetToRan(ran, ranUeList, cause)
+	return nil
+}
+
+// checkUeNgapIdPair detects a RanUe whose AMF UE NGAP ID does not match the one
+// sent by the RAN, e.g. a context restored from the DB which is stale. The
+// UE-associated NG connection is reset, as the RAN and the AMF disagree about it.
+func checkUeNgapIdPair(ran *context.AmfRan, ranUe *context.RanUe, aMFUENGAPID *ngapType.AMFUENGAPID) bool {
+	if ranUe == nil || aMFUENGAPID == nil || ranUe.AmfUeNgapId == aMFUENGAPID.Value {
+		return true
+	}
+	logger.NgapLog.Warnf("Inconsistent UE NGAP ID pair[RanUeNgapID: %d, AmfUeNgapID: %d, expected AmfUeNgapID: %d]",
+		ranUe.RanUeNgapId, aMFUENGAPID.Value, ranUe.AmfUeNgapId)
+	cause := ngapType.Cause{
+		Present: ngapType.CausePresentRadioNetwork,
+		RadioNetwork: &ngapType.CauseRadioNetwork{
+			Value: ngapType.CauseRadioNetworkPresentInconsistentRemoteUENGAPID,
+		},
+	}
+	ranUeNgapID := ranUe.RanUeNgapId
+	partOfNGInterface := &ngapType.UEAssociatedLogicalNGConnectionList{
+		List: []ngapType.UEAssociatedLogicalNGConnectionItem{{
+			AMFUENGAPID: &ngapType.AMFUENGAPID{Value: aMFUENGAPID.Value},
+			RANUENGAPID: &ngapType.RANUENGAPID{Value: ranUeNgapID},
+		}},
+	}
+	// the SMF requests of the UE event loop must not block the SCTP reader
+	go func() {
+		resetRanUe(ranUe, cause)
+		ngap_message.SendNGReset(ran, cause, partOfNGInterface)
+	}()
+	return false
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package ngap_test
+
+import (
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/ngap"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	libngap "github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+// newResetRan creates a RAN with a registered UE and a RanUe without UE context
+func newResetRan(t *testing.T, gnbId, supi string) (*context.AmfRan, *ngaputil.TestConn, *context.AmfUe) {
+	conn := &ngaputil.TestConn{}
+	self := context.AMF_Self()
+	ran := self.NewAmfRan(conn)
+	ran.GnbId = gnbId
+	ran.AnType = models.AccessType__3_GPP_ACCESS
+	t.Cleanup(ran.Remove)
+
+	ranUe, err := ran.NewRanUe(1)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	ue := self.NewAmfUe(supi)
+	ue.State[ran.AnType].Set(context.Registered)
+	ue.AttachRanUe(ranUe)
+	t.Cleanup(ue.Remove)
+
+	if _, err := ran.NewRanUe(2); err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	return ran, conn, ue
+}
+
+// sentResetType decodes the NG Reset sent to the RAN
+func sentResetType(t *testing.T, conn *ngaputil.TestConn) *ngapType.ResetType {
+	pdu, err := libngap.Decoder(conn.Data)
+	if err != nil || pdu.InitiatingMessage == nil || pdu.InitiatingMessage.Value.NGReset == nil {
+		t.Fatalf("No NG Reset is sent: %v", err)
+	}
+	for _, ie := range pdu.InitiatingMessage.Value.NGReset.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDResetType {
+			return ie.Value.ResetType
+		}
+	}
+	t.Fatal("No Reset Type in the NG Reset")
+	return nil
+}
+
+func TestSendNGResetToRan(t *testing.T) {
+	cause := ngapType.Cause{
+		Present: ngapType.CausePresentMisc,
+		Misc:    &ngapType.CauseMisc{Value: ngapType.CauseMiscPresentOmIntervention},
+	}
+	anType := models.AccessType__3_GPP_ACCESS
+
+	ran, conn, ue := newResetRan(t, "reset-gnb-1", "imsi-208930000007530")
+	ngap.SendNGResetToRan(ran, nil, cause)
+
+	if n := len(ran.RanUes()); n != 0 {
+		t.Errorf("%d UE-associated NG connection(s) are not reset", n)
+	}
+	if ue.CmConnect(anType) {
+		t.Error("UE is not in CM-IDLE after the reset")
+	}
+	if !ue.State[anType].Is(context.Registered) {
+		t.Error("Registration of the UE is not kept")
+	}
+	if ue.MobileReachableTimer[anType] == nil {
+		t.Error("Mobile reachable timer is not started")
+	}
+	// the reset is handled in the UE event loop without replacing the handler of its SBI requests
+	if ue.EventChannel == nil || ue.EventChannel.SbiHandler != nil {
+		t.Error("Reset is not submitted to the UE event loop with its own handler")
+	}
+	if resetType := sentResetType(t, conn); resetType.Present != ngapType.ResetTypePresentNGInterface {
+		t.Errorf("Reset type, want: NG interface, got: %d", resetType.Present)
+	}
+}
+
+func TestResetRanByGnbId(t *testing.T) {
+	ran, conn, ue := newResetRan(t, "reset-gnb-2", "imsi-208930000007531")
+	amfUeNgapId := ue.RanUe[ran.AnType].AmfUeNgapId
+
+	if err := ngap.ResetRanByGnbId("reset-gnb-2", []int64{amfUeNgapId}); err != nil {
+		t.Fatalf("ResetRanByGnbId: %v", err)
+	}
+	ranUes := ran.RanUes()
+	if len(ranUes) != 1 || ranUes[0].AmfUeNgapId == amfUeNgapId {
+		t.Errorf("Only the listed UE-associated NG connection is reset, left: %d", len(ranUes))
+	}
+	resetType := sentResetType(t, conn)
+	if resetType.Present != ngapType.ResetTypePresentPartOfNGInterface ||
+		len(resetType.PartOfNGInterface.List) != 1 ||
+		resetType.PartOfNGInterface.List[0].AMFUENGAPID.Value != amfUeNgapId {
+		t.Errorf("NG Reset does not list the reset UE-associated NG connection")
+	}
+
+	if err := ngap.ResetRanByGnbId("unknown-gnb", nil); err == nil {
+		t.Error("NG Reset of an unknown gNB is accepted")
+	}
+	if err := ngap.ResetRanByGnbId("reset-gnb-2", []int64{amfUeNgapId}); err == nil {
+		t.Error("NG Reset of an unknown UE-associated NG connection is accepted")
+	}
+}
@@ -16,6 +16,10 @@ import (
 	"github.com/omec-project/amf/factory"
 	"github.com/omec-project/amf/ngap"
 	"github.com/omec-project/amf/util"
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/nas/nasType"
+	"github.com/omec-project/openapi/models"
 )
 
 func init() {
@@ -80,3 +84,86 @@ func TestHandleNGSetupRequest(t *testing.T) {
 		}
 	}
 }
+
+// buildRegistrationRequest returns a plain NAS initial Registration Request with a SUCI
+func buildRegistrationRequest() ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeRegistrationRequest)
+
+	registrationRequest := nasMessage.NewRegistrationRequest(0)
+	registrationRequest.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	registrationRequest.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	registrationRequest.SetMessageType(nas.MsgTypeRegistrationRequest)
+	registrationRequest.NgksiAndRegistrationType5GS.SetTSC(nasMessage.TypeOfSecurityContextFlagNative)
+	registrationRequest.NgksiAndRegistrationType5GS.SetNasKeySetIdentifiler(7)
+	registrationRequest.NgksiAndRegistrationType5GS.SetFOR(1)
+	registrationRequest.NgksiAndRegistrationType5GS.SetRegistrationType5GS(
+		nasMessage.RegistrationType5GSInitialRegistration)
+	// SUCI of imsi-208930000007487, null protection scheme
+	registrationRequest.MobileIdentity5GS = nasType.MobileIdentity5GS{
+		Len:    12,
+		Buffer: []uint8{0x01, 0x02, 0xf8, 0x39, 0xf0, 0xff, 0x00, 0x00, 0x00, 0x00, 0x47, 0x78},
+	}
+	registrationRequest.UESecurityCapability = &nasType.UESecurityCapability{
+		Iei:    nasMessage.RegistrationRequestUESecurityCapabilityType,
+		Len:    2,
+		Buffer: []uint8{0x80, 0x20},
+	}
+	m.GmmMessage.RegistrationRequest = registrationRequest
+
+	return m.PlainNasEncode()
+}
+
+// TestN3iwfRegistration simulates an N3IWF: it sets up the NG interface and relays the Registration
+// Request of a UE connected over untrusted non-3GPP access
+func TestN3iwfRegistration(t *testing.T) {
+	conn := &ngaputil.TestConn{}
+
+	ngSetupReq, err := ngaputil.GetN3iwfNGSetupRequest([]byte{0x00, 0x01}, "N3IWF", "\x00\x00\x01")
+	if err != nil {
+		t.Fatalf("Failed to create N3IWF NGSetupRequest: %v", err)
+	}
+	ngap.Dispatch(conn, ngSetupReq)
+	time.Sleep(2 * time.Second)
+	if len(conn.Data) == 0 || conn.Data[0] != ngaputil.NgapPDUSuccessfulOutcome {
+		t.Fatal("N3IWF NG Setup failed")
+	}
+
+	ran, ok := context.AMF_Self().AmfRanFindByConn(conn)
+	if !ok {
+		t.Fatal("N3IWF is not stored")
+	}
+	if ran.AnType != models.AccessType_NON_3_GPP_ACCESS {
+		t.Fatalf("N3IWF access type, want: %s, got: %s", models.AccessType_NON_3_GPP_ACCESS, ran.AnType)
+	}
+
+	nasPdu, err := buildRegistrationRequest()
+	if err != nil {
+		t.Fatalf("Failed to create Registration Request: %v", err)
+	}
+	initialUeMsg, err := ngaputil.GetN3iwfInitialUEMessage(1, nasPdu, "10.0.0.1", 4500)
+	if err != nil {
+		t.Fatalf("Failed to create InitialUEMessage: %v", err)
+	}
+	ngap.Dispatch(conn, initialUeMsg)
+	time.Sleep(2 * time.Second)
+
+	ranUe := ran.RanUeFindByRanUeNgapID(1)
+	if ranUe == nil {
+		t.Fatal("RanUe of the N3IWF is not created")
+	}
+	n3gaLocation := ranUe.Location.N3gaLocation
+	if n3gaLocation == nil || n3gaLocation.UeIpv4Addr != "10.0.0.1" || n3gaLocation.PortNumber != 4500 {
+		t.Errorf("Unexpected N3GA location: %+v", n3gaLocation)
+	}
+	if ranUe.Tai != context.AMF_Self().Non3gppTai() {
+		t.Errorf("N3GPP TAI, want: %+v, got: %+v", context.AMF_Self().Non3gppTai(), ranUe.Tai)
+	}
+	if ranUe.AmfUe == nil || ranUe.AmfUe.RanUe[models.AccessType_NON_3_GPP_ACCESS] != ranUe {
+		t.Fatal("UE context is not attached to the non-3GPP access")
+	}
+	if ranUe.AmfUe.Location.N3gaLocation == nil {
+		t.Error("N3GA location is not stored in the UE context")
+	}
+}
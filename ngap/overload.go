@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package ngap
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/metrics"
+	ngap_message "github.com/omec-project/amf/ngap/message"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+const (
+	defaultOverloadCheckInterval = 5 * time.Second
+	// load has to drop below this percentage of every threshold before Overload Stop is sent
+	overloadRecoveryPercent = 80
+)
+
+// OverloadState values accepted by ForceOverloadState
+const (
+	OverloadStateAuto  = "auto"
+	OverloadStateStart = "start"
+	OverloadStateStop  = "stop"
+)
+
+// OverloadStatus is the state of the overload control reported to OAM
+type OverloadStatus struct {
+	Overloaded bool
+	Forced     string // "auto" if the state is driven by the load
+	QueueDepth int
+	Goroutines int
+	SbiLatency int64 // milliseconds
+}
+
+var overloadCtrl struct {
+	sync.Mutex
+	// serializes the state changes with their Overload Start/Stop, which are sent
+	// without holding the state lock
+	change     sync.Mutex
+	overloaded bool
+	forced     string
+	status     OverloadStatus
+}
+
+// StartOverloadControl periodically checks the load of the AMF against the
+// configured thresholds, it does nothing if overload control is not configured
+func StartOverloadControl() {
+	cfg := context.AMF_Self().OverloadCfg
+	if cfg == nil {
+		return
+	}
+	interval := defaultOverloadCheckInterval
+	if cfg.CheckInterval > 0 {
+		interval = time.Duration(cfg.CheckInterval) * time.Second
+	}
+	overloadCtrl.Lock()
+	overloadCtrl.forced = OverloadStateAuto
+	overloadCtrl.Unlock()
+
+	logger.NgapLog.Infof("Start overload control[interval: %v, queueDepth: %d, goroutines: %d, sbiLatency: %dms]",
+		interval, cfg.QueueDepth, cfg.Goroutines, cfg.SbiLatency)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkOverload()
+		}
+	}()
+}
+
+func checkOverload() {
+	amfSelf := context.AMF_Self()
+	cfg := amfSelf.OverloadCfg
+
+	amfSelf.DecaySbiLatency()
+	status := OverloadStatus{
+		QueueDepth: amfSelf.EventQueueDepth() + ueWorkerQueueDepth(),
+		Goroutines: runtime.NumGoroutine(),
+		SbiLatency: amfSelf.SbiLatency().Milliseconds(),
+	}
+	metrics.SetAmfLoadStats("queue_depth", float64(status.QueueDepth))
+	metrics.SetAmfLoadStats("goroutines", float64(status.Goroutines))
+	metrics.SetAmfLoadStats("sbi_latency_ms", float64(status.SbiLatency))
+
+	overloadCtrl.change.Lock()
+	defer overloadCtrl.change.Unlock()
+	overloadCtrl.Lock()
+	overloaded := overloadCtrl.overloaded
+	if overloadCtrl.forced == OverloadStateAuto {
+		if overloaded {
+			// hysteresis, stay overloaded until the load is clearly below all thresholds
+			overloaded = exceeds(status.QueueDepth, cfg.QueueDepth, overloadRecoveryPercent) ||
+				exceeds(status.Goroutines, cfg.Goroutines, overloadRecoveryPercent) ||
+				exceeds(int(status.SbiLatency), cfg.SbiLatency, overloadRecoveryPercent)
+		} else {
+			overloaded = exceeds(status.QueueDepth, cfg.QueueDepth, 100) ||
+				exceeds(status.Goroutines, cfg.Goroutines, 100) ||
+				exceeds(int(status.SbiLatency), cfg.SbiLatency, 100)
+		}
+	}
+	status.Overloaded = overloaded
+	status.Forced = overloadCtrl.forced
+	overloadCtrl.status = status
+	changed := setOverloaded(overloaded)
+	overloadCtrl.Unlock()
+
+	if changed {
+		sendOverloadStateToRans(overloaded)
+	}
+}
+
+// exceeds reports if value is above percent of threshold, a threshold of 0 is disabled
+func exceeds(value, threshold, percent int) bool {
+	return threshold > 0 && value*100 > threshold*percent
+}
+
+// setOverloaded updates the overload state and reports if it changed, the caller
+// must hold overloadCtrl and send Overload Start/Stop once it is released
+func setOverloaded(overloaded bool) bool {
+	if overloaded == overloadCtrl.overloaded {
+		return false
+	}
+	overloadCtrl.overloaded = overloaded
+	if overloaded {
+		logger.NgapLog.Warnf("AMF overloaded, send Overload Start to all RANs[%+v]", overloadCtrl.status)
+		metrics.SetAmfLoadStats("overloaded", 1)
+	} else {
+		logger.NgapLog.Infof("AMF load recovered, send Overload Stop to all RANs[%+v]", overloadCtrl.status)
+		metrics.SetAmfLoadStats("overloaded", 0)
+	}
+	return true
+}
+
+func sendOverloadStateToRans(overloaded bool) {
+	for _, ran := range context.AMF_Self().AmfRanListInArea(nil, nil) {
+		sendOverloadState(ran, overloaded)
+	}
+}
+
+func sendOverloadState(ran *context.AmfRan, overloaded bool) {
+	if !overloaded {
+		ngap_message.SendOverloadStop(ran)
+		return
+	}
+	cfg := context.AMF_Self().OverloadCfg
+	var trafficLoadReduction int64
+	var overloadStartNSSAIList *ngapType.OverloadStartNSSAIList
+	if cfg != nil {
+		trafficLoadReduction = cfg.TrafficLoadReduction
+		if len(cfg.SNssaiList) > 0 {
+			list := ngap_message.BuildOverloadStartNSSAIList(cfg.SNssaiList, cfg.TrafficLoadReduction)
+			overloadStartNSSAIList = &list
+			// the reduction applies to the listed slices only
+			trafficLoadReduction = 0
+		}
+	}
+	overloadResponse := &ngapType.OverloadResponse{
+		Present: ngapType.OverloadResponsePresentOverloadAction,
+		OverloadAction: &ngapType.OverloadAction{
+			Value: ngapType.OverloadActionPresentRejectNonEmergencyMoDt,
+		},
+	}
+	ngap_message.SendOverloadStart(ran, overloadResponse, trafficLoadReduction, overloadStartNSSAIList)
+}
+
+// SendOverloadStateToRan informs a RAN which just completed NG Setup of an
+// ongoing overload
+func SendOverloadStateToRan(ran *context.AmfRan) {
+	overloadCtrl.Lock()
+	overloaded := overloadCtrl.overloaded
+	overloadCtrl.Unlock()
+	if overloaded {
+		sendOverloadState(ran, true)
+	}
+}
+
+// ForceOverloadState lets OAM start or stop the overload state regardless of the
+// load, OverloadStateAuto hands control back to the load checks
+func ForceOverloadState(state string) error {
+	overloadCtrl.change.Lock()
+	defer overloadCtrl.change.Unlock()
+	overloadCtrl.Lock()
+	changed := false
+	switch state {
+	case OverloadStateStart:
+		changed = setOverloaded(true)
+	case OverloadStateStop:
+		changed = setOverloaded(false)
+	case OverloadStateAuto:
+	default:
+		overloadCtrl.Unlock()
+		return fmt.Errorf("unknown overload state: %s", state)
+	}
+	logger.NgapLog.Infof("Overload state forced to %s", state)
+	overloadCtrl.forced = state
+	overloadCtrl.status.Forced = state
+	overloadCtrl.status.Overloaded = overloadCtrl.overloaded
+	overloaded := overloadCtrl.overloaded
+	overloadCtrl.Unlock()
+
+	if changed {
+		sendOverloadStateToRans(overloaded)
+	}
+	return nil
+}
+
+// GetOverloadStatus returns the result of the last overload check
+func GetOverloadStatus() OverloadStatus {
+	overloadCtrl.Lock()
+	defer overloadCtrl.Unlock()
+	status := overloadCtrl.status
+	status.Overloaded = overloadCtrl.overloaded
+	if overloadCtrl.forced == "" {
+		status.Forced = OverloadStateAuto
+	}
+	return status
+}
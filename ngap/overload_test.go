@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package ngap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/factory"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	libngap "github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// setSbiLatency feeds the moving average until it settles at d
+func setSbiLatency(d time.Duration) {
+	for i := 0; i < 100; i++ {
+		context.AMF_Self().ObserveSbiLatency(d)
+	}
+}
+
+// sentOverloadProcedure returns the procedure code of the last message sent to the RAN
+func sentOverloadProcedure(t *testing.T, conn *ngaputil.TestConn) int64 {
+	if conn.Data == nil {
+		return 0
+	}
+	pdu, err := libngap.Decoder(conn.Data)
+	if err != nil || pdu.InitiatingMessage == nil {
+		t.Fatalf("No initiating message is sent: %v", err)
+	}
+	return pdu.InitiatingMessage.ProcedureCode.Value
+}
+
+func TestCheckOverload(t *testing.T) {
+	self := context.AMF_Self()
+	overloadCfg := self.OverloadCfg
+	self.OverloadCfg = &factory.Overload{SbiLatency: 100, TrafficLoadReduction: 50}
+	defer func() {
+		self.OverloadCfg = overloadCfg
+		overloadCtrl.Lock()
+		overloadCtrl.overloaded = false
+		overloadCtrl.forced = ""
+		overloadCtrl.Unlock()
+	}()
+	overloadCtrl.Lock()
+	overloadCtrl.forced = OverloadStateAuto
+	overloadCtrl.Unlock()
+
+	conn := &ngaputil.TestConn{}
+	ran := self.NewAmfRan(conn)
+	defer ran.Remove()
+
+	// each step is checked after the previous one, Overload Stop is only sent once the
+	// latency is below 80% of the threshold
+	steps := []struct {
+		description string
+		sbiLatency  time.Duration
+		overloaded  bool
+		sent        int64
+	}{
+		{
+			description: "below the threshold",
+			sbiLatency:  50 * time.Millisecond,
+		},
+		{
+			description: "above the threshold",
+			sbiLatency:  150 * time.Millisecond,
+			overloaded:  true,
+			sent:        ngapType.ProcedureCodeOverloadStart,
+		},
+		{
+			description: "below the threshold, above the recovery level",
+			sbiLatency:  90 * time.Millisecond,
+			overloaded:  true,
+		},
+		{
+			description: "below the recovery level",
+			sbiLatency:  70 * time.Millisecond,
+			sent:        ngapType.ProcedureCodeOverloadStop,
+		},
+		{
+			description: "above the recovery level again",
+			sbiLatency:  90 * time.Millisecond,
+		},
+	}
+
+	for _, step := range steps {
+		conn.Data = nil
+		setSbiLatency(step.sbiLatency)
+		checkOverload()
+
+		status := GetOverloadStatus()
+		if status.Overloaded != step.overloaded {
+			t.Errorf("%s: overloaded, want: %v, got: %v (%+v)", step.description, step.overloaded,
+				status.Overloaded, status)
+		}
+		if sent := sentOverloadProcedure(t, conn); sent != step.sent {
+			t.Errorf("%s: procedure sent to the RAN, want: %d, got: %d", step.description, step.sent, sent)
+		}
+	}
+}
+
+func TestExceeds(t *testing.T) {
+	testCases := []struct {
+		value, threshold, percent int
+		exceeds                   bool
+	}{
+		{value: 101, threshold: 100, percent: 100, exceeds: true},
+		{value: 100, threshold: 100, percent: 100},
+		{value: 81, threshold: 100, percent: overloadRecoveryPercent, exceeds: true},
+		{value: 80, threshold: 100, percent: overloadRecoveryPercent},
+		// a threshold of 0 is not checked
+		{value: 1000, threshold: 0, percent: 100},
+	}
+
+	for _, tc := range testCases {
+		if got := exceeds(tc.value, tc.threshold, tc.percent); got != tc.exceeds {
+			t.Errorf("exceeds(%d, %d, %d), want: %v, got: %v", tc.value, tc.threshold, tc.percent,
+				tc.exceeds, got)
+		}
+	}
+}
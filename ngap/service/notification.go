@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package service
+
+import (
+	"net"
+	"syscall"
+)
+
+// constants from linux/sctp.h, the sctp package does not decode SCTP_PEER_ADDR_CHANGE
+const (
+	sctpPeerAddrChange = 1<<15 + 2
+
+	// struct sctp_paddr_change is packed and aligned to 4 bytes
+	sizeofPaddrChange = 148
+	offsetSpcAaddr    = 8
+	offsetSpcState    = 136
+	offsetSpcError    = 140
+)
+
+var peerAddrStates = []string{
+	"SCTP_ADDR_AVAILABLE",
+	"SCTP_ADDR_UNREACHABLE",
+	"SCTP_ADDR_REMOVED",
+	"SCTP_ADDR_ADDED",
+	"SCTP_ADDR_MADE_PRIM",
+	"SCTP_ADDR_CONFIRMED",
+	"SCTP_ADDR_POTENTIALLY_FAILED",
+}
+
+// PeerAddrChange is a SCTP_PEER_ADDR_CHANGE notification: a path of a multi-homed
+// association changed its state (RFC 6458 6.1.2)
+type PeerAddrChange struct {
+	Addr  net.IP
+	State string
+	Error int32
+}
+
+// parsePeerAddrChange decodes the notification SCTPRead failed on, it returns false
+// if the notification is not a SCTP_PEER_ADDR_CHANGE
+func parsePeerAddrChange(b []byte) (*PeerAddrChange, bool) {
+	if len(b) < sizeofPaddrChange || nativeEndian.Uint16(b) != sctpPeerAddrChange {
+		return nil, false
+	}
+
+	change := &PeerAddrChange{Error: int32(nativeEndian.Uint32(b[offsetSpcError:]))}
+	if state := int(nativeEndian.Uint32(b[offsetSpcState:])); state < len(peerAddrStates) {
+		change.State = peerAddrStates[state]
+	} else {
+		change.State = "UNKNOWN"
+	}
+
+	// struct sockaddr_storage, the port and the address are in network byte order
+	addr := b[offsetSpcAaddr:]
+	switch nativeEndian.Uint16(addr) {
+	case syscall.AF_INET:
+		change.Addr = net.IP(append([]byte(nil), addr[4:8]...))
+	case syscall.AF_INET6:
+		change.Addr = net.IP(append([]byte(nil), addr[8:24]...))
+	}
+	return change, true
+}
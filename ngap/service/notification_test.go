@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package service
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func buildPaddrChange(family uint16, addr net.IP, state uint32) []byte {
+	b := make([]byte, sizeofPaddrChange)
+	nativeEndian.PutUint16(b, sctpPeerAddrChange)
+	nativeEndian.PutUint32(b[4:], sizeofPaddrChange)
+	nativeEndian.PutUint16(b[offsetSpcAaddr:], family)
+	binary.BigEndian.PutUint16(b[offsetSpcAaddr+2:], 38412)
+	if family == syscall.AF_INET {
+		copy(b[offsetSpcAaddr+4:], addr.To4())
+	} else {
+		copy(b[offsetSpcAaddr+8:], addr.To16())
+	}
+	nativeEndian.PutUint32(b[offsetSpcState:], state)
+	return b
+}
+
+func TestParsePeerAddrChange(t *testing.T) {
+	testCases := []struct {
+		description string
+		b           []byte
+		addr        net.IP
+		state       string
+	}{
+		{
+			description: "IPv4 path unreachable",
+			b:           buildPaddrChange(syscall.AF_INET, net.ParseIP("192.168.1.1"), 1),
+			addr:        net.ParseIP("192.168.1.1"),
+			state:       "SCTP_ADDR_UNREACHABLE",
+		},
+		{
+			description: "IPv6 path available",
+			b:           buildPaddrChange(syscall.AF_INET6, net.ParseIP("2001:db8::1"), 0),
+			addr:        net.ParseIP("2001:db8::1"),
+			state:       "SCTP_ADDR_AVAILABLE",
+		},
+		{
+			description: "unknown state",
+			b:           buildPaddrChange(syscall.AF_INET, net.ParseIP("192.168.1.1"), 42),
+			addr:        net.ParseIP("192.168.1.1"),
+			state:       "UNKNOWN",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			change, ok := parsePeerAddrChange(tc.b)
+			if !ok {
+				t.Fatal("SCTP_PEER_ADDR_CHANGE is not decoded")
+			}
+			if !change.Addr.Equal(tc.addr) || change.State != tc.state {
+				t.Errorf("want: %s %s, got: %s %s", tc.addr, tc.state, change.Addr, change.State)
+			}
+		})
+	}
+
+	// other notifications and truncated ones are not decoded
+	b := buildPaddrChange(syscall.AF_INET, net.ParseIP("192.168.1.1"), 1)
+	if _, ok := parsePeerAddrChange(b[:sizeofPaddrChange-1]); ok {
+		t.Error("Truncated notification is decoded")
+	}
+	nativeEndian.PutUint16(b, 1<<15+1)
+	if _, ok := parsePeerAddrChange(b); ok {
+		t.Error("SCTP_ASSOC_CHANGE is decoded as SCTP_PEER_ADDR_CHANGE")
+	}
+}
@@ -15,13 +15,16 @@ import (
 
 	"git.cs.nctu.edu.tw/calee/sctp"
 
+	"github.com/omec-project/amf/factory"
 	"github.com/omec-project/amf/logger"
 	"github.com/omec-project/ngap"
 )
 
 type NGAPHandler struct {
-	HandleMessage      func(conn net.Conn, msg []byte)
+	HandleMessage      func(conn net.Conn, msg []byte, streamId uint16)
 	HandleNotification func(conn net.Conn, notification sctp.Notification)
+	// HandlePeerAddrChange reports a path state change of a multi-homed association
+	HandlePeerAddrChange func(conn net.Conn, addr net.IP, state string)
 }
 
 const readBufSize uint32 = 131072
@@ -35,11 +38,65 @@ var (
 )
 
 var sctpConfig sctp.SocketConfig = sctp.SocketConfig{
-	InitMsg:   sctp.InitMsg{NumOstreams: 3, MaxInstreams: 5, MaxAttempts: 2, MaxInitTimeout: 2},
+	InitMsg: sctp.InitMsg{
+		NumOstreams:    factory.DefaultSctpNumOutStreams,
+		MaxInstreams:   factory.DefaultSctpMaxInStreams,
+		MaxAttempts:    2,
+		MaxInitTimeout: 2,
+	},
 	RtoInfo:   &sctp.RtoInfo{SrtoAssocID: 0, SrtoInitial: 500, SrtoMax: 1500, StroMin: 100},
 	AssocInfo: &sctp.AssocInfo{AsocMaxRxt: 4},
 }
 
+// ConfigureSctp applies the "sctp" configuration block, it shall be called before Run
+func ConfigureSctp(cfg *factory.Sctp) {
+	if cfg == nil {
+		return
+	}
+	if cfg.NumOutStreams != 0 {
+		sctpConfig.InitMsg.NumOstreams = cfg.NumOutStreams
+	}
+	if cfg.MaxInStreams != 0 {
+		sctpConfig.InitMsg.MaxInstreams = cfg.MaxInStreams
+	}
+	if cfg.MaxInitRetransmits != 0 {
+		sctpConfig.InitMsg.MaxAttempts = cfg.MaxInitRetransmits
+	}
+	if cfg.MaxInitTimeout != 0 {
+		sctpConfig.InitMsg.MaxInitTimeout = cfg.MaxInitTimeout
+	}
+	if cfg.RtoInitial != 0 {
+		sctpConfig.RtoInfo.SrtoInitial = cfg.RtoInitial
+	}
+	if cfg.RtoMin != 0 {
+		sctpConfig.RtoInfo.StroMin = cfg.RtoMin
+	}
+	if cfg.RtoMax != 0 {
+		sctpConfig.RtoInfo.SrtoMax = cfg.RtoMax
+	}
+	if cfg.AssocMaxRetrans != 0 {
+		sctpConfig.AssocInfo.AsocMaxRxt = cfg.AssocMaxRetrans
+	}
+	if cfg.HeartbeatInterval != 0 || cfg.PathMaxRetrans != 0 {
+		heartbeatInterval, pathMaxRetrans := cfg.HeartbeatInterval, cfg.PathMaxRetrans
+		sctpConfig.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = setPeerAddrParams(fd, heartbeatInterval, pathMaxRetrans)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	logger.NgapLog.Infof("SCTP streams[out: %d, in: %d] init[maxAttempts: %d, maxTimeout: %d]",
+		sctpConfig.InitMsg.NumOstreams, sctpConfig.InitMsg.MaxInstreams,
+		sctpConfig.InitMsg.MaxAttempts, sctpConfig.InitMsg.MaxInitTimeout)
+	logger.NgapLog.Infof("SCTP rto[initial: %d, min: %d, max: %d] assocMaxRetrans: %d "+
+		"heartbeatInterval: %d pathMaxRetrans: %d", sctpConfig.RtoInfo.SrtoInitial, sctpConfig.RtoInfo.StroMin,
+		sctpConfig.RtoInfo.SrtoMax, sctpConfig.AssocInfo.AsocMaxRxt, cfg.HeartbeatInterval, cfg.PathMaxRetrans)
+}
+
 func Run(addresses []string, port int, handler NGAPHandler) {
 	ips := []net.IPAddr{}
 
@@ -52,6 +109,11 @@ func Run(addresses []string, port int, handler NGAPHandler) {
 		}
 	}
 
+	// all addresses of NgapIpList are bound to one endpoint, i.e. the AMF is
+	// multi-homed and the RAN may fail over between them
+	if len(ips) > 1 {
+		logger.NgapLog.Infof("Multi-homed SCTP endpoint with %d addresses", len(ips))
+	}
 	addr := &sctp.SCTPAddr{
 		IPAddrs: ips,
 		Port:    port,
@@ -105,7 +167,8 @@ func listenAndServe(addr *sctp.SCTPAddr, handler NGAPHandler) {
 			logger.NgapLog.Debugf("Set default sent param[value: %+v]", info)
 		}
 
-		events := sctp.SCTP_EVENT_DATA_IO | sctp.SCTP_EVENT_SHUTDOWN | sctp.SCTP_EVENT_ASSOCIATION
+		events := sctp.SCTP_EVENT_DATA_IO | sctp.SCTP_EVENT_SHUTDOWN | sctp.SCTP_EVENT_ASSOCIATION |
+			sctp.SCTP_EVENT_ADDRESS
 		if err := newConn.SubscribeEvents(events); err != nil {
 			logger.NgapLog.Errorf("Failed to accept: %+v", err)
 			if err = newConn.Close(); err != nil {
@@ -113,7 +176,7 @@ func listenAndServe(addr *sctp.SCTPAddr, handler NGAPHandler) {
 			}
 			continue
 		} else {
-			logger.NgapLog.Debugln("Subscribe SCTP event[DATA_IO, SHUTDOWN_EVENT, ASSOCIATION_CHANGE]")
+			logger.NgapLog.Debugln("Subscribe SCTP event[DATA_IO, SHUTDOWN_EVENT, ASSOCIATION_CHANGE, ADDRESS_CHANGE]")
 		}
 
 		if err := newConn.SetReadBuffer(int(readBufSize)); err != nil {
@@ -186,6 +249,16 @@ func handleConnection(conn *sctp.SCTPConn, bufsize uint32, handler NGAPHandler)
 				logger.NgapLog.Debugf("SCTPRead: %+v", err)
 				continue
 			default:
+				// SCTPRead fails on the notifications it cannot decode, a path failover of
+				// a multi-homed association must not close the association
+				if n > 0 {
+					if change, ok := parsePeerAddrChange(buf[:n]); ok {
+						if handler.HandlePeerAddrChange != nil {
+							handler.HandlePeerAddrChange(conn, change.Addr, change.State)
+						}
+						continue
+					}
+				}
 				logger.NgapLog.Errorf("Handle connection[addr: %+v] error: %+v", conn.RemoteAddr(), err)
 				return
 			}
@@ -203,11 +276,12 @@ func handleConnection(conn *sctp.SCTPConn, bufsize uint32, handler NGAPHandler)
 				continue
 			}
 
-			logger.NgapLog.Tracef("Read %d bytes", n)
+			logger.NgapLog.Tracef("Read %d bytes on stream %d", n, info.Stream)
 			logger.NgapLog.Tracef("Packet content:\n%+v", hex.Dump(buf[:n]))
 
-			// TODO: concurrent on per-UE message
-			handler.HandleMessage(conn, buf[:n])
+			// HandleMessage only decodes the message and queues it to the per-UE,
+			// per-RAN or worker pool channel, so reading is not blocked by procedures
+			handler.HandleMessage(conn, buf[:n], info.Stream)
 		}
 	}
 }
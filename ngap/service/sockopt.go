@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package service
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+)
+
+// constants from linux/sctp.h
+const (
+	solSctp            = 132
+	sctpPeerAddrParams = 9
+	sppHbEnable        = 1 << 0
+
+	// struct sctp_paddrparams is packed and aligned to 4 bytes, spp_flags is unaligned
+	sizeofPaddrParams   = 156
+	offsetSppHbInterval = 132
+	offsetSppPathMaxRxt = 136
+	offsetSppFlags      = 146
+)
+
+// the kernel reads the fields of the socket option in host byte order
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// setPeerAddrParams configures heartbeat interval (ms) and path max retransmissions
+// on the socket. Applied on the listening socket, associations accepted from it
+// and all their peer addresses inherit these values.
+func setPeerAddrParams(fd uintptr, heartbeatInterval uint32, pathMaxRetrans uint16) error {
+	buf := make([]byte, sizeofPaddrParams)
+	var flags uint32
+
+	// spp_assoc_id and spp_address are left zero: the setting applies to the endpoint
+	if heartbeatInterval != 0 {
+		nativeEndian.PutUint32(buf[offsetSppHbInterval:], heartbeatInterval)
+		flags |= sppHbEnable
+	}
+	nativeEndian.PutUint16(buf[offsetSppPathMaxRxt:], pathMaxRetrans)
+	nativeEndian.PutUint32(buf[offsetSppFlags:], flags)
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, fd, solSctp, sctpPeerAddrParams,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package util
+
+import (
+	"encoding/binary"
+
+	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapConvert"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+// GetN3iwfNGSetupRequest returns an encoded NGSetupRequest sent by an N3IWF, the N3IWF ID is 16 bits long
+func GetN3iwfNGSetupRequest(n3iwfId []byte, name, tac string) ([]byte, error) {
+	message := BuildNGSetupRequest()
+	// GlobalRANNodeID
+	ie := message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[0]
+	globalRANNodeID := ie.Value.GlobalRANNodeID
+	globalRANNodeID.Present = ngapType.GlobalRANNodeIDPresentGlobalN3IWFID
+	globalRANNodeID.GlobalGNBID = nil
+	globalRANNodeID.GlobalN3IWFID = new(ngapType.GlobalN3IWFID)
+	globalRANNodeID.GlobalN3IWFID.PLMNIdentity.Value = aper.OctetString("\x02\xf8\x39")
+	globalRANNodeID.GlobalN3IWFID.N3IWFID.Present = ngapType.N3IWFIDPresentN3IWFID
+	globalRANNodeID.GlobalN3IWFID.N3IWFID.N3IWFID = &aper.BitString{
+		Bytes:     n3iwfId,
+		BitLength: 16,
+	}
+	// RANNodeName
+	ie = message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[1]
+	ie.Value.RANNodeName.Value = name
+
+	ie = message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[2]
+	ie.Value.SupportedTAList.List[0].TAC.Value = aper.OctetString(tac)
+
+	return ngap.Encoder(message)
+}
+
+// GetN3iwfInitialUEMessage returns an encoded InitialUEMessage sent by an N3IWF for the UE reachable
+// at the IPsec outer address ueIp:port
+func GetN3iwfInitialUEMessage(ranUeNgapId int64, nasPdu []byte, ueIp string, port uint16) ([]byte, error) {
+	message := BuildN3iwfInitialUEMessage(ranUeNgapId, nasPdu, ueIp, port)
+	return ngap.Encoder(message)
+}
+
+// BuildN3iwfInitialUEMessage forms and returns a new NGAPPDU struct value for
+// InitialUEMessage with the N3IWF user location information
+func BuildN3iwfInitialUEMessage(ranUeNgapId int64, nasPdu []byte, ueIp string, port uint16) (
+	pdu ngapType.NGAPPDU) {
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeInitialUEMessage
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentInitialUEMessage
+	initiatingMessage.Value.InitialUEMessage = new(ngapType.InitialUEMessage)
+
+	initialUEMessageIEs := &initiatingMessage.Value.InitialUEMessage.ProtocolIEs
+
+	// RAN UE NGAP ID
+	ie := ngapType.InitialUEMessageIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialUEMessageIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: ranUeNgapId}
+	initialUEMessageIEs.List = append(initialUEMessageIEs.List, ie)
+
+	// NAS-PDU
+	ie = ngapType.InitialUEMessageIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialUEMessageIEsPresentNASPDU
+	ie.Value.NASPDU = &ngapType.NASPDU{Value: nasPdu}
+	initialUEMessageIEs.List = append(initialUEMessageIEs.List, ie)
+
+	// User Location Information
+	ie = ngapType.InitialUEMessageIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUserLocationInformation
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialUEMessageIEsPresentUserLocationInformation
+	ie.Value.UserLocationInformation = new(ngapType.UserLocationInformation)
+
+	userLocationInformation := ie.Value.UserLocationInformation
+	userLocationInformation.Present = ngapType.UserLocationInformationPresentUserLocationInformationN3IWF
+	userLocationInformation.UserLocationInformationN3IWF = new(ngapType.UserLocationInformationN3IWF)
+
+	portNumber := make([]byte, 2)
+	binary.BigEndian.PutUint16(portNumber, port)
+	userLocationInformationN3IWF := userLocationInformation.UserLocationInformationN3IWF
+	userLocationInformationN3IWF.IPAddress = ngapConvert.IPAddressToNgap(ueIp, "")
+	userLocationInformationN3IWF.PortNumber.Value = portNumber
+	initialUEMessageIEs.List = append(initialUEMessageIEs.List, ie)
+
+	// RRC Establishment Cause
+	ie = ngapType.InitialUEMessageIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRRCEstablishmentCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.InitialUEMessageIEsPresentRRCEstablishmentCause
+	ie.Value.RRCEstablishmentCause = &ngapType.RRCEstablishmentCause{
+		Value: ngapType.RRCEstablishmentCausePresentMoSignalling,
+	}
+	initialUEMessageIEs.List = append(initialUEMessageIEs.List, ie)
+
+	return pdu
+}
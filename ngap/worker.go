@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package ngap
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/ngap/ngapType"
+)
+
+const (
+	defaultNgapWorkerPoolSize = 16
+	ngapWorkerQueueLen        = 128
+)
+
+// ueWorkerPool serializes UE-associated NGAP messages which arrive before the
+// UE has an AmfUe EventChannel (e.g. InitialUEMessage). Messages are hashed to a
+// worker by RAN and RAN UE NGAP ID, so messages of one UE are never reordered
+// while messages of different UEs are handled in parallel.
+var (
+	ueWorkerPool     []chan context.NgapMsg
+	ueWorkerPoolOnce sync.Once
+)
+
+func initUeWorkerPool() {
+	size := context.AMF_Self().NgapWorkerPoolSize
+	if size <= 0 {
+		size = defaultNgapWorkerPoolSize
+	}
+	logger.NgapLog.Infof("Start NGAP worker pool[size: %d]", size)
+	ueWorkerPool = make([]chan context.NgapMsg, size)
+	for i := range ueWorkerPool {
+		ueWorkerPool[i] = make(chan context.NgapMsg, ngapWorkerQueueLen)
+		go ueWorker(ueWorkerPool[i])
+	}
+}
+
+func ueWorker(msgChan chan context.NgapMsg) {
+	for msg := range msgChan {
+		DispatchNgapMsg(msg.Ran, msg.NgapMsg, msg.SctplbMsg)
+	}
+}
+
+func submitToUeWorker(key string, msg context.NgapMsg) {
+	ueWorkerPoolOnce.Do(initUeWorkerPool)
+	h := fnv.New32a()
+	if _, err := h.Write([]byte(key)); err != nil {
+		logger.NgapLog.Errorf("hash worker key error: %+v", err)
+	}
+	ueWorkerPool[h.Sum32()%uint32(len(ueWorkerPool))] <- msg
+}
+
+// RanNgapMsgHandler is the handler of the per-RAN worker
+func RanNgapMsgHandler(ran *context.AmfRan, msg context.NgapMsg) {
+	DispatchNgapMsg(ran, msg.NgapMsg, msg.SctplbMsg)
+}
+
+// dispatchWithoutAmfUe queues a message which can not be put on an AmfUe
+// EventChannel. UE-associated messages go to the worker pool, all other
+// messages go to the per-RAN worker.
+func dispatchWithoutAmfUe(ran *context.AmfRan, ranUe *context.RanUe, msg context.NgapMsg) {
+	var ranUeNgapID *int64
+	if ranUe != nil {
+		ranUeNgapID = &ranUe.RanUeNgapId
+	} else {
+		ranUeNgapID = initialUeMessageRanUeNgapID(msg.NgapMsg)
+	}
+
+	if ranUeNgapID != nil {
+		submitToUeWorker(ran.GnbIp+"/"+strconv.FormatInt(*ranUeNgapID, 10), msg)
+		return
+	}
+
+	// the EventChannel is read under ran.Mutex, it is reset concurrently when the RAN is removed
+	if !ran.SetEventChannel(RanNgapMsgHandler).SubmitMessage(msg) {
+		ran.Log.Warnf("RAN context has been removed, drop the NGAP message")
+	}
+}
+
+func initialUeMessageRanUeNgapID(pdu *ngapType.NGAPPDU) *int64 {
+	if pdu == nil || pdu.Present != ngapType.NGAPPDUPresentInitiatingMessage || pdu.InitiatingMessage == nil {
+		return nil
+	}
+	if pdu.InitiatingMessage.ProcedureCode.Value != ngapType.ProcedureCodeInitialUEMessage {
+		return nil
+	}
+	initialUEMessage := pdu.InitiatingMessage.Value.InitialUEMessage
+	if initialUEMessage == nil {
+		return nil
+	}
+	for _, ie := range initialUEMessage.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDRANUENGAPID && ie.Value.RANUENGAPID != nil {
+			return &ie.Value.RANUENGAPID.Value
+		}
+	}
+	return nil
+}
+
+func ueWorkerQueueDepth() (depth int) {
+	ueWorkerPoolOnce.Do(initUeWorkerPool)
+	for _, msgChan := range ueWorkerPool {
+		depth += len(msgChan)
+	}
+	return depth
+}
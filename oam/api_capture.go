@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/ngap/capture"
+	"github.com/omec-project/openapi/models"
+)
+
+func HTTPGetCaptureStatus(c *gin.Context) {
+	setCorsHeader(c)
+
+	c.JSON(http.StatusOK, capture.GetStatus())
+}
+
+// HTTPStartCapture starts an NGAP capture, the optional body filters by gnbId and supi
+func HTTPStartCapture(c *gin.Context) {
+	setCorsHeader(c)
+
+	var filter capture.Filter
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&filter); err != nil {
+			problemDetails := models.ProblemDetails{
+				Status: http.StatusBadRequest,
+				Cause:  "MALFORMED_REQUEST",
+				Detail: err.Error(),
+			}
+			c.JSON(http.StatusBadRequest, problemDetails)
+			return
+		}
+	}
+
+	if err := capture.Start(filter); err != nil {
+		logger.ProducerLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+		return
+	}
+	c.JSON(http.StatusOK, capture.GetStatus())
+}
+
+func HTTPStopCapture(c *gin.Context) {
+	setCorsHeader(c)
+
+	status := capture.GetStatus()
+	capture.Stop()
+	status.Running = false
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package oam
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/ngap"
+	"github.com/omec-project/openapi/models"
+)
+
+// HTTPNGReset resets the NG interface of a gNB, a list of amfUeNgapId query
+// parameters resets only the connections of these UEs
+func HTTPNGReset(c *gin.Context) {
+	setCorsHeader(c)
+
+	gnbId, _ := c.Params.Get("gnbId")
+	var amfUeNgapIds []int64
+	for _, idStr := range c.QueryArray("amfUeNgapId") {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			problemDetails := models.ProblemDetails{
+				Status: http.StatusBadRequest,
+				Cause:  "INVALID_QUERY_PARAM",
+				Detail: "invalid amfUeNgapId " + idStr,
+			}
+			c.JSON(http.StatusBadRequest, problemDetails)
+			return
+		}
+		amfUeNgapIds = append(amfUeNgapIds, id)
+	}
+
+	if err := ngap.ResetRanByGnbId(gnbId, amfUeNgapIds); err != nil {
+		logger.ProducerLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusNotFound, problemDetails)
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
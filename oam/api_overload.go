@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/ngap"
+	"github.com/omec-project/openapi/models"
+)
+
+func HTTPGetOverloadStatus(c *gin.Context) {
+	setCorsHeader(c)
+
+	c.JSON(http.StatusOK, ngap.GetOverloadStatus())
+}
+
+// HTTPForceOverloadState sets the overload state to start, stop or auto
+func HTTPForceOverloadState(c *gin.Context) {
+	setCorsHeader(c)
+
+	state, _ := c.Params.Get("state")
+	if err := ngap.ForceOverloadState(state); err != nil {
+		logger.ProducerLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "INVALID_PARAM",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusBadRequest, problemDetails)
+		return
+	}
+	c.JSON(http.StatusOK, ngap.GetOverloadStatus())
+}
@@ -55,6 +55,8 @@ func AddService(engine *gin.Engine) *gin.RouterGroup {
 		switch route.Method {
 		case "GET":
 			group.GET(route.Pattern, route.HandlerFunc)
+		case "POST":
+			group.POST(route.Pattern, route.HandlerFunc)
 		case "DELETE":
 			group.DELETE(route.Pattern, route.HandlerFunc)
 		}
@@ -100,4 +102,40 @@ var routes = Routes{
 		"/active-ues",
 		HTTPGetActiveUes,
 	},
+	{
+		"Overload Status",
+		strings.ToUpper("get"),
+		"/overload",
+		HTTPGetOverloadStatus,
+	},
+	{
+		"Force Overload State",
+		strings.ToUpper("post"),
+		"/overload/:state",
+		HTTPForceOverloadState,
+	},
+	{
+		"NG Reset",
+		strings.ToUpper("post"),
+		"/ng-reset/:gnbId",
+		HTTPNGReset,
+	},
+	{
+		"NGAP Capture Status",
+		strings.ToUpper("get"),
+		"/capture",
+		HTTPGetCaptureStatus,
+	},
+	{
+		"Start NGAP Capture",
+		strings.ToUpper("post"),
+		"/capture/start",
+		HTTPStartCapture,
+	},
+	{
+		"Stop NGAP Capture",
+		strings.ToUpper("post"),
+		"/capture/stop",
+		HTTPStopCapture,
+	},
 }
@@ -7,9 +7,11 @@
 package producer
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/mohae/deepcopy"
 
@@ -44,6 +46,12 @@ func SmContextHandler(s1, s2 string, msg interface{}) (interface{}, string, inte
 	case models.TerminationNotification:
 		r1 := AmPolicyControlUpdateNotifyTerminateProcedure(s1, msg.(models.TerminationNotification))
 		return nil, "", r1, nil
+	case models.N2InformationNotification:
+		r1 := N2InfoNotifyProcedure(s1, msg.(models.N2InformationNotification))
+		return nil, "", r1, nil
+	case models.ModificationNotification:
+		r1 := SdmChangeNotifyProcedure(s1, msg.(models.ModificationNotification))
+		return nil, "", r1, nil
 	}
 
 	return nil, "", nil, nil
@@ -277,23 +285,13 @@ func AmPolicyControlUpdateNotifyUpdateProcedure(polAssoID string,
 				gmm_message.SendConfigurationUpdateCommand(ue, models.AccessType__3_GPP_ACCESS, nil)
 				// UE is CM-IDLE => paging
 			} else {
-				message, err := gmm_message.BuildConfigurationUpdateCommand(ue, models.AccessType__3_GPP_ACCESS, nil)
-				if err != nil {
-					logger.GmmLog.Errorf("Build Configuration Update Command Failed : %s", err.Error())
-					return
-				}
-
-				ue.ConfigurationUpdateMessage = message
+				// the Configuration Update Command is built when the UE is connected again
+				ue.ConfigurationUpdatePending = true
 				ue.SetOnGoing(models.AccessType__3_GPP_ACCESS, &context.OnGoing{
 					Procedure: context.OnGoingProcedurePaging,
 				})
 
-				pkg, err := ngap_message.BuildPaging(ue, nil, false)
-				if err != nil {
-					logger.NgapLog.Errorf("Build Paging failed : %s", err.Error())
-					return
-				}
-				ngap_message.SendPaging(ue, pkg)
+				ngap_message.SendPaging(ue, nil, false)
 			}
 		}()
 	}
@@ -435,3 +433,154 @@ func N1MessageNotifyProcedure(n1MessageNotify models.N1MessageNotify) *models.Pr
 	}()
 	return nil
 }
+
+// TS 23.502 4.9.1.3.3 step 6a: the target AMF notifies the source AMF of the N2 handover completion
+func HandleN2InfoNotify(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infoln("[AMF] Handle N2 Info Notify")
+
+	ueContextID := request.Params["ueContextId"]
+	n2InformationNotification := request.Body.(models.N2InformationNotification)
+
+	amfSelf := context.AMF_Self()
+	ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	sbiMsg := context.SbiMsg{
+		UeContextId: ueContextID,
+		ReqUri:      "",
+		Msg:         n2InformationNotification,
+		Result:      make(chan context.SbiResponseMsg, 10),
+	}
+	ue.EventChannel.UpdateSbiHandler(SmContextHandler)
+	ue.EventChannel.SubmitMessage(sbiMsg)
+	msg := <-sbiMsg.Result
+
+	if msg.ProblemDetails != nil {
+		if problemDetails := msg.ProblemDetails.(*models.ProblemDetails); problemDetails != nil {
+			return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+		}
+	}
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+func N2InfoNotifyProcedure(ueContextID string,
+	n2InformationNotification models.N2InformationNotification) *models.ProblemDetails {
+	ue, ok := context.AMF_Self().AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		return &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+	}
+	if n2InformationNotification.NotifyReason != models.N2InfoNotifyReason_HANDOVER_COMPLETED {
+		ue.ProducerLog.Warnf("N2 Info Notify reason[%s] is not supported", n2InformationNotification.NotifyReason)
+		return nil
+	}
+
+	ranUe := ue.RanUe[models.AccessType__3_GPP_ACCESS]
+	if ranUe == nil {
+		ue.ProducerLog.Warnln("Source RanUe not found, remove the UE context")
+		ue.Remove()
+		context.DeleteContextFromDB(ue)
+		return nil
+	}
+	// step 14: release the resources in the source RAN, the UE context is removed afterwards
+	ngap_message.SendUEContextReleaseCommand(ranUe, context.UeContextReleaseInterAmfHandover,
+		ngapType.CausePresentRadioNetwork, ngapType.CauseRadioNetworkPresentSuccessfulHandover)
+	return nil
+}
+
+// TS 29.503 5.2.2.5: Nudm_SDM_Notification of the changed access and mobility subscription data of the UE
+func HandleSdmChangeNotify(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infoln("[AMF] Handle SDM Change Notify")
+
+	supi := request.Params["supi"]
+	modificationNotification := request.Body.(models.ModificationNotification)
+
+	ue, ok := context.AMF_Self().AmfUeFindBySupi(supi)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+			Detail: fmt.Sprintf("Supi[%s] Not Found", supi),
+		}
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	sbiMsg := context.SbiMsg{
+		UeContextId: supi,
+		ReqUri:      "",
+		Msg:         modificationNotification,
+		Handler:     SmContextHandler,
+		Result:      make(chan context.SbiResponseMsg, 10),
+	}
+	ue.SetEventChannel(nil)
+	ue.EventChannel.SubmitMessage(sbiMsg)
+	msg := <-sbiMsg.Result
+
+	if msg.ProblemDetails != nil {
+		if problemDetails := msg.ProblemDetails.(*models.ProblemDetails); problemDetails != nil {
+			return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+		}
+	}
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+func SdmChangeNotifyProcedure(supi string,
+	modificationNotification models.ModificationNotification) *models.ProblemDetails {
+	ue, ok := context.AMF_Self().AmfUeFindBySupi(supi)
+	if !ok {
+		return &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+			Detail: fmt.Sprintf("Supi[%s] Not Found", supi),
+		}
+	}
+
+	for _, notifyItem := range modificationNotification.NotifyItems {
+		for _, change := range notifyItem.Changes {
+			if change.Op == models.ChangeType_REMOVE {
+				continue
+			}
+			var err error
+			switch strings.TrimPrefix(change.Path, "/") {
+			case "sorInfo":
+				sorInfo := new(models.SorInfo)
+				if err = decodeChangeValue(change.NewValue, sorInfo); err == nil {
+					ue.SorInfo = sorInfo
+				}
+			case "upuInfo":
+				upuInfo := new(models.UpuInfo)
+				if err = decodeChangeValue(change.NewValue, upuInfo); err == nil {
+					ue.UpuInfo = upuInfo
+				}
+			default:
+				ue.ProducerLog.Debugf("Change of %s%s is not handled", notifyItem.ResourceId, change.Path)
+			}
+			if err != nil {
+				ue.ProducerLog.Errorf("Decode %s of the SDM change notification failed: %+v", change.Path, err)
+			}
+		}
+	}
+
+	// a UE in CM-IDLE gets the SOR information and UPU data at its next registration, the procedure
+	// runs in the event loop of the UE, so the NAS COUNTs are not used concurrently
+	ranUe := ue.RanUe[models.AccessType__3_GPP_ACCESS]
+	if ranUe != nil && ue.State[models.AccessType__3_GPP_ACCESS].Is(context.Registered) {
+		gmm_message.SendSorTransparentContainer(ranUe)
+		gmm_message.SendUpuTransparentContainer(ranUe)
+	}
+	return nil
+}
+
+func decodeChangeValue(value interface{}, v interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
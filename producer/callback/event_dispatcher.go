@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package callback
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/omec-project/openapi/models"
+)
+
+// delivery of the event notifications, a notification is retried with an exponential backoff until the
+// maximum number of retries and is dead-lettered afterwards
+var (
+	eventNotifyTimeout        = 3 * time.Second
+	eventNotifyMaxRetries     = 5
+	eventNotifyInitialBackoff = 1 * time.Second
+	eventNotifyMaxBackoff     = 30 * time.Second
+	eventNotifyQueueSize      = 1024
+	eventDeadLetterSize       = 256
+)
+
+// EventDeadLetter is an event notification which could not be delivered to its subscriber
+type EventDeadLetter struct {
+	Uri          string
+	Notification models.AmfEventNotification
+	Reason       string
+	Time         time.Time
+}
+
+var (
+	eventNotifiersMu sync.Mutex
+	eventNotifiers   = make(map[string]*eventNotifier) // notify URI -> notifier
+	deadLettersMu    sync.Mutex
+	eventDeadLetters []EventDeadLetter
+)
+
+// eventNotifier delivers in order the notifications of a subscriber, it runs while notifications are pending
+// and is removed once its queue is drained
+type eventNotifier struct {
+	uri     string
+	pending []models.AmfEventNotification // guarded by eventNotifiersMu
+}
+
+// dispatchAmfEventNotification queues the notification for the subscriber of the notify URI
+func dispatchAmfEventNotification(uri string, notification models.AmfEventNotification) {
+	eventNotifiersMu.Lock()
+	defer eventNotifiersMu.Unlock()
+	n, ok := eventNotifiers[uri]
+	if !ok {
+		n = &eventNotifier{uri: uri}
+		eventNotifiers[uri] = n
+		go n.run()
+	}
+	if len(n.pending) >= eventNotifyQueueSize {
+		deadLetter(n.uri, notification, "notification queue is full")
+		return
+	}
+	n.pending = append(n.pending, notification)
+}
+
+func (n *eventNotifier) run() {
+	for {
+		eventNotifiersMu.Lock()
+		if len(n.pending) == 0 {
+			delete(eventNotifiers, n.uri)
+			eventNotifiersMu.Unlock()
+			return
+		}
+		notification := n.pending[0]
+		n.pending = n.pending[1:]
+		eventNotifiersMu.Unlock()
+
+		n.deliver(notification)
+	}
+}
+
+func (n *eventNotifier) deliver(notification models.AmfEventNotification) {
+	backoff := eventNotifyInitialBackoff
+	for retry := 0; ; retry++ {
+		retryable, err := sendAmfEventNotification(n.uri, notification)
+		if err == nil {
+			return
+		}
+		if !retryable {
+			deadLetter(n.uri, notification, err.Error())
+			return
+		}
+		if retry == eventNotifyMaxRetries {
+			deadLetter(n.uri, notification, fmt.Sprintf("%s after %d retries", err, retry))
+			return
+		}
+		HttpLog.Warnf("Send AMF Event Notification to %s failed[%v], retry in %s", n.uri, err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > eventNotifyMaxBackoff {
+			backoff = eventNotifyMaxBackoff
+		}
+	}
+}
+
+func deadLetter(uri string, notification models.AmfEventNotification, reason string) {
+	HttpLog.Errorf("AMF Event Notification[%s] to %s is dead-lettered: %s",
+		notification.NotifyCorrelationId, uri, reason)
+	deadLettersMu.Lock()
+	defer deadLettersMu.Unlock()
+	if len(eventDeadLetters) == eventDeadLetterSize {
+		eventDeadLetters = eventDeadLetters[1:]
+	}
+	eventDeadLetters = append(eventDeadLetters, EventDeadLetter{
+		Uri:          uri,
+		Notification: notification,
+		Reason:       reason,
+		Time:         time.Now().UTC(),
+	})
+}
+
+// EventDeadLetters returns the latest event notifications which could not be delivered
+func EventDeadLetters() []EventDeadLetter {
+	deadLettersMu.Lock()
+	defer deadLettersMu.Unlock()
+	return append([]EventDeadLetter(nil), eventDeadLetters...)
+}
+
+// sendAmfEventNotification posts the notification, the failure is retryable unless the subscriber rejects it
+func sendAmfEventNotification(uri string, notification models.AmfEventNotification) (retryable bool, err error) {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventNotifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// the request is bounded by the timeout of ctx
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer rsp.Body.Close()
+	switch {
+	case rsp.StatusCode == http.StatusNoContent || rsp.StatusCode == http.StatusOK:
+		return false, nil
+	case rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= http.StatusInternalServerError:
+		return true, fmt.Errorf("unexpected status %d", rsp.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected status %d", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package callback
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omec-project/openapi/models"
+)
+
+func TestEventNotificationRetry(t *testing.T) {
+	initialBackoff, maxRetries := eventNotifyInitialBackoff, eventNotifyMaxRetries
+	eventNotifyInitialBackoff = 10 * time.Millisecond
+	eventNotifyMaxRetries = 2
+	resetDeadLetters := func() {
+		deadLettersMu.Lock()
+		eventDeadLetters = nil
+		deadLettersMu.Unlock()
+	}
+	resetDeadLetters()
+	t.Cleanup(func() {
+		eventNotifyInitialBackoff, eventNotifyMaxRetries = initialBackoff, maxRetries
+		resetDeadLetters()
+	})
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	var delivered []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification models.AmfEventNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		id := notification.NotifyCorrelationId
+		attempts[id]++
+		switch {
+		case id == "rejected":
+			w.WriteHeader(http.StatusNotFound)
+		case id == "unavailable" || attempts[id] <= 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			delivered = append(delivered, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	for _, id := range []string{"first", "rejected", "unavailable", "second"} {
+		dispatchAmfEventNotification(server.URL, models.AmfEventNotification{NotifyCorrelationId: id})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := len(delivered) == 2
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the notifications are delivered in order after their retries
+	if len(delivered) != 2 || delivered[0] != "first" || delivered[1] != "second" {
+		t.Fatalf("Delivered notifications, want: [first second], got: %v", delivered)
+	}
+	if attempts["rejected"] != 1 {
+		t.Errorf("Rejected notification is retried: %d attempts", attempts["rejected"])
+	}
+	if attempts["unavailable"] != 3 {
+		t.Errorf("Attempts of the undeliverable notification, want: 3, got: %d", attempts["unavailable"])
+	}
+
+	deadLetters := EventDeadLetters()
+	if len(deadLetters) != 2 || deadLetters[0].Notification.NotifyCorrelationId != "rejected" ||
+		deadLetters[1].Notification.NotifyCorrelationId != "unavailable" {
+		t.Errorf("Unexpected dead letters: %+v", deadLetters)
+	}
+
+	// the notifier of the subscriber is removed once its queue is drained
+	for time.Now().Before(deadline) {
+		eventNotifiersMu.Lock()
+		_, ok := eventNotifiers[server.URL]
+		eventNotifiersMu.Unlock()
+		if !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Idle notifier is not removed")
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2021 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package callback
+
+import (
+	"time"
+
+	amf_context "github.com/omec-project/amf/context"
+	"github.com/omec-project/openapi/models"
+)
+
+// SendAmfEventReport notifies the subscribers of the UE which subscribed to the type of the report and whose
+// event filter matches the UE (Namf_EventExposure_Notify, TS 29.518 5.3.2.4)
+func SendAmfEventReport(ue *amf_context.AmfUe, report models.AmfEventReport) {
+	for subscriptionID, ueSubscription := range ue.EventSubscriptionsInfo {
+		event, ok := ueSubscription.FindEvent(report.Type)
+		if !ok || !ue.MatchAmfEvent(event, ueSubscription.EventSnssais[report.Type]) {
+			continue
+		}
+		SendUeEventReport(ue, subscriptionID, report)
+	}
+}
+
+// SendUeEventReport sends the report to a subscription of the UE, the subscription related fields of the
+// report are filled here. The subscription of the UE ends with its last report
+func SendUeEventReport(ue *amf_context.AmfUe, subscriptionID string, report models.AmfEventReport) {
+	ueSubscription, ok := ue.EventSubscriptionsInfo[subscriptionID]
+	if !ok {
+		return
+	}
+	subscription := ueSubscription.EventSubscription
+	if subscription == nil || subscription.EventNotifyUri == "" || !ueSubscription.State().Active {
+		return
+	}
+
+	ueReport := report
+	ueReport.AnyUe = ueSubscription.AnyUe
+	ueReport.Supi = ue.Supi
+	ueReport.SubscriptionId = subscriptionID
+	if ueReport.TimeStamp == nil {
+		now := time.Now().UTC()
+		ueReport.TimeStamp = &now
+	}
+	ueReport.State = ueSubscription.CountReport()
+	if !ueReport.State.Active {
+		endUeEventSubscription(ue, subscriptionID)
+	}
+
+	notification := models.AmfEventNotification{
+		NotifyCorrelationId: subscription.NotifyCorrelationId,
+		ReportList:          []models.AmfEventReport{ueReport},
+	}
+	HttpLog.Infof("Send AMF Event Report[%s] of UE[%s] to %s", report.Type, ue.Supi, subscription.EventNotifyUri)
+	dispatchAmfEventNotification(subscription.EventNotifyUri, notification)
+}
+
+// endUeEventSubscription removes the subscription of the UE, a subscription for a single UE is deleted with it
+func endUeEventSubscription(ue *amf_context.AmfUe, subscriptionID string) {
+	delete(ue.EventSubscriptionsInfo, subscriptionID)
+	amfSelf := amf_context.AMF_Self()
+	if subscription, ok := amfSelf.FindEventSubscription(subscriptionID); ok &&
+		!subscription.IsAnyUe && !subscription.IsGroupUe {
+		amfSelf.DeleteEventSubscription(subscriptionID)
+	}
+}
+
+// JoinEventSubscriptions adds a UE registering with the AMF to the subscriptions for any UE and to the
+// subscriptions of its groups, the subscribers for any UE are told of the UE with SUBSCRIPTION_ID_ADDITION
+func JoinEventSubscriptions(ue *amf_context.AmfUe) {
+	amf_context.AMF_Self().EventSubscriptions.Range(func(key, value interface{}) bool {
+		subscriptionID := key.(string)
+		subscription := value.(*amf_context.AMFContextEventSubscription)
+		if !subscription.IsAnyUe && !subscription.HasGroupMember(ue) {
+			return true
+		}
+		// a UE context created again, e.g. after the UE context was removed, joins again
+		if _, ok := ue.EventSubscriptionsInfo[subscriptionID]; ok {
+			return true
+		}
+		added := subscription.AddUeSupi(ue.Supi)
+		HttpLog.Infof("UE[%s] joins AMF Event Subscription[%s]", ue.Supi, subscriptionID)
+		ue.AddEventSubscription(subscriptionID, subscription)
+		// the subscriber is already told of a UE listed in the subscription
+		if added && subscription.IsAnyUe {
+			SendSubscriptionIdAddition(ue, subscriptionID)
+		}
+		return true
+	})
+}
+
+// SendSubscriptionIdAddition notifies the subscriber that the UE is added to its subscription, the
+// notification is not accounted as a report of the subscription
+func SendSubscriptionIdAddition(ue *amf_context.AmfUe, subscriptionID string) {
+	ueSubscription, ok := ue.EventSubscriptionsInfo[subscriptionID]
+	if !ok || ueSubscription.EventSubscription == nil || ueSubscription.EventSubscription.EventNotifyUri == "" {
+		return
+	}
+	subscription := ueSubscription.EventSubscription
+	now := time.Now().UTC()
+	notification := models.AmfEventNotification{
+		NotifyCorrelationId: subscription.NotifyCorrelationId,
+		ReportList: []models.AmfEventReport{{
+			Type:           models.AmfEventType_SUBSCRIPTION_ID_ADDITION,
+			State:          ueSubscription.State(),
+			TimeStamp:      &now,
+			SubscriptionId: subscriptionID,
+			AnyUe:          true,
+			Supi:           ue.Supi,
+		}},
+	}
+	HttpLog.Infof("Send AMF Event Report[%s] of UE[%s] to %s", models.AmfEventType_SUBSCRIPTION_ID_ADDITION,
+		ue.Supi, subscription.EventNotifyUri)
+	dispatchAmfEventNotification(subscription.EventNotifyUri, notification)
+}
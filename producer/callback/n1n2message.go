@@ -140,9 +140,7 @@ func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass,
 			n2InformationNotify := models.N2InfoNotifyRequest{
 				JsonData: &models.N2InformationNotification{
 					N2NotifySubscriptionId: strconv.Itoa(int(subscriptionID)),
-					N2InfoContainer: &models.N2InfoContainer{
-						N2InformationClass: n2class,
-					},
+					N2InfoContainer:        buildN2InfoContainer(n2class),
 				},
 				BinaryDataN1Message:     n1Msg,
 				BinaryDataN2Information: n2Msg,
@@ -150,40 +148,6 @@ func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass,
 			if n2Msg == nil {
 				HttpLog.Errorln("Send N2 Info Notify Error(N2 Info does not exist)")
 			}
-			switch n2class {
-			case models.N2InformationClass_SM:
-				n2InformationNotify.JsonData.N2InfoContainer.SmInfo = &models.N2SmInformation{
-					N2InfoContent: &models.N2InfoContent{
-						NgapData: &models.RefToBinaryData{
-							ContentId: "n2Info",
-						},
-					},
-				}
-			case models.N2InformationClass_NRP_PA:
-				n2InformationNotify.JsonData.N2InfoContainer.NrppaInfo = &models.NrppaInformation{
-					NrppaPdu: &models.N2InfoContent{
-						NgapData: &models.RefToBinaryData{
-							ContentId: "n2Info",
-						},
-					},
-				}
-			case models.N2InformationClass_PWS, models.N2InformationClass_PWS_BCAL, models.N2InformationClass_PWS_RF:
-				n2InformationNotify.JsonData.N2InfoContainer.PwsInfo = &models.PwsInformation{
-					PwsContainer: &models.N2InfoContent{
-						NgapData: &models.RefToBinaryData{
-							ContentId: "n2Info",
-						},
-					},
-				}
-			case models.N2InformationClass_RAN:
-				n2InformationNotify.JsonData.N2InfoContainer.RanInfo = &models.N2RanInformation{
-					N2InfoContent: &models.N2InfoContent{
-						NgapData: &models.RefToBinaryData{
-							ContentId: "n2Info",
-						},
-					},
-				}
-			}
 
 			httpResponse, err := client.N2InfoNotifyCallbackDocumentApiServiceCallbackDocumentApi.
 				N2InfoNotify(context.Background(), subscription.N2NotifyCallbackUri, n2InformationNotify)
@@ -198,3 +162,181 @@ func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass,
 		return true
 	})
 }
+
+// TS 23.273 6.11.1: the uplink LPP messages of a positioning session are notified to the default
+// notification subscription of the LMF serving it, otherwise to the NFs which subscribed to them
+func SendLcsN1MessageNotify(ue *amf_context.AmfUe, n1Msg []byte) {
+	callbackUri := lmfNotificationUri(ue, models.NotificationType_N1_MESSAGES)
+	if callbackUri == "" {
+		SendN1MessageNotify(ue, models.N1MessageClass_LPP, n1Msg, nil)
+		return
+	}
+	session, _ := ue.LcsSession()
+
+	configuration := Namf_Communication.NewConfiguration()
+	client := Namf_Communication.NewAPIClient(configuration)
+
+	n1MessageNotify := models.N1MessageNotify{
+		JsonData: &models.N1MessageNotification{
+			N1MessageContainer: &models.N1MessageContainer{
+				N1MessageClass: models.N1MessageClass_LPP,
+				N1MessageContent: &models.RefToBinaryData{
+					ContentId: "n1Msg",
+				},
+			},
+			LcsCorrelationId: session.CorrelationId,
+		},
+		BinaryDataN1Message: n1Msg,
+	}
+
+	httpResponse, err := client.N1MessageNotifyCallbackDocumentApiServiceCallbackDocumentApi.
+		N1MessageNotify(context.Background(), callbackUri, n1MessageNotify)
+	if err != nil {
+		if httpResponse == nil {
+			HttpLog.Errorln(err.Error())
+		} else if err.Error() != httpResponse.Status {
+			HttpLog.Errorln(err.Error())
+		}
+	}
+}
+
+// TS 23.273 6.11.1: the uplink UE associated NRPPa PDUs are notified the same way as the LPP messages,
+// with the NF ID of the LMF carried in the Routing ID
+func SendLcsN2InfoNotify(ue *amf_context.AmfUe, n2Msg []byte, nfId string) {
+	callbackUri := lmfNotificationUri(ue, models.NotificationType_N2_INFORMATION)
+	if callbackUri == "" {
+		SendN2InfoNotify(ue, models.N2InformationClass_NRP_PA, nil, n2Msg)
+		return
+	}
+	session, _ := ue.LcsSession()
+
+	configuration := Namf_Communication.NewConfiguration()
+	client := Namf_Communication.NewAPIClient(configuration)
+
+	n2InformationNotify := models.N2InfoNotifyRequest{
+		JsonData: &models.N2InformationNotification{
+			N2InfoContainer:  buildN2InfoContainer(models.N2InformationClass_NRP_PA),
+			LcsCorrelationId: session.CorrelationId,
+		},
+		BinaryDataN2Information: n2Msg,
+	}
+	n2InformationNotify.JsonData.N2InfoContainer.NrppaInfo.NfId = nfId
+
+	httpResponse, err := client.N2InfoNotifyCallbackDocumentApiServiceCallbackDocumentApi.
+		N2InfoNotify(context.Background(), callbackUri, n2InformationNotify)
+	if err != nil {
+		if httpResponse == nil {
+			HttpLog.Errorln(err.Error())
+		} else if err.Error() != httpResponse.Status {
+			HttpLog.Errorln(err.Error())
+		}
+	}
+}
+
+func lmfNotificationUri(ue *amf_context.AmfUe, notificationType models.NotificationType) string {
+	session, ok := ue.LcsSession()
+	if !ok || session.LmfProfile == nil {
+		return ""
+	}
+	for _, subscription := range session.LmfProfile.DefaultNotificationSubscriptions {
+		if subscription.NotificationType != notificationType {
+			continue
+		}
+		if notificationType == models.NotificationType_N1_MESSAGES &&
+			subscription.N1MessageClass != models.N1MessageClass_LPP {
+			continue
+		}
+		if notificationType == models.NotificationType_N2_INFORMATION &&
+			subscription.N2InformationClass != models.N2InformationClass_NRP_PA {
+			continue
+		}
+		return subscription.CallbackUri
+	}
+	return ""
+}
+
+// TS 29.518 5.2.2.4.4: the uplink non UE associated N2 information is notified to the NFs which
+// subscribed to its class, an NRPPa message only to the LMF identified by the Routing ID
+func SendNonUeN2InfoNotify(ran *amf_context.AmfRan, n2class models.N2InformationClass, n2Info []byte, nfId string) {
+	amf_context.AMF_Self().NonUeN2InfoSubscriptions.Range(func(key, value interface{}) bool {
+		subscriptionID := key.(string)
+		subscription := value.(models.NonUeN2InfoSubscriptionCreateData)
+
+		if subscription.N2NotifyCallbackUri == "" || subscription.N2InformationClass != n2class {
+			return true
+		}
+		if n2class == models.N2InformationClass_NRP_PA && subscription.NfId != "" && subscription.NfId != nfId {
+			return true
+		}
+		if len(subscription.GlobalRanNodeList) > 0 && !ran.InRanNodeList(subscription.GlobalRanNodeList) {
+			return true
+		}
+		if len(subscription.AnTypeList) > 0 && !accessTypeIncluded(subscription.AnTypeList, ran.AnType) {
+			return true
+		}
+
+		configuration := Namf_Communication.NewConfiguration()
+		client := Namf_Communication.NewAPIClient(configuration)
+
+		n2InformationNotify := models.N2InfoNotifyRequest{
+			JsonData: &models.N2InformationNotification{
+				N2NotifySubscriptionId: subscriptionID,
+				N2InfoContainer:        buildN2InfoContainer(n2class),
+			},
+			BinaryDataN2Information: n2Info,
+		}
+		if n2class == models.N2InformationClass_NRP_PA {
+			n2InformationNotify.JsonData.N2InfoContainer.NrppaInfo.NfId = nfId
+		}
+
+		httpResponse, err := client.N2InfoNotifyCallbackDocumentApiServiceCallbackDocumentApi.
+			N2InfoNotify(context.Background(), subscription.N2NotifyCallbackUri, n2InformationNotify)
+		if err != nil {
+			if httpResponse == nil {
+				HttpLog.Errorln(err.Error())
+			} else if err.Error() != httpResponse.Status {
+				HttpLog.Errorln(err.Error())
+			}
+		}
+		return true
+	})
+}
+
+func buildN2InfoContainer(n2class models.N2InformationClass) *models.N2InfoContainer {
+	n2InfoContainer := &models.N2InfoContainer{
+		N2InformationClass: n2class,
+	}
+	n2InfoContent := &models.N2InfoContent{
+		NgapData: &models.RefToBinaryData{
+			ContentId: "n2Info",
+		},
+	}
+	switch n2class {
+	case models.N2InformationClass_SM:
+		n2InfoContainer.SmInfo = &models.N2SmInformation{
+			N2InfoContent: n2InfoContent,
+		}
+	case models.N2InformationClass_NRP_PA:
+		n2InfoContainer.NrppaInfo = &models.NrppaInformation{
+			NrppaPdu: n2InfoContent,
+		}
+	case models.N2InformationClass_PWS, models.N2InformationClass_PWS_BCAL, models.N2InformationClass_PWS_RF:
+		n2InfoContainer.PwsInfo = &models.PwsInformation{
+			PwsContainer: n2InfoContent,
+		}
+	case models.N2InformationClass_RAN:
+		n2InfoContainer.RanInfo = &models.N2RanInformation{
+			N2InfoContent: n2InfoContent,
+		}
+	}
+	return n2InfoContainer
+}
+
+func accessTypeIncluded(anTypeList []models.AccessType, anType models.AccessType) bool {
+	for _, accessType := range anTypeList {
+		if accessType == anType {
+			return true
+		}
+	}
+	return false
+}
@@ -15,7 +15,8 @@ import (
 	"github.com/omec-project/openapi/models"
 )
 
-func SendAmfStatusChangeNotify(amfStatus string, guamiList []models.Guami) {
+// targetAmf is the AMF which takes over the GUAMIs (TS 29.518 6.1.6.2.19), may be empty
+func SendAmfStatusChangeNotify(amfStatus string, guamiList []models.Guami, targetAmf string) {
 	amfSelf := amf_context.AMF_Self()
 
 	amfSelf.AMFStatusSubscriptions.Range(func(key, value interface{}) bool {
@@ -35,11 +36,8 @@ func SendAmfStatusChangeNotify(amfStatus string, guamiList []models.Guami) {
 			}
 		}
 
-		amfStatusInfo = models.AmfStatusInfo{
-			StatusChange:     (models.StatusChange)(amfStatus),
-			TargetAmfRemoval: "",
-			TargetAmfFailure: "",
-		}
+		amfStatusInfo.StatusChange = (models.StatusChange)(amfStatus)
+		amfStatusInfo.TargetAmfRemoval = targetAmf
 
 		amfStatusNotification.AmfStatusInfoList = append(amfStatusNotification.AmfStatusInfoList, amfStatusInfo)
 		uri := subscriptionData.AmfStatusUri
@@ -10,16 +10,32 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/mohae/deepcopy"
+
+	"github.com/omec-project/amf/consumer"
 	"github.com/omec-project/amf/context"
 	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/producer/callback"
 	"github.com/omec-project/http_wrapper"
 	"github.com/omec-project/openapi/models"
 )
 
+func init() {
+	context.UeLocationHandler = HandleUeLocationUpdate
+}
+
+// AmfCreateEventSubscriptionRequest is the body of a Subscribe request, the S-NSSAIs of the areas of interest
+// of the events (TS 29.518 6.2.6.2.16) are decoded aside as the AmfEventArea model has no S-NSSAI
+type AmfCreateEventSubscriptionRequest struct {
+	CreateEventSubscription models.AmfCreateEventSubscription
+	EventSnssais            map[models.AmfEventType][]models.Snssai
+}
+
 func HandleCreateAMFEventSubscription(request *http_wrapper.Request) *http_wrapper.Response {
-	createEventSubscription := request.Body.(models.AmfCreateEventSubscription)
+	createRequest := request.Body.(AmfCreateEventSubscriptionRequest)
 
-	createdEventSubscription, problemDetails := CreateAMFEventSubscriptionProcedure(createEventSubscription)
+	createdEventSubscription, problemDetails := CreateAMFEventSubscriptionProcedure(
+		createRequest.CreateEventSubscription, createRequest.EventSnssais)
 	if createdEventSubscription != nil {
 		return http_wrapper.NewResponse(http.StatusCreated, nil, createdEventSubscription)
 	} else if problemDetails != nil {
@@ -33,18 +49,24 @@ func HandleCreateAMFEventSubscription(request *http_wrapper.Request) *http_wrapp
 	}
 }
 
-// TODO: handle event filter
-func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreateEventSubscription) (
+func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreateEventSubscription,
+	eventSnssais map[models.AmfEventType][]models.Snssai) (
 	*models.AmfCreatedEventSubscription, *models.ProblemDetails) {
 	amfSelf := context.AMF_Self()
 
-	createdEventSubscription := &models.AmfCreatedEventSubscription{}
 	subscription := createEventSubscription.Subscription
-	contextEventSubscription := &context.AMFContextEventSubscription{}
+	if subscription == nil || subscription.EventList == nil || len(*subscription.EventList) == 0 {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "Event list is missing",
+		}
+		return nil, problemDetails
+	}
+	contextEventSubscription := &context.AMFContextEventSubscription{
+		EventSnssais: eventSnssais,
+	}
 	contextEventSubscription.EventSubscription = *subscription
-	var isImmediate bool
-	var immediateFlags []bool
-	var reportlist []models.AmfEventReport
 
 	id, err := amfSelf.EventSubscriptionIDGenerator.Allocate()
 	if err != nil {
@@ -56,139 +78,207 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 	}
 	newSubscriptionID := strconv.Itoa(int(id))
 
-	// store subscription in context
-	ueEventSubscription := context.AmfUeEventSubscription{}
-	ueEventSubscription.EventSubscription = &contextEventSubscription.EventSubscription
-	ueEventSubscription.Timestamp = time.Now().UTC()
-
-	if subscription.Options != nil && subscription.Options.Trigger == models.AmfEventTrigger_CONTINUOUS {
-		ueEventSubscription.RemainReports = new(int32)
-		*ueEventSubscription.RemainReports = subscription.Options.MaxReports
-	}
-	for _, events := range *subscription.EventList {
-		immediateFlags = append(immediateFlags, events.ImmediateFlag)
-		if events.ImmediateFlag {
-			isImmediate = true
-		}
-	}
-
+	var ueList []*context.AmfUe
 	if subscription.AnyUE {
 		contextEventSubscription.IsAnyUe = true
-		ueEventSubscription.AnyUe = true
 		amfSelf.UePool.Range(func(key, value interface{}) bool {
-			ue := value.(*context.AmfUe)
-			ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-			*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
-			contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
+			ueList = append(ueList, value.(*context.AmfUe))
 			return true
 		})
 	} else if subscription.GroupId != "" {
 		contextEventSubscription.IsGroupUe = true
-		ueEventSubscription.AnyUe = true
+		// the members are resolved by the UDM, the UEs registering later are matched with their group IDs
+		if supis, err := consumer.SDMGetGroupMembers(subscription.GroupId); err != nil {
+			logger.EeLog.Warnf("Members of group[%s] cannot be resolved by the UDM: %+v", subscription.GroupId, err)
+		} else {
+			contextEventSubscription.GroupSupis = supis
+		}
 		amfSelf.UePool.Range(func(key, value interface{}) bool {
-			ue := value.(*context.AmfUe)
-			if ue.GroupID == subscription.GroupId {
-				ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-				*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
-				contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
+			if ue := value.(*context.AmfUe); contextEventSubscription.HasGroupMember(ue) {
+				ueList = append(ueList, ue)
 			}
 			return true
 		})
 	} else {
-		if ue, ok := amfSelf.AmfUeFindBySupi(subscription.Supi); !ok {
+		ue, ok := amfSelf.AmfUeFindBySupi(subscription.Supi)
+		if !ok {
+			amfSelf.EventSubscriptionIDGenerator.FreeID(id)
 			problemDetails := &models.ProblemDetails{
 				Status: http.StatusForbidden,
 				Cause:  "UE_NOT_SERVED_BY_AMF",
 			}
 			return nil, problemDetails
-		} else {
-			ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-			*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
-			contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
 		}
+		ueList = append(ueList, ue)
 	}
 
-	// delete subscription
+	// store subscription in context
+	for _, ue := range ueList {
+		ue.AddEventSubscription(newSubscriptionID, contextEventSubscription)
+		contextEventSubscription.AddUeSupi(ue.Supi)
+	}
 	if subscription.Options != nil {
 		contextEventSubscription.Expiry = subscription.Options.Expiry
 	}
 	amfSelf.NewEventSubscription(newSubscriptionID, contextEventSubscription)
 
 	// build response
+	createdEventSubscription := &models.AmfCreatedEventSubscription{
+		Subscription:   subscription,
+		SubscriptionId: newSubscriptionID,
+	}
 
-	createdEventSubscription.Subscription = subscription
-	createdEventSubscription.SubscriptionId = newSubscriptionID
-
-	// for immediate use
-	if subscription.AnyUE {
-		amfSelf.UePool.Range(func(key, value interface{}) bool {
-			ue := value.(*context.AmfUe)
-			if isImmediate {
-				subReports(ue, newSubscriptionID)
+	// the immediate reports are returned in the response and count as reports of the subscription
+	for _, ue := range ueList {
+		for i := range *subscription.EventList {
+			event := &(*subscription.EventList)[i]
+			ueSubscription, ok := ue.EventSubscriptionsInfo[newSubscriptionID]
+			if !ok {
+				break
 			}
-			for i, flag := range immediateFlags {
-				if flag {
-					report, ok := NewAmfEventReport(ue, (*subscription.EventList)[i].Type, newSubscriptionID)
-					if ok {
-						reportlist = append(reportlist, report)
-					}
-				}
+			if !event.ImmediateFlag || !ue.MatchAmfEvent(event, eventSnssais[event.Type]) {
+				continue
 			}
-			// delete subscription
-			if reportlistLen := len(reportlist); reportlistLen > 0 && (!reportlist[reportlistLen-1].State.Active) {
+			report, ok := NewAmfEventReport(ue, event.Type, newSubscriptionID)
+			if !ok {
+				continue
+			}
+			report.State = ueSubscription.CountReport()
+			if !report.State.Active {
 				delete(ue.EventSubscriptionsInfo, newSubscriptionID)
 			}
-			return true
+			createdEventSubscription.ReportList = append(createdEventSubscription.ReportList, report)
+		}
+	}
+
+	// a subscription for a single UE ends with its last immediate report
+	if !subscription.AnyUE && subscription.GroupId == "" {
+		if _, ok := ueList[0].EventSubscriptionsInfo[newSubscriptionID]; !ok {
+			amfSelf.DeleteEventSubscription(newSubscriptionID)
+			return createdEventSubscription, nil
+		}
+	}
+	scheduleEventSubscription(newSubscriptionID, contextEventSubscription)
+
+	return createdEventSubscription, nil
+}
+
+// scheduleEventSubscription enforces the expiry of the subscription and sends the reports of a periodic
+// subscription (TS 29.518 6.2.6.2.5)
+func scheduleEventSubscription(subscriptionID string, subscription *context.AMFContextEventSubscription) {
+	scheduleEventSubscriptionExpiry(subscriptionID, subscription)
+
+	options := subscription.EventSubscription.Options
+	if options != nil && options.Trigger == models.AmfEventTrigger_PERIODIC && options.RepPeriod > 0 {
+		subscription.StartPeriodicReports(time.Duration(options.RepPeriod)*time.Second, func() {
+			submitPeriodicReports(subscriptionID, subscription)
 		})
-	} else if subscription.GroupId != "" {
-		amfSelf.UePool.Range(func(key, value interface{}) bool {
-			ue := value.(*context.AmfUe)
-			if isImmediate {
-				subReports(ue, newSubscriptionID)
+	}
+}
+
+func scheduleEventSubscriptionExpiry(subscriptionID string, subscription *context.AMFContextEventSubscription) {
+	subscription.StartExpiryTimer(func() {
+		logger.EeLog.Infof("AMF Event Subscription[%s] expired", subscriptionID)
+		// the UEs leave the subscription in their event loops, which own their event subscriptions
+		submitToSubscribedUes(subscriptionID, subscription, eventSubscriptionExpiry{})
+		context.AMF_Self().DeleteEventSubscription(subscriptionID)
+	})
+}
+
+// periodicEventReport and eventSubscriptionExpiry are handled in the event loop of the UE, which owns its
+// event subscriptions
+type (
+	periodicEventReport     struct{}
+	eventSubscriptionExpiry struct{}
+)
+
+func EventExposureHandler(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
+	ue, ok := context.AMF_Self().AmfUeFindBySupi(s1)
+	if !ok {
+		return nil, "", nil, nil
+	}
+	switch msg.(type) {
+	case periodicEventReport:
+		sendPeriodicReports(ue, s2)
+	case eventSubscriptionExpiry:
+		delete(ue.EventSubscriptionsInfo, s2)
+	}
+	return nil, "", nil, nil
+}
+
+func submitPeriodicReports(subscriptionID string, subscription *context.AMFContextEventSubscription) {
+	submitToSubscribedUes(subscriptionID, subscription, periodicEventReport{})
+}
+
+// submitToSubscribedUes submits the message to the event loop of every UE of the subscription
+func submitToSubscribedUes(subscriptionID string, subscription *context.AMFContextEventSubscription,
+	msg interface{}) {
+	amfSelf := context.AMF_Self()
+	for _, supi := range subscription.UeSupis() {
+		ue, ok := amfSelf.AmfUeFindBySupi(supi)
+		if !ok {
+			continue
+		}
+		sbiMsg := context.SbiMsg{
+			UeContextId: supi,
+			ReqUri:      subscriptionID,
+			Msg:         msg,
+			Handler:     EventExposureHandler,
+			Result:      make(chan context.SbiResponseMsg, 1),
+		}
+		ue.SetEventChannel(nil)
+		ue.EventChannel.SubmitMessage(sbiMsg)
+	}
+}
+
+// sendPeriodicReports reports all the events of the subscription matching the UE
+func sendPeriodicReports(ue *context.AmfUe, subscriptionID string) {
+	ueSubscription, ok := ue.EventSubscriptionsInfo[subscriptionID]
+	if !ok {
+		return
+	}
+	for i := range *ueSubscription.EventSubscription.EventList {
+		event := &(*ueSubscription.EventSubscription.EventList)[i]
+		if !ue.MatchAmfEvent(event, ueSubscription.EventSnssais[event.Type]) {
+			continue
+		}
+		if report, ok := NewAmfEventReport(ue, event.Type, subscriptionID); ok {
+			callback.SendUeEventReport(ue, subscriptionID, report)
+		}
+	}
+}
+
+// HandleUeLocationUpdate reports the location and the presence in the areas of interest of the UE to the
+// subscriptions whose last report is outdated by the location update, the periodic subscriptions only
+// report on their period
+func HandleUeLocationUpdate(ue *context.AmfUe) {
+	for subscriptionID, ueSubscription := range ue.EventSubscriptionsInfo {
+		if options := ueSubscription.EventSubscription.Options; options != nil &&
+			options.Trigger == models.AmfEventTrigger_PERIODIC {
+			continue
+		}
+		for _, eventType := range []models.AmfEventType{
+			models.AmfEventType_LOCATION_REPORT, models.AmfEventType_PRESENCE_IN_AOI_REPORT,
+		} {
+			event, ok := ueSubscription.FindEvent(eventType)
+			if !ok || !ue.MatchAmfEvent(event, ueSubscription.EventSnssais[eventType]) {
+				continue
 			}
-			if ue.GroupID == subscription.GroupId {
-				for i, flag := range immediateFlags {
-					if flag {
-						report, ok := NewAmfEventReport(ue, (*subscription.EventList)[i].Type, newSubscriptionID)
-						if ok {
-							reportlist = append(reportlist, report)
-						}
-					}
+			switch eventType {
+			case models.AmfEventType_LOCATION_REPORT:
+				if !ue.LocationChangedSince(ueSubscription.ReportedLocation, event.LocationFilterList) {
+					continue
 				}
-				// delete subscription
-				if reportlistLen := len(reportlist); reportlistLen > 0 && (!reportlist[reportlistLen-1].State.Active) {
-					delete(ue.EventSubscriptionsInfo, newSubscriptionID)
+			case models.AmfEventType_PRESENCE_IN_AOI_REPORT:
+				if ue.AoiPresenceState(event.AreaList) == ueSubscription.AoiPresence {
+					continue
 				}
 			}
-			return true
-		})
-	} else {
-		ue, _ := amfSelf.AmfUeFindBySupi(subscription.Supi)
-		if isImmediate {
-			subReports(ue, newSubscriptionID)
-		}
-		for i, flag := range immediateFlags {
-			if flag {
-				report, ok := NewAmfEventReport(ue, (*subscription.EventList)[i].Type, newSubscriptionID)
-				if ok {
-					reportlist = append(reportlist, report)
-				}
+			if report, ok := NewAmfEventReport(ue, eventType, subscriptionID); ok {
+				callback.SendUeEventReport(ue, subscriptionID, report)
 			}
 		}
-		// delete subscription
-		if reportlistLen := len(reportlist); reportlistLen > 0 && (!reportlist[reportlistLen-1].State.Active) {
-			delete(ue.EventSubscriptionsInfo, newSubscriptionID)
-		}
-	}
-	if len(reportlist) > 0 {
-		createdEventSubscription.ReportList = reportlist
-		// delete subscription
-		if !reportlist[0].State.Active {
-			amfSelf.DeleteEventSubscription(newSubscriptionID)
-		}
 	}
-
-	return createdEventSubscription, nil
 }
 
 func HandleDeleteAMFEventSubscription(request *http_wrapper.Request) *http_wrapper.Response {
@@ -216,7 +306,7 @@ func DeleteAMFEventSubscriptionProcedure(subscriptionID string) *models.ProblemD
 		return problemDetails
 	}
 
-	for _, supi := range subscription.UeSupiList {
+	for _, supi := range subscription.UeSupis() {
 		if ue, ok := amfSelf.AmfUeFindBySupi(supi); ok {
 			delete(ue.EventSubscriptionsInfo, subscriptionID)
 		}
@@ -263,6 +353,11 @@ func ModifyAMFEventSubscriptionProcedure(
 
 	if modifySubscriptionRequest.OptionItem != nil {
 		contextSubscription.Expiry = modifySubscriptionRequest.OptionItem.Value
+		if contextSubscription.EventSubscription.Options == nil {
+			contextSubscription.EventSubscription.Options = new(models.AmfEventMode)
+		}
+		contextSubscription.EventSubscription.Options.Expiry = contextSubscription.Expiry
+		scheduleEventSubscriptionExpiry(subscriptionID, contextSubscription)
 	} else if modifySubscriptionRequest.SubscriptionItemInner != nil {
 		subscription := &contextSubscription.EventSubscription
 		if !contextSubscription.IsAnyUe && !contextSubscription.IsGroupUe {
@@ -307,15 +402,9 @@ func ModifyAMFEventSubscriptionProcedure(
 	return updatedEventSubscription, nil
 }
 
-func subReports(ue *context.AmfUe, subscriptionId string) {
-	remainReport := ue.EventSubscriptionsInfo[subscriptionId].RemainReports
-	if remainReport == nil {
-		return
-	}
-	*remainReport--
-}
-
-// DO NOT handle AmfEventType_PRESENCE_IN_AOI_REPORT and AmfEventType_UES_IN_AREA_REPORT(about area)
+// NewAmfEventReport builds the report of the event for the subscription of the UE, the location and the presence
+// in the areas of interest reported are kept as reference for the later reports.
+// DO NOT handle AmfEventType_UES_IN_AREA_REPORT(about area)
 func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscriptionId string) (
 	report models.AmfEventReport, ok bool) {
 	ueSubscription, ok := ue.EventSubscriptionsInfo[subscriptionId]
@@ -327,26 +416,18 @@ func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscription
 	report.Supi = ue.Supi
 	report.Type = Type
 	report.TimeStamp = &ueSubscription.Timestamp
-	report.State = new(models.AmfEventState)
-	mode := ueSubscription.EventSubscription.Options
-	if mode == nil {
-		report.State.Active = true
-	} else if mode.Trigger == models.AmfEventTrigger_ONE_TIME {
-		report.State.Active = false
-	} else if *ueSubscription.RemainReports <= 0 {
-		report.State.Active = false
-	} else {
-		report.State.Active = getDuration(mode.Expiry, &report.State.RemainDuration)
-		if report.State.Active {
-			report.State.RemainReports = *ueSubscription.RemainReports
-		}
-	}
+	report.State = ueSubscription.State()
 
 	switch Type {
 	case models.AmfEventType_LOCATION_REPORT:
-		report.Location = &ue.Location
-	// case models.AmfEventType_PRESENCE_IN_AOI_REPORT:
-	// report.AreaList = (*subscription.EventList)[eventIndex].AreaList
+		location := deepcopy.Copy(ue.Location).(models.UserLocation)
+		ueSubscription.ReportedLocation = &location
+		report.Location = &location
+	case models.AmfEventType_PRESENCE_IN_AOI_REPORT:
+		if event, found := ueSubscription.FindEvent(Type); found {
+			ueSubscription.AoiPresence = ue.AoiPresenceState(event.AreaList)
+			report.AreaList = aoiPresenceAreas(event.AreaList, ueSubscription.AoiPresence)
+		}
 	case models.AmfEventType_TIMEZONE_REPORT:
 		report.Timezone = ue.TimeZone
 	case models.AmfEventType_ACCESS_TYPE_REPORT:
@@ -375,7 +456,7 @@ func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscription
 	case models.AmfEventType_SUBSCRIBED_DATA_REPORT:
 		report.SubscribedData = &ue.SubscribedData
 	case models.AmfEventType_COMMUNICATION_FAILURE_REPORT:
-		// TODO : report.CommFailure
+		report.CommFailure = ue.CommFailure
 	case models.AmfEventType_SUBSCRIPTION_ID_CHANGE:
 		report.SubscriptionId = subscriptionId
 	case models.AmfEventType_SUBSCRIPTION_ID_ADDITION:
@@ -384,14 +465,21 @@ func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscription
 	return report, ok
 }
 
-func getDuration(expiry *time.Time, remainDuration *int32) bool {
-	if expiry != nil {
-		if time.Now().After(*expiry) {
-			return false
-		} else {
-			duration := time.Until(*expiry)
-			*remainDuration = int32(duration.Seconds())
+// aoiPresenceAreas returns the areas of interest with the presence state of the UE
+func aoiPresenceAreas(areaList []models.AmfEventArea, state models.PresenceState) []models.AmfEventArea {
+	areas := make([]models.AmfEventArea, 0, len(areaList))
+	for _, area := range areaList {
+		if area.PresenceInfo != nil {
+			presenceInfo := *area.PresenceInfo
+			presenceInfo.PresenceState = state
+			area.PresenceInfo = &presenceInfo
+		}
+		if area.LadnInfo != nil {
+			ladnInfo := *area.LadnInfo
+			ladnInfo.Presence = state
+			area.LadnInfo = &ladnInfo
 		}
+		areas = append(areas, area)
 	}
-	return true
+	return areas
 }
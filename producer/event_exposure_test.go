@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package producer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/producer/callback"
+	"github.com/omec-project/openapi/models"
+)
+
+// stubEventConsumer records the event notifications of the AMF
+type stubEventConsumer struct {
+	*httptest.Server
+	mu            sync.Mutex
+	notifications []models.AmfEventNotification
+}
+
+func newStubEventConsumer() *stubEventConsumer {
+	consumer := &stubEventConsumer{}
+	consumer.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification models.AmfEventNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		consumer.mu.Lock()
+		consumer.notifications = append(consumer.notifications, notification)
+		consumer.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return consumer
+}
+
+func (consumer *stubEventConsumer) reports() (reports []models.AmfEventReport) {
+	consumer.mu.Lock()
+	defer consumer.mu.Unlock()
+	for _, notification := range consumer.notifications {
+		reports = append(reports, notification.ReportList...)
+	}
+	return reports
+}
+
+// waitReports waits for the reports delivered asynchronously to the subscriber
+func (consumer *stubEventConsumer) waitReports(count int) []models.AmfEventReport {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if reports := consumer.reports(); len(reports) >= count {
+			return reports
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return consumer.reports()
+}
+
+func nrLocation(tac string) models.UserLocation {
+	return models.UserLocation{
+		NrLocation: &models.NrLocation{
+			Tai:  &models.Tai{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: tac},
+			Ncgi: &models.Ncgi{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, NrCellId: "000000010"},
+		},
+	}
+}
+
+func TestPresenceInAoiReport(t *testing.T) {
+	self := context.AMF_Self()
+	consumer := newStubEventConsumer()
+	defer consumer.Close()
+
+	ue := self.NewAmfUe("imsi-208930000007489")
+	ue.SetAccessLocation(models.AccessType__3_GPP_ACCESS, nrLocation("000002"))
+
+	areaOfInterest := models.Tai{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: "000001"}
+	created, problemDetails := CreateAMFEventSubscriptionProcedure(models.AmfCreateEventSubscription{
+		Subscription: &models.AmfEventSubscription{
+			EventList: &[]models.AmfEvent{{
+				Type: models.AmfEventType_PRESENCE_IN_AOI_REPORT,
+				AreaList: []models.AmfEventArea{{
+					PresenceInfo: &models.PresenceInfo{TrackingAreaList: []models.Tai{areaOfInterest}},
+				}},
+			}},
+			EventNotifyUri:      consumer.URL,
+			NotifyCorrelationId: "aoi",
+			Supi:                ue.Supi,
+			Options: &models.AmfEventMode{
+				Trigger:    models.AmfEventTrigger_CONTINUOUS,
+				MaxReports: 2,
+			},
+		},
+	}, nil)
+	if problemDetails != nil {
+		t.Fatalf("Subscription is rejected: %+v", problemDetails)
+	}
+
+	// moves within the area of interest, leaves it, and moves outside of it
+	ue.SetAccessLocation(models.AccessType__3_GPP_ACCESS, nrLocation("000001"))
+	ue.SetAccessLocation(models.AccessType__3_GPP_ACCESS, nrLocation("000001"))
+	ue.SetAccessLocation(models.AccessType__3_GPP_ACCESS, nrLocation("000003"))
+	ue.SetAccessLocation(models.AccessType__3_GPP_ACCESS, nrLocation("000004"))
+
+	reports := consumer.waitReports(2)
+	if len(reports) != 2 {
+		t.Fatalf("Number of reports, want: 2, got: %d", len(reports))
+	}
+	for i, state := range []models.PresenceState{models.PresenceState_IN_AREA, models.PresenceState_OUT_OF_AREA} {
+		report := reports[i]
+		if report.Type != models.AmfEventType_PRESENCE_IN_AOI_REPORT || len(report.AreaList) != 1 ||
+			report.AreaList[0].PresenceInfo == nil || report.AreaList[0].PresenceInfo.PresenceState != state {
+			t.Errorf("Report %d, want presence: %s, got: %+v", i, state, report)
+		}
+		if report.SubscriptionId != created.SubscriptionId {
+			t.Errorf("Report %d, subscription ID: %s", i, report.SubscriptionId)
+		}
+	}
+	if reports[1].State == nil || reports[1].State.Active {
+		t.Errorf("Last report of the subscription is still active: %+v", reports[1].State)
+	}
+	if _, ok := self.FindEventSubscription(created.SubscriptionId); ok {
+		t.Errorf("Subscription is not deleted after its maximum number of reports")
+	}
+}
+
+func TestSubscriptionIdAddition(t *testing.T) {
+	self := context.AMF_Self()
+	consumer := newStubEventConsumer()
+	defer consumer.Close()
+
+	created, problemDetails := CreateAMFEventSubscriptionProcedure(models.AmfCreateEventSubscription{
+		Subscription: &models.AmfEventSubscription{
+			EventList: &[]models.AmfEvent{{
+				Type: models.AmfEventType_REGISTRATION_STATE_REPORT,
+			}},
+			EventNotifyUri:      consumer.URL,
+			NotifyCorrelationId: "any-ue",
+			AnyUE:               true,
+		},
+	}, nil)
+	if problemDetails != nil {
+		t.Fatalf("Subscription is rejected: %+v", problemDetails)
+	}
+	defer DeleteAMFEventSubscriptionProcedure(created.SubscriptionId)
+
+	// the UE registers after the subscription is created, it joins the subscription once
+	ue := self.NewAmfUe("imsi-208930000007490")
+	callback.JoinEventSubscriptions(ue)
+	callback.JoinEventSubscriptions(ue)
+
+	if _, ok := ue.EventSubscriptionsInfo[created.SubscriptionId]; !ok {
+		t.Fatalf("UE does not join the subscription for any UE")
+	}
+	consumer.waitReports(1)
+	time.Sleep(100 * time.Millisecond)
+	reports := consumer.reports()
+	if len(reports) != 1 {
+		t.Fatalf("Number of reports, want: 1, got: %d", len(reports))
+	}
+	if report := reports[0]; report.Type != models.AmfEventType_SUBSCRIPTION_ID_ADDITION ||
+		report.Supi != ue.Supi || report.SubscriptionId != created.SubscriptionId || !report.AnyUe {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	// a UE context created again for a UE listed in the subscription, e.g. loaded from the DB,
+	// joins the subscription without notifying the subscriber again
+	reloaded := self.NewAmfUe(ue.Supi)
+	callback.JoinEventSubscriptions(reloaded)
+	if _, ok := reloaded.EventSubscriptionsInfo[created.SubscriptionId]; !ok {
+		t.Fatalf("UE context created again does not join the subscription for any UE")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if reports := consumer.reports(); len(reports) != 1 {
+		t.Errorf("SUBSCRIPTION_ID_ADDITION is sent again, number of reports: %d", len(reports))
+	}
+}
@@ -9,9 +9,13 @@ package producer
 import (
 	"net/http"
 
+	"github.com/google/uuid"
+
+	"github.com/omec-project/amf/consumer"
 	"github.com/omec-project/amf/context"
 	"github.com/omec-project/amf/logger"
 	"github.com/omec-project/http_wrapper"
+	"github.com/omec-project/openapi/Nnrf_NFDiscovery"
 	"github.com/omec-project/openapi/models"
 )
 
@@ -106,3 +110,84 @@ func ProvideLocationInfoProcedure(requestLocInfo models.RequestLocInfo, ueContex
 	}
 	return provideLocInfo, nil
 }
+
+// TS 29.518 5.5.2.3, TS 23.273 6.11.1: unlike ProvideLocationInfo, the positioning does not run in the
+// event loop of the UE, the LMF transfers the LPP and NRPPa messages of the UE while the request is pending
+func HandleProvidePositioningInfoRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Info("Handle Provide Positioning Info Request")
+
+	requestPosInfo := request.Body.(models.RequestPosInfo)
+	ueContextID := request.Params["ueContextId"]
+
+	providePosInfo, problemDetails := ProvidePositioningInfoProcedure(requestPosInfo, ueContextID)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	return http_wrapper.NewResponse(http.StatusOK, nil, providePosInfo)
+}
+
+func ProvidePositioningInfoProcedure(requestPosInfo models.RequestPosInfo, ueContextID string) (
+	*models.ProvidePosInfo, *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return nil, problemDetails
+	}
+
+	// LPP and NRPPa are only conveyed over the NG-RAN, the UE in CM-IDLE is paged first (TS 23.273 6.11.1)
+	if !ue.CmConnect(models.AccessType__3_GPP_ACCESS) {
+		if _, problemDetails := waitUeReachability(ue, ueContextID, models.EnableUeReachabilityReqData{
+			Reachability: models.UeReachability_REACHABLE,
+		}); problemDetails != nil {
+			return nil, problemDetails
+		}
+	}
+	param := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{}
+	lmfUri, lmfProfile, err := consumer.SearchLmfLocationInstance(amfSelf.NrfUri, models.NfType_LMF,
+		models.NfType_AMF, &param)
+	if err != nil {
+		ue.ProducerLog.Errorf("LMF selection failed: %+v", err)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "POSITIONING_FAILED",
+			Detail: err.Error(),
+		}
+		return nil, problemDetails
+	}
+
+	// the session is read by the event loop of the UE, which notifies the LPP and NRPPa messages to the LMF
+	session := context.LcsSession{
+		CorrelationId: uuid.New().String(),
+		LmfUri:        lmfUri,
+		LmfProfile:    lmfProfile,
+	}
+	if !ue.StartLcsSession(session) {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusConflict,
+			Cause:  "UNSPECIFIED",
+			Detail: "A positioning session of the UE is ongoing",
+		}
+		return nil, problemDetails
+	}
+	defer ue.StopLcsSession()
+	ue.ProducerLog.Infof("Positioning session[%s] with LMF[%s]", session.CorrelationId, session.LmfUri)
+
+	providePosInfo, problemDetails, err := consumer.SendDetermineLocationRequest(ue, session, requestPosInfo)
+	if err != nil {
+		ue.ProducerLog.Errorf("DetermineLocation failed: %+v", err)
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "POSITIONING_FAILED",
+			Detail: err.Error(),
+		}
+	}
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+	return providePosInfo, nil
+}
@@ -0,0 +1,337 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/gmm"
+	amf_ngap "github.com/omec-project/amf/ngap"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/nas"
+	"github.com/omec-project/nas/nasMessage"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+var (
+	lppDownlink   = []byte{0x92, 0x2b, 0x08, 0x04}
+	lppUplink     = []byte{0x92, 0x2b, 0x10, 0x05}
+	nrppaDownlink = []byte{0x00, 0x0a, 0x00, 0x01}
+	nrppaUplink   = []byte{0x20, 0x0a, 0x00, 0x02}
+)
+
+// fakeLmf serves the NRF discovery of the LMF and Nlmf_Location DetermineLocation, it runs the
+// positioning with the UE and the RAN through the AMF before answering with the location estimate
+type fakeLmf struct {
+	*httptest.Server
+	t         *testing.T
+	nfId      string
+	ue        *context.AmfUe
+	ran       *context.AmfRan
+	conn      *ngaputil.TestConn
+	mu        sync.Mutex
+	inputData map[string]interface{}
+	n1Notify  []byte
+	n2Notify  []byte
+}
+
+func newFakeLmf(t *testing.T, ue *context.AmfUe, ran *context.AmfRan, conn *ngaputil.TestConn) *fakeLmf {
+	lmf := &fakeLmf{t: t, nfId: "d8a2b3b0-7f3c-4f2e-9c34-1a2b3c4d5e6f", ue: ue, ran: ran, conn: conn}
+	lmf.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/nf-instances"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(models.SearchResult{NfInstances: []models.NfProfile{lmf.profile()}})
+		case strings.HasSuffix(r.URL.Path, "/determine-location"):
+			lmf.determineLocation(w, r)
+		case strings.HasSuffix(r.URL.Path, "/n1-notify"):
+			body, _ := ioutil.ReadAll(r.Body)
+			lmf.mu.Lock()
+			lmf.n1Notify = body
+			lmf.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/n2-notify"):
+			body, _ := ioutil.ReadAll(r.Body)
+			lmf.mu.Lock()
+			lmf.n2Notify = body
+			lmf.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return lmf
+}
+
+func (lmf *fakeLmf) profile() models.NfProfile {
+	return models.NfProfile{
+		NfInstanceId: lmf.nfId,
+		NfType:       models.NfType_LMF,
+		NfStatus:     models.NfStatus_REGISTERED,
+		NfServices: &[]models.NfService{{
+			ServiceInstanceId: "0",
+			ServiceName:       models.ServiceName_NLMF_LOC,
+			NfServiceStatus:   models.NfServiceStatus_REGISTERED,
+			ApiPrefix:         lmf.URL,
+		}},
+		DefaultNotificationSubscriptions: []models.DefaultNotificationSubscription{
+			{
+				NotificationType: models.NotificationType_N1_MESSAGES,
+				CallbackUri:      lmf.URL + "/n1-notify",
+				N1MessageClass:   models.N1MessageClass_LPP,
+			},
+			{
+				NotificationType:   models.NotificationType_N2_INFORMATION,
+				CallbackUri:        lmf.URL + "/n2-notify",
+				N2InformationClass: models.N2InformationClass_NRP_PA,
+			},
+		},
+	}
+}
+
+func (lmf *fakeLmf) determineLocation(w http.ResponseWriter, r *http.Request) {
+	t := lmf.t
+	if err := json.NewDecoder(r.Body).Decode(&lmf.inputData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// LPP exchange with the UE
+	_, _, problemDetails, transferErr := N1N2MessageTransferProcedure(lmf.ue.Supi, "", models.N1N2MessageTransferRequest{
+		JsonData: &models.N1N2MessageTransferReqData{
+			N1MessageContainer: &models.N1MessageContainer{
+				N1MessageClass:   models.N1MessageClass_LPP,
+				N1MessageContent: &models.RefToBinaryData{ContentId: "n1msg"},
+			},
+		},
+		BinaryDataN1Message: lppDownlink,
+	})
+	if problemDetails != nil || transferErr != nil {
+		t.Errorf("LPP transfer is rejected: %+v %+v", problemDetails, transferErr)
+	}
+	if payload := sentLppPayload(t, lmf.conn.Data); !bytes.Equal(payload, lppDownlink) {
+		t.Errorf("LPP message to the UE, want: %x, got: %x", lppDownlink, payload)
+	}
+	ulNasTransport := nasMessage.NewULNASTransport(0)
+	ulNasTransport.SetPayloadContainerType(nasMessage.PayloadContainerTypeLPP)
+	ulNasTransport.PayloadContainer.SetLen(uint16(len(lppUplink)))
+	ulNasTransport.PayloadContainer.SetPayloadContainerContents(lppUplink)
+	if err := gmm.HandleULNASTransport(lmf.ue, models.AccessType__3_GPP_ACCESS, ulNasTransport); err != nil {
+		t.Errorf("HandleULNASTransport: %v", err)
+	}
+
+	// NRPPa exchange with the serving NG-RAN node
+	_, _, problemDetails, transferErr = N1N2MessageTransferProcedure(lmf.ue.Supi, "", models.N1N2MessageTransferRequest{
+		JsonData: &models.N1N2MessageTransferReqData{
+			N2InfoContainer: &models.N2InfoContainer{
+				N2InformationClass: models.N2InformationClass_NRP_PA,
+				NrppaInfo: &models.NrppaInformation{
+					NfId:     lmf.nfId,
+					NrppaPdu: &models.N2InfoContent{NgapData: &models.RefToBinaryData{ContentId: "n2msg"}},
+				},
+			},
+		},
+		BinaryDataN2Information: nrppaDownlink,
+	})
+	if problemDetails != nil || transferErr != nil {
+		t.Errorf("NRPPa transfer is rejected: %+v %+v", problemDetails, transferErr)
+	}
+	routingID, nrppaPdu := sentNrppa(t, lmf.conn.Data)
+	if string(routingID) != lmf.nfId || !bytes.Equal(nrppaPdu, nrppaDownlink) {
+		t.Errorf("NRPPa to the RAN, routing ID: %s, NRPPa PDU: %x", routingID, nrppaPdu)
+	}
+	amf_ngap.HandleUplinkUEAssociatedNRPPATransport(lmf.ran, uplinkNrppa(lmf.ue.RanUe[models.AccessType__3_GPP_ACCESS],
+		routingID, nrppaUplink))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"locationEstimate":{"shape":"POINT","point":{"lon":7.0,"lat":43.6}},"ageOfLocationEstimate":1}`))
+}
+
+func sentLppPayload(t *testing.T, data []byte) []byte {
+	pdu, err := ngap.Decoder(data)
+	if err != nil || pdu.InitiatingMessage == nil || pdu.InitiatingMessage.Value.DownlinkNASTransport == nil {
+		t.Errorf("No DownlinkNASTransport is sent: %v", err)
+		return nil
+	}
+	for _, ie := range pdu.InitiatingMessage.Value.DownlinkNASTransport.ProtocolIEs.List {
+		if ie.Id.Value != ngapType.ProtocolIEIDNASPDU {
+			continue
+		}
+		m := nas.NewMessage()
+		if err := m.PlainNasDecode(&ie.Value.NASPDU.Value); err != nil || m.GmmMessage.DLNASTransport == nil {
+			t.Errorf("No DL NAS Transport in the NAS-PDU: %v", err)
+			return nil
+		}
+		dlNasTransport := m.GmmMessage.DLNASTransport
+		if dlNasTransport.GetPayloadContainerType() != nasMessage.PayloadContainerTypeLPP {
+			t.Errorf("Payload container type: %d", dlNasTransport.GetPayloadContainerType())
+		}
+		return dlNasTransport.PayloadContainer.GetPayloadContainerContents()
+	}
+	return nil
+}
+
+func sentNrppa(t *testing.T, data []byte) (routingID, nrppaPdu []byte) {
+	pdu, err := ngap.Decoder(data)
+	if err != nil || pdu.InitiatingMessage == nil ||
+		pdu.InitiatingMessage.Value.DownlinkUEAssociatedNRPPaTransport == nil {
+		t.Errorf("No DownlinkUEAssociatedNRPPaTransport is sent: %v", err)
+		return nil, nil
+	}
+	for _, ie := range pdu.InitiatingMessage.Value.DownlinkUEAssociatedNRPPaTransport.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDRoutingID:
+			routingID = ie.Value.RoutingID.Value
+		case ngapType.ProtocolIEIDNRPPaPDU:
+			nrppaPdu = ie.Value.NRPPaPDU.Value
+		}
+	}
+	return routingID, nrppaPdu
+}
+
+func uplinkNrppa(ranUe *context.RanUe, routingID, nrppaPdu []byte) *ngapType.NGAPPDU {
+	ies := []ngapType.UplinkUEAssociatedNRPPaTransportIEs{
+		{
+			Id:    ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDAMFUENGAPID},
+			Value: ngapType.UplinkUEAssociatedNRPPaTransportIEsValue{AMFUENGAPID: &ngapType.AMFUENGAPID{Value: ranUe.AmfUeNgapId}},
+		},
+		{
+			Id:    ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDRANUENGAPID},
+			Value: ngapType.UplinkUEAssociatedNRPPaTransportIEsValue{RANUENGAPID: &ngapType.RANUENGAPID{Value: ranUe.RanUeNgapId}},
+		},
+		{
+			Id:    ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDRoutingID},
+			Value: ngapType.UplinkUEAssociatedNRPPaTransportIEsValue{RoutingID: &ngapType.RoutingID{Value: routingID}},
+		},
+		{
+			Id:    ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDNRPPaPDU},
+			Value: ngapType.UplinkUEAssociatedNRPPaTransportIEsValue{NRPPaPDU: &ngapType.NRPPaPDU{Value: nrppaPdu}},
+		},
+	}
+	return &ngapType.NGAPPDU{
+		Present: ngapType.NGAPPDUPresentInitiatingMessage,
+		InitiatingMessage: &ngapType.InitiatingMessage{
+			ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeUplinkUEAssociatedNRPPaTransport},
+			Value: ngapType.InitiatingMessageValue{
+				Present: ngapType.InitiatingMessagePresentUplinkUEAssociatedNRPPaTransport,
+				UplinkUEAssociatedNRPPaTransport: &ngapType.UplinkUEAssociatedNRPPaTransport{
+					ProtocolIEs: ngapType.ProtocolIEContainerUplinkUEAssociatedNRPPaTransportIEs{List: ies},
+				},
+			},
+		},
+	}
+}
+
+func TestProvidePositioningInfo(t *testing.T) {
+	self := context.AMF_Self()
+	conn := &ngaputil.TestConn{}
+	ran := self.NewAmfRan(conn)
+	ranUe, err := ran.NewRanUe(1)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	ue := self.NewAmfUe("imsi-208930000007488")
+	ue.AttachRanUe(ranUe)
+
+	lmf := newFakeLmf(t, ue, ran, conn)
+	defer lmf.Close()
+	nrfUri := self.NrfUri
+	self.NrfUri = lmf.URL
+	defer func() { self.NrfUri = nrfUri }()
+
+	providePosInfo, problemDetails := ProvidePositioningInfoProcedure(models.RequestPosInfo{
+		LcsClientType: models.ExternalClientType_EMERGENCY_SERVICES,
+		Supi:          ue.Supi,
+	}, ue.Supi)
+	if problemDetails != nil {
+		t.Fatalf("ProvidePositioningInfo failed: %+v", problemDetails)
+	}
+
+	estimate, _ := json.Marshal(providePosInfo.LocationEstimate)
+	if !bytes.Contains(estimate, []byte(`"shape":"POINT"`)) || !bytes.Contains(estimate, []byte(`"lat":43.6`)) {
+		t.Errorf("Location estimate of the LMF is not provided: %s", estimate)
+	}
+	correlationID, _ := lmf.inputData["correlationID"].(string)
+	if correlationID == "" || lmf.inputData["supi"] != ue.Supi || lmf.inputData["amfId"] != self.NfId {
+		t.Errorf("Input data of DetermineLocation: %v", lmf.inputData)
+	}
+	lmf.mu.Lock()
+	defer lmf.mu.Unlock()
+	if !bytes.Contains(lmf.n1Notify, lppUplink) || !bytes.Contains(lmf.n1Notify, []byte(correlationID)) {
+		t.Errorf("LPP message of the UE is not notified to the LMF")
+	}
+	if !bytes.Contains(lmf.n2Notify, nrppaUplink) || !bytes.Contains(lmf.n2Notify, []byte(lmf.nfId)) {
+		t.Errorf("NRPPa PDU of the RAN is not notified to the LMF")
+	}
+	if _, ok := ue.LcsSession(); ok {
+		t.Errorf("Positioning session is not cleared")
+	}
+}
+
+func TestProvidePositioningInfoIdleUe(t *testing.T) {
+	self := context.AMF_Self()
+	conn := &ngaputil.TestConn{}
+	ran := self.NewAmfRan(conn)
+	ran.AnType = models.AccessType__3_GPP_ACCESS
+	tai := models.Tai{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: "000001"}
+	ran.SupportedTAList = append(ran.SupportedTAList, context.SupportedTAI{Tai: tai})
+	ue := self.NewAmfUe("imsi-208930000007489")
+	ue.Guti = "20893cafe0000000002"
+	ue.Reachability = models.UeReachability_REACHABLE
+	ue.RegistrationArea[models.AccessType__3_GPP_ACCESS] = []models.Tai{tai}
+	ue.State[models.AccessType__3_GPP_ACCESS].Set(context.Registered)
+
+	lmf := newFakeLmf(t, ue, ran, conn)
+	defer lmf.Close()
+	nrfUri := self.NrfUri
+	self.NrfUri = lmf.URL
+	defer func() { self.NrfUri = nrfUri }()
+
+	// the UE in CM-IDLE is paged, the positioning starts once it connects
+	result := make(chan *models.ProblemDetails, 1)
+	go func() {
+		_, problemDetails := ProvidePositioningInfoProcedure(models.RequestPosInfo{
+			LcsClientType: models.ExternalClientType_EMERGENCY_SERVICES,
+			Supi:          ue.Supi,
+		}, ue.Supi)
+		result <- problemDetails
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for ue.OnGoing(models.AccessType__3_GPP_ACCESS).Procedure != context.OnGoingProcedurePaging {
+		if time.Now().After(deadline) {
+			t.Fatalf("UE is not paged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case problemDetails := <-result:
+		t.Fatalf("Positioning ends before the UE connects: %+v", problemDetails)
+	case <-time.After(50 * time.Millisecond):
+	}
+	ranUe, err := ran.NewRanUe(2)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	ue.AttachRanUe(ranUe)
+	if problemDetails := <-result; problemDetails != nil {
+		t.Errorf("ProvidePositioningInfo of the paged UE failed: %+v", problemDetails)
+	}
+	if ue.T3513 != nil {
+		ue.T3513.Stop()
+		ue.T3513 = nil
+	}
+}
@@ -7,19 +7,35 @@
 package producer
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/omec-project/amf/context"
 	"github.com/omec-project/amf/logger"
+	ngap_message "github.com/omec-project/amf/ngap/message"
 	"github.com/omec-project/http_wrapper"
 	"github.com/omec-project/openapi/models"
 )
 
+// the UE is waited for while it is paged, when T3513 is disabled the paging is not retransmitted
+const defaultUeReachabilityTimeout = 10 * time.Second
+
 func MtHandler(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
-	switch msg.(type) {
+	switch msg := msg.(type) {
 	case string:
-		r1, r2 := ProvideDomainSelectionInfoProcedure(s1, s2, msg.(string))
-		return r1, "", r2, nil
+		r1, r2 := ProvideDomainSelectionInfoProcedure(s1, s2, msg)
+		if r2 != nil {
+			return nil, "", r2, nil
+		}
+		return r1, "", nil, nil
+	case models.EnableUeReachabilityReqData:
+		r1, r2, r3 := EnableUeReachabilityProcedure(s1, msg)
+		if r3 != nil {
+			return nil, "", r3, nil
+		}
+		return ueReachabilityResult{rspData: r1, wait: r2}, "", nil, nil
 	}
 
 	return nil, "", nil, nil
@@ -43,6 +59,9 @@ func HandleProvideDomainSelectionInfoRequest(request *http_wrapper.Request) *htt
 		}
 		return http_wrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
 	}
+	if ownerUri, ok := ueOwnerUri(ue); ok {
+		return ueContextRedirect(ownerUri + request.URL.RequestURI())
+	}
 	sbiMsg := context.SbiMsg{
 		UeContextId: ueContextID,
 		ReqUri:      infoClassQuery,
@@ -59,7 +78,8 @@ func HandleProvideDomainSelectionInfoRequest(request *http_wrapper.Request) *htt
 	//ueContextInfo, problemDetails := ProvideDomainSelectionInfoProcedure(ueContextID,
 	//	infoClassQuery, supportedFeaturesQuery)
 	if msg.ProblemDetails != nil {
-		return http_wrapper.NewResponse(int(msg.ProblemDetails.(models.ProblemDetails).Status), nil, msg.ProblemDetails.(models.ProblemDetails))
+		problemDetails := msg.ProblemDetails.(*models.ProblemDetails)
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
 	} else {
 		return http_wrapper.NewResponse(http.StatusOK, nil, ueContextInfo)
 	}
@@ -80,7 +100,7 @@ func ProvideDomainSelectionInfoProcedure(ueContextID string, infoClassQuery stri
 
 	ueContextInfo := new(models.UeContextInfo)
 
-	// TODO: Error Status 307, 403 in TS29.518 Table 6.3.3.3.3.1-3
+	// TODO: Error Status 403 in TS29.518 Table 6.3.3.3.3.1-3
 	anType := ue.GetAnType()
 	if anType != "" && infoClassQuery != "" {
 		ranUe := ue.RanUe[anType]
@@ -94,3 +114,157 @@ func ProvideDomainSelectionInfoProcedure(ueContextID string, infoClassQuery stri
 
 	return ueContextInfo, nil
 }
+
+// TS 29.518 5.4.2.3
+func HandleEnableUeReachabilityRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.MtLog.Info("Handle Enable Ue Reachability Request")
+
+	ueContextID := request.Params["ueContextId"]
+	reqData := request.Body.(models.EnableUeReachabilityReqData)
+
+	ue, ok := context.AMF_Self().AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return http_wrapper.NewResponse(http.StatusNotFound, nil, problemDetails)
+	}
+	// the UE context is served by the AMF instance which owns it
+	if ownerUri, ok := ueOwnerUri(ue); ok {
+		return ueContextRedirect(ownerUri + request.URL.RequestURI())
+	}
+
+	rspData, problemDetails := waitUeReachability(ue, ueContextID, reqData)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	return http_wrapper.NewResponse(http.StatusOK, nil, rspData)
+}
+
+// waitUeReachability pages the UE in CM-IDLE in its event loop and waits until it is reachable
+func waitUeReachability(ue *context.AmfUe, ueContextID string, reqData models.EnableUeReachabilityReqData) (
+	*models.EnableUeReachabilityRspData, *models.ProblemDetails) {
+	sbiMsg := context.SbiMsg{
+		UeContextId: ueContextID,
+		Msg:         reqData,
+		Handler:     MtHandler,
+		Result:      make(chan context.SbiResponseMsg, 10),
+	}
+	ue.SetEventChannel(nil)
+	ue.EventChannel.SubmitMessage(sbiMsg)
+	msg := <-sbiMsg.Result
+	if msg.ProblemDetails != nil {
+		return nil, msg.ProblemDetails.(*models.ProblemDetails)
+	}
+	result := msg.RespData.(ueReachabilityResult)
+
+	// the UE is paged, the response is sent once it is reachable
+	if result.wait != nil {
+		select {
+		case reachable := <-result.wait:
+			if !reachable {
+				return nil, &models.ProblemDetails{
+					Status: http.StatusForbidden,
+					Cause:  "UE_NOT_REACHABLE",
+					Detail: "UE does not respond to paging",
+				}
+			}
+		case <-time.After(ueReachabilityTimeout()):
+			ue.CancelReachabilityWait(result.wait)
+			return nil, &models.ProblemDetails{
+				Status: http.StatusGatewayTimeout,
+				Cause:  "UE_NOT_REACHABLE",
+				Detail: "UE is not reachable before the timeout",
+			}
+		}
+	}
+	return result.rspData, nil
+}
+
+// ueReachabilityResult is the outcome of EnableUeReachabilityProcedure in the event loop of the UE
+type ueReachabilityResult struct {
+	rspData *models.EnableUeReachabilityRspData
+	wait    <-chan bool
+}
+
+// EnableUeReachabilityProcedure pages the UE in CM-IDLE, the returned channel tells whether the paged UE
+// became reachable. The UE can't be reached when it is not registered or its mobile reachable timer
+// has expired
+func EnableUeReachabilityProcedure(ueContextID string, reqData models.EnableUeReachabilityReqData) (
+	*models.EnableUeReachabilityRspData, <-chan bool, *models.ProblemDetails) {
+	ue, ok := context.AMF_Self().AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		return nil, nil, &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+	}
+	if reqData.Reachability == "" {
+		return nil, nil, &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "Reachability is missing",
+		}
+	}
+
+	anType := models.AccessType__3_GPP_ACCESS
+	if !ue.State[anType].Is(context.Registered) || ue.Reachability == models.UeReachability_UNREACHABLE ||
+		(ue.Reachability == models.UeReachability_REGULATORY_ONLY &&
+			reqData.Reachability != models.UeReachability_REGULATORY_ONLY) {
+		return nil, nil, &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "UE_NOT_REACHABLE",
+		}
+	}
+
+	rspData := &models.EnableUeReachabilityRspData{
+		Reachability:      reqData.Reachability,
+		SupportedFeatures: reqData.SupportedFeatures,
+	}
+	if ue.CmConnect(anType) {
+		return rspData, nil, nil
+	}
+
+	wait := ue.WaitReachability()
+	// the UE is already paged, e.g. for a N1N2 message transfer
+	if ue.OnGoing(anType).Procedure != context.OnGoingProcedurePaging {
+		ue.GmmLog.Infof("Page UE to enable its reachability")
+		ue.SetOnGoing(anType, &context.OnGoing{
+			Procedure: context.OnGoingProcedurePaging,
+		})
+		ngap_message.SendPaging(ue, nil, false)
+	}
+	return rspData, wait, nil
+}
+
+func ueReachabilityTimeout() time.Duration {
+	cfg := context.AMF_Self().T3513Cfg
+	if !cfg.Enable {
+		return defaultUeReachabilityTimeout
+	}
+	// the paging ends after the last retransmission expires
+	return cfg.ExpireTime * time.Duration(cfg.MaxRetryTimes+2)
+}
+
+// ueOwnerUri returns the URI of the AMF instance owning the UE context when it is not this instance,
+// the UE contexts are shared through the DB and DRSM tracks the owner of the TMSI of the UE
+func ueOwnerUri(ue *context.AmfUe) (string, bool) {
+	amfSelf := context.AMF_Self()
+	if !amfSelf.EnableDbStore || amfSelf.Drsm == nil || ue.Tmsi == 0 {
+		return "", false
+	}
+	id, err := amfSelf.Drsm.FindOwnerInt32ID(ue.Tmsi)
+	if err != nil || id == nil || id.PodName == os.Getenv("HOSTNAME") {
+		return "", false
+	}
+	return fmt.Sprintf("%s://%s:%d", amfSelf.UriScheme, id.PodIp, amfSelf.SBIPort), true
+}
+
+func ueContextRedirect(location string) *http_wrapper.Response {
+	logger.MtLog.Infof("UE context is owned by another AMF instance, redirect to %s", location)
+	headers := http.Header{
+		"Location": {location},
+	}
+	return http_wrapper.NewResponse(http.StatusTemporaryRedirect, headers, nil)
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package producer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/omec-project/amf/context"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/http_wrapper"
+	"github.com/omec-project/openapi/models"
+)
+
+func enableUeReachability(ue *context.AmfUe) *http_wrapper.Response {
+	httpReq := httptest.NewRequest(http.MethodPost, "/namf-mt/v1/ue-contexts/"+ue.Supi+"/ue-reachind", nil)
+	req := http_wrapper.NewRequest(httpReq, models.EnableUeReachabilityReqData{
+		Reachability: models.UeReachability_REACHABLE,
+	})
+	req.Params["ueContextId"] = ue.Supi
+	return HandleEnableUeReachabilityRequest(req)
+}
+
+func TestEnableUeReachability(t *testing.T) {
+	self := context.AMF_Self()
+	ran := self.NewAmfRan(&ngaputil.TestConn{})
+	ran.AnType = models.AccessType__3_GPP_ACCESS
+	tai := models.Tai{PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: "000001"}
+	ran.SupportedTAList = append(ran.SupportedTAList, context.SupportedTAI{Tai: tai})
+	ranUe, err := ran.NewRanUe(20)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	ue := self.NewAmfUe("imsi-208930000007492")
+	ue.Guti = "20893cafe0000000001"
+	ue.RegistrationArea[models.AccessType__3_GPP_ACCESS] = []models.Tai{tai}
+	ue.State[models.AccessType__3_GPP_ACCESS].Set(context.Registered)
+	ue.AttachRanUe(ranUe)
+
+	// CM-CONNECTED UE is reachable
+	if rsp := enableUeReachability(ue); rsp.Status != http.StatusOK {
+		t.Fatalf("Reachability of the CM-CONNECTED UE, status: %d, body: %+v", rsp.Status, rsp.Body)
+	}
+
+	// CM-IDLE UE is paged, the response is sent once it connects
+	ue.DetachRanUe(models.AccessType__3_GPP_ACCESS)
+	result := make(chan *http_wrapper.Response, 1)
+	go func() {
+		result <- enableUeReachability(ue)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for ue.OnGoing(models.AccessType__3_GPP_ACCESS).Procedure != context.OnGoingProcedurePaging {
+		if time.Now().After(deadline) {
+			t.Fatalf("UE is not paged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case rsp := <-result:
+		t.Fatalf("Response is sent before the UE connects, status: %d", rsp.Status)
+	case <-time.After(50 * time.Millisecond):
+	}
+	ranUe, err = ran.NewRanUe(21)
+	if err != nil {
+		t.Fatalf("Failed to create RanUe: %v", err)
+	}
+	ue.AttachRanUe(ranUe)
+	if rsp := <-result; rsp.Status != http.StatusOK {
+		t.Errorf("Reachability of the paged UE, status: %d, body: %+v", rsp.Status, rsp.Body)
+	}
+	if ue.T3513 != nil {
+		ue.T3513.Stop()
+		ue.T3513 = nil
+	}
+
+	// the mobile reachable timer of the UE has expired
+	ue.DetachRanUe(models.AccessType__3_GPP_ACCESS)
+	ue.Reachability = models.UeReachability_UNREACHABLE
+	if rsp := enableUeReachability(ue); rsp.Status != http.StatusForbidden {
+		t.Errorf("Reachability of the unreachable UE, status: %d, body: %+v", rsp.Status, rsp.Body)
+	}
+}
+
+func TestEnableUeReachabilityForbidden(t *testing.T) {
+	testCases := []struct {
+		description  string
+		supi         string
+		registered   bool
+		ueReachable  models.UeReachability
+		reachability models.UeReachability
+	}{
+		{
+			description:  "UE is not registered",
+			supi:         "imsi-208930000007493",
+			ueReachable:  models.UeReachability_REACHABLE,
+			reachability: models.UeReachability_REACHABLE,
+		},
+		{
+			description:  "mobile reachable timer has expired",
+			supi:         "imsi-208930000007494",
+			registered:   true,
+			ueReachable:  models.UeReachability_UNREACHABLE,
+			reachability: models.UeReachability_REGULATORY_ONLY,
+		},
+		{
+			description:  "UE is only reachable for regulatory prioritized services",
+			supi:         "imsi-208930000007495",
+			registered:   true,
+			ueReachable:  models.UeReachability_REGULATORY_ONLY,
+			reachability: models.UeReachability_REACHABLE,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ue := context.AMF_Self().NewAmfUe(tc.supi)
+			defer ue.Remove()
+			ue.Reachability = tc.ueReachable
+			if tc.registered {
+				ue.State[models.AccessType__3_GPP_ACCESS].Set(context.Registered)
+			}
+
+			_, wait, problemDetails := EnableUeReachabilityProcedure(ue.Supi,
+				models.EnableUeReachabilityReqData{Reachability: tc.reachability})
+			if problemDetails == nil || problemDetails.Status != http.StatusForbidden ||
+				problemDetails.Cause != "UE_NOT_REACHABLE" {
+				t.Errorf("Problem details, want: 403 UE_NOT_REACHABLE, got: %+v", problemDetails)
+			}
+			if wait != nil || ue.OnGoing(models.AccessType__3_GPP_ACCESS).Procedure == context.OnGoingProcedurePaging {
+				t.Error("Unreachable UE is paged")
+			}
+		})
+	}
+}
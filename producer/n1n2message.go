@@ -8,6 +8,7 @@
 package producer
 
 import (
+	"encoding/hex"
 	"net/http"
 	"strconv"
 
@@ -181,6 +182,16 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 					anType = smContext.AccessType()
 				}
 			}
+		case models.N2InformationClass_NRP_PA:
+			ue.ProducerLog.Debug("Receive N2 NRPPa Message")
+			// TS 23.273 6.11.1: UE associated NRPPa is only exchanged with the UE in CM-CONNECTED
+			if !ue.CmConnect(anType) {
+				problemDetails = &models.ProblemDetails{
+					Status: http.StatusGatewayTimeout,
+					Cause:  "UE_NOT_REACHABLE",
+				}
+				return nil, "", problemDetails, nil
+			}
 		default:
 			ue.ProducerLog.Warnf("N2 Information type [%s] is not supported", requestData.N2InfoContainer.N2InformationClass)
 			problemDetails = &models.ProblemDetails{
@@ -204,7 +215,10 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 			}
 			return nil, "", nil, transferErr
 		}
-		ue.T3513.Stop()
+		if ue.T3513 != nil {
+			ue.T3513.Stop()
+			ue.T3513 = nil // clear the timer
+		}
 		callback.SendN1N2TransferFailureNotification(ue, models.N1N2MessageTransferCause_UE_NOT_RESPONDING)
 	case context.OnGoingProcedureRegistration:
 		transferErr = new(models.N1N2MessageTransferError)
@@ -229,7 +243,7 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 			err    error
 		)
 		if n1Msg != nil {
-			nasPdu, err = gmm_message.BuildDLNASTransport(ue, n1MsgType, n1Msg, uint8(requestData.PduSessionId), nil, nil, 0)
+			nasPdu, err = gmm_message.BuildDLNASTransport(ue, anType, n1MsgType, n1Msg, uint8(requestData.PduSessionId), nil, nil, 0)
 			if err != nil {
 				ue.ProducerLog.Errorf("Build DL NAS Transport error: %+v", err)
 				problemDetails = &models.ProblemDetails{
@@ -249,6 +263,19 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 			}
 		}
 
+		if n2Info != nil && requestData.N2InfoContainer.N2InformationClass == models.N2InformationClass_NRP_PA {
+			ranUe := ue.RanUe[anType]
+			// the NF ID of the LMF is the Routing ID, the RAN returns it with the NRPPa response
+			if nrppaInfo := requestData.N2InfoContainer.NrppaInfo; nrppaInfo != nil && nrppaInfo.NfId != "" {
+				ranUe.RoutingID = hex.EncodeToString([]byte(nrppaInfo.NfId))
+			}
+			ue.ProducerLog.Debug("Forward NRPPa Message to RAN")
+			ngap_message.SendDownlinkUEAssociatedNRPPaTransport(ranUe, ngapType.NRPPaPDU{Value: n2Info})
+			n1n2MessageTransferRspData = new(models.N1N2MessageTransferRspData)
+			n1n2MessageTransferRspData.Cause = models.N1N2MessageTransferCause_N1_N2_TRANSFER_INITIATED
+			return n1n2MessageTransferRspData, "", nil, nil
+		}
+
 		// TODO: only support transfer N2 SM information now
 		if n2Info != nil {
 			smInfo := requestData.N2InfoContainer.SmInfo
@@ -321,8 +348,6 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 
 	n1n2MessageTransferRspData = new(models.N1N2MessageTransferRspData)
 
-	var pagingPriority *ngapType.PagingPriority
-
 	var n1n2MessageID int64
 	if n1n2MessageIDTmp, err := ue.N1N2MessageIDGenerator.Allocate(); err != nil {
 		ue.ProducerLog.Errorf("Allocate n1n2MessageID error: %+v", err)
@@ -355,16 +380,7 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 				Ppi:       requestData.Ppi,
 			})
 
-			if onGoing.Ppi != 0 {
-				pagingPriority = new(ngapType.PagingPriority)
-				pagingPriority.Value = aper.Enumerated(onGoing.Ppi)
-			}
-			pkg, err := ngap_message.BuildPaging(ue, pagingPriority, false)
-			if err != nil {
-				logger.NgapLog.Errorf("Build Paging failed : %s", err.Error())
-				return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
-			}
-			ngap_message.SendPaging(ue, pkg)
+			ngap_message.SendPaging(ue, pagingPriority(requestData), false)
 		}
 		// TODO: WAITING_FOR_ASYNCHRONOUS_TRANSFER
 		return n1n2MessageTransferRspData, locationHeader, nil, nil
@@ -407,15 +423,7 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 				Procedure: context.OnGoingProcedurePaging,
 				Ppi:       requestData.Ppi,
 			})
-			if onGoing.Ppi != 0 {
-				pagingPriority = new(ngapType.PagingPriority)
-				pagingPriority.Value = aper.Enumerated(onGoing.Ppi)
-			}
-			pkg, err := ngap_message.BuildPaging(ue, pagingPriority, true)
-			if err != nil {
-				logger.NgapLog.Errorf("Build Paging failed : %s", err.Error())
-			}
-			ngap_message.SendPaging(ue, pkg)
+			ngap_message.SendPaging(ue, pagingPriority(requestData), true)
 			return n1n2MessageTransferRspData, locationHeader, nil, nil
 		}
 	}
@@ -582,3 +590,32 @@ func N1N2MessageUnSubscribeProcedure(ueContextID string, subscriptionID string)
 	ue.N1N2MessageSubscription.Delete(subscriptionID)
 	return nil
 }
+
+// paging priority of the standardized 5QIs of prioritized services (TS 23.501 Table 5.7.4-1),
+// used when the SMF does not provide an ARP that is reserved for prioritized services
+var fiveQiPagingPriority = map[int32]aper.Enumerated{
+	69: ngapType.PagingPriorityPresentPriolevel1, // Mission Critical delay sensitive signalling
+	65: ngapType.PagingPriorityPresentPriolevel2, // Mission Critical user plane Push To Talk voice
+	66: ngapType.PagingPriorityPresentPriolevel3, // Non-Mission-Critical user plane Push To Talk voice
+	5:  ngapType.PagingPriorityPresentPriolevel4, // IMS Signalling
+}
+
+// TS 23.501 5.4.3: the AMF derives the Paging Priority from the ARP (or 5QI) provided by the SMF
+// for the QoS flow that triggered the paging. ARP priority levels 1-8 are assigned to prioritized
+// services (TS 23.501 5.7.2.2) and map to the 8 NGAP paging priority levels.
+func pagingPriority(requestData *models.N1N2MessageTransferReqData) *ngapType.PagingPriority {
+	if requestData == nil {
+		return nil
+	}
+	if arp := requestData.Arp; arp != nil && arp.PriorityLevel >= 1 && arp.PriorityLevel <= 8 {
+		return &ngapType.PagingPriority{
+			Value: aper.Enumerated(arp.PriorityLevel - 1),
+		}
+	}
+	if priority, ok := fiveQiPagingPriority[requestData.Var5qi]; ok {
+		return &ngapType.PagingPriority{
+			Value: priority,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package producer
+
+import (
+	"testing"
+
+	"github.com/omec-project/aper"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+func TestPagingPriority(t *testing.T) {
+	testCases := []struct {
+		description string
+		requestData *models.N1N2MessageTransferReqData
+		priority    *aper.Enumerated
+	}{
+		{
+			description: "no request data",
+		},
+		{
+			description: "highest ARP priority level",
+			requestData: &models.N1N2MessageTransferReqData{Arp: &models.Arp{PriorityLevel: 1}},
+			priority:    enumerated(ngapType.PagingPriorityPresentPriolevel1),
+		},
+		{
+			description: "lowest ARP priority level of prioritized services",
+			requestData: &models.N1N2MessageTransferReqData{Arp: &models.Arp{PriorityLevel: 8}},
+			priority:    enumerated(ngapType.PagingPriorityPresentPriolevel8),
+		},
+		{
+			description: "ARP priority level of a service which is not prioritized",
+			requestData: &models.N1N2MessageTransferReqData{Arp: &models.Arp{PriorityLevel: 9}},
+		},
+		{
+			description: "ARP takes precedence over the 5QI",
+			requestData: &models.N1N2MessageTransferReqData{Arp: &models.Arp{PriorityLevel: 3}, Var5qi: 69},
+			priority:    enumerated(ngapType.PagingPriorityPresentPriolevel3),
+		},
+		{
+			description: "Mission Critical delay sensitive signalling 5QI",
+			requestData: &models.N1N2MessageTransferReqData{Arp: &models.Arp{PriorityLevel: 15}, Var5qi: 69},
+			priority:    enumerated(ngapType.PagingPriorityPresentPriolevel1),
+		},
+		{
+			description: "IMS signalling 5QI",
+			requestData: &models.N1N2MessageTransferReqData{Var5qi: 5},
+			priority:    enumerated(ngapType.PagingPriorityPresentPriolevel4),
+		},
+		{
+			description: "5QI which is not prioritized",
+			requestData: &models.N1N2MessageTransferReqData{Var5qi: 9},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			priority := pagingPriority(tc.requestData)
+			if tc.priority == nil {
+				if priority != nil {
+					t.Errorf("Paging priority is set: %d", priority.Value)
+				}
+				return
+			}
+			if priority == nil || priority.Value != *tc.priority {
+				t.Errorf("Paging priority, want: %d, got: %+v", *tc.priority, priority)
+			}
+		})
+	}
+}
+
+func enumerated(value aper.Enumerated) *aper.Enumerated {
+	return &value
+}
@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package producer
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/amf/logger"
+	ngap_message "github.com/omec-project/amf/ngap/message"
+	"github.com/omec-project/http_wrapper"
+	"github.com/omec-project/ngap"
+	"github.com/omec-project/ngap/ngapType"
+	"github.com/omec-project/openapi/models"
+)
+
+// NonUeN2MessageTransferRequest is the multipart body of a Non UE N2 Message Transfer request,
+// the N2 information is the binary part referenced by the N2 information container
+type NonUeN2MessageTransferRequest struct {
+	JsonData                *models.N2InformationTransferReqData
+	BinaryDataN2Information []byte
+}
+
+// TS 29.518 5.2.2.4.1
+func HandleNonUeN2MessageTransfer(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non UE N2 Message Transfer")
+
+	transferRequest := request.Body.(NonUeN2MessageTransferRequest)
+
+	transferResponse, problemDetails := NonUeN2MessageTransferProcedure(transferRequest)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	return http_wrapper.NewResponse(http.StatusOK, nil, transferResponse)
+}
+
+func NonUeN2MessageTransferProcedure(transferRequest NonUeN2MessageTransferRequest) (
+	*models.N2InformationTransferRspData, *models.ProblemDetails) {
+	requestData := transferRequest.JsonData
+	if requestData == nil || requestData.N2Information == nil || len(transferRequest.BinaryDataN2Information) == 0 {
+		return nil, &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "N2 Information is missing",
+		}
+	}
+	n2Info := requestData.N2Information
+	n2Msg := transferRequest.BinaryDataN2Information
+
+	ranList := context.AMF_Self().AmfRanListInArea(requestData.TaiList, requestData.GlobalRanNodeList)
+	if len(ranList) == 0 {
+		return nil, &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "UNSPECIFIED",
+			Detail: "No NG-RAN node serves the target area",
+		}
+	}
+
+	transferResponse := &models.N2InformationTransferRspData{
+		Result: models.N2InformationTransferResult_N2_INFO_TRANSFER_INITIATED,
+	}
+
+	switch n2Info.N2InformationClass {
+	case models.N2InformationClass_NRP_PA:
+		if n2Info.NrppaInfo == nil {
+			return nil, &models.ProblemDetails{
+				Status: http.StatusBadRequest,
+				Cause:  "MANDATORY_IE_MISSING",
+				Detail: "NRPPa Information is missing",
+			}
+		}
+		// the NF ID of the LMF is the Routing ID, the RAN returns it with the NRPPa response
+		routingID := []byte(n2Info.NrppaInfo.NfId)
+		for _, ran := range ranList {
+			ngap_message.SendDownlinkNonUEAssociatedNRPPATransport(ran, routingID, ngapType.NRPPaPDU{Value: n2Msg})
+		}
+	case models.N2InformationClass_PWS, models.N2InformationClass_RAN:
+		// the N2 information is the NGAP message for the RANs, e.g. Write-Replace Warning Request
+		if problemDetails := checkNonUeNgapMessage(n2Info.N2InformationClass, n2Msg); problemDetails != nil {
+			return nil, problemDetails
+		}
+		for _, ran := range ranList {
+			ran.Log.Infof("Send Non UE N2 Message[class: %s]", n2Info.N2InformationClass)
+			ngap_message.SendToRan(ran, n2Msg)
+		}
+		if n2Info.N2InformationClass == models.N2InformationClass_PWS && n2Info.PwsInfo != nil {
+			transferResponse.PwsRspData = &models.PwsResponseData{
+				MessageIdentifier: n2Info.PwsInfo.MessageIdentifier,
+				SerialNumber:      n2Info.PwsInfo.SerialNumber,
+				UnknownTaiList:    unknownTaiList(requestData.TaiList, ranList),
+			}
+			if n2Info.PwsInfo.PwsContainer != nil {
+				transferResponse.PwsRspData.NgapMessageType = n2Info.PwsInfo.PwsContainer.NgapMessageType
+			}
+		}
+	default:
+		return nil, &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "INVALID_MSG_FORMAT",
+			Detail: fmt.Sprintf("N2 Information Class[%s] is not supported", n2Info.N2InformationClass),
+		}
+	}
+	return transferResponse, nil
+}
+
+func checkNonUeNgapMessage(n2class models.N2InformationClass, n2Msg []byte) *models.ProblemDetails {
+	pdu, err := ngap.Decoder(n2Msg)
+	if err != nil || pdu.Present != ngapType.NGAPPDUPresentInitiatingMessage {
+		return &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "INVALID_MSG_FORMAT",
+			Detail: "N2 Information is not an NGAP initiating message",
+		}
+	}
+	procedureCode := pdu.InitiatingMessage.ProcedureCode.Value
+	if n2class == models.N2InformationClass_PWS &&
+		procedureCode != ngapType.ProcedureCodeWriteReplaceWarning && procedureCode != ngapType.ProcedureCodePWSCancel {
+		return &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "INVALID_MSG_FORMAT",
+			Detail: fmt.Sprintf("NGAP procedure[%d] is not a PWS procedure", procedureCode),
+		}
+	}
+	return nil
+}
+
+// unknownTaiList returns the TAIs served by none of the RANs
+func unknownTaiList(taiList []models.Tai, ranList []*context.AmfRan) (unknownTais []models.Tai) {
+	for _, tai := range taiList {
+		known := false
+		for _, ran := range ranList {
+			if ran.ServesTaiList([]models.Tai{tai}) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknownTais = append(unknownTais, tai)
+		}
+	}
+	return unknownTais
+}
+
+// TS 29.518 5.2.2.4.2
+func HandleNonUeN2InfoSubscribe(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non UE N2 Info Subscribe")
+
+	subscription := request.Body.(models.NonUeN2InfoSubscriptionCreateData)
+
+	createdData, locationHeader, problemDetails := NonUeN2InfoSubscribeProcedure(subscription)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+
+	headers := http.Header{
+		"Location": {locationHeader},
+	}
+	return http_wrapper.NewResponse(http.StatusCreated, headers, createdData)
+}
+
+func NonUeN2InfoSubscribeProcedure(subscription models.NonUeN2InfoSubscriptionCreateData) (
+	createdData *models.NonUeN2InfoSubscriptionCreatedData, locationHeader string,
+	problemDetails *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	if subscription.N2NotifyCallbackUri == "" {
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "N2 Notify Callback URI is missing",
+		}
+		return
+	}
+	switch subscription.N2InformationClass {
+	case models.N2InformationClass_NRP_PA, models.N2InformationClass_PWS_BCAL, models.N2InformationClass_PWS_RF:
+	default:
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "INVALID_MSG_FORMAT",
+			Detail: fmt.Sprintf("N2 Information Class[%s] is not supported", subscription.N2InformationClass),
+		}
+		return
+	}
+
+	subscriptionID := amfSelf.NewNonUeN2InfoSubscription(subscription)
+	if subscriptionID == "" {
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+		}
+		return
+	}
+	logger.CommLog.Infof("new Non UE N2 Info Subscription[%s] of class %s", subscriptionID,
+		subscription.N2InformationClass)
+
+	createdData = &models.NonUeN2InfoSubscriptionCreatedData{
+		N2NotifySubscriptionId: subscriptionID,
+		N2InformationClass:     subscription.N2InformationClass,
+	}
+	locationHeader = amfSelf.GetIPv4Uri() + "/namf-comm/v1/non-ue-n2-messages/subscriptions/" + subscriptionID
+	return
+}
+
+// TS 29.518 5.2.2.4.3
+func HandleNonUeN2InfoUnSubscribe(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non UE N2 Info UnSubscribe")
+
+	subscriptionID := request.Params["n2NotifySubscriptionId"]
+
+	problemDetails := NonUeN2InfoUnSubscribeProcedure(subscriptionID)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+func NonUeN2InfoUnSubscribeProcedure(subscriptionID string) (problemDetails *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	if _, ok := amfSelf.FindNonUeN2InfoSubscription(subscriptionID); !ok {
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "SUBSCRIPTION_NOT_FOUND",
+		}
+	} else {
+		logger.CommLog.Debugf("Delete Non UE N2 Info Subscription[%s]", subscriptionID)
+		amfSelf.DeleteNonUeN2InfoSubscription(subscriptionID)
+	}
+	return
+}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package producer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	ngaputil "github.com/omec-project/amf/ngap/util"
+	"github.com/omec-project/amf/producer/callback"
+	"github.com/omec-project/openapi/models"
+)
+
+// countingConn counts the NGAP messages sent to the RAN
+type countingConn struct {
+	ngaputil.TestConn
+	writes int
+}
+
+func (conn *countingConn) Write(b []byte) (int, error) {
+	conn.writes++
+	return conn.TestConn.Write(b)
+}
+
+func newTestRan(gnbValue string, anType models.AccessType) (*context.AmfRan, *countingConn) {
+	conn := &countingConn{}
+	ran := context.AMF_Self().NewAmfRan(conn)
+	ran.AnType = anType
+	ran.RanId = &models.GlobalRanNodeId{
+		PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"},
+		GNbId:  &models.GNbId{BitLength: 24, GNBValue: gnbValue},
+	}
+	return ran, conn
+}
+
+func TestNonUeN2MessageTransferFanOut(t *testing.T) {
+	self := context.AMF_Self()
+	ranA, connA := newTestRan("000101", models.AccessType__3_GPP_ACCESS)
+	ranB, connB := newTestRan("000102", models.AccessType__3_GPP_ACCESS)
+	// a RAN connected with direct SCTP is also stored under its GnbId
+	self.AmfRanPool.Store("208:93:000101", ranA)
+	defer self.AmfRanPool.Delete("208:93:000101")
+
+	ranList := self.AmfRanListInArea(nil, []models.GlobalRanNodeId{*ranA.RanId, *ranB.RanId})
+	if len(ranList) != 2 {
+		t.Fatalf("Number of RANs in the area, want: 2, got: %d", len(ranList))
+	}
+
+	_, problemDetails := NonUeN2MessageTransferProcedure(NonUeN2MessageTransferRequest{
+		JsonData: &models.N2InformationTransferReqData{
+			GlobalRanNodeList: []models.GlobalRanNodeId{*ranA.RanId, *ranB.RanId},
+			N2Information: &models.N2InfoContainer{
+				N2InformationClass: models.N2InformationClass_NRP_PA,
+				NrppaInfo: &models.NrppaInformation{
+					NfId: "lmf",
+					NrppaPdu: &models.N2InfoContent{
+						NgapData: &models.RefToBinaryData{ContentId: "nrppa"},
+					},
+				},
+			},
+		},
+		BinaryDataN2Information: []byte{0x00, 0x01, 0x02, 0x03},
+	})
+	if problemDetails != nil {
+		t.Fatalf("Transfer is rejected: %+v", problemDetails)
+	}
+	if connA.writes != 1 || connB.writes != 1 {
+		t.Errorf("NGAP messages sent to the RANs, want: 1 and 1, got: %d and %d", connA.writes, connB.writes)
+	}
+}
+
+func TestNonUeN2InfoNotifyFiltering(t *testing.T) {
+	self := context.AMF_Self()
+	var mu sync.Mutex
+	notified := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		notified[r.URL.Path]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ran, _ := newTestRan("000201", models.AccessType__3_GPP_ACCESS)
+	otherRan, _ := newTestRan("000202", models.AccessType__3_GPP_ACCESS)
+	subscriptions := map[string]models.NonUeN2InfoSubscriptionCreateData{
+		"/lmf":       {N2InformationClass: models.N2InformationClass_NRP_PA, NfId: "lmf"},
+		"/other-lmf": {N2InformationClass: models.N2InformationClass_NRP_PA, NfId: "other-lmf"},
+		"/pws":       {N2InformationClass: models.N2InformationClass_PWS},
+		"/ran-node":  {N2InformationClass: models.N2InformationClass_NRP_PA, GlobalRanNodeList: []models.GlobalRanNodeId{*ran.RanId}},
+		"/other-ran-node": {
+			N2InformationClass: models.N2InformationClass_NRP_PA,
+			GlobalRanNodeList:  []models.GlobalRanNodeId{*otherRan.RanId},
+		},
+		"/non-3gpp": {
+			N2InformationClass: models.N2InformationClass_NRP_PA,
+			AnTypeList:         []models.AccessType{models.AccessType_NON_3_GPP_ACCESS},
+		},
+	}
+	for path, subscription := range subscriptions {
+		subscription.N2NotifyCallbackUri = server.URL + path
+		subscriptionID := self.NewNonUeN2InfoSubscription(subscription)
+		defer self.DeleteNonUeN2InfoSubscription(subscriptionID)
+	}
+
+	callback.SendNonUeN2InfoNotify(ran, models.N2InformationClass_NRP_PA, []byte{0x00, 0x01}, "lmf")
+
+	mu.Lock()
+	defer mu.Unlock()
+	for path := range subscriptions {
+		want := 0
+		if path == "/lmf" || path == "/ran-node" {
+			want = 1
+		}
+		if notified[path] != want {
+			t.Errorf("Notifications of the subscription %s, want: %d, got: %d", path, want, notified[path])
+		}
+	}
+}
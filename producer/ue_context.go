@@ -9,18 +9,39 @@ package producer
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/omec-project/amf/consumer"
 	"github.com/omec-project/amf/context"
 	"github.com/omec-project/amf/logger"
+	"github.com/omec-project/amf/nas/nas_security"
+	ngap_message "github.com/omec-project/amf/ngap/message"
+	"github.com/omec-project/aper"
 	"github.com/omec-project/http_wrapper"
+	"github.com/omec-project/ngap/ngapType"
 	"github.com/omec-project/openapi/models"
 )
 
+// how long the target AMF waits for the target RAN to answer the Handover Request
+const interAmfHandoverTimeout = 20 * time.Second
+
+// CreateUeContextRequest is the multipart body of a Create UE Context request, the NGAP IEs
+// are the binary parts referenced by their Content-ID in the JSON data
+type CreateUeContextRequest struct {
+	JsonData  *models.UeContextCreateData
+	NgapParts map[string][]byte
+}
+
+// CreateUeContextResponse is the multipart body of a Create UE Context response
+type CreateUeContextResponse struct {
+	JsonData  *models.UeContextCreatedData
+	NgapParts map[string][]byte
+}
+
 func UeContextHandler(s1, s2 string, msg interface{}) (interface{}, string, interface{}, interface{}) {
 	switch msg.(type) {
-	case models.CreateUeContextRequest:
-		r1, r2 := CreateUEContextProcedure(s1, msg.(models.CreateUeContextRequest))
+	case CreateUeContextRequest:
+		r1, r2 := CreateUEContextProcedure(s1, msg.(CreateUeContextRequest))
 		return r1, "", nil, r2
 	case models.UeContextRelease:
 		r1 := ReleaseUEContextProcedure(s1, msg.(models.UeContextRelease))
@@ -43,140 +64,202 @@ func UeContextHandler(s1, s2 string, msg interface{}) (interface{}, string, inte
 func HandleCreateUEContextRequest(request *http_wrapper.Request) *http_wrapper.Response {
 	logger.CommLog.Infof("Handle Create UE Context Request")
 
-	createUeContextRequest := request.Body.(models.CreateUeContextRequest)
+	createUeContextRequest := request.Body.(CreateUeContextRequest)
 	ueContextID := request.Params["ueContextId"]
 
 	amfSelf := context.AMF_Self()
 
-	ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID)
-	if !ok {
-		problemDetails := &models.ProblemDetails{
-			Status: http.StatusNotFound,
-			Cause:  "CONTEXT_NOT_FOUND",
+	ue, found := amfSelf.AmfUeFindByUeContextID(ueContextID)
+	if !found {
+		switch {
+		case strings.HasPrefix(ueContextID, "imsi"):
+			// the UE is handed over from another AMF, create the UE context in target amf
+			ue = amfSelf.NewAmfUe(ueContextID)
+		case strings.HasPrefix(ueContextID, "imei") && amfSelf.EmergencyEnabled():
+			// emergency registered UE without SUPI
+			ue = amfSelf.NewAmfUe("")
+			amfSelf.AddAmfUeToUePoolByPei(ue, ueContextID)
+		default:
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusForbidden,
+				Cause:  "HANDOVER_FAILURE",
+			}
+			return http_wrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
 		}
-		return http_wrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
 	}
+	if ue.EventChannel == nil {
+		ue.EventChannel = ue.NewEventChannel()
+		go ue.EventChannel.Start()
+	}
+	ue.InterAmfHandoverResult = make(chan context.InterAmfHandoverResult, 1)
+	defer func() {
+		ue.InterAmfHandoverResult = nil
+	}()
+
 	sbiMsg := context.SbiMsg{
 		UeContextId: ueContextID,
 		ReqUri:      "",
 		Msg:         createUeContextRequest,
 		Result:      make(chan context.SbiResponseMsg, 10),
 	}
-	var createUeContextRspData *models.CreateUeContextResponse
-	var ueContextCreateErr *models.UeContextCreateError
 	ue.EventChannel.UpdateSbiHandler(UeContextHandler)
 	ue.EventChannel.SubmitMessage(sbiMsg)
 	msg := <-sbiMsg.Result
-	if msg.RespData != nil {
-		createUeContextRspData = msg.RespData.(*models.CreateUeContextResponse)
-	}
 	if msg.TransferErr != nil {
-		ueContextCreateErr = msg.TransferErr.(*models.UeContextCreateError)
+		if ueContextCreateErr := msg.TransferErr.(*models.UeContextCreateError); ueContextCreateErr != nil {
+			// the handover is not prepared, the UE context created for it is removed
+			if !found {
+				ue.Remove()
+			}
+			return http_wrapper.NewResponse(int(ueContextCreateErr.Error.Status), nil, ueContextCreateErr)
+		}
 	}
-	//createUeContextResponse, ueContextCreateError := CreateUEContextProcedure(ueContextID, createUeContextRequest)
-	if ueContextCreateErr != nil {
-		return http_wrapper.NewResponse(int(ueContextCreateErr.Error.Status), nil, ueContextCreateErr)
-	} else {
+
+	// the response is sent when the target RAN has answered the Handover Request
+	select {
+	case result := <-ue.InterAmfHandoverResult:
+		if result.CreateError != nil {
+			return http_wrapper.NewResponse(int(result.CreateError.Error.Status), nil, result.CreateError)
+		}
+		createUeContextRspData := &CreateUeContextResponse{
+			JsonData:  result.CreatedData,
+			NgapParts: result.NgapParts,
+		}
 		return http_wrapper.NewResponse(http.StatusCreated, nil, createUeContextRspData)
+	case <-time.After(interAmfHandoverTimeout):
+		logger.CommLog.Warnf("Handover resource allocation for UE[%s] timed out", ueContextID)
+		ue.EventChannel.SubmitMessage(context.SbiMsg{
+			UeContextId: ueContextID,
+			Msg: models.UeContextRelease{
+				NgapCause: &models.NgApCause{
+					Group: int32(ngapType.CausePresentRadioNetwork),
+					Value: int32(ngapType.CauseRadioNetworkPresentTngrelocprepExpiry),
+				},
+			},
+			Result: make(chan context.SbiResponseMsg, 10),
+		})
+		ueContextCreateErr := &models.UeContextCreateError{
+			Error: &models.ProblemDetails{
+				Status: http.StatusForbidden,
+				Cause:  "HANDOVER_FAILURE",
+			},
+		}
+		return http_wrapper.NewResponse(http.StatusForbidden, nil, ueContextCreateErr)
 	}
 }
 
-func CreateUEContextProcedure(ueContextID string, createUeContextRequest models.CreateUeContextRequest) (
-	*models.CreateUeContextResponse, *models.UeContextCreateError) {
+// TS 23.502 4.9.1.3.2 step 4-9: store the UE context received from the source AMF, prepare
+// the PDU sessions at the SMFs and send the Handover Request to the target RAN. The response
+// is returned once the target RAN has answered (see ngap handover handlers).
+func CreateUEContextProcedure(ueContextID string, createUeContextRequest CreateUeContextRequest) (
+	*CreateUeContextResponse, *models.UeContextCreateError) {
 	amfSelf := context.AMF_Self()
 	ueContextCreateData := createUeContextRequest.JsonData
 
-	if ueContextCreateData.UeContext == nil || ueContextCreateData.TargetId == nil ||
+	if ueContextCreateData == nil || ueContextCreateData.UeContext == nil || ueContextCreateData.TargetId == nil ||
+		ueContextCreateData.TargetId.RanNodeId == nil || ueContextCreateData.TargetId.Tai == nil ||
 		ueContextCreateData.PduSessionList == nil || ueContextCreateData.SourceToTargetData == nil ||
-		ueContextCreateData.N2NotifyUri == "" {
-		ueContextCreateError := &models.UeContextCreateError{
-			Error: &models.ProblemDetails{
-				Status: http.StatusForbidden,
-				Cause:  "HANDOVER_FAILURE",
-			},
-		}
-		return nil, ueContextCreateError
-	}
-	// create the UE context in target amf
-	ue := amfSelf.NewAmfUe(ueContextID)
-	// amfSelf.AmfRanSetByRanId(*ueContextCreateData.TargetId.RanNodeId)
-	// ue.N1N2Message[ueContextId] = &context.N1N2Message{}
-	// ue.N1N2Message[ueContextId].Request.JsonData = &models.N1N2MessageTransferReqData{
-	// 	N2InfoContainer: &models.N2InfoContainer{
-	// 		SmInfo: &models.N2SmInformation{
-	// 			N2InfoContent: ueContextCreateData.SourceToTargetData,
-	// 		},
-	// 	},
-	// }
-	ue.HandoverNotifyUri = ueContextCreateData.N2NotifyUri
+		ueContextCreateData.SourceToTargetData.NgapData == nil || ueContextCreateData.N2NotifyUri == "" {
+		return nil, handoverFailure(nil)
+	}
+	ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		return nil, handoverFailure(nil)
+	}
 
-	amfSelf.AmfRanFindByRanID(*ueContextCreateData.TargetId.RanNodeId)
-	supportedTAI := context.NewSupportedTAI()
-	supportedTAI.Tai.Tac = ueContextCreateData.TargetId.Tai.Tac
-	supportedTAI.Tai.PlmnId = ueContextCreateData.TargetId.Tai.PlmnId
-	// ue.N1N2MessageSubscribeInfo[ueContextID] = &models.UeN1N2InfoSubscriptionCreateData{
-	// 	N2NotifyCallbackUri: ueContextCreateData.N2NotifyUri,
-	// }
+	ue.CopyDataFromUeContextModel(*ueContextCreateData.UeContext)
+	if ueContextCreateData.UeContext.SeafData != nil {
+		ue.SecurityContextAvailable = true
+	}
 	ue.UnauthenticatedSupi = ueContextCreateData.UeContext.SupiUnauthInd
-	// should be smInfo list
-
-	//for _, smInfo := range ueContextCreateData.PduSessionList {
-	//if smInfo.N2InfoContent.NgapIeType == "NgapIeType_HANDOVER_REQUIRED" {
-	// ue.N1N2Message[amfSelf.Uri].Request.JsonData.N2InfoContainer.SmInfo = &smInfo
-	//}
-	//}
-
+	// an UE context without an authenticated SUPI only exists for emergency registered UEs
+	if ue.UnauthenticatedSupi || strings.HasPrefix(ueContextID, "imei") {
+		if !amfSelf.EmergencyEnabled() {
+			ue.GmmLog.Warnf("Emergency services are not supported")
+			return nil, handoverFailure(nil)
+		}
+		ue.EmergencyRegistered = true
+	}
 	ue.RoutingIndicator = ueContextCreateData.UeContext.RoutingIndicator
-
 	// optional
 	ue.UdmGroupId = ueContextCreateData.UeContext.UdmGroupId
 	ue.AusfGroupId = ueContextCreateData.UeContext.AusfGroupId
-	// ueContextCreateData.UeContext.HpcfId
-	ue.RatType = ueContextCreateData.UeContext.RestrictedRatList[0] // minItem = -1
-	// ueContextCreateData.UeContext.ForbiddenAreaList
-	// ueContextCreateData.UeContext.ServiceAreaRestriction
-	// ueContextCreateData.UeContext.RestrictedCoreNwTypeList
-
-	// it's not in 5.2.2.1.1 step 2a, so don't support
-	// ue.Gpsi = ueContextCreateData.UeContext.GpsiList
-	// ue.Pei = ueContextCreateData.UeContext.Pei
-	// ueContextCreateData.UeContext.GroupList
-	// ueContextCreateData.UeContext.DrxParameter
-	// ueContextCreateData.UeContext.SubRfsp
-	// ueContextCreateData.UeContext.UsedRfsp
-	// ue.UEAMBR = ueContextCreateData.UeContext.SubUeAmbr
-	// ueContextCreateData.UeContext.SmsSupport
-	// ueContextCreateData.UeContext.SmsfId
-	// ueContextCreateData.UeContext.SeafData
-	// ueContextCreateData.UeContext.Var5gMmCapability
-	// ueContextCreateData.UeContext.PcfId
-	// ueContextCreateData.UeContext.PcfAmPolicyUri
-	// ueContextCreateData.UeContext.AmPolicyReqTriggerList
-	// ueContextCreateData.UeContext.EventSubscriptionList
-	// ueContextCreateData.UeContext.MmContextList
-	// ue.CurPduSession.PduSessionId = ueContextCreateData.UeContext.SessionContextList.
-	// ue.TraceData = ueContextCreateData.UeContext.TraceData
-	createUeContextResponse := new(models.CreateUeContextResponse)
-	createUeContextResponse.JsonData = &models.UeContextCreatedData{
-		UeContext: &models.UeContext{
-			Supi: ueContextCreateData.UeContext.Supi,
-		},
+	ue.RatType = models.RatType_NR
+	ue.HandoverNotifyUri = ueContextCreateData.N2NotifyUri
+	ue.Tai = *ueContextCreateData.TargetId.Tai
+
+	targetRan, ok := amfSelf.AmfRanFindByRanID(*ueContextCreateData.TargetId.RanNodeId)
+	if !ok {
+		ue.GmmLog.Errorf("Target RAN[%+v] not found", *ueContextCreateData.TargetId.RanNodeId)
+		return nil, handoverFailure(&models.NgApCause{
+			Group: int32(ngapType.CausePresentRadioNetwork),
+			Value: int32(ngapType.CauseRadioNetworkPresentUnknownTargetID),
+		})
 	}
 
-	// response.JsonData.TargetToSourceData =
-	// ue.N1N2Message[ueContextId].Request.JsonData.N2InfoContainer.SmInfo.N2InfoContent
-	createUeContextResponse.JsonData.PduSessionList = ueContextCreateData.PduSessionList
-	createUeContextResponse.JsonData.PcfReselectedInd = false
-	// TODO: When  Target AMF selects a nw PCF for AM policy, set the flag to true.
+	var pduSessionReqList ngapType.PDUSessionResourceSetupListHOReq
+	for _, smInfo := range ueContextCreateData.PduSessionList {
+		smContext, exist := ue.SmContextFindByPDUSessionID(smInfo.PduSessionId)
+		if !exist || smInfo.N2InfoContent == nil || smInfo.N2InfoContent.NgapData == nil {
+			ue.GmmLog.Warnf("PDU Session[%d] can not be handed over", smInfo.PduSessionId)
+			continue
+		}
+		transfer := createUeContextRequest.NgapParts[smInfo.N2InfoContent.NgapData.ContentId]
+		if len(transfer) == 0 {
+			ue.GmmLog.Warnf("HandoverRequiredTransfer of PDU Session[%d] is missing", smInfo.PduSessionId)
+			continue
+		}
+		response, _, _, err := consumer.SendUpdateSmContextN2HandoverPreparing(ue, smContext,
+			models.N2SmInfoType_HANDOVER_REQUIRED, transfer, amfSelf.NfId, ueContextCreateData.TargetId)
+		if err != nil {
+			ue.GmmLog.Errorf("consumer.SendUpdateSmContextN2HandoverPreparing Error: %+v", err)
+		}
+		if response == nil || response.BinaryDataN2SmInformation == nil {
+			ue.GmmLog.Errorf("SendUpdateSmContextN2HandoverPreparing Error for PduSessionId[%d]", smInfo.PduSessionId)
+			continue
+		}
+		ngap_message.AppendPDUSessionResourceSetupListHOReq(&pduSessionReqList, smInfo.PduSessionId,
+			smContext.Snssai(), response.BinaryDataN2SmInformation)
+	}
+	if len(pduSessionReqList.List) == 0 {
+		return nil, handoverFailure(&models.NgApCause{
+			Group: int32(ngapType.CausePresentRadioNetwork),
+			Value: int32(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem),
+		})
+	}
 
-	//response.UeContext = ueContextCreateData.UeContext
-	//response.TargetToSourceData = ue.N1N2Message[amfSelf.Uri].Request.JsonData.N2InfoContainer.SmInfo.N2InfoContent
-	//response.PduSessionList = ueContextCreateData.PduSessionList
-	//response.PcfReselectedInd = false // TODO:When  Target AMF selects a nw PCF for AM policy, set the flag to true.
-	//
+	causePresent := ngapType.CausePresentRadioNetwork
+	causeValue := ngapType.CauseRadioNetworkPresentHandoverDesirableForRadioReason
+	if ngapCause := ueContextCreateData.NgapCause; ngapCause != nil {
+		causePresent, causeValue = int(ngapCause.Group), aper.Enumerated(ngapCause.Value)
+	}
+	cause, err := ngap_message.BuildCause(causePresent, causeValue)
+	if err != nil {
+		ue.GmmLog.Errorf("Build NGAP cause error: %+v", err)
+		return nil, handoverFailure(nil)
+	}
+	var container ngapType.SourceToTargetTransparentContainer
+	container.Value = createUeContextRequest.NgapParts[ueContextCreateData.SourceToTargetData.NgapData.ContentId]
+	if len(container.Value) == 0 {
+		ue.GmmLog.Errorln("SourceToTargetData is missing")
+		return nil, handoverFailure(nil)
+	}
+	if err := ngap_message.SendHandoverRequestToTargetRan(ue, targetRan, cause, pduSessionReqList,
+		container, false); err != nil {
+		ue.GmmLog.Errorf("Send Handover Request error: %+v", err)
+		return nil, handoverFailure(nil)
+	}
+	return nil, nil
+}
 
-	// return http_wrapper.NewResponse(http.StatusCreated, nil, createUeContextResponse)
-	return createUeContextResponse, nil
+func handoverFailure(ngapCause *models.NgApCause) *models.UeContextCreateError {
+	return &models.UeContextCreateError{
+		Error: &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "HANDOVER_FAILURE",
+		},
+		NgapCause: ngapCause,
+	}
 }
 
 // TS 29.518 5.2.2.2.4
@@ -216,16 +299,6 @@ func HandleReleaseUEContextRequest(request *http_wrapper.Request) *http_wrapper.
 func ReleaseUEContextProcedure(ueContextID string, ueContextRelease models.UeContextRelease) *models.ProblemDetails {
 	amfSelf := context.AMF_Self()
 
-	// TODO: UE is emergency registered and the SUPI is not authenticated
-	if ueContextRelease.Supi != "" {
-		logger.GmmLog.Warnf("Emergency registered UE is not supported.")
-		problemDetails := &models.ProblemDetails{
-			Status: http.StatusForbidden,
-			Cause:  "UNSPECIFIED",
-		}
-		return problemDetails
-	}
-
 	if ueContextRelease.NgapCause == nil {
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusBadRequest,
@@ -237,7 +310,21 @@ func ReleaseUEContextProcedure(ueContextID string, ueContextRelease models.UeCon
 	logger.CommLog.Debugf("Release UE Context NGAP cause: %+v", ueContextRelease.NgapCause)
 
 	if ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID); ok {
-		ue.Remove()
+		// TS 29.518 6.1.6.2.21: the SUPI is given for an emergency registered UE identified by its PEI
+		if ueContextRelease.Supi != "" && (!ue.EmergencyRegistered || ue.Supi != ueContextRelease.Supi) {
+			ue.ProducerLog.Warnf("SUPI[%s] does not match the emergency registered UE", ueContextRelease.Supi)
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusForbidden,
+				Cause:  "SUPI_OR_PEI_UNKNOWN",
+			}
+			return problemDetails
+		}
+		if ue.HandoverNotifyUri != "" {
+			// TS 23.502 4.11.1.2.3 step 3-4: the source AMF cancelled the inter-AMF handover
+			cancelInterAmfHandover(ue, *ueContextRelease.NgapCause)
+		} else {
+			ue.Remove()
+		}
 	} else {
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusNotFound,
@@ -319,84 +406,38 @@ func UEContextTransferProcedure(ueContextID string, ueContextTransferRequest mod
 		return nil, problemDetails
 	}
 
-	var ueContextTransferResponse *models.UeContextTransferResponse
-	ueContextTransferResponse.JsonData = new(models.UeContextTransferRspData)
+	ueContextTransferResponse := &models.UeContextTransferResponse{
+		JsonData: new(models.UeContextTransferRspData),
+	}
 	ueContextTransferRspData := ueContextTransferResponse.JsonData
 
-	//if ue.GetAnType() != UeContextTransferReqData.AccessType {
-	//for _, tai := range ue.RegistrationArea[ue.GetAnType()] {
-	//if UeContextTransferReqData.PlmnId == tai.PlmnId {
-	// TODO : generate N2 signalling
-	//}
-	//}
-	//}
-
 	switch UeContextTransferReqData.Reason {
-	case models.TransferReason_INIT_REG:
-		// TODO: check integrity of the registration request included in ueContextTransferRequest
-		// TODO: handle condition of TS 29.518 5.2.2.2.1.1 step 2a case b
-		ueContextTransferRspData.UeContext = buildUEContextModel(ue)
-	case models.TransferReason_MOBI_REG:
-		// TODO: check integrity of the registration request included in ueContextTransferRequest
-		ueContextTransferRspData.UeContext = buildUEContextModel(ue)
-
-		sessionContextList := &ueContextTransferRspData.UeContext.SessionContextList
-		ue.SmContextList.Range(func(key, value interface{}) bool {
-			smContext := value.(*context.SmContext)
-			snssai := smContext.Snssai()
-			pduSessionContext := models.PduSessionContext{
-				PduSessionId: smContext.PduSessionID(),
-				SmContextRef: smContext.SmContextRef(),
-				SNssai:       &snssai,
-				Dnn:          smContext.Dnn(),
-				AccessType:   smContext.AccessType(),
-				HsmfId:       smContext.HSmfID(),
-				VsmfId:       smContext.VSmfID(),
-				NsInstance:   smContext.NsInstance(),
+	case models.TransferReason_INIT_REG, models.TransferReason_MOBI_REG:
+		// TS 29.518 5.2.2.2.1.1 step 2a: the UE context is only returned if the integrity check
+		// of the Registration Request succeeds with the security context of this AMF
+		if UeContextTransferReqData.RegRequest == nil {
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusBadRequest,
+				Cause:  "MANDATORY_IE_MISSING",
+				InvalidParams: []models.InvalidParam{
+					{
+						Param: "regRequest",
+					},
+				},
 			}
-			*sessionContextList = append(*sessionContextList, pduSessionContext)
-			return true
-		})
-
-		ueContextTransferRspData.UeRadioCapability = &models.N2InfoContent{
-			NgapMessageType: 0,
-			NgapIeType:      models.NgapIeType_UE_RADIO_CAPABILITY,
-			NgapData: &models.RefToBinaryData{
-				ContentId: "n2Info",
-			},
+			return nil, problemDetails
 		}
-		b := []byte(ue.UeRadioCapability)
-		copy(ueContextTransferResponse.BinaryDataN2Information, b)
-	case models.TransferReason_MOBI_REG_UE_VALIDATED:
-		ueContextTransferRspData.UeContext = buildUEContextModel(ue)
-
-		sessionContextList := &ueContextTransferRspData.UeContext.SessionContextList
-		ue.SmContextList.Range(func(key, value interface{}) bool {
-			smContext := value.(*context.SmContext)
-			snssai := smContext.Snssai()
-			pduSessionContext := models.PduSessionContext{
-				PduSessionId: smContext.PduSessionID(),
-				SmContextRef: smContext.SmContextRef(),
-				SNssai:       &snssai,
-				Dnn:          smContext.Dnn(),
-				AccessType:   smContext.AccessType(),
-				HsmfId:       smContext.HSmfID(),
-				VsmfId:       smContext.VSmfID(),
-				NsInstance:   smContext.NsInstance(),
+		if !nas_security.VerifyIntegrity(ue, UeContextTransferReqData.AccessType,
+			ueContextTransferRequest.BinaryDataN1Message) {
+			ue.ProducerLog.Warnln("Integrity check of the Registration Request from the new AMF failed")
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusForbidden,
+				Cause:  "INTEGRITY_CHECK_FAIL",
 			}
-			*sessionContextList = append(*sessionContextList, pduSessionContext)
-			return true
-		})
-
-		ueContextTransferRspData.UeRadioCapability = &models.N2InfoContent{
-			NgapMessageType: 0,
-			NgapIeType:      models.NgapIeType_UE_RADIO_CAPABILITY,
-			NgapData: &models.RefToBinaryData{
-				ContentId: "n2Info",
-			},
+			return nil, problemDetails
 		}
-		b := []byte(ue.UeRadioCapability)
-		copy(ueContextTransferResponse.BinaryDataN2Information, b)
+	case models.TransferReason_MOBI_REG_UE_VALIDATED:
+		// the new AMF has authenticated the UE itself
 	default:
 		logger.ProducerLog.Warnf("Invalid Transfer Reason: %+v", UeContextTransferReqData.Reason)
 		problemDetails := &models.ProblemDetails{
@@ -410,86 +451,28 @@ func UEContextTransferProcedure(ueContextID string, ueContextTransferRequest mod
 		}
 		return nil, problemDetails
 	}
-	return ueContextTransferResponse, nil
-}
-
-func buildUEContextModel(ue *context.AmfUe) *models.UeContext {
-	ueContext := new(models.UeContext)
-	ueContext.Supi = ue.Supi
-	ueContext.SupiUnauthInd = ue.UnauthenticatedSupi
-
-	if ue.Gpsi != "" {
-		ueContext.GpsiList = append(ueContext.GpsiList, ue.Gpsi)
-	}
-
-	if ue.Pei != "" {
-		ueContext.Pei = ue.Pei
-	}
-
-	if ue.UdmGroupId != "" {
-		ueContext.UdmGroupId = ue.UdmGroupId
-	}
-
-	if ue.AusfGroupId != "" {
-		ueContext.AusfGroupId = ue.AusfGroupId
-	}
 
-	if ue.RoutingIndicator != "" {
-		ueContext.RoutingIndicator = ue.RoutingIndicator
+	ueContext := consumer.BuildUeContextModel(ue)
+	ueContextTransferRspData.UeContext = &ueContext
+	ue.ContextTransferReason = UeContextTransferReqData.Reason
+	if UeContextTransferReqData.Reason == models.TransferReason_INIT_REG {
+		// the PDU sessions are not kept over an initial registration, they are released once the
+		// new AMF reports the transfer (RegistrationStatusUpdate)
+		ueContextTransferRspData.UeContext.SessionContextList = nil
+		return ueContextTransferResponse, nil
 	}
 
-	if ue.AccessAndMobilitySubscriptionData != nil {
-		if ue.AccessAndMobilitySubscriptionData.SubscribedUeAmbr != nil {
-			ueContext.SubUeAmbr = &models.Ambr{
-				Uplink:   ue.AccessAndMobilitySubscriptionData.SubscribedUeAmbr.Uplink,
-				Downlink: ue.AccessAndMobilitySubscriptionData.SubscribedUeAmbr.Downlink,
-			}
-		}
-		if ue.AccessAndMobilitySubscriptionData.RfspIndex != 0 {
-			ueContext.SubRfsp = ue.AccessAndMobilitySubscriptionData.RfspIndex
-		}
-	}
-
-	if ue.PcfId != "" {
-		ueContext.PcfId = ue.PcfId
-	}
-
-	if ue.AmPolicyUri != "" {
-		ueContext.PcfAmPolicyUri = ue.AmPolicyUri
-	}
-
-	if ue.AmPolicyAssociation != nil {
-		if len(ue.AmPolicyAssociation.Triggers) > 0 {
-			ueContext.AmPolicyReqTriggerList = buildAmPolicyReqTriggers(ue.AmPolicyAssociation.Triggers)
-		}
-	}
-
-	for _, eventSub := range ue.EventSubscriptionsInfo {
-		if eventSub.EventSubscription != nil {
-			ueContext.EventSubscriptionList = append(ueContext.EventSubscriptionList, *eventSub.EventSubscription)
-		}
-	}
-
-	if ue.TraceData != nil {
-		ueContext.TraceData = ue.TraceData
-	}
-	return ueContext
-}
-
-func buildAmPolicyReqTriggers(triggers []models.RequestTrigger) (amPolicyReqTriggers []models.AmPolicyReqTrigger) {
-	for _, trigger := range triggers {
-		switch trigger {
-		case models.RequestTrigger_LOC_CH:
-			amPolicyReqTriggers = append(amPolicyReqTriggers, models.AmPolicyReqTrigger_LOCATION_CHANGE)
-		case models.RequestTrigger_PRA_CH:
-			amPolicyReqTriggers = append(amPolicyReqTriggers, models.AmPolicyReqTrigger_PRA_CHANGE)
-		case models.RequestTrigger_SERV_AREA_CH:
-			amPolicyReqTriggers = append(amPolicyReqTriggers, models.AmPolicyReqTrigger_SARI_CHANGE)
-		case models.RequestTrigger_RFSP_CH:
-			amPolicyReqTriggers = append(amPolicyReqTriggers, models.AmPolicyReqTrigger_RFSP_INDEX_CHANGE)
+	if ue.UeRadioCapability != "" {
+		ueContextTransferRspData.UeRadioCapability = &models.N2InfoContent{
+			NgapMessageType: 0,
+			NgapIeType:      models.NgapIeType_UE_RADIO_CAPABILITY,
+			NgapData: &models.RefToBinaryData{
+				ContentId: "n2Info",
+			},
 		}
+		ueContextTransferResponse.BinaryDataN2Information = []byte(ue.UeRadioCapability)
 	}
-	return
+	return ueContextTransferResponse, nil
 }
 
 // TS 29.518 5.2.2.6
@@ -633,13 +616,17 @@ func RegistrationStatusUpdateProcedure(ueContextID string, ueRegStatusUpdateReqD
 			smContext, ok := ue.SmContextFindByPDUSessionID(pduSessionId)
 			if !ok {
 				ue.ProducerLog.Errorf("SmContext[PDU Session ID:%d] not found", pduSessionId)
+				continue
 			}
-			problem, err := consumer.SendReleaseSmContextRequest(ue, smContext, causeAll, "", nil)
-			if problem != nil {
-				logger.GmmLog.Errorf("Release SmContext[pduSessionId: %d] Failed Problem[%+v]", pduSessionId, problem)
-			} else if err != nil {
-				logger.GmmLog.Errorf("Release SmContext[pduSessionId: %d] Error[%v]", pduSessionId, err.Error())
-			}
+			releaseSmContext(ue, smContext, causeAll)
+		}
+		// the PDU sessions of the UE were not transferred on an initial registration (TS 23.502 4.2.2.2.2),
+		// every SM context left is released before the UE context is removed
+		if ue.ContextTransferReason == models.TransferReason_INIT_REG {
+			ue.SmContextList.Range(func(key, value interface{}) bool {
+				releaseSmContext(ue, value.(*context.SmContext), nil)
+				return true
+			})
 		}
 
 		if ueRegStatusUpdateReqData.PcfReselectedInd {
@@ -652,6 +639,7 @@ func RegistrationStatusUpdateProcedure(ueContextID string, ueRegStatusUpdateReqD
 		}
 
 		ue.Remove()
+		context.DeleteContextFromDB(ue)
 	} else {
 		// NOT_TRANSFERRED
 		logger.CommLog.Debug("[AMF] RegistrationStatusUpdate: NOT_TRANSFERRED")
@@ -660,3 +648,43 @@ func RegistrationStatusUpdateProcedure(ueContextID string, ueRegStatusUpdateReqD
 	ueRegStatusUpdateRspData.RegStatusTransferComplete = true
 	return ueRegStatusUpdateRspData, nil
 }
+
+func releaseSmContext(ue *context.AmfUe, smContext *context.SmContext, causeAll *context.CauseAll) {
+	pduSessionId := smContext.PduSessionID()
+	problem, err := consumer.SendReleaseSmContextRequest(ue, smContext, causeAll, "", nil)
+	if problem != nil {
+		logger.GmmLog.Errorf("Release SmContext[pduSessionId: %d] Failed Problem[%+v]", pduSessionId, problem)
+	} else if err != nil {
+		logger.GmmLog.Errorf("Release SmContext[pduSessionId: %d] Error[%v]", pduSessionId, err.Error())
+	}
+}
+
+func cancelInterAmfHandover(ue *context.AmfUe, ngapCause models.NgApCause) {
+	ue.SmContextList.Range(func(key, value interface{}) bool {
+		smContext := value.(*context.SmContext)
+		_, _, _, err := consumer.SendUpdateSmContextN2HandoverCanceled(ue, smContext,
+			context.CauseAll{NgapCause: &ngapCause})
+		if err != nil {
+			ue.GmmLog.Errorf("Send UpdateSmContextN2HandoverCanceled Error for PduSessionId[%d]", key.(int32))
+		}
+		return true
+	})
+	ue.NotifyInterAmfHandoverResult(context.InterAmfHandoverResult{
+		CreateError: handoverFailure(&ngapCause),
+	})
+
+	// the UE context is removed when the target RAN has released the UE
+	released := false
+	context.AMF_Self().RanUePool.Range(func(key, value interface{}) bool {
+		ranUe := value.(*context.RanUe)
+		if ranUe.AmfUe == ue {
+			ngap_message.SendUEContextReleaseCommand(ranUe, context.UeContextReleaseInterAmfHandover,
+				int(ngapCause.Group), aper.Enumerated(ngapCause.Value))
+			released = true
+		}
+		return true
+	})
+	if !released {
+		ue.Remove()
+	}
+}
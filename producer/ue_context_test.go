@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package producer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/omec-project/amf/context"
+	"github.com/omec-project/nas/security"
+	"github.com/omec-project/openapi/models"
+)
+
+// protectedRegistrationRequest integrity protects a Registration Request with the NAS COUNT and the bearer
+// of the access, as the UE sends it to the new AMF
+func protectedRegistrationRequest(t *testing.T, ue *context.AmfUe, anType models.AccessType) []byte {
+	plain := []byte{0x7e, 0x00, 0x41, 0x01, 0x00, 0x0b, 0xf2, 0x02, 0xf8, 0x39, 0xca, 0xfe, 0x00, 0x00, 0x00, 0x00, 0x01}
+	count := ue.NasULCount(anType)
+	payload := append([]byte{count.SQN()}, plain...)
+	mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, count.Get(), context.NasBearer(anType),
+		security.DirectionUplink, payload)
+	if err != nil {
+		t.Fatalf("NASMacCalculate: %v", err)
+	}
+	return append(append([]byte{0x7e, 0x01}, mac32...), payload...)
+}
+
+func TestUEContextTransferProcedure(t *testing.T) {
+	ue := context.AMF_Self().NewAmfUe("imsi-208930000007497")
+	defer ue.Remove()
+	ue.SecurityContextAvailable = true
+	ue.IntegrityAlg = security.AlgIntegrity128NIA2
+	copy(ue.KnasInt[:], []byte("0123456789abcdef"))
+	ue.ULCount.Set(0, 5)
+	ue.Non3gppULCount.Set(0, 9)
+
+	protected3gpp := protectedRegistrationRequest(t, ue, models.AccessType__3_GPP_ACCESS)
+	protectedNon3gpp := protectedRegistrationRequest(t, ue, models.AccessType_NON_3_GPP_ACCESS)
+	tampered := append([]byte(nil), protected3gpp...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	testCases := []struct {
+		description string
+		reason      models.TransferReason
+		anType      models.AccessType
+		regRequest  []byte
+		status      int32
+	}{
+		{
+			description: "Registration Request on 3GPP access",
+			reason:      models.TransferReason_INIT_REG,
+			anType:      models.AccessType__3_GPP_ACCESS,
+			regRequest:  protected3gpp,
+		},
+		{
+			description: "Registration Request on non-3GPP access",
+			reason:      models.TransferReason_MOBI_REG,
+			anType:      models.AccessType_NON_3_GPP_ACCESS,
+			regRequest:  protectedNon3gpp,
+		},
+		{
+			description: "Registration Request protected for the other access",
+			reason:      models.TransferReason_INIT_REG,
+			anType:      models.AccessType__3_GPP_ACCESS,
+			regRequest:  protectedNon3gpp,
+			status:      http.StatusForbidden,
+		},
+		{
+			description: "tampered Registration Request",
+			reason:      models.TransferReason_INIT_REG,
+			anType:      models.AccessType__3_GPP_ACCESS,
+			regRequest:  tampered,
+			status:      http.StatusForbidden,
+		},
+		{
+			description: "Registration Request is missing",
+			reason:      models.TransferReason_MOBI_REG,
+			anType:      models.AccessType__3_GPP_ACCESS,
+			status:      http.StatusBadRequest,
+		},
+		{
+			description: "UE validated by the new AMF",
+			reason:      models.TransferReason_MOBI_REG_UE_VALIDATED,
+			anType:      models.AccessType__3_GPP_ACCESS,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			request := models.UeContextTransferRequest{
+				JsonData: &models.UeContextTransferReqData{
+					Reason:     tc.reason,
+					AccessType: tc.anType,
+				},
+			}
+			if tc.regRequest != nil {
+				request.JsonData.RegRequest = &models.N1MessageContainer{
+					N1MessageClass:   models.N1MessageClass__5_GMM,
+					N1MessageContent: &models.RefToBinaryData{ContentId: "n1Msg"},
+				}
+				request.BinaryDataN1Message = tc.regRequest
+			}
+
+			rsp, problemDetails := UEContextTransferProcedure(ue.Supi, request)
+			if tc.status != 0 {
+				if problemDetails == nil || problemDetails.Status != tc.status {
+					t.Errorf("Problem details, want status: %d, got: %+v", tc.status, problemDetails)
+				}
+				return
+			}
+			if problemDetails != nil {
+				t.Fatalf("UE context transfer is rejected: %+v", problemDetails)
+			}
+			if rsp.JsonData.UeContext == nil || rsp.JsonData.UeContext.Supi != ue.Supi {
+				t.Errorf("UE context is not transferred: %+v", rsp.JsonData)
+			}
+		})
+	}
+
+	// the NAS COUNT is only updated by the NAS messages received by this AMF
+	if ue.ULCount.Get() != 5 || ue.Non3gppULCount.Get() != 9 {
+		t.Errorf("NAS COUNT is updated, 3GPP: %d, non-3GPP: %d", ue.ULCount.Get(), ue.Non3gppULCount.Get())
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"reflect"
 	"strconv"
 	"sync"
 	"syscall"
@@ -127,6 +128,9 @@ func (amf *AMF) Initialize(c *cli.Context) error {
 	if err := factory.CheckConfigVersion(); err != nil {
 		return err
 	}
+	if err := factory.CheckOverloadConfig(); err != nil {
+		return err
+	}
 
 	if _, err := os.Stat("/free5gc/config/amfcfg.conf"); err == nil {
 		viper.SetConfigName("amfcfg.conf")
@@ -167,7 +171,12 @@ func (amf *AMF) WatchConfig() {
 			fmt.Println("error in loading updated configuration")
 		} else {
 			self := context.AMF_Self()
+			securityAlgorithm := self.SecurityAlgorithm
 			util.InitAmfContext(self)
+			ngap.SendAMFConfigurationUpdateToRans()
+			if !reflect.DeepEqual(securityAlgorithm, self.SecurityAlgorithm) {
+				HandleSecurityPolicyChange()
+			}
 			fmt.Println("successfully updated configuration")
 		}
 	})
@@ -334,10 +343,13 @@ func (amf *AMF) Start() {
 	addr := fmt.Sprintf("%s:%d", self.BindingIPv4, self.SBIPort)
 
 	ngapHandler := ngap_service.NGAPHandler{
-		HandleMessage:      ngap.Dispatch,
-		HandleNotification: ngap.HandleSCTPNotification,
+		HandleMessage:        ngap.DispatchStream,
+		HandleNotification:   ngap.HandleSCTPNotification,
+		HandlePeerAddrChange: ngap.HandleSCTPPeerAddrChange,
 	}
+	ngap_service.ConfigureSctp(factory.AmfConfig.Configuration.Sctp)
 	ngap_service.Run(self.NgapIpList, self.NgapPort, ngapHandler)
+	ngap.StartOverloadControl()
 
 	go amf.SendNFProfileUpdateToNrf()
 
@@ -429,8 +441,6 @@ func (amf *AMF) Terminate() {
 	logger.InitLog.Infof("Terminating AMF...")
 	amfSelf := context.AMF_Self()
 
-	// TODO: forward registered UE contexts to target AMF in the same AMF set if there is one
-
 	// deregister with NRF
 	problemDetails, err := consumer.SendDeregisterNFInstance()
 	if problemDetails != nil {
@@ -441,21 +451,56 @@ func (amf *AMF) Terminate() {
 		logger.InitLog.Infof("[AMF] Deregister from NRF successfully")
 	}
 
-	// send AMF status indication to ran to notify ran that this AMF will be unavailable
+	// new registrations are rejected until the AMF is terminated
+	amfSelf.SetDraining(true)
+
+	// send AMF status indication to ran to notify ran that this AMF will be unavailable,
+	// the RAN selects the backup AMF for UEs of the unavailable GUAMIs (TS 23.501 5.21.2.2)
 	logger.InitLog.Infof("Send AMF Status Indication to Notify RANs due to AMF terminating")
-	unavailableGuamiList := ngap_message.BuildUnavailableGUAMIList(amfSelf.ServedGuamiList)
-	amfSelf.AmfRanPool.Range(func(key, value interface{}) bool {
-		ran := value.(*context.AmfRan)
+	unavailableGuamiList := ngap_message.BuildUnavailableGUAMIList(amfSelf.ServedGuamiList, amfSelf.BackupAmfName)
+	for _, ran := range amfSelf.AmfRanListInArea(nil, nil) {
 		ngap_message.SendAMFStatusIndication(ran, unavailableGuamiList)
-		return true
-	})
+	}
 
-	ngap_service.Stop()
+	callback.SendAmfStatusChangeNotify((string)(models.StatusChange_UNAVAILABLE), amfSelf.ServedGuamiList,
+		amfSelf.BackupAmfName)
 
-	callback.SendAmfStatusChangeNotify((string)(models.StatusChange_UNAVAILABLE), amfSelf.ServedGuamiList)
+	amf.drainUes(amfSelf.ShutdownGracePeriod)
+
+	ngap_service.Stop()
 	logger.InitLog.Infof("AMF terminated")
 }
 
+// drainUes waits until all UEs have left CM-CONNECTED on this AMF (released or
+// moved to the backup AMF) or the grace period expired
+func (amf *AMF) drainUes(gracePeriod time.Duration) {
+	if gracePeriod <= 0 {
+		return
+	}
+	amfSelf := context.AMF_Self()
+	logger.InitLog.Infof("Wait up to %v for UEs to move to another AMF", gracePeriod)
+
+	deadline := time.Now().Add(gracePeriod)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		connectedUes := 0
+		amfSelf.RanUePool.Range(func(key, value interface{}) bool {
+			connectedUes++
+			return true
+		})
+		if connectedUes == 0 {
+			logger.InitLog.Infof("All UEs moved, continue terminating")
+			return
+		}
+		if time.Now().After(deadline) {
+			logger.InitLog.Warnf("Grace period expired with %d UEs still connected", connectedUes)
+			return
+		}
+		<-ticker.C
+	}
+}
+
 func (amf *AMF) StartKeepAliveTimer(nfProfile models.NfProfile) {
 	KeepAliveTimerMutex.Lock()
 	defer KeepAliveTimerMutex.Unlock()
@@ -620,10 +665,9 @@ func (amf *AMF) UpdateConfig(commChannel chan *protos.NetworkSliceResponse) bool
 			if len(ns.DeletedImsis) > 0 {
 				HandleImsiDeleteFromNetworkSlice(ns)
 			}
-			//TODO Inform connected UEs with update Slice
-			/*if len(ns.AddUpdatedImsis) > 0 {
+			if len(ns.AddUpdatedImsis) > 0 {
 				HandleImsiAddInNetworkSlice(ns)
-			}*/
+			}
 
 			if ns.Site != nil {
 				site := ns.Site
@@ -673,6 +717,7 @@ func (amf *AMF) SendNFProfileUpdateToNrf() {
 		if rocUpdateConfig {
 			self := context.AMF_Self()
 			util.InitAmfContext(self)
+			ngap.SendAMFConfigurationUpdateToRans()
 
 			// Register to NRF with Updated Profile
 			var profile models.NfProfile
@@ -786,8 +831,41 @@ func HandleImsiAddInNetworkSlice(slice *protos.NetworkSlice) {
 			Sst:  slice.Nssai.Sst,
 			Sd:   slice.Nssai.Sd,
 		}
-
+		ue.SetEventChannel(nil)
 		ue.EventChannel.UpdateConfigHandler(UeConfigSliceAddHandler)
 		ue.EventChannel.SubmitMessage(configMsg)
 	}
 }
+
+func UeConfigSecurityPolicyHandler(supi, sst, sd string, msg interface{}) {
+	ue := msg.(*context.AmfUe)
+	for _, accessType := range []models.AccessType{models.AccessType__3_GPP_ACCESS, models.AccessType_NON_3_GPP_ACCESS} {
+		if ue.State[accessType] == nil || !ue.State[accessType].Is(context.Registered) {
+			continue
+		}
+		gmm.GmmFSM.SendEvent(ue.State[accessType], gmm.SecurityPolicyChangeEvent, fsm.ArgsType{
+			gmm.ArgAmfUe:      ue,
+			gmm.ArgAccessType: accessType,
+		})
+	}
+}
+
+// HandleSecurityPolicyChange re-runs the security mode control procedure for the registered UEs
+// whose NAS security algorithms are no longer allowed by the updated policy
+func HandleSecurityPolicyChange() {
+	logger.CfgLog.Infof("[AMF] Handle NAS Security Policy Change")
+
+	amfSelf := context.AMF_Self()
+	amfSelf.UePool.Range(func(key, value interface{}) bool {
+		ue := value.(*context.AmfUe)
+		//publish the event to ue channel
+		configMsg := context.ConfigMsg{
+			Supi: ue.Supi,
+			Msg:  ue,
+		}
+		ue.SetEventChannel(nil)
+		ue.EventChannel.UpdateConfigHandler(UeConfigSecurityPolicyHandler)
+		ue.EventChannel.SubmitMessage(configMsg)
+		return true
+	})
+}
@@ -8,6 +8,7 @@ package util
 
 import (
 	"os"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/omec-project/util/drsm"
@@ -53,6 +54,15 @@ func InitAmfContext(context *context.AMFContext) {
 	}
 	context.NgapPort = configuration.NgapPort
 	context.SctpGrpcPort = configuration.SctpGrpcPort
+	context.NgapWorkerPoolSize = configuration.NgapWorkerPoolSize
+	context.SctpNumOutStreams = factory.DefaultSctpNumOutStreams
+	if configuration.Sctp != nil && configuration.Sctp.NumOutStreams != 0 {
+		context.SctpNumOutStreams = configuration.Sctp.NumOutStreams
+	}
+	if configuration.Shutdown != nil {
+		context.ShutdownGracePeriod = time.Duration(configuration.Shutdown.GracePeriod) * time.Second
+		context.BackupAmfName = configuration.Shutdown.BackupAmfName
+	}
 	sbi := configuration.Sbi
 	if sbi.Scheme != "" {
 		context.UriScheme = models.UriScheme(sbi.Scheme)
@@ -103,16 +113,25 @@ func InitAmfContext(context *context.AMFContext) {
 	if security != nil {
 		context.SecurityAlgorithm.IntegrityOrder = getIntAlgOrder(security.IntegrityOrder)
 		context.SecurityAlgorithm.CipheringOrder = getEncAlgOrder(security.CipheringOrder)
+		context.SecurityAlgorithm.Policies = getSecurityPolicies(security.Policies)
 	}
 	context.NetworkName = configuration.NetworkName
 	context.T3502Value = configuration.T3502Value
 	context.T3512Value = configuration.T3512Value
 	context.Non3gppDeregistrationTimerValue = configuration.Non3gppDeregistrationTimerValue
+	context.MobileReachableTimerValue = configuration.MobileReachableTimerValue
+	context.ImplicitDeregTimerValue = configuration.ImplicitDeregTimerValue
 	context.T3513Cfg = configuration.T3513
 	context.T3522Cfg = configuration.T3522
 	context.T3550Cfg = configuration.T3550
 	context.T3560Cfg = configuration.T3560
 	context.T3565Cfg = configuration.T3565
+	context.T3555Cfg = configuration.T3555
+	context.OverloadCfg = configuration.Overload
+	context.CaptureCfg = configuration.Capture
+	context.EmergencyCfg = configuration.Emergency
+	context.GutiReallocationCfg = configuration.GutiReallocation
+	context.Non3gppTaiCfg = configuration.Non3gppTai
 	context.EnableSctpLb = configuration.EnableSctpLb
 	context.EnableDbStore = configuration.EnableDbStore
 
@@ -153,3 +172,15 @@ func getEncAlgOrder(cipheringOrder []string) (encOrder []uint8) {
 	}
 	return
 }
+
+func getSecurityPolicies(policies []factory.SecurityPolicy) (securityPolicies []context.SecurityPolicy) {
+	for _, policy := range policies {
+		securityPolicies = append(securityPolicies, context.SecurityPolicy{
+			PlmnId:        policy.PlmnId,
+			Snssai:        policy.Snssai,
+			IntegrityAlgs: getIntAlgOrder(policy.IntegrityAlgs),
+			CipheringAlgs: getEncAlgOrder(policy.CipheringAlgs),
+		})
+	}
+	return
+}
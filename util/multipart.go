@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// NgapContentType is the media type of the binary NGAP parts of a multipart/related body (TS 29.518 6.1.4)
+const NgapContentType = "application/vnd.3gpp.ngap"
+
+// MultipartRelatedSerialize encodes the JSON data as the root part followed by the NGAP parts,
+// each part is identified by the Content-ID referenced in the JSON data (TS 29.500 6.2)
+func MultipartRelatedSerialize(jsonData interface{}, ngapParts map[string][]byte) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	content, err := json.Marshal(jsonData)
+	if err != nil {
+		return nil, "", err
+	}
+	part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json"}})
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = part.Write(content); err != nil {
+		return nil, "", err
+	}
+
+	contentIds := make([]string, 0, len(ngapParts))
+	for contentId := range ngapParts {
+		contentIds = append(contentIds, contentId)
+	}
+	sort.Strings(contentIds)
+	for _, contentId := range contentIds {
+		part, err = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {NgapContentType},
+			"Content-Id":   {contentId},
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err = part.Write(ngapParts[contentId]); err != nil {
+			return nil, "", err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return nil, "", err
+	}
+	contentType := fmt.Sprintf("multipart/related; boundary=%s; type=\"application/json\"", writer.Boundary())
+	return body.Bytes(), contentType, nil
+}
+
+// MultipartRelatedDeserialize decodes the JSON part into jsonData and returns the NGAP parts keyed by Content-ID
+func MultipartRelatedDeserialize(body []byte, contentType string, jsonData interface{}) (map[string][]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != "multipart/related" {
+		return nil, fmt.Errorf("unexpected content type %s", mediaType)
+	}
+
+	ngapParts := make(map[string][]byte)
+	jsonFound := false
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "application/json":
+			if err := json.Unmarshal(content, jsonData); err != nil {
+				return nil, err
+			}
+			jsonFound = true
+		case NgapContentType:
+			ngapParts[strings.Trim(part.Header.Get("Content-Id"), "<>")] = content
+		}
+	}
+	if !jsonFound {
+		return nil, fmt.Errorf("JSON part is missing")
+	}
+	return ngapParts, nil
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2022 Open Networking Foundation <info@opennetworking.org>
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package util
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testN2InfoContent struct {
+	NgapIeType string `json:"ngapIeType"`
+	ContentId  string `json:"contentId"`
+}
+
+func TestMultipartRelated(t *testing.T) {
+	testCases := []struct {
+		description string
+		ngapParts   map[string][]byte
+	}{
+		{
+			description: "JSON part only",
+			ngapParts:   map[string][]byte{},
+		},
+		{
+			description: "NGAP parts",
+			ngapParts: map[string][]byte{
+				"ngap-1": {0x00, 0x0c, 0x40, 0x80},
+				"ngap-2": {0xff},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			jsonData := testN2InfoContent{NgapIeType: "SRC_TO_TAR_CONTAINER", ContentId: "ngap-1"}
+			body, contentType, err := MultipartRelatedSerialize(jsonData, tc.ngapParts)
+			if err != nil {
+				t.Fatalf("MultipartRelatedSerialize: %v", err)
+			}
+			if !strings.HasPrefix(contentType, "multipart/related; boundary=") {
+				t.Errorf("Content type: %s", contentType)
+			}
+
+			var decoded testN2InfoContent
+			ngapParts, err := MultipartRelatedDeserialize(body, contentType, &decoded)
+			if err != nil {
+				t.Fatalf("MultipartRelatedDeserialize: %v", err)
+			}
+			if decoded != jsonData {
+				t.Errorf("JSON part, want: %+v, got: %+v", jsonData, decoded)
+			}
+			if !reflect.DeepEqual(ngapParts, tc.ngapParts) {
+				t.Errorf("NGAP parts, want: %x, got: %x", tc.ngapParts, ngapParts)
+			}
+		})
+	}
+}
+
+func TestMultipartRelatedSerializeOrder(t *testing.T) {
+	ngapParts := map[string][]byte{"c": {0x03}, "a": {0x01}, "b": {0x02}}
+	body, _, err := MultipartRelatedSerialize(struct{}{}, ngapParts)
+	if err != nil {
+		t.Fatalf("MultipartRelatedSerialize: %v", err)
+	}
+	a, b, c := bytes.Index(body, []byte("Content-Id: a")), bytes.Index(body, []byte("Content-Id: b")),
+		bytes.Index(body, []byte("Content-Id: c"))
+	if a < 0 || !(a < b && b < c) {
+		t.Errorf("NGAP parts are not sorted by Content-ID:\n%s", body)
+	}
+}
+
+func TestMultipartRelatedDeserializeInvalid(t *testing.T) {
+	body, contentType, err := MultipartRelatedSerialize(struct{}{}, map[string][]byte{"ngap-1": {0x01}})
+	if err != nil {
+		t.Fatalf("MultipartRelatedSerialize: %v", err)
+	}
+	boundary := strings.TrimPrefix(strings.Split(contentType, ";")[1], " boundary=")
+	ngapOnly := "--" + boundary + "\r\nContent-Type: application/vnd.3gpp.ngap\r\nContent-Id: <ngap-1>\r\n\r\n" +
+		"\x01\r\n--" + boundary + "--\r\n"
+
+	testCases := []struct {
+		description string
+		body        []byte
+		contentType string
+	}{
+		{description: "not multipart/related", body: body, contentType: "application/json"},
+		{description: "invalid content type", body: body, contentType: "multipart/related; boundary"},
+		{description: "invalid JSON part", body: bytes.Replace(body, []byte("{}"), []byte("{"), 1),
+			contentType: contentType},
+		{description: "JSON part is missing", body: []byte(ngapOnly), contentType: contentType},
+		{description: "truncated body", body: body[:len(body)/2], contentType: contentType},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var jsonData struct{}
+			if _, err := MultipartRelatedDeserialize(tc.body, tc.contentType, &jsonData); err == nil {
+				t.Error("Invalid body is decoded")
+			}
+		})
+	}
+}